@@ -0,0 +1,89 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	OpenTypeInput  = "input"
+	OpenTypeOutput = "output"
+)
+
+type QueueHandlesReader interface {
+	Read() ([]QueueHandles, error)
+}
+
+// QueueHandles is the number of open handles of an application on a queue
+// for either input or output.
+type QueueHandles struct {
+	Metadata        QueueMetadata
+	ApplicationName string
+	OpenType        string
+	Count           int
+}
+
+type ApplicationCollector struct {
+	sync.Mutex
+	logger *slog.Logger
+	reader QueueHandlesReader
+
+	openHandles *prometheus.GaugeVec
+}
+
+func NewApplicationCollector(logger *slog.Logger, reader QueueHandlesReader, labelNames LabelNames) *ApplicationCollector {
+	return &ApplicationCollector{
+		logger: logger,
+		reader: reader,
+
+		openHandles: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "open_handles_by_application",
+			Help:      "Number of open handles on the queue by application.",
+		}, append(labelNames.names(), "application_name", "open_type")),
+	}
+}
+
+func (c *ApplicationCollector) reset() {
+	c.openHandles.Reset()
+}
+
+func (c *ApplicationCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.openHandles.Describe(ch)
+}
+
+func (c *ApplicationCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.reset()
+
+	handles, err := c.reader.Read()
+	if err != nil {
+		c.logger.Error("Failed to read queue handles", "err", err)
+	}
+
+	for _, h := range handles {
+		c.openHandles.WithLabelValues(append(h.Metadata.prometheusLabelValues(), h.ApplicationName, h.OpenType)...).Set(float64(h.Count))
+	}
+
+	c.openHandles.Collect(ch)
+}
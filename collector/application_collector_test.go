@@ -0,0 +1,90 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type queueHandlesReaderFunc func() ([]QueueHandles, error)
+
+func (f queueHandlesReaderFunc) Read() ([]QueueHandles, error) {
+	return f()
+}
+
+func TestApplicationCollector(t *testing.T) {
+
+	testcase := `# HELP mq_queue_open_handles_by_application Number of open handles on the queue by application.
+# TYPE mq_queue_open_handles_by_application gauge
+mq_queue_open_handles_by_application{application_name="amqsget",channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",open_type="input",queue_manager="QM1"} 2
+mq_queue_open_handles_by_application{application_name="amqsput",channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",open_type="output",queue_manager="QM1"} 1
+`
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	collector := NewApplicationCollector(logger, queueHandlesReaderFunc(func() ([]QueueHandles, error) {
+		return []QueueHandles{
+			{Metadata: metadata, ApplicationName: "amqsget", OpenType: OpenTypeInput, Count: 2},
+			{Metadata: metadata, ApplicationName: "amqsput", OpenType: OpenTypeOutput, Count: 1},
+		}, nil
+	}), DefaultLabelNames)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplicationCollectorWithLabelNames(t *testing.T) {
+
+	testcase := `# HELP mq_queue_open_handles_by_application Number of open handles on the queue by application.
+# TYPE mq_queue_open_handles_by_application gauge
+mq_queue_open_handles_by_application{application_name="amqsget",channel="DEV.APP.SVRCONN",connection="localhost(1414)",open_type="input",qmgr="QM1",queue_name="DEV.QUEUE.1"} 2
+`
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	labelNames := LabelNames{Name: "queue_name", Connection: "connection", QueueManager: "qmgr", Channel: "channel"}
+
+	collector := NewApplicationCollector(logger, queueHandlesReaderFunc(func() ([]QueueHandles, error) {
+		return []QueueHandles{{Metadata: metadata, ApplicationName: "amqsget", OpenType: OpenTypeInput, Count: 2}}, nil
+	}), labelNames)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplicationCollectorWithReadError(t *testing.T) {
+
+	collector := NewApplicationCollector(logger, queueHandlesReaderFunc(func() ([]QueueHandles, error) {
+		return nil, errors.New("Failed")
+	}), DefaultLabelNames)
+
+	if count := testutil.CollectAndCount(collector); count != 0 {
+		t.Errorf("Should not emit metrics on read error, got %d.", count)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type ChannelMetadata struct {
+	ChannelName    string
+	ConnectionName string
+	QMgrName       string
+}
+
+type ChannelMetricsReader interface {
+	Read() ([]ChannelMetrics, error)
+}
+
+type ChannelMetrics struct {
+	Metadata    ChannelMetadata
+	Status      int32
+	StatusText  string
+	LastMsgTime time.Time
+
+	// NetworkTime is the (short-term) network time indicator of the running
+	// channel, 0 if the channel is not running or it's not available.
+	NetworkTime time.Duration
+
+	// SSLKeyResets is the number of TLS secret key resets of all instances of
+	// the channel since they were started.
+	SSLKeyResets int64
+
+	// Messages is the number of messages sent or received by all instances
+	// of the channel since they were started.
+	Messages int64
+
+	// InDoubtInstances is the number of instances of the channel which are
+	// in doubt, i.e. whose last batch of messages is not yet confirmed by the
+	// remote end.
+	InDoubtInstances int64
+}
+
+type ChannelCollector struct {
+	sync.Mutex
+	logger *slog.Logger
+	reader ChannelMetricsReader
+
+	status      *prometheus.GaugeVec
+	lastMsgDate *prometheus.GaugeVec
+	networkTime *prometheus.GaugeVec
+
+	// sslKeyResets counts the increase of the TLS secret key resets between
+	// reads, prevSSLKeyResets are the ones of the last read by channel.
+	sslKeyResets     *prometheus.CounterVec
+	prevSSLKeyResets map[string]int64
+
+	// messages counts the increase of the messages between reads,
+	// prevMessages are the ones of the last read by channel.
+	messages     *prometheus.CounterVec
+	prevMessages map[string]int64
+
+	// inDoubt counts the instances of the channel which became in doubt
+	// between reads, prevInDoubt are the instances in doubt of the last read
+	// by channel.
+	inDoubt     *prometheus.CounterVec
+	prevInDoubt map[string]int64
+}
+
+func (m *ChannelMetadata) prometheusLabelValues() []string {
+	return []string{
+		m.ChannelName,
+		m.ConnectionName,
+		m.QMgrName,
+	}
+}
+
+func NewChannelCollector(logger *slog.Logger, reader ChannelMetricsReader) *ChannelCollector {
+
+	newChannelMetric := func(name string, help string, labels ...string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "channel",
+			Name:      name,
+			Help:      help,
+		}, append([]string{"channel_name", "connection", "queue_manager"}, labels...))
+	}
+
+	return &ChannelCollector{
+		logger: logger,
+		reader: reader,
+
+		status:      newChannelMetric("status", "Status (MQCHS_*) of the channel.", "status_text"),
+		lastMsgDate: newChannelMetric("last_msg_date_seconds", "Unix timestamp of the last message sent on the channel, 0 if none."),
+		networkTime: newChannelMetric("network_time_seconds", "Network time indicator of the running channel, i.e. the time to the remote end and back, in seconds."),
+
+		sslKeyResets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "channel",
+			Name:      "ssl_key_resets_total",
+			Help:      "Number of TLS secret key resets of the channel.",
+		}, []string{"channel_name", "connection", "queue_manager"}),
+		prevSSLKeyResets: make(map[string]int64),
+
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "channel",
+			Name:      "msgs_total",
+			Help:      "Number of messages sent or received on the channel.",
+		}, []string{"channel_name", "connection", "queue_manager"}),
+		prevMessages: make(map[string]int64),
+
+		inDoubt: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "channel",
+			Name:      "in_doubt_total",
+			Help:      "Number of times an instance of the channel was found in doubt, i.e. with a batch of messages awaiting confirmation of the remote end.",
+		}, []string{"channel_name", "connection", "queue_manager"}),
+		prevInDoubt: make(map[string]int64),
+	}
+}
+
+func (c *ChannelCollector) reset() {
+	c.status.Reset()
+	c.lastMsgDate.Reset()
+	c.networkTime.Reset()
+}
+
+func (c *ChannelCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.status.Describe(ch)
+	c.lastMsgDate.Describe(ch)
+	c.networkTime.Describe(ch)
+	c.sslKeyResets.Describe(ch)
+	c.messages.Describe(ch)
+	c.inDoubt.Describe(ch)
+}
+
+func (c *ChannelCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.reset()
+
+	metrics, err := c.reader.Read()
+	if err != nil {
+		c.logger.Error("Failed to read channel metrics", "err", err)
+	}
+
+	for _, m := range metrics {
+
+		lvs := m.Metadata.prometheusLabelValues()
+
+		c.status.WithLabelValues(append(m.Metadata.prometheusLabelValues(), m.StatusText)...).Set(float64(m.Status))
+		if m.LastMsgTime.IsZero() {
+			c.lastMsgDate.WithLabelValues(lvs...).Set(0)
+		} else {
+			c.lastMsgDate.WithLabelValues(lvs...).Set(float64(m.LastMsgTime.Unix()))
+		}
+		if m.NetworkTime > 0 {
+			c.networkTime.WithLabelValues(lvs...).Set(m.NetworkTime.Seconds())
+		}
+		key := strings.Join(lvs, "\xff")
+		c.sslKeyResets.WithLabelValues(lvs...).Add(float64(countIncrease(c.prevSSLKeyResets, key, m.SSLKeyResets)))
+		c.messages.WithLabelValues(lvs...).Add(float64(countIncrease(c.prevMessages, key, m.Messages)))
+		c.inDoubt.WithLabelValues(lvs...).Add(float64(inDoubtIncrease(c.prevInDoubt, key, m.InDoubtInstances)))
+	}
+
+	c.status.Collect(ch)
+	c.lastMsgDate.Collect(ch)
+	c.networkTime.Collect(ch)
+	c.sslKeyResets.Collect(ch)
+	c.messages.Collect(ch)
+	c.inDoubt.Collect(ch)
+}
+
+// countIncrease returns the increase of a count of the channel since the last
+// read, which is 0 for the first read. If the count decreased, the channel was
+// restarted and the whole count is new.
+func countIncrease(prev map[string]int64, key string, count int64) int64 {
+
+	last, ok := prev[key]
+	prev[key] = count
+
+	switch {
+	case !ok:
+		return 0
+	case count < last:
+		return count
+	default:
+		return count - last
+	}
+}
+
+// inDoubtIncrease returns the number of instances of the channel which became
+// in doubt since the last read. The instances in doubt on the first read are
+// all new.
+func inDoubtIncrease(prev map[string]int64, key string, inDoubt int64) int64 {
+	last := prev[key]
+	prev[key] = inDoubt
+	return max(inDoubt-last, 0)
+}
@@ -0,0 +1,207 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type channelMetricsReaderFunc func() ([]ChannelMetrics, error)
+
+func (f channelMetricsReaderFunc) Read() ([]ChannelMetrics, error) {
+	return f()
+}
+
+func TestChannelCollector(t *testing.T) {
+
+	testcase := `# HELP mq_channel_in_doubt_total Number of times an instance of the channel was found in doubt, i.e. with a batch of messages awaiting confirmation of the remote end.
+# TYPE mq_channel_in_doubt_total counter
+mq_channel_in_doubt_total{channel_name="DEV.APP.SVRCONN",connection="localhost(1414)",queue_manager="QM1"} 0
+mq_channel_in_doubt_total{channel_name="TO.QM2",connection="localhost(1414)",queue_manager="QM1"} 0
+# HELP mq_channel_last_msg_date_seconds Unix timestamp of the last message sent on the channel, 0 if none.
+# TYPE mq_channel_last_msg_date_seconds gauge
+mq_channel_last_msg_date_seconds{channel_name="DEV.APP.SVRCONN",connection="localhost(1414)",queue_manager="QM1"} 1.7e+09
+mq_channel_last_msg_date_seconds{channel_name="TO.QM2",connection="localhost(1414)",queue_manager="QM1"} 0
+# HELP mq_channel_msgs_total Number of messages sent or received on the channel.
+# TYPE mq_channel_msgs_total counter
+mq_channel_msgs_total{channel_name="DEV.APP.SVRCONN",connection="localhost(1414)",queue_manager="QM1"} 0
+mq_channel_msgs_total{channel_name="TO.QM2",connection="localhost(1414)",queue_manager="QM1"} 0
+# HELP mq_channel_network_time_seconds Network time indicator of the running channel, i.e. the time to the remote end and back, in seconds.
+# TYPE mq_channel_network_time_seconds gauge
+mq_channel_network_time_seconds{channel_name="DEV.APP.SVRCONN",connection="localhost(1414)",queue_manager="QM1"} 0.0015
+# HELP mq_channel_ssl_key_resets_total Number of TLS secret key resets of the channel.
+# TYPE mq_channel_ssl_key_resets_total counter
+mq_channel_ssl_key_resets_total{channel_name="DEV.APP.SVRCONN",connection="localhost(1414)",queue_manager="QM1"} 0
+mq_channel_ssl_key_resets_total{channel_name="TO.QM2",connection="localhost(1414)",queue_manager="QM1"} 0
+# HELP mq_channel_status Status (MQCHS_*) of the channel.
+# TYPE mq_channel_status gauge
+mq_channel_status{channel_name="DEV.APP.SVRCONN",connection="localhost(1414)",queue_manager="QM1",status_text="running"} 3
+mq_channel_status{channel_name="TO.QM2",connection="localhost(1414)",queue_manager="QM1",status_text="inactive"} 0
+`
+
+	collector := NewChannelCollector(logger, channelMetricsReaderFunc(func() ([]ChannelMetrics, error) {
+		return []ChannelMetrics{
+			{
+				Metadata:    ChannelMetadata{ChannelName: "DEV.APP.SVRCONN", ConnectionName: "localhost(1414)", QMgrName: "QM1"},
+				Status:      3,
+				StatusText:  "running",
+				LastMsgTime: time.Unix(1700000000, 0),
+				NetworkTime: 1500 * time.Microsecond,
+			},
+			{
+				Metadata:   ChannelMetadata{ChannelName: "TO.QM2", ConnectionName: "localhost(1414)", QMgrName: "QM1"},
+				Status:     0,
+				StatusText: "inactive",
+			},
+		}, nil
+	}))
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChannelCollectorSSLKeyResets(t *testing.T) {
+
+	metadata := ChannelMetadata{ChannelName: "TO.QM2", ConnectionName: "localhost(1414)", QMgrName: "QM1"}
+
+	var resets int64
+	collector := NewChannelCollector(logger, channelMetricsReaderFunc(func() ([]ChannelMetrics, error) {
+		return []ChannelMetrics{{Metadata: metadata, Status: 3, StatusText: "running", SSLKeyResets: resets}}, nil
+	}))
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	// the resets before the first read are not counted, a decrease is a
+	// restart of the channel
+	for _, tt := range []struct {
+		resets int64
+		want   string
+	}{
+		{resets: 5, want: "0"},
+		{resets: 8, want: "3"},
+		{resets: 8, want: "3"},
+		{resets: 2, want: "5"},
+	} {
+		resets = tt.resets
+		testcase := `# HELP mq_channel_ssl_key_resets_total Number of TLS secret key resets of the channel.
+# TYPE mq_channel_ssl_key_resets_total counter
+mq_channel_ssl_key_resets_total{channel_name="TO.QM2",connection="localhost(1414)",queue_manager="QM1"} ` + tt.want + `
+`
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_channel_ssl_key_resets_total"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestChannelCollectorMessages(t *testing.T) {
+
+	metadata := ChannelMetadata{ChannelName: "TO.QM2", ConnectionName: "localhost(1414)", QMgrName: "QM1"}
+
+	var messages int64
+	collector := NewChannelCollector(logger, channelMetricsReaderFunc(func() ([]ChannelMetrics, error) {
+		return []ChannelMetrics{{Metadata: metadata, Status: 3, StatusText: "running", Messages: messages}}, nil
+	}))
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	// the messages before the first read are not counted, a decrease is a
+	// restart of the channel, so the counter never decreases
+	var last float64
+	for _, tt := range []struct {
+		messages int64
+		want     float64
+	}{
+		{messages: 100, want: 0},
+		{messages: 150, want: 50},
+		{messages: 150, want: 50},
+		{messages: 20, want: 70},
+		{messages: 0, want: 70},
+		{messages: 5, want: 75},
+	} {
+		messages = tt.messages
+		if _, err := reg.Gather(); err != nil {
+			t.Fatal(err)
+		}
+		got := testutil.ToFloat64(collector.messages.WithLabelValues(metadata.prometheusLabelValues()...))
+		if got != tt.want {
+			t.Errorf("messages %d: want %v, got %v", tt.messages, tt.want, got)
+		}
+		if got < last {
+			t.Errorf("messages %d: counter decreased from %v to %v", tt.messages, last, got)
+		}
+		last = got
+	}
+}
+
+func TestChannelCollectorInDoubt(t *testing.T) {
+
+	metadata := ChannelMetadata{ChannelName: "TO.QM2", ConnectionName: "localhost(1414)", QMgrName: "QM1"}
+
+	var inDoubt int64
+	collector := NewChannelCollector(logger, channelMetricsReaderFunc(func() ([]ChannelMetrics, error) {
+		return []ChannelMetrics{{Metadata: metadata, Status: 3, StatusText: "running", InDoubtInstances: inDoubt}}, nil
+	}))
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	// an instance which stays in doubt is counted once, the instances in
+	// doubt on the first read are counted too
+	for _, tt := range []struct {
+		inDoubt int64
+		want    float64
+	}{
+		{inDoubt: 1, want: 1},
+		{inDoubt: 1, want: 1},
+		{inDoubt: 0, want: 1},
+		{inDoubt: 2, want: 3},
+		{inDoubt: 1, want: 3},
+	} {
+		inDoubt = tt.inDoubt
+		if _, err := reg.Gather(); err != nil {
+			t.Fatal(err)
+		}
+		if got := testutil.ToFloat64(collector.inDoubt.WithLabelValues(metadata.prometheusLabelValues()...)); got != tt.want {
+			t.Errorf("in doubt %d: want %v, got %v", tt.inDoubt, tt.want, got)
+		}
+	}
+}
+
+func TestChannelCollectorWithReadError(t *testing.T) {
+
+	collector := NewChannelCollector(logger, channelMetricsReaderFunc(func() ([]ChannelMetrics, error) {
+		return nil, errors.New("Failed")
+	}))
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	if count := testutil.CollectAndCount(collector); count != 0 {
+		t.Errorf("Should not emit metrics on read error, got %d.", count)
+	}
+}
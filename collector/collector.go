@@ -16,8 +16,15 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -26,31 +33,160 @@ import (
 const (
 	namespace = "mq"
 	subsystem = "queue"
+
+	// ScrapeModeBlock waits for a collect in progress, ScrapeModeSkip provides
+	// the metrics of the last collect instead.
+	ScrapeModeBlock = "block"
+	ScrapeModeSkip  = "skip"
 )
 
 type Queue struct {
 	Metadata QueueMetadata
 	Reader   QueueMetricsReader
+
+	// Timeout to read the metrics of the queue, which is the timeout of the
+	// collector if 0.
+	Timeout time.Duration
+
+	// DepthWarnThreshold is the configured warn threshold of the current
+	// depth of the queue, which is not provided if 0.
+	DepthWarnThreshold int32
+
+	// ReadLimit is the semaphore shared by the queues of a queue manager,
+	// which limits the reads in progress by its capacity, unlimited if nil.
+	ReadLimit chan struct{}
 }
 
 type QueueMetadata struct {
-	QueueName      string
-	ConnectionName string
-	QMgrName       string
-	ChannelName    string
+	QueueName      string `json:"queueName"`
+	ConnectionName string `json:"connectionName"`
+	QMgrName       string `json:"qMgrName"`
+	ChannelName    string `json:"channelName"`
+
+	// ExtraLabels are additional labels of the queue metrics from the
+	// configuration of the queue.
+	ExtraLabels map[string]string `json:"extraLabels,omitempty"`
+}
+
+// LabelNames are the names of the labels of the queue metadata.
+type LabelNames struct {
+	Name         string
+	Connection   string
+	QueueManager string `yaml:"queueManager"`
+	Channel      string
+}
+
+// DefaultDepthHistogramBuckets are the buckets of the histogram of observed
+// queue depths.
+var DefaultDepthHistogramBuckets = []float64{0, 1, 10, 100, 1000, 5000, 10000}
+
+// DefaultDepthHistoryCapacity is the number of the most recent depth
+// observations of a queue the fill forecast is based on.
+const DefaultDepthHistoryCapacity = 10
+
+// DefaultDepthWindowSize is the number of the most recent depths of a queue
+// the standard deviation is based on.
+const DefaultDepthWindowSize = 10
+
+// DefaultDepthSlopeWindowSize is the number of the most recent depth
+// observations of a queue the depth slope is based on.
+const DefaultDepthSlopeWindowSize = 5
+
+// DefaultDepthRatioAlertThreshold is the ratio of the current to the maximum
+// depth of a queue above which a scrape counts as overload.
+const DefaultDepthRatioAlertThreshold = 0.9
+
+var DefaultLabelNames = LabelNames{
+	Name:         "name",
+	Connection:   "connection",
+	QueueManager: "queue_manager",
+	Channel:      "channel",
+}
+
+// names returns the label names in the order of the label values of the
+// queue metadata.
+func (n LabelNames) names() []string {
+	return []string{n.Name, n.Connection, n.QueueManager, n.Channel}
 }
 
 type QueueMetricsReader interface {
 	Read() (QueueMetrics, error)
 }
 
+// CancelableQueueMetricsReader is a QueueMetricsReader whose read in progress
+// is canceled if it exceeds the timeout, so it doesn't block the following
+// reads.
+type CancelableQueueMetricsReader interface {
+	QueueMetricsReader
+	Cancel()
+}
+
+// ReasonCoder is implemented by the errors of failed MQI calls, which provide
+// the reason code (MQRC) of the failure.
+type ReasonCoder interface {
+	ReasonCode() int32
+}
+
 type QueueMetrics struct {
-	Metadata        QueueMetadata
-	CurrentDepth    int32
-	MaxDepth        int32
-	OpenInputCount  int32
-	OpenOutputCount int32
-	RequestDuration time.Duration
+	Metadata        QueueMetadata `json:"metadata"`
+	CollectMetrics  []string      `json:"collectMetrics,omitempty"`
+	CurrentDepth    int32         `json:"currentDepth"`
+	MaxDepth        int32         `json:"maxDepth"`
+	OpenInputCount  int32         `json:"openInputCount"`
+	OpenOutputCount int32         `json:"openOutputCount"`
+	StorageClass    string        `json:"storageClass"`
+	Usage           string        `json:"usage"`
+	ClusterName     string        `json:"clusterName"`
+	IndexType       string        `json:"indexType"`
+	// RequestDuration is negative if the metrics are the cached ones of the
+	// last successful read.
+	RequestDuration time.Duration `json:"requestDuration"`
+
+	DepthHighEventEnabled bool `json:"depthHighEventEnabled"`
+	DepthLowEventEnabled  bool `json:"depthLowEventEnabled"`
+	DepthMaxEventEnabled  bool `json:"depthMaxEventEnabled"`
+
+	DefaultPersistence     int32 `json:"defaultPersistence"`
+	MsgDeliverySequence    int32 `json:"msgDeliverySequence"`
+	DefaultInputOpenOption int32 `json:"defaultInputOpenOption"`
+	DefaultPutResponseType int32 `json:"defaultPutResponseType"`
+
+	// QueueTimeIndicator is the short-term time messages remain on the queue
+	// in microseconds, QueueFileSize the size of the queue file in bytes.
+	// LastPutTime is the zero time if no message was put to the queue.
+	QueueTimeIndicator int32     `json:"queueTimeIndicator"`
+	QueueFileSize      int64     `json:"queueFileSize"`
+	LastPutTime        time.Time `json:"lastPutTime"`
+
+	ClusterWorkloadRank int32 `json:"clusterWorkloadRank"`
+
+	ServiceInterval                 time.Duration `json:"serviceInterval"`
+	ServiceIntervalHighEventEnabled bool          `json:"serviceIntervalHighEventEnabled"`
+	ServiceIntervalOkEventEnabled   bool          `json:"serviceIntervalOkEventEnabled"`
+
+	HardenBackout int32 `json:"hardenBackout"`
+	Shareability  int32 `json:"shareability"`
+
+	// RetentionInterval is the retention interval of the queue in hours.
+	RetentionInterval int32 `json:"retentionInterval"`
+
+	// StatisticsQ is the statistics level of the queue: 0 off, 1 low, 2
+	// medium, 3 high or -1 if inherited from the queue manager.
+	StatisticsQ int32 `json:"statisticsQ"`
+
+	// MaxMessageLength is the maximum length of a message on the queue in
+	// bytes.
+	MaxMessageLength int32 `json:"maxMessageLength"`
+
+	// Scope of the queue definition: 0 queue manager or 1 cell.
+	Scope int32 `json:"scope"`
+
+	// DefaultPriority is the default priority of messages put to the queue.
+	DefaultPriority int32 `json:"defaultPriority"`
+
+	// AccountingLevel is the accounting level of the queue: 0 off, 1 low, 2
+	// medium, 3 high or -1 if inherited from the queue manager.
+	AccountingLevel int32 `json:"accountingLevel"`
 }
 
 type QueueCollector struct {
@@ -59,12 +195,200 @@ type QueueCollector struct {
 	timeout time.Duration
 	queues  []Queue
 
+	// scrapeMode of a collect while another one is in progress, the metrics
+	// of the last collect are cached for ScrapeModeSkip.
+	scrapeMode    string
+	cacheMutex    sync.Mutex
+	cachedMetrics []prometheus.Metric
+
+	// backgroundInterval of the reads of the queues by RunBackgroundScrape,
+	// whose last read is collected instead of reading the queues on collect.
+	backgroundInterval time.Duration
+	backgroundRead     atomic.Pointer[backgroundRead]
+
+	// health of the queues of the last collect.
+	health atomic.Pointer[queueHealth]
+
+	lastLabelValues map[string][]string
+	queueLabelNames []string
+	extraLabelNames []string
+
+	// metricNames are the names of the queue metrics whose help text can be
+	// overridden.
+	metricNames []string
+
+	prevDepth     sync.Map
+	depthIntegral sync.Map
+	lastCollect   time.Time
+	now           func() time.Time
+
+	// depthHistory are the most recent depth observations (*depthHistory) of
+	// each queue for the fill forecast.
+	depthHistory         sync.Map
+	depthHistoryCapacity int
+
+	// depthForecast are the lines (depthLine) fitted to the depth history of
+	// each queue by the last collect, which predict the depth of the next one.
+	depthForecast sync.Map
+
+	// depthWindow are the most recent depths (*depthWindow) of each queue for
+	// the standard deviation.
+	depthWindow     sync.Map
+	depthWindowSize int
+
+	// depthSlopeHistory are the most recent depth observations
+	// (*depthHistory) of each queue for the depth slope.
+	depthSlopeHistory    sync.Map
+	depthSlopeWindowSize int
+
+	// depthRatioAlertThreshold is the ratio of the current to the maximum
+	// depth above which a scrape of a queue counts as overload.
+	depthRatioAlertThreshold float64
+
+	// depthChangeTime are the times (time.Time) of the last depth change of
+	// each queue.
+	depthChangeTime sync.Map
+
+	// thresholdExceededSince are the times (time.Time) since which the depth
+	// of each queue above its warn threshold is not yet counted.
+	thresholdExceededSince sync.Map
+
+	// generation of the queues set by SetQueues and of the queues the state
+	// of the last collect is based on.
+	generation          int64
+	collectedGeneration int64
+
 	up              *prometheus.GaugeVec
+	info            *prometheus.GaugeVec
 	currentDepth    *prometheus.GaugeVec
 	maxDepth        *prometheus.GaugeVec
 	openInputCount  *prometheus.GaugeVec
 	openOutputCount *prometheus.GaugeVec
+	openTotal       *prometheus.GaugeVec
 	requestDuration *prometheus.GaugeVec
+
+	usingCachedMetrics *prometheus.GaugeVec
+
+	depthHighEventEnabled *prometheus.GaugeVec
+	depthLowEventEnabled  *prometheus.GaugeVec
+	depthMaxEventEnabled  *prometheus.GaugeVec
+
+	messageNetRate    *prometheus.GaugeVec
+	messagesPerSecond *prometheus.GaugeVec
+
+	defaultPersistence     *prometheus.GaugeVec
+	msgDeliverySequence    *prometheus.GaugeVec
+	defaultInputOpenOption *prometheus.GaugeVec
+	defaultPutResponseType *prometheus.GaugeVec
+
+	timeIndicator *prometheus.GaugeVec
+	fileSize      *prometheus.GaugeVec
+	lastPutTime   *prometheus.GaugeVec
+
+	clusterWorkloadRank *prometheus.GaugeVec
+
+	serviceInterval                 *prometheus.GaugeVec
+	serviceIntervalHighEventEnabled *prometheus.GaugeVec
+	serviceIntervalOkEventEnabled   *prometheus.GaugeVec
+
+	hardenBackout     *prometheus.GaugeVec
+	shareInputAllowed *prometheus.GaugeVec
+
+	retentionInterval *prometheus.GaugeVec
+
+	statisticsLevel *prometheus.GaugeVec
+
+	maxMessageLength *prometheus.GaugeVec
+
+	scope *prometheus.GaugeVec
+
+	defaultPriority *prometheus.GaugeVec
+
+	accountingLevel *prometheus.GaugeVec
+
+	clusterRoutingEnabled *prometheus.GaugeVec
+
+	depthIntegralSeconds *prometheus.CounterVec
+
+	depthIncrease *prometheus.CounterVec
+	depthDecrease *prometheus.CounterVec
+
+	depthObservations *prometheus.HistogramVec
+
+	depthWarnThreshold *prometheus.GaugeVec
+
+	depthAboveThresholdSeconds *prometheus.CounterVec
+
+	depthRatioExceededTotal *prometheus.CounterVec
+
+	readErrors *prometheus.CounterVec
+
+	depthFillForecast    *prometheus.GaugeVec
+	depthPredictionError *prometheus.GaugeVec
+	depthStddev          *prometheus.GaugeVec
+	depthSlope           *prometheus.GaugeVec
+
+	depthLastChange       *prometheus.GaugeVec
+	depthUnchangedSeconds *prometheus.GaugeVec
+
+	openHandlesTotal prometheus.Gauge
+
+	lastScrape           prometheus.Gauge
+	lastSuccessfulScrape prometheus.Gauge
+
+	scrapeSkipped prometheus.Counter
+	prunedQueues  prometheus.Counter
+}
+
+// depthObservation is the depth of a queue at the time of a successful read.
+type depthObservation struct {
+	depth int32
+	time  time.Time
+}
+
+// depthHistory is a ring buffer of the most recent depth observations of a
+// queue.
+type depthHistory struct {
+	observations []depthObservation
+	next         int
+}
+
+func (h *depthHistory) add(o depthObservation, capacity int) {
+	if len(h.observations) < capacity {
+		h.observations = append(h.observations, o)
+		return
+	}
+	h.observations[h.next] = o
+	h.next = (h.next + 1) % len(h.observations)
+}
+
+// depthLine is the line fitted to the depth observations of a queue by linear
+// regression, starting at the time of the first observation.
+type depthLine struct {
+	origin    time.Time
+	latest    time.Time
+	intercept float64
+	slope     float64
+}
+
+// at returns the depth of the line at the time.
+func (l depthLine) at(t time.Time) float64 {
+	return l.intercept + l.slope*t.Sub(l.origin).Seconds()
+}
+
+// depthWindow is a sliding window of the most recent depths of a queue.
+type depthWindow struct {
+	depths []float64
+	next   int
+}
+
+func (w *depthWindow) add(depth float64, size int) {
+	if len(w.depths) < size {
+		w.depths = append(w.depths, depth)
+		return
+	}
+	w.depths[w.next] = depth
+	w.next = (w.next + 1) % len(w.depths)
 }
 
 func (m *QueueMetadata) prometheusLabelValues() []string {
@@ -76,112 +400,1286 @@ func (m *QueueMetadata) prometheusLabelValues() []string {
 	}
 }
 
-func NewQueueCollector(logger *slog.Logger, timeout time.Duration, queues []Queue) *QueueCollector {
+func (m *QueueMetadata) key() string {
+	return strings.Join(m.prometheusLabelValues(), "\x00")
+}
+
+func (m *QueueMetrics) prometheusLabelValues() []string {
+	return append(m.Metadata.prometheusLabelValues(), m.StorageClass, m.Usage)
+}
+
+// cached reports whether the metrics are the cached ones of the last
+// successful read, which is indicated by a negative request duration.
+func (m *QueueMetrics) cached() bool {
+	return m.RequestDuration < 0
+}
+
+// collects reports whether the metric of the given name was inquired for the
+// queue, which are all if the metrics to collect are not restricted.
+func (m *QueueMetrics) collects(name string) bool {
+	return len(m.CollectMetrics) == 0 || slices.Contains(m.CollectMetrics, name)
+}
 
-	newQueueMetric := func(name string, help string) *prometheus.GaugeVec {
+// NewQueueCollector returns the collector of the queues. The help texts of the
+// queue metrics are overridden by the descriptions, which are keyed by the
+// metric name without namespace, e.g. 'queue_current_depth'.
+func NewQueueCollector(logger *slog.Logger, timeout time.Duration, queues []Queue, labelNames LabelNames, descriptions map[string]string) *QueueCollector {
+
+	extraLabelNames := extraLabelNames(queues)
+	queueLabelNames := slices.Concat(labelNames.names(), []string{"storage_class", "usage"}, extraLabelNames)
+
+	metricNames := make([]string, 0)
+	newQueueMetric := func(name string, help string, labels ...string) *prometheus.GaugeVec {
+		metricNames = append(metricNames, subsystem+"_"+name)
+		if description, ok := descriptions[subsystem+"_"+name]; ok {
+			help = description
+		}
 		return prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: subsystem,
 			Name:      name,
 			Help:      help,
-		}, []string{"name", "connection", "queue_manager", "channel"})
+		}, slices.Concat(queueLabelNames, labels))
 	}
 
-	return &QueueCollector{
+	c := &QueueCollector{
 		logger:  logger,
 		timeout: timeout,
 		queues:  queues,
 
+		lastLabelValues: make(map[string][]string),
+		queueLabelNames: queueLabelNames,
+		extraLabelNames: extraLabelNames,
+		now:             time.Now,
+
+		depthHistoryCapacity: DefaultDepthHistoryCapacity,
+		depthWindowSize:      DefaultDepthWindowSize,
+		depthSlopeWindowSize: DefaultDepthSlopeWindowSize,
+
+		depthRatioAlertThreshold: DefaultDepthRatioAlertThreshold,
+
 		up:              newQueueMetric("up", "Was the last scrape of the queue successful."),
+		info:            newQueueMetric("info", "Information about the queue.", "cluster", "index_type"),
 		currentDepth:    newQueueMetric("current_depth", "Current number of messages on queue."),
 		maxDepth:        newQueueMetric("max_depth", "Maximum number of messages allowed on queue."),
 		openInputCount:  newQueueMetric("open_input_count", "Number of MQOPEN calls that have the queue open for input."),
 		openOutputCount: newQueueMetric("open_output_count", "Number of MQOPEN calls that have the queue open for output."),
+		openTotal:       newQueueMetric("open_total", "Number of MQOPEN calls that have the queue open for input or output."),
 		requestDuration: newQueueMetric("request_duration_seconds", "Duration for request queue metrics in seconds."),
+
+		usingCachedMetrics: newQueueMetric("using_cached_metrics", "Are the metrics of the queue the cached ones of the last successful read (1) or not (0), e.g. while re-connecting."),
+
+		depthHighEventEnabled: newQueueMetric("depth_high_event_enabled", "Are queue depth high events enabled (1) or not (0)."),
+		depthLowEventEnabled:  newQueueMetric("depth_low_event_enabled", "Are queue depth low events enabled (1) or not (0)."),
+		depthMaxEventEnabled:  newQueueMetric("depth_max_event_enabled", "Are queue full events enabled (1) or not (0)."),
+
+		messageNetRate:    newQueueMetric("message_net_rate", "Change of the current queue depth since the last scrape."),
+		messagesPerSecond: newQueueMetric("messages_per_second", "Change of the current queue depth per second since the last scrape."),
+
+		defaultPersistence:     newQueueMetric("default_msg_persistence", "Default persistence (MQPER_*) of messages on queue."),
+		msgDeliverySequence:    newQueueMetric("msg_delivery_sequence", "Message delivery sequence of queue: 0 priority or 1 FIFO."),
+		defaultInputOpenOption: newQueueMetric("default_input_open_option", "Default share option (MQOO_INPUT_*) of applications opening queue for input."),
+		defaultPutResponseType: newQueueMetric("default_put_response_type", "Default put response type (MQPRT_*) of the queue: 0 as parent, 1 synchronous, 2 asynchronous."),
+
+		timeIndicator: newQueueMetric("time_indicator_microseconds", "Short-term time messages remain on the queue in microseconds."),
+		fileSize:      newQueueMetric("file_size_bytes", "Current size of the queue file in bytes."),
+		lastPutTime:   newQueueMetric("last_put_time_seconds", "Time of the last message put to queue in unix seconds."),
+
+		clusterWorkloadRank: newQueueMetric("cluster_workload_rank", "Rank (0-9) of the queue for cluster workload management."),
+
+		serviceInterval:                 newQueueMetric("service_interval_seconds", "Target time between a put and the next get on the queue for service interval events in seconds."),
+		serviceIntervalHighEventEnabled: newQueueMetric("service_interval_high_event_enabled", "Are service interval high events enabled (1) or not (0)."),
+		serviceIntervalOkEventEnabled:   newQueueMetric("service_interval_ok_event_enabled", "Are service interval OK events enabled (1) or not (0)."),
+
+		hardenBackout:     newQueueMetric("harden_backout", "Is the backout count of messages hardened (1) or not (0)."),
+		shareInputAllowed: newQueueMetric("share_input_allowed", "Can the queue be opened for input by multiple handles at the same time (1) or not (0)."),
+
+		retentionInterval: newQueueMetric("retention_interval_days", "Retention interval of the queue in days, i.e. the time the queue is needed for."),
+
+		statisticsLevel: newQueueMetric("statistics_level", "Statistics collection level of the queue: 0 off, 1 low, 2 medium, 3 high or -1 inherited from the queue manager."),
+
+		maxMessageLength: newQueueMetric("max_message_size_bytes", "Maximum size of a message on queue in bytes."),
+
+		scope: newQueueMetric("scope", "Scope of the queue definition: 0 queue manager or 1 cell."),
+
+		defaultPriority: newQueueMetric("default_priority", "Default priority of messages put to queue."),
+
+		accountingLevel: newQueueMetric("accounting_level", "Accounting level of the queue: 0 off, 1 low, 2 medium, 3 high or -1 inherited from the queue manager."),
+
+		clusterRoutingEnabled: newQueueMetric("cluster_routing_enabled", "Is the queue a member of a cluster (1) or not (0)."),
+
+		depthIntegralSeconds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "depth_integral_messages_seconds",
+			Help:      "Time-weighted queue depth (integral of the current depth over time) in message seconds.",
+		}, queueLabelNames),
+
+		depthIncrease: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "depth_increase_total",
+			Help:      "Total increase of the current number of messages on queue between scrapes.",
+		}, queueLabelNames),
+		depthDecrease: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "depth_decrease_total",
+			Help:      "Total decrease of the current number of messages on queue between scrapes.",
+		}, queueLabelNames),
+
+		depthObservations: newDepthObservations(queueLabelNames, DefaultDepthHistogramBuckets),
+
+		depthWarnThreshold: newQueueMetric("depth_warn_threshold", "Configured warn threshold of the current number of messages on queue."),
+
+		depthAboveThresholdSeconds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "depth_above_threshold_duration_seconds",
+			Help:      "Total time the current number of messages on queue was above the configured warn threshold in seconds.",
+		}, queueLabelNames),
+
+		depthRatioExceededTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "max_depth_ratio_exceeded_total",
+			Help:      "Number of scrapes whose ratio of the current to the maximum number of messages on queue was above the alert threshold.",
+		}, queueLabelNames),
+
+		readErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "error_total",
+			Help:      "Number of failed reads of the queue by reason code (MQRC) or 'timeout'.",
+		}, append(labelNames.names(), "mqrc")),
+
+		depthFillForecast:    newQueueMetric("depth_fill_forecast_minutes", "Forecast of the minutes until the queue is full by linear regression of the recent depths, -1 if the depth is not increasing."),
+		depthPredictionError: newQueueMetric("depth_prediction_error", "Absolute difference of the current number of messages on queue and the one predicted by the linear regression of the recent depths of the last scrape."),
+		depthStddev:          newQueueMetric("depth_stddev", "Population standard deviation of the recent queue depths."),
+		depthSlope:           newQueueMetric("depth_slope_messages_per_second", "Slope of the recent queue depths by linear regression in messages per second, positive if the queue is filling and negative if it's draining."),
+
+		depthLastChange:       newQueueMetric("depth_last_change_timestamp", "Unix time of the last change of the current number of messages on queue, 0 if not known yet."),
+		depthUnchangedSeconds: newQueueMetric("depth_unchanged_duration_seconds", "Duration in seconds since the last change of the current number of messages on queue, 0 if not known yet."),
+
+		openHandlesTotal: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "open_handles_total",
+			Help:      "Number of MQOPEN calls that have any of the queues open for input or output.",
+		}),
+
+		lastScrape: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "last_scrape_timestamp",
+			Help:      "Unix timestamp of the last scrape of the queues.",
+		}),
+		lastSuccessfulScrape: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "last_successful_scrape_timestamp",
+			Help:      "Unix timestamp of the last scrape of the queues with at least one successful queue read.",
+		}),
+		scrapeSkipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "scrape_skipped_total",
+			Help:      "Number of scrapes which provided the metrics of the last scrape as another scrape was in progress.",
+		}),
+		prunedQueues: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "pruned_queues_total",
+			Help:      "Number of queues whose metrics are deleted as the queue is no longer read.",
+		}),
 	}
+	c.metricNames = metricNames
+	return c
 }
 
-func (c *QueueCollector) reset() {
-	for _, queue := range c.queues {
-		c.up.WithLabelValues(queue.Metadata.prometheusLabelValues()...).Set(0)
+// extraLabelNames returns the sorted union of the extra label names of all
+// queues.
+func extraLabelNames(queues []Queue) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, queue := range queues {
+		for name := range queue.Metadata.ExtraLabels {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newDepthObservations(labelNames []string, buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "depth_observations",
+		Help:      "Histogram of the current queue depths observed on each scrape.",
+		Buckets:   buckets,
+	}, labelNames)
+}
+
+// QueueMetricNames returns the names (without namespace) of the queue metrics
+// whose help text can be overridden by the descriptions of NewQueueCollector.
+func QueueMetricNames() []string {
+	return NewQueueCollector(nil, 0, nil, DefaultLabelNames, nil).metricNames
+}
+
+// SetDepthHistogramBuckets sets the buckets of the histogram of observed queue
+// depths. It discards all observations so far and must be called before the
+// collector is registered.
+func (c *QueueCollector) SetDepthHistogramBuckets(buckets []float64) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.depthObservations = newDepthObservations(c.queueLabelNames, buckets)
+}
+
+// SetDepthHistoryCapacity sets the number of the most recent depth
+// observations of a queue the fill forecast is based on. It must be called
+// before the collector is registered.
+func (c *QueueCollector) SetDepthHistoryCapacity(capacity int) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.depthHistoryCapacity = capacity
+}
+
+// SetScrapeMode sets the mode of a collect while another one is in progress,
+// which is either ScrapeModeBlock (default) or ScrapeModeSkip. It must be
+// called before the collector is registered.
+func (c *QueueCollector) SetScrapeMode(mode string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.scrapeMode = mode
+}
+
+// SetDepthWindowSize sets the number of the most recent depths of a queue the
+// standard deviation is based on. It must be called before the collector is
+// registered.
+func (c *QueueCollector) SetDepthWindowSize(size int) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.depthWindowSize = size
+}
+
+// SetDepthSlopeWindowSize sets the number of the most recent depth
+// observations of a queue the depth slope is based on. It must be called
+// before the collector is registered.
+func (c *QueueCollector) SetDepthSlopeWindowSize(size int) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.depthSlopeWindowSize = size
+}
+
+// SetDepthRatioAlertThreshold sets the ratio of the current to the maximum
+// depth of a queue above which a scrape is counted by
+// mq_queue_max_depth_ratio_exceeded_total. It must be called before the
+// collector is registered.
+func (c *QueueCollector) SetDepthRatioAlertThreshold(threshold float64) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.depthRatioAlertThreshold = threshold
+}
+
+// labelValues returns the label values of the last successful read of the
+// queue, so a failing queue keeps its attribute labels.
+func (c *QueueCollector) labelValues(metadata QueueMetadata) []string {
+	if lvs, ok := c.lastLabelValues[metadata.key()]; ok {
+		return lvs
+	}
+	return c.queueLabelValues(QueueMetrics{Metadata: metadata})
+}
+
+// queueLabelValues returns the label values of the queue metrics followed by
+// the values of the extra labels, which are empty if not set for the queue.
+func (c *QueueCollector) queueLabelValues(m QueueMetrics) []string {
+	lvs := m.prometheusLabelValues()
+	for _, name := range c.extraLabelNames {
+		lvs = append(lvs, m.Metadata.ExtraLabels[name])
 	}
+	return lvs
+}
+
+func (c *QueueCollector) reset() {
+	c.up.Reset()
+	c.info.Reset()
+	c.clusterRoutingEnabled.Reset()
 	c.currentDepth.Reset()
 	c.maxDepth.Reset()
 	c.openInputCount.Reset()
 	c.openOutputCount.Reset()
+	c.openTotal.Reset()
 	c.requestDuration.Reset()
+	c.usingCachedMetrics.Reset()
+	c.depthHighEventEnabled.Reset()
+	c.depthLowEventEnabled.Reset()
+	c.depthMaxEventEnabled.Reset()
+	c.messageNetRate.Reset()
+	c.messagesPerSecond.Reset()
+	c.defaultPersistence.Reset()
+	c.msgDeliverySequence.Reset()
+	c.defaultInputOpenOption.Reset()
+	c.defaultPutResponseType.Reset()
+	c.timeIndicator.Reset()
+	c.fileSize.Reset()
+	c.lastPutTime.Reset()
+	c.clusterWorkloadRank.Reset()
+	c.depthWarnThreshold.Reset()
+	c.depthFillForecast.Reset()
+	c.depthPredictionError.Reset()
+	c.depthStddev.Reset()
+	c.depthSlope.Reset()
+	c.depthLastChange.Reset()
+	c.depthUnchangedSeconds.Reset()
+	c.serviceInterval.Reset()
+	c.serviceIntervalHighEventEnabled.Reset()
+	c.serviceIntervalOkEventEnabled.Reset()
+	c.hardenBackout.Reset()
+	c.shareInputAllowed.Reset()
+	c.retentionInterval.Reset()
+	c.statisticsLevel.Reset()
+	c.maxMessageLength.Reset()
+	c.scope.Reset()
+	c.defaultPriority.Reset()
+	c.accountingLevel.Reset()
 }
 
 func (c *QueueCollector) Describe(ch chan<- *prometheus.Desc) {
-	c.up.Describe(ch)
-	c.currentDepth.Describe(ch)
-	c.maxDepth.Describe(ch)
-	c.openInputCount.Describe(ch)
-	c.openOutputCount.Describe(ch)
-	c.requestDuration.Describe(ch)
+	for _, metric := range c.metrics() {
+		metric.Describe(ch)
+	}
+	c.scrapeSkipped.Describe(ch)
+}
+
+// metrics returns the metrics provided by each collect. The skipped scrapes
+// are provided by Collect itself.
+func (c *QueueCollector) metrics() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.up,
+		c.info,
+		c.clusterRoutingEnabled,
+		c.currentDepth,
+		c.maxDepth,
+		c.openInputCount,
+		c.openOutputCount,
+		c.openTotal,
+		c.requestDuration,
+		c.usingCachedMetrics,
+		c.depthHighEventEnabled,
+		c.depthLowEventEnabled,
+		c.depthMaxEventEnabled,
+		c.messageNetRate,
+		c.messagesPerSecond,
+		c.defaultPersistence,
+		c.msgDeliverySequence,
+		c.defaultInputOpenOption,
+		c.defaultPutResponseType,
+		c.timeIndicator,
+		c.fileSize,
+		c.lastPutTime,
+		c.clusterWorkloadRank,
+		c.serviceInterval,
+		c.serviceIntervalHighEventEnabled,
+		c.serviceIntervalOkEventEnabled,
+		c.hardenBackout,
+		c.shareInputAllowed,
+		c.retentionInterval,
+		c.statisticsLevel,
+		c.maxMessageLength,
+		c.scope,
+		c.defaultPriority,
+		c.accountingLevel,
+		c.depthIntegralSeconds,
+		c.depthIncrease,
+		c.depthDecrease,
+		c.depthObservations,
+		c.depthWarnThreshold,
+		c.depthAboveThresholdSeconds,
+		c.depthRatioExceededTotal,
+		c.readErrors,
+		c.depthFillForecast,
+		c.depthPredictionError,
+		c.depthStddev,
+		c.depthSlope,
+		c.depthLastChange,
+		c.depthUnchangedSeconds,
+		c.openHandlesTotal,
+		c.lastScrape,
+		c.lastSuccessfulScrape,
+		c.prunedQueues,
+	}
 }
 
+// Collect reads the metrics of the queues. If another collect is in progress,
+// it waits for it unless the scrape mode is ScrapeModeSkip, which provides the
+// metrics of the last collect instead.
 func (c *QueueCollector) Collect(ch chan<- prometheus.Metric) {
 
-	c.Lock()
+	if c.scrapeMode != ScrapeModeSkip {
+		c.Lock()
+		defer c.Unlock()
+
+		c.collect(ch)
+		c.scrapeSkipped.Collect(ch)
+		return
+	}
+
+	if !c.TryLock() {
+		c.scrapeSkipped.Inc()
+		c.cacheMutex.Lock()
+		for _, metric := range c.cachedMetrics {
+			ch <- metric
+		}
+		c.cacheMutex.Unlock()
+		c.scrapeSkipped.Collect(ch)
+		return
+	}
 	defer c.Unlock()
 
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		c.collect(metrics)
+		close(metrics)
+	}()
+
+	cached := make([]prometheus.Metric, 0)
+	for metric := range metrics {
+		ch <- metric
+		if snapshot, err := newSnapshotMetric(metric); err != nil {
+			c.logger.Error("Failed to cache metric", "err", err)
+		} else {
+			cached = append(cached, snapshot)
+		}
+	}
+	c.cacheMutex.Lock()
+	c.cachedMetrics = cached
+	c.cacheMutex.Unlock()
+
+	c.scrapeSkipped.Collect(ch)
+}
+
+func (c *QueueCollector) collect(ch chan<- prometheus.Metric) {
+
 	c.reset()
 
-	metrics := collect(c.logger, c.timeout, c.queues, context.Background())
-	for _, m := range *metrics {
+	up := make(map[string]bool)
+	depths := make(map[string]int32)
+
+	now := c.now()
+	var elapsed time.Duration
+	if !c.lastCollect.IsZero() {
+		elapsed = now.Sub(c.lastCollect)
+	}
+	c.lastCollect = now
+
+	if c.generation != c.collectedGeneration {
+		clearMap(&c.prevDepth)
+		clearMap(&c.depthIntegral)
+		clearMap(&c.depthHistory)
+		clearMap(&c.depthForecast)
+		clearMap(&c.depthWindow)
+		clearMap(&c.depthSlopeHistory)
+		clearMap(&c.depthChangeTime)
+		clearMap(&c.thresholdExceededSince)
+		c.collectedGeneration = c.generation
+	}
+
+	c.lastScrape.Set(float64(now.Unix()))
+
+	metrics := c.scrapeQueues(now)
+	if len(metrics) > 0 {
+		c.lastSuccessfulScrape.Set(float64(now.Unix()))
+	}
+	var openHandles int32
+	for _, m := range metrics {
 
-		lvs := m.Metadata.prometheusLabelValues()
+		lvs := c.queueLabelValues(m)
+		c.lastLabelValues[m.Metadata.key()] = lvs
+		up[m.Metadata.key()] = true
+		depths[m.Metadata.key()] = m.CurrentDepth
 
 		c.up.WithLabelValues(lvs...).Set(1)
-		c.currentDepth.WithLabelValues(lvs...).Set(float64(m.CurrentDepth))
-		c.maxDepth.WithLabelValues(lvs...).Set(float64(m.MaxDepth))
-		c.openInputCount.WithLabelValues(lvs...).Set(float64(m.OpenInputCount))
-		c.openOutputCount.WithLabelValues(lvs...).Set(float64(m.OpenOutputCount))
-		c.requestDuration.WithLabelValues(lvs...).Set(float64(m.RequestDuration.Seconds()))
+		openHandles += m.OpenInputCount + m.OpenOutputCount
+
+		if m.collects("clusterName") || m.collects("indexType") {
+			c.info.WithLabelValues(append(c.queueLabelValues(m), m.ClusterName, m.IndexType)...).Set(1)
+		}
+		if m.collects("clusterName") {
+			c.clusterRoutingEnabled.WithLabelValues(lvs...).Set(boolToFloat64(m.ClusterName != ""))
+		}
+		if m.collects("currentDepth") {
+			c.currentDepth.WithLabelValues(lvs...).Set(float64(m.CurrentDepth))
+		}
+		if m.collects("maxDepth") {
+			c.maxDepth.WithLabelValues(lvs...).Set(float64(m.MaxDepth))
+		}
+		if m.collects("openInputCount") {
+			c.openInputCount.WithLabelValues(lvs...).Set(float64(m.OpenInputCount))
+		}
+		if m.collects("openOutputCount") {
+			c.openOutputCount.WithLabelValues(lvs...).Set(float64(m.OpenOutputCount))
+		}
+		if m.collects("depthHighEventEnabled") {
+			c.depthHighEventEnabled.WithLabelValues(lvs...).Set(boolToFloat64(m.DepthHighEventEnabled))
+		}
+		if m.collects("depthLowEventEnabled") {
+			c.depthLowEventEnabled.WithLabelValues(lvs...).Set(boolToFloat64(m.DepthLowEventEnabled))
+		}
+		if m.collects("depthMaxEventEnabled") {
+			c.depthMaxEventEnabled.WithLabelValues(lvs...).Set(boolToFloat64(m.DepthMaxEventEnabled))
+		}
+		if m.collects("defaultPersistence") {
+			c.defaultPersistence.WithLabelValues(lvs...).Set(float64(m.DefaultPersistence))
+		}
+		if m.collects("msgDeliverySequence") {
+			c.msgDeliverySequence.WithLabelValues(lvs...).Set(float64(m.MsgDeliverySequence))
+		}
+		if m.collects("defaultInputOpenOption") {
+			c.defaultInputOpenOption.WithLabelValues(lvs...).Set(float64(m.DefaultInputOpenOption))
+		}
+		if m.collects("defaultPutResponseType") {
+			c.defaultPutResponseType.WithLabelValues(lvs...).Set(float64(m.DefaultPutResponseType))
+		}
+		if m.collects("clusterWorkloadRank") {
+			c.clusterWorkloadRank.WithLabelValues(lvs...).Set(float64(m.ClusterWorkloadRank))
+		}
+		if m.collects("serviceInterval") {
+			c.serviceInterval.WithLabelValues(lvs...).Set(m.ServiceInterval.Seconds())
+		}
+		if m.collects("serviceIntervalEvent") {
+			c.serviceIntervalHighEventEnabled.WithLabelValues(lvs...).Set(boolToFloat64(m.ServiceIntervalHighEventEnabled))
+			c.serviceIntervalOkEventEnabled.WithLabelValues(lvs...).Set(boolToFloat64(m.ServiceIntervalOkEventEnabled))
+		}
+		if m.collects("hardenBackout") {
+			c.hardenBackout.WithLabelValues(lvs...).Set(float64(m.HardenBackout))
+		}
+		if m.collects("shareability") {
+			c.shareInputAllowed.WithLabelValues(lvs...).Set(float64(m.Shareability))
+		}
+		if m.collects("retentionInterval") {
+			c.retentionInterval.WithLabelValues(lvs...).Set(float64(m.RetentionInterval) / 24)
+		}
+		if m.collects("statisticsQ") {
+			c.statisticsLevel.WithLabelValues(lvs...).Set(float64(m.StatisticsQ))
+		}
+		if m.collects("maxMessageLength") {
+			c.maxMessageLength.WithLabelValues(lvs...).Set(float64(m.MaxMessageLength))
+		}
+		if m.collects("scope") {
+			c.scope.WithLabelValues(lvs...).Set(float64(m.Scope))
+		}
+		if m.collects("defaultPriority") {
+			c.defaultPriority.WithLabelValues(lvs...).Set(float64(m.DefaultPriority))
+		}
+		if m.collects("accountingLevel") {
+			c.accountingLevel.WithLabelValues(lvs...).Set(float64(m.AccountingLevel))
+		}
+
+		// The remaining metrics are either derived or not inquired by
+		// selectors of the queue, so they are only provided for queues which
+		// collect all metrics.
+		if len(m.CollectMetrics) > 0 {
+			continue
+		}
+
+		if m.cached() {
+			c.usingCachedMetrics.WithLabelValues(lvs...).Set(1)
+		} else {
+			c.usingCachedMetrics.WithLabelValues(lvs...).Set(0)
+			c.requestDuration.WithLabelValues(lvs...).Set(float64(m.RequestDuration.Seconds()))
+		}
+		c.openTotal.WithLabelValues(lvs...).Set(float64(m.OpenInputCount + m.OpenOutputCount))
+
+		change, ok := c.depthChange(m)
+		delta := depthDelta(m, change)
+		c.messageNetRate.WithLabelValues(lvs...).Set(float64(delta))
+		if elapsed > 0 {
+			c.messagesPerSecond.WithLabelValues(lvs...).Set(float64(delta) / elapsed.Seconds())
+		} else {
+			c.messagesPerSecond.WithLabelValues(lvs...).Set(0)
+		}
+
+		c.timeIndicator.WithLabelValues(lvs...).Set(float64(m.QueueTimeIndicator))
+		c.fileSize.WithLabelValues(lvs...).Set(float64(m.QueueFileSize))
+		if m.LastPutTime.IsZero() {
+			c.lastPutTime.WithLabelValues(lvs...).Set(0)
+		} else {
+			c.lastPutTime.WithLabelValues(lvs...).Set(float64(m.LastPutTime.Unix()))
+		}
+		c.depthObservations.WithLabelValues(lvs...).Observe(float64(m.CurrentDepth))
+
+		if area, ok := c.depthArea(m, now); ok {
+			c.depthIntegralSeconds.WithLabelValues(lvs...).Add(area)
+		} else {
+			c.depthIntegralSeconds.DeleteLabelValues(lvs...)
+			c.depthIntegralSeconds.WithLabelValues(lvs...)
+		}
+
+		if predictionError, ok := c.depthPredictionErrorOf(m, now); ok {
+			c.depthPredictionError.WithLabelValues(lvs...).Set(predictionError)
+		}
+		if forecast, ok := c.depthFillForecastMinutes(m, now); ok {
+			c.depthFillForecast.WithLabelValues(lvs...).Set(forecast)
+		}
+		c.depthStddev.WithLabelValues(lvs...).Set(c.depthStddevOf(m))
+		c.depthSlope.WithLabelValues(lvs...).Set(c.depthSlopeOf(m, now))
+
+		if lastChange, ok := c.depthLastChangeTime(m, ok && change != 0, now); ok {
+			c.depthLastChange.WithLabelValues(lvs...).Set(float64(lastChange.Unix()))
+			c.depthUnchangedSeconds.WithLabelValues(lvs...).Set(now.Sub(lastChange).Seconds())
+		} else {
+			c.depthLastChange.WithLabelValues(lvs...).Set(0)
+			c.depthUnchangedSeconds.WithLabelValues(lvs...).Set(0)
+		}
+
+		c.depthRatioExceededTotal.WithLabelValues(lvs...)
+		if m.MaxDepth > 0 && float64(m.CurrentDepth)/float64(m.MaxDepth) > c.depthRatioAlertThreshold {
+			c.depthRatioExceededTotal.WithLabelValues(lvs...).Inc()
+		}
+
+		c.depthIncrease.WithLabelValues(lvs...)
+		c.depthDecrease.WithLabelValues(lvs...)
+		if ok && change > 0 {
+			c.depthIncrease.WithLabelValues(lvs...).Add(float64(change))
+		}
+		if ok && change < 0 {
+			c.depthDecrease.WithLabelValues(lvs...).Add(float64(-change))
+		}
+	}
+
+	c.openHandlesTotal.Set(float64(openHandles))
+
+	health := &queueHealth{queues: len(c.queues)}
+	for _, queue := range c.queues {
+		if up[queue.Metadata.key()] {
+			health.up++
+		}
+	}
+	c.health.Store(health)
+
+	for _, queue := range c.queues {
+		if !up[queue.Metadata.key()] {
+			c.up.WithLabelValues(c.labelValues(queue.Metadata)...).Set(0)
+			c.depthIntegral.Delete(queue.Metadata.key())
+			c.depthHistory.Delete(queue.Metadata.key())
+			c.depthForecast.Delete(queue.Metadata.key())
+			c.depthWindow.Delete(queue.Metadata.key())
+			c.depthSlopeHistory.Delete(queue.Metadata.key())
+			c.depthChangeTime.Delete(queue.Metadata.key())
+			c.thresholdExceededSince.Delete(queue.Metadata.key())
+		}
+		if queue.DepthWarnThreshold > 0 {
+			lvs := c.labelValues(queue.Metadata)
+			c.depthWarnThreshold.WithLabelValues(lvs...).Set(float64(queue.DepthWarnThreshold))
+			c.depthAboveThresholdSeconds.WithLabelValues(lvs...)
+			if depth, ok := depths[queue.Metadata.key()]; ok {
+				c.depthAboveThresholdSeconds.WithLabelValues(lvs...).Add(c.aboveThresholdDuration(queue, depth, now).Seconds())
+			}
+		}
+	}
+
+	for _, metric := range c.metrics() {
+		metric.Collect(ch)
+	}
+}
+
+// depthChange returns the change of the current depth of the queue since the
+// last successful read. It's not ok for the first read.
+func (c *QueueCollector) depthChange(m QueueMetrics) (int32, bool) {
+	prev, ok := c.prevDepth.Swap(m.Metadata.key(), m.CurrentDepth)
+	if !ok {
+		return 0, false
+	}
+	return m.CurrentDepth - prev.(int32), true
+}
+
+// depthDelta returns the change of the current depth of the queue as net rate,
+// which is 0 if the queue was cleared, i.e. it is empty now.
+func depthDelta(m QueueMetrics, change int32) int32 {
+	if change < 0 && m.CurrentDepth == 0 {
+		return 0
+	}
+	return change
+}
+
+// depthArea returns the area under the depth curve of the queue since the
+// last successful read by the trapezoidal rule. It's not ok for the first
+// read and the first read after the queue was down, which starts the integral
+// anew.
+func (c *QueueCollector) depthArea(m QueueMetrics, now time.Time) (float64, bool) {
+	prev, ok := c.depthIntegral.Swap(m.Metadata.key(), depthObservation{depth: m.CurrentDepth, time: now})
+	if !ok {
+		return 0, false
+	}
+	p := prev.(depthObservation)
+	return float64(p.depth+m.CurrentDepth) / 2 * now.Sub(p.time).Seconds(), true
+}
+
+// depthPredictionErrorOf returns the absolute difference of the current depth
+// of the queue and the one predicted by the line of the last collect. It's not
+// ok if there is no prediction.
+func (c *QueueCollector) depthPredictionErrorOf(m QueueMetrics, now time.Time) (float64, bool) {
+	value, ok := c.depthForecast.Load(m.Metadata.key())
+	if !ok {
+		return 0, false
+	}
+	return math.Abs(value.(depthLine).at(now) - float64(m.CurrentDepth)), true
+}
+
+// depthFillForecastMinutes adds the current depth to the history of the queue
+// and returns the forecast of the minutes until the queue is full. It's not ok
+// unless there are at least two observations. The line fitted to the history
+// is kept as prediction of the depth of the next collect.
+func (c *QueueCollector) depthFillForecastMinutes(m QueueMetrics, now time.Time) (float64, bool) {
+	value, _ := c.depthHistory.LoadOrStore(m.Metadata.key(), &depthHistory{})
+	history := value.(*depthHistory)
+	history.add(depthObservation{depth: m.CurrentDepth, time: now}, c.depthHistoryCapacity)
+
+	if line, ok := fitDepthLine(history.observations); ok {
+		c.depthForecast.Store(m.Metadata.key(), line)
+	} else {
+		c.depthForecast.Delete(m.Metadata.key())
+	}
+	return fillForecastMinutes(history.observations, m.MaxDepth)
+}
+
+// depthStddevOf adds the current depth to the window of the queue and returns
+// the standard deviation of the depths in the window.
+func (c *QueueCollector) depthStddevOf(m QueueMetrics) float64 {
+	value, _ := c.depthWindow.LoadOrStore(m.Metadata.key(), &depthWindow{})
+	window := value.(*depthWindow)
+	window.add(float64(m.CurrentDepth), c.depthWindowSize)
+	return stddev(window.depths)
+}
+
+// depthSlopeOf adds the current depth to the slope history of the queue and
+// returns the slope of the line fitted to the history in messages per
+// second, which is 0 unless there are at least two observations spanning
+// some time.
+func (c *QueueCollector) depthSlopeOf(m QueueMetrics, now time.Time) float64 {
+	value, _ := c.depthSlopeHistory.LoadOrStore(m.Metadata.key(), &depthHistory{})
+	history := value.(*depthHistory)
+	history.add(depthObservation{depth: m.CurrentDepth, time: now}, c.depthSlopeWindowSize)
+
+	if len(history.observations) < 2 {
+		return 0
+	}
+	line, ok := fitDepthLine(history.observations)
+	if !ok {
+		return 0
+	}
+	return line.slope
+}
+
+// depthLastChangeTime returns the time of the last change of the depth of the
+// queue, which is now if the depth changed. The first read is taken as last
+// change, as the one before is not known, so it's not ok for the first read.
+func (c *QueueCollector) depthLastChangeTime(m QueueMetrics, changed bool, now time.Time) (time.Time, bool) {
+	value, loaded := c.depthChangeTime.LoadOrStore(m.Metadata.key(), now)
+	if !loaded {
+		return time.Time{}, false
+	}
+	if changed {
+		c.depthChangeTime.Store(m.Metadata.key(), now)
+		return now, true
+	}
+	return value.(time.Time), true
+}
+
+// aboveThresholdDuration returns the time the depth of the queue was above its
+// warn threshold since the last collect, which is 0 if the depth just exceeded
+// the threshold. A depth at or below the threshold stops the tracking.
+func (c *QueueCollector) aboveThresholdDuration(queue Queue, depth int32, now time.Time) time.Duration {
+	key := queue.Metadata.key()
+	if depth <= queue.DepthWarnThreshold {
+		c.thresholdExceededSince.Delete(key)
+		return 0
+	}
+	since, ok := c.thresholdExceededSince.Swap(key, now)
+	if !ok {
+		return 0
+	}
+	return now.Sub(since.(time.Time))
+}
+
+// stddev returns the population standard deviation of the values, which is 0
+// for less than two values.
+func stddev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(squares / float64(len(values)))
+}
+
+// fitDepthLine fits a line to the depth observations by linear least squares
+// regression. The line of a single observation is constant. It's not ok if
+// there are no observations or the observations don't span any time.
+func fitDepthLine(observations []depthObservation) (depthLine, bool) {
+	if len(observations) == 0 {
+		return depthLine{}, false
+	}
+
+	first, latest := observations[0].time, observations[0].time
+	for _, o := range observations {
+		if o.time.Before(first) {
+			first = o.time
+		}
+		if o.time.After(latest) {
+			latest = o.time
+		}
+	}
+	if len(observations) == 1 {
+		return depthLine{origin: first, latest: latest, intercept: float64(observations[0].depth)}, true
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+	for _, o := range observations {
+		x := o.time.Sub(first).Seconds()
+		y := float64(o.depth)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(observations))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return depthLine{}, false
+	}
+
+	slope := (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+	return depthLine{origin: first, latest: latest, intercept: intercept, slope: slope}, true
+}
+
+// fillForecastMinutes fits a line to the depth observations by linear least
+// squares regression and returns the minutes from the latest observation
+// until the line reaches the max depth, which is -1 if the slope is not
+// positive and 0 if the max depth is already reached. It's not ok for less
+// than two observations or if the observations don't span any time.
+func fillForecastMinutes(observations []depthObservation, maxDepth int32) (float64, bool) {
+	if len(observations) < 2 {
+		return 0, false
+	}
+
+	line, ok := fitDepthLine(observations)
+	if !ok {
+		return 0, false
+	}
+	if line.slope <= 0 {
+		return -1, true
+	}
+
+	seconds := (float64(maxDepth) - line.at(line.latest)) / line.slope
+	if seconds < 0 {
+		return 0, true
+	}
+	return seconds / 60, true
+}
+
+func clearMap(m *sync.Map) {
+	m.Range(func(key, _ any) bool {
+		m.Delete(key)
+		return true
+	})
+}
+
+func boolToFloat64(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// backgroundRead are the metrics of the queues of a generation read in the
+// background at a point in time.
+type backgroundRead struct {
+	metrics    []QueueMetrics
+	at         time.Time
+	generation int64
+}
+
+// queueHealth is the number of the queues which are up of all queues.
+type queueHealth struct {
+	up     int
+	queues int
+}
+
+// Health returns the number of the queues which were up and the number of
+// all queues of the last collect, both 0 before the first collect.
+func (c *QueueCollector) Health() (up int, queues int) {
+	if health := c.health.Load(); health != nil {
+		return health.up, health.queues
+	}
+	return 0, 0
+}
+
+// SetBackgroundScrapeInterval sets the interval of the reads of the queues by
+// RunBackgroundScrape, 0 (default) reads the queues on each collect. It must
+// be called before the collector is registered.
+func (c *QueueCollector) SetBackgroundScrapeInterval(interval time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.backgroundInterval = interval
+}
+
+// RunBackgroundScrape reads the queues in the background scrape interval until
+// done is closed, so a collect doesn't depend on the duration of the reads.
+func (c *QueueCollector) RunBackgroundScrape(done <-chan struct{}) {
+
+	c.Lock()
+	interval := c.backgroundInterval
+	c.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.readInBackground()
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *QueueCollector) readInBackground() {
+
+	c.Lock()
+	queues, timeout, generation := c.queues, c.timeout, c.generation
+	c.Unlock()
+
+	metrics := readQueues(c.logger, queues, timeout, c.readFailed)
+	c.backgroundRead.Store(&backgroundRead{metrics: metrics, at: c.now(), generation: generation})
+}
+
+// scrapeQueues returns the metrics of the queues, which are read unless
+// scraped in the background. The last background read is stale if it's
+// older than two intervals or of a previous generation of the queues, so the
+// queues are reported as down.
+func (c *QueueCollector) scrapeQueues(now time.Time) []QueueMetrics {
+
+	if c.backgroundInterval <= 0 {
+		return c.collectQueues(c.timeout)
+	}
+
+	read := c.backgroundRead.Load()
+	if read == nil || read.generation != c.generation || now.Sub(read.at) > 2*c.backgroundInterval {
+		return nil
+	}
+	return read.metrics
+}
+
+// QueueMetrics reads the metrics of all queues like Collect does, but returns
+// them as they are instead of updating the Prometheus metrics.
+func (c *QueueCollector) QueueMetrics() []QueueMetrics {
+
+	c.Lock()
+	queues, timeout := c.queues, c.timeout
+	c.Unlock()
+
+	return readQueues(c.logger, queues, timeout, c.readFailed)
+}
+
+// QueueMetricsWithTimeout is like QueueMetrics, but reads the metrics of all
+// queues within the given timeout instead of the timeout of the collector.
+func (c *QueueCollector) QueueMetricsWithTimeout(timeout time.Duration) []QueueMetrics {
+
+	c.Lock()
+	queues := c.queues
+	c.Unlock()
+
+	return readQueues(c.logger, queues, timeout, c.readFailed)
+}
+
+// collectQueues reads the metrics of the queues grouped by their timeout,
+// which is the given timeout unless set for the queue. The lock must be held
+// by the caller.
+func (c *QueueCollector) collectQueues(timeout time.Duration) []QueueMetrics {
+	return readQueues(c.logger, c.queues, timeout, c.readFailed)
+}
+
+// readFailed counts the failed read of the queue by the reason of the failure.
+func (c *QueueCollector) readFailed(queue Queue, reason string) {
+	c.readErrors.WithLabelValues(append(queue.Metadata.prometheusLabelValues(), reason)...).Inc()
+}
+
+func readQueues(logger *slog.Logger, queues []Queue, timeout time.Duration, failed func(Queue, string)) []QueueMetrics {
+
+	timeouts := make([]time.Duration, 0)
+	groups := make(map[time.Duration][]Queue)
+	for _, queue := range queues {
+		t := queue.Timeout
+		if t <= 0 {
+			t = timeout
+		}
+		if _, ok := groups[t]; !ok {
+			timeouts = append(timeouts, t)
+		}
+		groups[t] = append(groups[t], queue)
+	}
+
+	metrics := make([]QueueMetrics, 0, len(queues))
+	for _, t := range timeouts {
+		metrics = append(metrics, *collect(logger, t, groups[t], context.Background(), failed)...)
+	}
+	return metrics
+}
+
+// SetQueues replaces the queues whose metrics are read, e.g. after a reconnect
+// to the queue manager. If the generation differs from the one of the current
+// queues, the state of the previous reads (e.g. for the net rate) is discarded
+// on the next collect. The queues must not introduce new extra labels.
+func (c *QueueCollector) SetQueues(queues []Queue, generation int64) {
+	c.Lock()
+	defer c.Unlock()
+
+	keys := make(map[string]bool)
+	for _, queue := range queues {
+		keys[queue.Metadata.key()] = true
+	}
+	for _, queue := range c.queues {
+		if !keys[queue.Metadata.key()] {
+			c.deleteSeries(queue.Metadata)
+			c.prunedQueues.Inc()
+		}
+	}
+
+	c.queues = queues
+	c.generation = generation
+}
+
+// DeleteSeries deletes the metrics and the state of the previous reads of the
+// queue, e.g. if the queue is no longer read.
+func (c *QueueCollector) DeleteSeries(metadata QueueMetadata) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.deleteSeries(metadata)
+}
+
+func (c *QueueCollector) deleteSeries(metadata QueueMetadata) {
+
+	labels := make(prometheus.Labels)
+	for i, value := range metadata.prometheusLabelValues() {
+		labels[c.queueLabelNames[i]] = value
+	}
+	for _, vec := range c.queueVecs() {
+		vec.DeletePartialMatch(labels)
+	}
+
+	key := metadata.key()
+	delete(c.lastLabelValues, key)
+	c.prevDepth.Delete(key)
+	c.depthIntegral.Delete(key)
+	c.depthHistory.Delete(key)
+	c.depthForecast.Delete(key)
+	c.depthWindow.Delete(key)
+	c.depthSlopeHistory.Delete(key)
+	c.depthChangeTime.Delete(key)
+	c.thresholdExceededSince.Delete(key)
+}
+
+// queueVecs returns the metrics of the queues, which are labeled by the
+// queue.
+func (c *QueueCollector) queueVecs() []*prometheus.MetricVec {
+	return []*prometheus.MetricVec{
+		c.up.MetricVec,
+		c.info.MetricVec,
+		c.clusterRoutingEnabled.MetricVec,
+		c.currentDepth.MetricVec,
+		c.maxDepth.MetricVec,
+		c.openInputCount.MetricVec,
+		c.openOutputCount.MetricVec,
+		c.openTotal.MetricVec,
+		c.requestDuration.MetricVec,
+		c.usingCachedMetrics.MetricVec,
+		c.depthHighEventEnabled.MetricVec,
+		c.depthLowEventEnabled.MetricVec,
+		c.depthMaxEventEnabled.MetricVec,
+		c.messageNetRate.MetricVec,
+		c.messagesPerSecond.MetricVec,
+		c.defaultPersistence.MetricVec,
+		c.msgDeliverySequence.MetricVec,
+		c.defaultInputOpenOption.MetricVec,
+		c.defaultPutResponseType.MetricVec,
+		c.timeIndicator.MetricVec,
+		c.fileSize.MetricVec,
+		c.lastPutTime.MetricVec,
+		c.clusterWorkloadRank.MetricVec,
+		c.serviceInterval.MetricVec,
+		c.serviceIntervalHighEventEnabled.MetricVec,
+		c.serviceIntervalOkEventEnabled.MetricVec,
+		c.hardenBackout.MetricVec,
+		c.shareInputAllowed.MetricVec,
+		c.retentionInterval.MetricVec,
+		c.statisticsLevel.MetricVec,
+		c.maxMessageLength.MetricVec,
+		c.scope.MetricVec,
+		c.defaultPriority.MetricVec,
+		c.accountingLevel.MetricVec,
+		c.depthIntegralSeconds.MetricVec,
+		c.depthIncrease.MetricVec,
+		c.depthDecrease.MetricVec,
+		c.depthObservations.MetricVec,
+		c.depthWarnThreshold.MetricVec,
+		c.depthAboveThresholdSeconds.MetricVec,
+		c.depthRatioExceededTotal.MetricVec,
+		c.readErrors.MetricVec,
+		c.depthFillForecast.MetricVec,
+		c.depthPredictionError.MetricVec,
+		c.depthStddev.MetricVec,
+		c.depthSlope.MetricVec,
+		c.depthLastChange.MetricVec,
+		c.depthUnchangedSeconds.MetricVec,
+	}
+}
+
+// SetTimeout sets the timeout to read the metrics of all queues, which
+// applies from the next collect on.
+func (c *QueueCollector) SetTimeout(timeout time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.timeout = timeout
+}
+
+func (c *QueueCollector) Timeout() time.Duration {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.timeout
+}
+
+// acquireRead waits for a read of the read limit of a queue until the context
+// is done, which is not ok.
+func acquireRead(ctx context.Context, limit chan struct{}) bool {
+	if limit == nil {
+		return true
+	}
+	select {
+	case limit <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func releaseRead(limit chan struct{}) {
+	if limit != nil {
+		<-limit
 	}
+}
+
+// cancelRead cancels the read in progress of the queue if its reader is
+// cancelable.
+func cancelRead(logger *slog.Logger, queue *Queue) {
+	if queue == nil {
+		return
+	}
+	if reader, ok := queue.Reader.(CancelableQueueMetricsReader); ok {
+		logger.Warn("Cancel read of queue metrics", "queue", queue.Metadata.QueueName)
+		reader.Cancel()
+	}
+}
 
-	c.up.Collect(ch)
-	c.currentDepth.Collect(ch)
-	c.maxDepth.Collect(ch)
-	c.openInputCount.Collect(ch)
-	c.openOutputCount.Collect(ch)
-	c.requestDuration.Collect(ch)
+// readResult is the outcome of the read of the queue of the index.
+type readResult struct {
+	index   int
+	metrics QueueMetrics
+	err     error
 }
 
-func collect(logger *slog.Logger, timeout time.Duration, queues []Queue, ctx context.Context) *[]QueueMetrics {
+// collect reads the metrics of the queues one after another within the
+// timeout. A failed read and each queue not read by the timeout is reported
+// to failed if not nil, by the reason code of the error or 'timeout'.
+func collect(logger *slog.Logger, timeout time.Duration, queues []Queue, ctx context.Context, failed func(Queue, string)) *[]QueueMetrics {
 
 	metrics := make([]QueueMetrics, 0)
+	read := make([]bool, len(queues))
 
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 
-	ch := make(chan QueueMetrics)
+	ch := make(chan readResult)
 	defer close(ch)
 
+	var reading atomic.Pointer[Queue]
 	go func() {
 		defer cancel()
 
-		for _, queue := range queues {
-			metric, err := queue.Reader.Read()
-			if ctx.Err() != nil {
+		for i := range queues {
+			if !acquireRead(ctx, queues[i].ReadLimit) {
 				return
 			}
-			if err == nil {
-				ch <- metric
+			reading.Store(&queues[i])
+			metric, err := queues[i].Reader.Read()
+			reading.Store(nil)
+			releaseRead(queues[i].ReadLimit)
+			if ctx.Err() != nil {
+				return
 			}
+			ch <- readResult{index: i, metrics: metric, err: err}
 		}
 	}()
 
 	for {
 		select {
-		case metric := <-ch:
+		case result := <-ch:
+			read[result.index] = true
+			if result.err != nil {
+				if failed != nil {
+					failed(queues[result.index], readErrorReason(result.err))
+				}
+				continue
+			}
+			metric := result.metrics
 			logger.Debug("Got queue metrics", "queue", metric.Metadata.QueueName, "connection", metric.Metadata.ConnectionName, "queue_manager", metric.Metadata.QMgrName, "channel", metric.Metadata.ChannelName)
 			metrics = append(metrics, metric)
 		case <-ctx.Done():
 			if ctx.Err() == context.DeadlineExceeded {
 				logger.Error("Deadline exceeded while waiting for queue metrics", "timeout", timeout)
+				cancelRead(logger, reading.Load())
+				for i, queue := range queues {
+					if !read[i] && failed != nil {
+						failed(queue, "timeout")
+					}
+				}
 			}
 			return &metrics
 		}
 	}
 }
+
+// readErrorReason returns the reason code of the error of a failed read, which
+// is 'unknown' if the error is not the one of an MQI call.
+func readErrorReason(err error) string {
+	var rc ReasonCoder
+	if errors.As(err, &rc) {
+		return strconv.Itoa(int(rc.ReasonCode()))
+	}
+	return "unknown"
+}
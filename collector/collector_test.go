@@ -17,10 +17,16 @@ package collector
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -47,6 +53,17 @@ func (r failingQueueMetricReader) Read() (QueueMetrics, error) {
 	return QueueMetrics{}, r.value
 }
 
+// reasonCodeError is the error of a failed MQI call by its reason code.
+type reasonCodeError int32
+
+func (e reasonCodeError) Error() string {
+	return "MQRC " + strconv.Itoa(int(e))
+}
+
+func (e reasonCodeError) ReasonCode() int32 {
+	return int32(e)
+}
+
 type slowQueueMetricReader struct {
 	duration time.Duration
 	value    QueueMetrics
@@ -57,6 +74,28 @@ func (r slowQueueMetricReader) Read() (QueueMetrics, error) {
 	return r.value, nil
 }
 
+// cancelableQueueMetricReader blocks a read until it's canceled.
+type cancelableQueueMetricReader struct {
+	canceled chan time.Time
+	release  chan struct{}
+}
+
+func (r cancelableQueueMetricReader) Read() (QueueMetrics, error) {
+	<-r.release
+	return QueueMetrics{}, errors.New("canceled")
+}
+
+func (r cancelableQueueMetricReader) Cancel() {
+	r.canceled <- time.Now()
+	close(r.release)
+}
+
+type queueMetricReaderFunc func() (QueueMetrics, error)
+
+func (f queueMetricReaderFunc) Read() (QueueMetrics, error) {
+	return f()
+}
+
 func (m QueueMetadata) succeeding() Queue {
 	return Queue{Metadata: m, Reader: succeedingQueueMetricReader{value: QueueMetrics{Metadata: m}}}
 }
@@ -163,7 +202,7 @@ func TestCollectMetrics(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			have := collect(logger, tt.args.timeout, tt.args.queues, context.Background())
+			have := collect(logger, tt.args.timeout, tt.args.queues, context.Background(), nil)
 
 			if diff := cmp.Diff(tt.want, *have); diff != "" {
 				t.Errorf("Should contain expected metric(s) (-want, +got):\n%s", diff)
@@ -185,7 +224,7 @@ func TestCollectDoesNotLeakGoRoutine(t *testing.T) {
 		q2.succeeding(),
 	}
 
-	collect(logger, 500*time.Millisecond, queues, context.Background())
+	collect(logger, 500*time.Millisecond, queues, context.Background(), nil)
 
 	time.Sleep(3 * time.Second)
 	if numGoroutinesAfter := runtime.NumGoroutine(); numGoroutinesAfter > numGoroutinesBefore {
@@ -195,30 +234,211 @@ func TestCollectDoesNotLeakGoRoutine(t *testing.T) {
 
 func TestCollectorAllQueueRequestsSucceeds(t *testing.T) {
 
-	testcase := `# HELP mq_queue_current_depth Current number of messages on queue.
+	testcase := `# HELP mq_exporter_last_scrape_timestamp Unix timestamp of the last scrape of the queues.
+# TYPE mq_exporter_last_scrape_timestamp gauge
+mq_exporter_last_scrape_timestamp 1.7e+09
+# HELP mq_exporter_last_successful_scrape_timestamp Unix timestamp of the last scrape of the queues with at least one successful queue read.
+# TYPE mq_exporter_last_successful_scrape_timestamp gauge
+mq_exporter_last_successful_scrape_timestamp 1.7e+09
+# HELP mq_exporter_pruned_queues_total Number of queues whose metrics are deleted as the queue is no longer read.
+# TYPE mq_exporter_pruned_queues_total counter
+mq_exporter_pruned_queues_total 0
+# HELP mq_exporter_scrape_skipped_total Number of scrapes which provided the metrics of the last scrape as another scrape was in progress.
+# TYPE mq_exporter_scrape_skipped_total counter
+mq_exporter_scrape_skipped_total 0
+# HELP mq_queue_accounting_level Accounting level of the queue: 0 off, 1 low, 2 medium, 3 high or -1 inherited from the queue manager.
+# TYPE mq_queue_accounting_level gauge
+mq_queue_accounting_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_accounting_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_cluster_routing_enabled Is the queue a member of a cluster (1) or not (0).
+# TYPE mq_queue_cluster_routing_enabled gauge
+mq_queue_cluster_routing_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_cluster_routing_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_cluster_workload_rank Rank (0-9) of the queue for cluster workload management.
+# TYPE mq_queue_cluster_workload_rank gauge
+mq_queue_cluster_workload_rank{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_cluster_workload_rank{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_current_depth Current number of messages on queue.
 # TYPE mq_queue_current_depth gauge
-mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 1
-mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 0
+mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_default_input_open_option Default share option (MQOO_INPUT_*) of applications opening queue for input.
+# TYPE mq_queue_default_input_open_option gauge
+mq_queue_default_input_open_option{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_default_input_open_option{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_default_msg_persistence Default persistence (MQPER_*) of messages on queue.
+# TYPE mq_queue_default_msg_persistence gauge
+mq_queue_default_msg_persistence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_default_msg_persistence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_default_priority Default priority of messages put to queue.
+# TYPE mq_queue_default_priority gauge
+mq_queue_default_priority{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_default_priority{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_default_put_response_type Default put response type (MQPRT_*) of the queue: 0 as parent, 1 synchronous, 2 asynchronous.
+# TYPE mq_queue_default_put_response_type gauge
+mq_queue_default_put_response_type{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_default_put_response_type{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_decrease_total Total decrease of the current number of messages on queue between scrapes.
+# TYPE mq_queue_depth_decrease_total counter
+mq_queue_depth_decrease_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_decrease_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_high_event_enabled Are queue depth high events enabled (1) or not (0).
+# TYPE mq_queue_depth_high_event_enabled gauge
+mq_queue_depth_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_increase_total Total increase of the current number of messages on queue between scrapes.
+# TYPE mq_queue_depth_increase_total counter
+mq_queue_depth_increase_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_increase_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_integral_messages_seconds Time-weighted queue depth (integral of the current depth over time) in message seconds.
+# TYPE mq_queue_depth_integral_messages_seconds counter
+mq_queue_depth_integral_messages_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_integral_messages_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_last_change_timestamp Unix time of the last change of the current number of messages on queue, 0 if not known yet.
+# TYPE mq_queue_depth_last_change_timestamp gauge
+mq_queue_depth_last_change_timestamp{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_last_change_timestamp{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_low_event_enabled Are queue depth low events enabled (1) or not (0).
+# TYPE mq_queue_depth_low_event_enabled gauge
+mq_queue_depth_low_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_low_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_max_event_enabled Are queue full events enabled (1) or not (0).
+# TYPE mq_queue_depth_max_event_enabled gauge
+mq_queue_depth_max_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_max_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_observations Histogram of the current queue depths observed on each scrape.
+# TYPE mq_queue_depth_observations histogram
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="0"} 0
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="1"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="10"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="100"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="1000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="5000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="10000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="+Inf"} 1
+mq_queue_depth_observations_sum{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_depth_observations_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage="",le="0"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage="",le="1"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage="",le="10"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage="",le="100"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage="",le="1000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage="",le="5000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage="",le="10000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage="",le="+Inf"} 1
+mq_queue_depth_observations_sum{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_observations_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_depth_slope_messages_per_second Slope of the recent queue depths by linear regression in messages per second, positive if the queue is filling and negative if it's draining.
+# TYPE mq_queue_depth_slope_messages_per_second gauge
+mq_queue_depth_slope_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_slope_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_stddev Population standard deviation of the recent queue depths.
+# TYPE mq_queue_depth_stddev gauge
+mq_queue_depth_stddev{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_stddev{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_unchanged_duration_seconds Duration in seconds since the last change of the current number of messages on queue, 0 if not known yet.
+# TYPE mq_queue_depth_unchanged_duration_seconds gauge
+mq_queue_depth_unchanged_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_unchanged_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_file_size_bytes Current size of the queue file in bytes.
+# TYPE mq_queue_file_size_bytes gauge
+mq_queue_file_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_file_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_harden_backout Is the backout count of messages hardened (1) or not (0).
+# TYPE mq_queue_harden_backout gauge
+mq_queue_harden_backout{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_harden_backout{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_info Information about the queue.
+# TYPE mq_queue_info gauge
+mq_queue_info{channel="DEV.APP.SVRCONN",cluster="",connection="localhost(1414)",index_type="",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_info{channel="DEV.APP.SVRCONN",cluster="",connection="localhost(1414)",index_type="",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_last_put_time_seconds Time of the last message put to queue in unix seconds.
+# TYPE mq_queue_last_put_time_seconds gauge
+mq_queue_last_put_time_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_last_put_time_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
 # HELP mq_queue_max_depth Maximum number of messages allowed on queue.
 # TYPE mq_queue_max_depth gauge
-mq_queue_max_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 500
-mq_queue_max_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 500
+mq_queue_max_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 500
+mq_queue_max_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 500
+# HELP mq_queue_max_depth_ratio_exceeded_total Number of scrapes whose ratio of the current to the maximum number of messages on queue was above the alert threshold.
+# TYPE mq_queue_max_depth_ratio_exceeded_total counter
+mq_queue_max_depth_ratio_exceeded_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_max_depth_ratio_exceeded_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_max_message_size_bytes Maximum size of a message on queue in bytes.
+# TYPE mq_queue_max_message_size_bytes gauge
+mq_queue_max_message_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_max_message_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_message_net_rate Change of the current queue depth since the last scrape.
+# TYPE mq_queue_message_net_rate gauge
+mq_queue_message_net_rate{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_message_net_rate{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_messages_per_second Change of the current queue depth per second since the last scrape.
+# TYPE mq_queue_messages_per_second gauge
+mq_queue_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_msg_delivery_sequence Message delivery sequence of queue: 0 priority or 1 FIFO.
+# TYPE mq_queue_msg_delivery_sequence gauge
+mq_queue_msg_delivery_sequence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_msg_delivery_sequence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_open_handles_total Number of MQOPEN calls that have any of the queues open for input or output.
+# TYPE mq_queue_open_handles_total gauge
+mq_queue_open_handles_total 2
 # HELP mq_queue_open_input_count Number of MQOPEN calls that have the queue open for input.
 # TYPE mq_queue_open_input_count gauge
-mq_queue_open_input_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 0
-mq_queue_open_input_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 1
+mq_queue_open_input_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_open_input_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
 # HELP mq_queue_open_output_count Number of MQOPEN calls that have the queue open for output.
 # TYPE mq_queue_open_output_count gauge
-mq_queue_open_output_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 1
-mq_queue_open_output_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 0
+mq_queue_open_output_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_open_output_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_open_total Number of MQOPEN calls that have the queue open for input or output.
+# TYPE mq_queue_open_total gauge
+mq_queue_open_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_open_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
 # HELP mq_queue_request_duration_seconds Duration for request queue metrics in seconds.
 # TYPE mq_queue_request_duration_seconds gauge
-mq_queue_request_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 0.000422679
-mq_queue_request_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 0.000335981
+mq_queue_request_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0.000422679
+mq_queue_request_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0.000335981
+# HELP mq_queue_retention_interval_days Retention interval of the queue in days, i.e. the time the queue is needed for.
+# TYPE mq_queue_retention_interval_days gauge
+mq_queue_retention_interval_days{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_retention_interval_days{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_scope Scope of the queue definition: 0 queue manager or 1 cell.
+# TYPE mq_queue_scope gauge
+mq_queue_scope{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_scope{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_service_interval_high_event_enabled Are service interval high events enabled (1) or not (0).
+# TYPE mq_queue_service_interval_high_event_enabled gauge
+mq_queue_service_interval_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_service_interval_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_service_interval_ok_event_enabled Are service interval OK events enabled (1) or not (0).
+# TYPE mq_queue_service_interval_ok_event_enabled gauge
+mq_queue_service_interval_ok_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_service_interval_ok_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_service_interval_seconds Target time between a put and the next get on the queue for service interval events in seconds.
+# TYPE mq_queue_service_interval_seconds gauge
+mq_queue_service_interval_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_service_interval_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_share_input_allowed Can the queue be opened for input by multiple handles at the same time (1) or not (0).
+# TYPE mq_queue_share_input_allowed gauge
+mq_queue_share_input_allowed{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_share_input_allowed{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_statistics_level Statistics collection level of the queue: 0 off, 1 low, 2 medium, 3 high or -1 inherited from the queue manager.
+# TYPE mq_queue_statistics_level gauge
+mq_queue_statistics_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_statistics_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_time_indicator_microseconds Short-term time messages remain on the queue in microseconds.
+# TYPE mq_queue_time_indicator_microseconds gauge
+mq_queue_time_indicator_microseconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_time_indicator_microseconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
 # HELP mq_queue_up Was the last scrape of the queue successful.
 # TYPE mq_queue_up gauge
-mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 1
-mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 1
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_using_cached_metrics Are the metrics of the queue the cached ones of the last successful read (1) or not (0), e.g. while re-connecting.
+# TYPE mq_queue_using_cached_metrics gauge
+mq_queue_using_cached_metrics{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_using_cached_metrics{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
 `
 	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
 	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
@@ -242,7 +462,8 @@ mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUE
 			}),
 	}
 
-	collector := NewQueueCollector(logger, 1*time.Second, queues)
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+	collector.now = func() time.Time { return time.Unix(1700000000, 0) }
 
 	reg := prometheus.NewRegistry()
 	reg.MustRegister(collector)
@@ -255,26 +476,165 @@ mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUE
 
 func TestCollectorWithQueueRequestTimeout(t *testing.T) {
 
-	testcase := `# HELP mq_queue_current_depth Current number of messages on queue.
+	testcase := `# HELP mq_exporter_last_scrape_timestamp Unix timestamp of the last scrape of the queues.
+# TYPE mq_exporter_last_scrape_timestamp gauge
+mq_exporter_last_scrape_timestamp 1.7e+09
+# HELP mq_exporter_last_successful_scrape_timestamp Unix timestamp of the last scrape of the queues with at least one successful queue read.
+# TYPE mq_exporter_last_successful_scrape_timestamp gauge
+mq_exporter_last_successful_scrape_timestamp 1.7e+09
+# HELP mq_exporter_pruned_queues_total Number of queues whose metrics are deleted as the queue is no longer read.
+# TYPE mq_exporter_pruned_queues_total counter
+mq_exporter_pruned_queues_total 0
+# HELP mq_exporter_scrape_skipped_total Number of scrapes which provided the metrics of the last scrape as another scrape was in progress.
+# TYPE mq_exporter_scrape_skipped_total counter
+mq_exporter_scrape_skipped_total 0
+# HELP mq_queue_accounting_level Accounting level of the queue: 0 off, 1 low, 2 medium, 3 high or -1 inherited from the queue manager.
+# TYPE mq_queue_accounting_level gauge
+mq_queue_accounting_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_cluster_routing_enabled Is the queue a member of a cluster (1) or not (0).
+# TYPE mq_queue_cluster_routing_enabled gauge
+mq_queue_cluster_routing_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_cluster_workload_rank Rank (0-9) of the queue for cluster workload management.
+# TYPE mq_queue_cluster_workload_rank gauge
+mq_queue_cluster_workload_rank{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_current_depth Current number of messages on queue.
 # TYPE mq_queue_current_depth gauge
-mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 1
+mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_default_input_open_option Default share option (MQOO_INPUT_*) of applications opening queue for input.
+# TYPE mq_queue_default_input_open_option gauge
+mq_queue_default_input_open_option{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_default_msg_persistence Default persistence (MQPER_*) of messages on queue.
+# TYPE mq_queue_default_msg_persistence gauge
+mq_queue_default_msg_persistence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_default_priority Default priority of messages put to queue.
+# TYPE mq_queue_default_priority gauge
+mq_queue_default_priority{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_default_put_response_type Default put response type (MQPRT_*) of the queue: 0 as parent, 1 synchronous, 2 asynchronous.
+# TYPE mq_queue_default_put_response_type gauge
+mq_queue_default_put_response_type{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_decrease_total Total decrease of the current number of messages on queue between scrapes.
+# TYPE mq_queue_depth_decrease_total counter
+mq_queue_depth_decrease_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_high_event_enabled Are queue depth high events enabled (1) or not (0).
+# TYPE mq_queue_depth_high_event_enabled gauge
+mq_queue_depth_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_increase_total Total increase of the current number of messages on queue between scrapes.
+# TYPE mq_queue_depth_increase_total counter
+mq_queue_depth_increase_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_integral_messages_seconds Time-weighted queue depth (integral of the current depth over time) in message seconds.
+# TYPE mq_queue_depth_integral_messages_seconds counter
+mq_queue_depth_integral_messages_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_last_change_timestamp Unix time of the last change of the current number of messages on queue, 0 if not known yet.
+# TYPE mq_queue_depth_last_change_timestamp gauge
+mq_queue_depth_last_change_timestamp{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_low_event_enabled Are queue depth low events enabled (1) or not (0).
+# TYPE mq_queue_depth_low_event_enabled gauge
+mq_queue_depth_low_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_max_event_enabled Are queue full events enabled (1) or not (0).
+# TYPE mq_queue_depth_max_event_enabled gauge
+mq_queue_depth_max_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_observations Histogram of the current queue depths observed on each scrape.
+# TYPE mq_queue_depth_observations histogram
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="0"} 0
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="1"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="10"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="100"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="1000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="5000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="10000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="+Inf"} 1
+mq_queue_depth_observations_sum{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_depth_observations_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_depth_slope_messages_per_second Slope of the recent queue depths by linear regression in messages per second, positive if the queue is filling and negative if it's draining.
+# TYPE mq_queue_depth_slope_messages_per_second gauge
+mq_queue_depth_slope_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_stddev Population standard deviation of the recent queue depths.
+# TYPE mq_queue_depth_stddev gauge
+mq_queue_depth_stddev{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_unchanged_duration_seconds Duration in seconds since the last change of the current number of messages on queue, 0 if not known yet.
+# TYPE mq_queue_depth_unchanged_duration_seconds gauge
+mq_queue_depth_unchanged_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_error_total Number of failed reads of the queue by reason code (MQRC) or 'timeout'.
+# TYPE mq_queue_error_total counter
+mq_queue_error_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",mqrc="timeout",name="DEV.QUEUE.2",queue_manager="QM1"} 1
+mq_queue_error_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",mqrc="timeout",name="DEV.QUEUE.3",queue_manager="QM1"} 1
+# HELP mq_queue_file_size_bytes Current size of the queue file in bytes.
+# TYPE mq_queue_file_size_bytes gauge
+mq_queue_file_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_harden_backout Is the backout count of messages hardened (1) or not (0).
+# TYPE mq_queue_harden_backout gauge
+mq_queue_harden_backout{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_info Information about the queue.
+# TYPE mq_queue_info gauge
+mq_queue_info{channel="DEV.APP.SVRCONN",cluster="",connection="localhost(1414)",index_type="",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_last_put_time_seconds Time of the last message put to queue in unix seconds.
+# TYPE mq_queue_last_put_time_seconds gauge
+mq_queue_last_put_time_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
 # HELP mq_queue_max_depth Maximum number of messages allowed on queue.
 # TYPE mq_queue_max_depth gauge
-mq_queue_max_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 500
+mq_queue_max_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 500
+# HELP mq_queue_max_depth_ratio_exceeded_total Number of scrapes whose ratio of the current to the maximum number of messages on queue was above the alert threshold.
+# TYPE mq_queue_max_depth_ratio_exceeded_total counter
+mq_queue_max_depth_ratio_exceeded_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_max_message_size_bytes Maximum size of a message on queue in bytes.
+# TYPE mq_queue_max_message_size_bytes gauge
+mq_queue_max_message_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_message_net_rate Change of the current queue depth since the last scrape.
+# TYPE mq_queue_message_net_rate gauge
+mq_queue_message_net_rate{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_messages_per_second Change of the current queue depth per second since the last scrape.
+# TYPE mq_queue_messages_per_second gauge
+mq_queue_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_msg_delivery_sequence Message delivery sequence of queue: 0 priority or 1 FIFO.
+# TYPE mq_queue_msg_delivery_sequence gauge
+mq_queue_msg_delivery_sequence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_open_handles_total Number of MQOPEN calls that have any of the queues open for input or output.
+# TYPE mq_queue_open_handles_total gauge
+mq_queue_open_handles_total 1
 # HELP mq_queue_open_input_count Number of MQOPEN calls that have the queue open for input.
 # TYPE mq_queue_open_input_count gauge
-mq_queue_open_input_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 0
+mq_queue_open_input_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
 # HELP mq_queue_open_output_count Number of MQOPEN calls that have the queue open for output.
 # TYPE mq_queue_open_output_count gauge
-mq_queue_open_output_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 1
+mq_queue_open_output_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_open_total Number of MQOPEN calls that have the queue open for input or output.
+# TYPE mq_queue_open_total gauge
+mq_queue_open_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
 # HELP mq_queue_request_duration_seconds Duration for request queue metrics in seconds.
 # TYPE mq_queue_request_duration_seconds gauge
-mq_queue_request_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 0.000422679
+mq_queue_request_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0.000422679
+# HELP mq_queue_retention_interval_days Retention interval of the queue in days, i.e. the time the queue is needed for.
+# TYPE mq_queue_retention_interval_days gauge
+mq_queue_retention_interval_days{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_scope Scope of the queue definition: 0 queue manager or 1 cell.
+# TYPE mq_queue_scope gauge
+mq_queue_scope{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_service_interval_high_event_enabled Are service interval high events enabled (1) or not (0).
+# TYPE mq_queue_service_interval_high_event_enabled gauge
+mq_queue_service_interval_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_service_interval_ok_event_enabled Are service interval OK events enabled (1) or not (0).
+# TYPE mq_queue_service_interval_ok_event_enabled gauge
+mq_queue_service_interval_ok_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_service_interval_seconds Target time between a put and the next get on the queue for service interval events in seconds.
+# TYPE mq_queue_service_interval_seconds gauge
+mq_queue_service_interval_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_share_input_allowed Can the queue be opened for input by multiple handles at the same time (1) or not (0).
+# TYPE mq_queue_share_input_allowed gauge
+mq_queue_share_input_allowed{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_statistics_level Statistics collection level of the queue: 0 off, 1 low, 2 medium, 3 high or -1 inherited from the queue manager.
+# TYPE mq_queue_statistics_level gauge
+mq_queue_statistics_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_time_indicator_microseconds Short-term time messages remain on the queue in microseconds.
+# TYPE mq_queue_time_indicator_microseconds gauge
+mq_queue_time_indicator_microseconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
 # HELP mq_queue_up Was the last scrape of the queue successful.
 # TYPE mq_queue_up gauge
-mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 1
-mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 0
-mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1"} 0
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_using_cached_metrics Are the metrics of the queue the cached ones of the last successful read (1) or not (0), e.g. while re-connecting.
+# TYPE mq_queue_using_cached_metrics gauge
+mq_queue_using_cached_metrics{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
 `
 
 	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
@@ -298,7 +658,8 @@ mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUE
 		}),
 	}
 
-	collector := NewQueueCollector(logger, 500*time.Millisecond, queues)
+	collector := NewQueueCollector(logger, 500*time.Millisecond, queues, DefaultLabelNames, nil)
+	collector.now = func() time.Time { return time.Unix(1700000000, 0) }
 
 	reg := prometheus.NewRegistry()
 	reg.MustRegister(collector)
@@ -311,31 +672,215 @@ mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUE
 
 func TestCollectorWithQueueRequestError(t *testing.T) {
 
-	testcase := `# HELP mq_queue_current_depth Current number of messages on queue.
+	testcase := `# HELP mq_exporter_last_scrape_timestamp Unix timestamp of the last scrape of the queues.
+# TYPE mq_exporter_last_scrape_timestamp gauge
+mq_exporter_last_scrape_timestamp 1.7e+09
+# HELP mq_exporter_last_successful_scrape_timestamp Unix timestamp of the last scrape of the queues with at least one successful queue read.
+# TYPE mq_exporter_last_successful_scrape_timestamp gauge
+mq_exporter_last_successful_scrape_timestamp 1.7e+09
+# HELP mq_exporter_pruned_queues_total Number of queues whose metrics are deleted as the queue is no longer read.
+# TYPE mq_exporter_pruned_queues_total counter
+mq_exporter_pruned_queues_total 0
+# HELP mq_exporter_scrape_skipped_total Number of scrapes which provided the metrics of the last scrape as another scrape was in progress.
+# TYPE mq_exporter_scrape_skipped_total counter
+mq_exporter_scrape_skipped_total 0
+# HELP mq_queue_accounting_level Accounting level of the queue: 0 off, 1 low, 2 medium, 3 high or -1 inherited from the queue manager.
+# TYPE mq_queue_accounting_level gauge
+mq_queue_accounting_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_accounting_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_cluster_routing_enabled Is the queue a member of a cluster (1) or not (0).
+# TYPE mq_queue_cluster_routing_enabled gauge
+mq_queue_cluster_routing_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_cluster_routing_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_cluster_workload_rank Rank (0-9) of the queue for cluster workload management.
+# TYPE mq_queue_cluster_workload_rank gauge
+mq_queue_cluster_workload_rank{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_cluster_workload_rank{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_current_depth Current number of messages on queue.
 # TYPE mq_queue_current_depth gauge
-mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 1
-mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1"} 0
+mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_default_input_open_option Default share option (MQOO_INPUT_*) of applications opening queue for input.
+# TYPE mq_queue_default_input_open_option gauge
+mq_queue_default_input_open_option{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_default_input_open_option{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_default_msg_persistence Default persistence (MQPER_*) of messages on queue.
+# TYPE mq_queue_default_msg_persistence gauge
+mq_queue_default_msg_persistence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_default_msg_persistence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_default_priority Default priority of messages put to queue.
+# TYPE mq_queue_default_priority gauge
+mq_queue_default_priority{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_default_priority{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_default_put_response_type Default put response type (MQPRT_*) of the queue: 0 as parent, 1 synchronous, 2 asynchronous.
+# TYPE mq_queue_default_put_response_type gauge
+mq_queue_default_put_response_type{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_default_put_response_type{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_decrease_total Total decrease of the current number of messages on queue between scrapes.
+# TYPE mq_queue_depth_decrease_total counter
+mq_queue_depth_decrease_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_decrease_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_high_event_enabled Are queue depth high events enabled (1) or not (0).
+# TYPE mq_queue_depth_high_event_enabled gauge
+mq_queue_depth_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_increase_total Total increase of the current number of messages on queue between scrapes.
+# TYPE mq_queue_depth_increase_total counter
+mq_queue_depth_increase_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_increase_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_integral_messages_seconds Time-weighted queue depth (integral of the current depth over time) in message seconds.
+# TYPE mq_queue_depth_integral_messages_seconds counter
+mq_queue_depth_integral_messages_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_integral_messages_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_last_change_timestamp Unix time of the last change of the current number of messages on queue, 0 if not known yet.
+# TYPE mq_queue_depth_last_change_timestamp gauge
+mq_queue_depth_last_change_timestamp{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_last_change_timestamp{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_low_event_enabled Are queue depth low events enabled (1) or not (0).
+# TYPE mq_queue_depth_low_event_enabled gauge
+mq_queue_depth_low_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_low_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_max_event_enabled Are queue full events enabled (1) or not (0).
+# TYPE mq_queue_depth_max_event_enabled gauge
+mq_queue_depth_max_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_max_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_observations Histogram of the current queue depths observed on each scrape.
+# TYPE mq_queue_depth_observations histogram
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="0"} 0
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="1"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="10"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="100"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="1000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="5000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="10000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="+Inf"} 1
+mq_queue_depth_observations_sum{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_depth_observations_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage="",le="0"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage="",le="1"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage="",le="10"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage="",le="100"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage="",le="1000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage="",le="5000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage="",le="10000"} 1
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage="",le="+Inf"} 1
+mq_queue_depth_observations_sum{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_observations_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_depth_slope_messages_per_second Slope of the recent queue depths by linear regression in messages per second, positive if the queue is filling and negative if it's draining.
+# TYPE mq_queue_depth_slope_messages_per_second gauge
+mq_queue_depth_slope_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_slope_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_stddev Population standard deviation of the recent queue depths.
+# TYPE mq_queue_depth_stddev gauge
+mq_queue_depth_stddev{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_stddev{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_unchanged_duration_seconds Duration in seconds since the last change of the current number of messages on queue, 0 if not known yet.
+# TYPE mq_queue_depth_unchanged_duration_seconds gauge
+mq_queue_depth_unchanged_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_unchanged_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_error_total Number of failed reads of the queue by reason code (MQRC) or 'timeout'.
+# TYPE mq_queue_error_total counter
+mq_queue_error_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",mqrc="unknown",name="DEV.QUEUE.2",queue_manager="QM1"} 1
+# HELP mq_queue_file_size_bytes Current size of the queue file in bytes.
+# TYPE mq_queue_file_size_bytes gauge
+mq_queue_file_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_file_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_harden_backout Is the backout count of messages hardened (1) or not (0).
+# TYPE mq_queue_harden_backout gauge
+mq_queue_harden_backout{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_harden_backout{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_info Information about the queue.
+# TYPE mq_queue_info gauge
+mq_queue_info{channel="DEV.APP.SVRCONN",cluster="",connection="localhost(1414)",index_type="",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_info{channel="DEV.APP.SVRCONN",cluster="",connection="localhost(1414)",index_type="",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_last_put_time_seconds Time of the last message put to queue in unix seconds.
+# TYPE mq_queue_last_put_time_seconds gauge
+mq_queue_last_put_time_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_last_put_time_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
 # HELP mq_queue_max_depth Maximum number of messages allowed on queue.
 # TYPE mq_queue_max_depth gauge
-mq_queue_max_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 500
-mq_queue_max_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1"} 500
+mq_queue_max_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 500
+mq_queue_max_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 500
+# HELP mq_queue_max_depth_ratio_exceeded_total Number of scrapes whose ratio of the current to the maximum number of messages on queue was above the alert threshold.
+# TYPE mq_queue_max_depth_ratio_exceeded_total counter
+mq_queue_max_depth_ratio_exceeded_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_max_depth_ratio_exceeded_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_max_message_size_bytes Maximum size of a message on queue in bytes.
+# TYPE mq_queue_max_message_size_bytes gauge
+mq_queue_max_message_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_max_message_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_message_net_rate Change of the current queue depth since the last scrape.
+# TYPE mq_queue_message_net_rate gauge
+mq_queue_message_net_rate{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_message_net_rate{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_messages_per_second Change of the current queue depth per second since the last scrape.
+# TYPE mq_queue_messages_per_second gauge
+mq_queue_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_msg_delivery_sequence Message delivery sequence of queue: 0 priority or 1 FIFO.
+# TYPE mq_queue_msg_delivery_sequence gauge
+mq_queue_msg_delivery_sequence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_msg_delivery_sequence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_open_handles_total Number of MQOPEN calls that have any of the queues open for input or output.
+# TYPE mq_queue_open_handles_total gauge
+mq_queue_open_handles_total 2
 # HELP mq_queue_open_input_count Number of MQOPEN calls that have the queue open for input.
 # TYPE mq_queue_open_input_count gauge
-mq_queue_open_input_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 0
-mq_queue_open_input_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1"} 1
+mq_queue_open_input_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_open_input_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 1
 # HELP mq_queue_open_output_count Number of MQOPEN calls that have the queue open for output.
 # TYPE mq_queue_open_output_count gauge
-mq_queue_open_output_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 1
-mq_queue_open_output_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1"} 0
+mq_queue_open_output_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_open_output_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_open_total Number of MQOPEN calls that have the queue open for input or output.
+# TYPE mq_queue_open_total gauge
+mq_queue_open_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_open_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 1
 # HELP mq_queue_request_duration_seconds Duration for request queue metrics in seconds.
 # TYPE mq_queue_request_duration_seconds gauge
-mq_queue_request_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 0.000646478
-mq_queue_request_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1"} 0.000272913
+mq_queue_request_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0.000646478
+mq_queue_request_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0.000272913
+# HELP mq_queue_retention_interval_days Retention interval of the queue in days, i.e. the time the queue is needed for.
+# TYPE mq_queue_retention_interval_days gauge
+mq_queue_retention_interval_days{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_retention_interval_days{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_scope Scope of the queue definition: 0 queue manager or 1 cell.
+# TYPE mq_queue_scope gauge
+mq_queue_scope{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_scope{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_service_interval_high_event_enabled Are service interval high events enabled (1) or not (0).
+# TYPE mq_queue_service_interval_high_event_enabled gauge
+mq_queue_service_interval_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_service_interval_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_service_interval_ok_event_enabled Are service interval OK events enabled (1) or not (0).
+# TYPE mq_queue_service_interval_ok_event_enabled gauge
+mq_queue_service_interval_ok_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_service_interval_ok_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_service_interval_seconds Target time between a put and the next get on the queue for service interval events in seconds.
+# TYPE mq_queue_service_interval_seconds gauge
+mq_queue_service_interval_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_service_interval_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_share_input_allowed Can the queue be opened for input by multiple handles at the same time (1) or not (0).
+# TYPE mq_queue_share_input_allowed gauge
+mq_queue_share_input_allowed{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_share_input_allowed{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_statistics_level Statistics collection level of the queue: 0 off, 1 low, 2 medium, 3 high or -1 inherited from the queue manager.
+# TYPE mq_queue_statistics_level gauge
+mq_queue_statistics_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_statistics_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_time_indicator_microseconds Short-term time messages remain on the queue in microseconds.
+# TYPE mq_queue_time_indicator_microseconds gauge
+mq_queue_time_indicator_microseconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_time_indicator_microseconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
 # HELP mq_queue_up Was the last scrape of the queue successful.
 # TYPE mq_queue_up gauge
-mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 1
-mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 0
-mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1"} 1
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_using_cached_metrics Are the metrics of the queue the cached ones of the last successful read (1) or not (0), e.g. while re-connecting.
+# TYPE mq_queue_using_cached_metrics gauge
+mq_queue_using_cached_metrics{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_using_cached_metrics{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
 `
 
 	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
@@ -360,7 +905,8 @@ mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUE
 		}),
 	}
 
-	collector := NewQueueCollector(logger, 1*time.Second, queues)
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+	collector.now = func() time.Time { return time.Unix(1700000000, 0) }
 
 	reg := prometheus.NewRegistry()
 	reg.MustRegister(collector)
@@ -370,3 +916,1875 @@ mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUE
 		t.Fatal(err)
 	}
 }
+
+func TestCollectorKeepsStorageClassOfFailingQueue(t *testing.T) {
+
+	testcase := `# HELP mq_queue_up Was the last scrape of the queue successful.
+# TYPE mq_queue_up gauge
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="DEFAULT",usage=""} 0
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="ARCHIVE",usage=""} 1
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	reads := 0
+	queues := []Queue{
+		{
+			Metadata: q1,
+			Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+				reads++
+				if reads > 1 {
+					return QueueMetrics{}, errors.New("Failed")
+				}
+				return QueueMetrics{Metadata: q1, StorageClass: "DEFAULT"}, nil
+			}),
+		},
+		q2.succeedingWith(QueueMetrics{StorageClass: "ARCHIVE"}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_up")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorQueueInfoCluster(t *testing.T) {
+
+	testcase := `# HELP mq_queue_info Information about the queue.
+# TYPE mq_queue_info gauge
+mq_queue_info{channel="DEV.APP.SVRCONN",cluster="CLUSTER1",connection="localhost(1414)",index_type="",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_info{channel="DEV.APP.SVRCONN",cluster="",connection="localhost(1414)",index_type="",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{ClusterName: "CLUSTER1"}),
+		q2.succeedingWith(QueueMetrics{ClusterName: ""}),
+		q3.failingWith(errors.New("Failed")),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_info")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorClusterRoutingEnabled(t *testing.T) {
+
+	testcase := `# HELP mq_queue_cluster_routing_enabled Is the queue a member of a cluster (1) or not (0).
+# TYPE mq_queue_cluster_routing_enabled gauge
+mq_queue_cluster_routing_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_cluster_routing_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{ClusterName: "CLUSTER1", CollectMetrics: []string{"clusterName"}}),
+		q2.succeedingWith(QueueMetrics{ClusterName: ""}),
+		q3.succeedingWith(QueueMetrics{ClusterName: "CLUSTER1", CollectMetrics: []string{"maxDepth"}}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_cluster_routing_enabled")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorQueueInfoIndexType(t *testing.T) {
+
+	testcase := `# HELP mq_queue_info Information about the queue.
+# TYPE mq_queue_info gauge
+mq_queue_info{channel="DEV.APP.SVRCONN",cluster="",connection="localhost(1414)",index_type="",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_info{channel="DEV.APP.SVRCONN",cluster="",connection="localhost(1414)",index_type="correl_id",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_info{channel="DEV.APP.SVRCONN",cluster="",connection="localhost(1414)",index_type="none",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q4 := QueueMetadata{QueueName: "DEV.QUEUE.4", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{IndexType: "none"}),
+		q2.succeedingWith(QueueMetrics{IndexType: "correl_id", CollectMetrics: []string{"indexType"}}),
+		// the index type is not inquired, but the cluster name
+		q3.succeedingWith(QueueMetrics{CollectMetrics: []string{"clusterName"}}),
+		q4.succeedingWith(QueueMetrics{IndexType: "msg_id", CollectMetrics: []string{"currentDepth"}}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_info")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorDepthEventsEnabled(t *testing.T) {
+
+	testcase := `# HELP mq_queue_depth_high_event_enabled Are queue depth high events enabled (1) or not (0).
+# TYPE mq_queue_depth_high_event_enabled gauge
+mq_queue_depth_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_depth_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_depth_low_event_enabled Are queue depth low events enabled (1) or not (0).
+# TYPE mq_queue_depth_low_event_enabled gauge
+mq_queue_depth_low_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_low_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_depth_max_event_enabled Are queue full events enabled (1) or not (0).
+# TYPE mq_queue_depth_max_event_enabled gauge
+mq_queue_depth_max_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_depth_max_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{DepthHighEventEnabled: true, DepthMaxEventEnabled: true}),
+		q2.succeedingWith(QueueMetrics{DepthLowEventEnabled: true, DepthMaxEventEnabled: true}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase),
+		"mq_queue_depth_high_event_enabled", "mq_queue_depth_low_event_enabled", "mq_queue_depth_max_event_enabled")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorWithCustomLabelNames(t *testing.T) {
+
+	testcase := `# HELP mq_queue_up Was the last scrape of the queue successful.
+# TYPE mq_queue_up gauge
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",qmgr="QM1",queue_name="DEV.QUEUE.1",storage_class="",usage=""} 1
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",qmgr="QM1",queue_name="DEV.QUEUE.2",storage_class="",usage=""} 0
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeeding(),
+		q2.failingWith(errors.New("Failed")),
+	}
+
+	labelNames := LabelNames{Name: "queue_name", Connection: "connection", QueueManager: "qmgr", Channel: "channel"}
+	collector := NewQueueCollector(logger, 1*time.Second, queues, labelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_up")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorMessageRate(t *testing.T) {
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	depths := map[string][]int32{
+		q1.QueueName: {10, 30},
+		q2.QueueName: {20, 5},
+		q3.QueueName: {1000, 0},
+	}
+	scrape := 0
+
+	reader := func(metadata QueueMetadata) Queue {
+		return Queue{
+			Metadata: metadata,
+			Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+				return QueueMetrics{Metadata: metadata, CurrentDepth: depths[metadata.QueueName][scrape]}, nil
+			}),
+		}
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{reader(q1), reader(q2), reader(q3)}, DefaultLabelNames, nil)
+
+	now := time.Unix(1700000000, 0)
+	collector.now = func() time.Time { return now }
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	first := `# HELP mq_queue_message_net_rate Change of the current queue depth since the last scrape.
+# TYPE mq_queue_message_net_rate gauge
+mq_queue_message_net_rate{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_message_net_rate{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_message_net_rate{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_messages_per_second Change of the current queue depth per second since the last scrape.
+# TYPE mq_queue_messages_per_second gauge
+mq_queue_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+`
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(first), "mq_queue_message_net_rate", "mq_queue_messages_per_second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scrape++
+	now = now.Add(10 * time.Second)
+
+	second := `# HELP mq_queue_message_net_rate Change of the current queue depth since the last scrape.
+# TYPE mq_queue_message_net_rate gauge
+mq_queue_message_net_rate{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 20
+mq_queue_message_net_rate{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} -15
+mq_queue_message_net_rate{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_messages_per_second Change of the current queue depth per second since the last scrape.
+# TYPE mq_queue_messages_per_second gauge
+mq_queue_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 2
+mq_queue_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} -1.5
+mq_queue_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",usage=""} 0
+`
+
+	err = testutil.GatherAndCompare(reg, strings.NewReader(second), "mq_queue_message_net_rate", "mq_queue_messages_per_second")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorQueueDefinitionAttributes(t *testing.T) {
+
+	testcase := `# HELP mq_queue_default_input_open_option Default share option (MQOO_INPUT_*) of applications opening queue for input.
+# TYPE mq_queue_default_input_open_option gauge
+mq_queue_default_input_open_option{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 2
+mq_queue_default_input_open_option{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 4
+# HELP mq_queue_default_msg_persistence Default persistence (MQPER_*) of messages on queue.
+# TYPE mq_queue_default_msg_persistence gauge
+mq_queue_default_msg_persistence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_default_msg_persistence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_msg_delivery_sequence Message delivery sequence of queue: 0 priority or 1 FIFO.
+# TYPE mq_queue_msg_delivery_sequence gauge
+mq_queue_msg_delivery_sequence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_msg_delivery_sequence{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{DefaultPersistence: 0, MsgDeliverySequence: 0, DefaultInputOpenOption: 2}),
+		q2.succeedingWith(QueueMetrics{DefaultPersistence: 1, MsgDeliverySequence: 1, DefaultInputOpenOption: 4}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase),
+		"mq_queue_default_input_open_option", "mq_queue_default_msg_persistence", "mq_queue_msg_delivery_sequence")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorQueueStatus(t *testing.T) {
+
+	testcase := `# HELP mq_queue_file_size_bytes Current size of the queue file in bytes.
+# TYPE mq_queue_file_size_bytes gauge
+mq_queue_file_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 2.097152e+06
+mq_queue_file_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_last_put_time_seconds Time of the last message put to queue in unix seconds.
+# TYPE mq_queue_last_put_time_seconds gauge
+mq_queue_last_put_time_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1.7e+09
+mq_queue_last_put_time_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_time_indicator_microseconds Short-term time messages remain on the queue in microseconds.
+# TYPE mq_queue_time_indicator_microseconds gauge
+mq_queue_time_indicator_microseconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1500
+mq_queue_time_indicator_microseconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} -1
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{QueueTimeIndicator: 1500, QueueFileSize: 2 * 1024 * 1024, LastPutTime: time.Unix(1700000000, 0)}),
+		q2.succeedingWith(QueueMetrics{QueueTimeIndicator: -1}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_time_indicator_microseconds", "mq_queue_file_size_bytes", "mq_queue_last_put_time_seconds")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorSetTimeout(t *testing.T) {
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{q1.slowBy(200 * time.Millisecond)}, DefaultLabelNames, nil)
+
+	if got := len(collector.QueueMetrics()); got != 1 {
+		t.Fatalf("Should read queue within timeout, got %d metric(s).", got)
+	}
+
+	collector.SetTimeout(100 * time.Millisecond)
+
+	if got := collector.Timeout(); got != 100*time.Millisecond {
+		t.Errorf("Should return new timeout, got %s.", got)
+	}
+	if got := len(collector.QueueMetrics()); got != 0 {
+		t.Errorf("Should exceed new timeout, got %d metric(s).", got)
+	}
+}
+
+func TestCollectorCancelsReadOnTimeout(t *testing.T) {
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	reader := cancelableQueueMetricReader{canceled: make(chan time.Time, 1), release: make(chan struct{})}
+	collector := NewQueueCollector(logger, 200*time.Millisecond, []Queue{
+		q1.succeeding(),
+		{Metadata: q2, Reader: reader},
+	}, DefaultLabelNames, nil)
+
+	start := time.Now()
+	if got := len(collector.QueueMetrics()); got != 1 {
+		t.Fatalf("Should read queue within timeout, got %d metric(s).", got)
+	}
+
+	select {
+	case canceled := <-reader.canceled:
+		if d := canceled.Sub(start.Add(200 * time.Millisecond)); d > 100*time.Millisecond {
+			t.Errorf("Should cancel read within 100ms of timeout, got %s.", d)
+		}
+	default:
+		t.Fatal("Should cancel read on timeout.")
+	}
+}
+
+func TestCollectorReadLimit(t *testing.T) {
+
+	var active, maxActive atomic.Int32
+	reader := queueMetricReaderFunc(func() (QueueMetrics, error) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			m := maxActive.Load()
+			if n <= m || maxActive.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return QueueMetrics{}, nil
+	})
+
+	limit := make(chan struct{}, 2)
+	queues := make([]Queue, 0)
+	for _, name := range []string{"DEV.QUEUE.1", "DEV.QUEUE.2", "DEV.QUEUE.3"} {
+		queues = append(queues, Queue{Metadata: QueueMetadata{QueueName: name}, Reader: reader, ReadLimit: limit})
+	}
+	collector := NewQueueCollector(logger, 5*time.Second, queues, DefaultLabelNames, nil)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collector.QueueMetrics()
+		}()
+	}
+	wg.Wait()
+
+	if got := maxActive.Load(); got != 2 {
+		t.Errorf("Should read at most 2 queues at the same time, got %d.", got)
+	}
+}
+
+// TestCollectorQueueMetricsWhileQueuesChange reads the queues while they are
+// replaced, e.g. on reconnect, which is a data race unless the queues are
+// taken under the lock (go test -race).
+func TestCollectorQueueMetricsWhileQueuesChange(t *testing.T) {
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{metadata.succeedingWith(QueueMetrics{CurrentDepth: 1})}, DefaultLabelNames, nil)
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for generation := range int64(10) {
+			collector.SetQueues([]Queue{metadata.succeedingWith(QueueMetrics{CurrentDepth: 2})}, generation)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 10 {
+			if got := len(collector.QueueMetrics()); got != 1 {
+				t.Errorf("Should read 1 queue, got %d.", got)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 10 {
+			if got := len(collector.QueueMetricsWithTimeout(time.Second)); got != 1 {
+				t.Errorf("Should read 1 queue, got %d.", got)
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestCollectorDepthIntegral(t *testing.T) {
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	depths := []int32{10, 30, 0}
+	scrape := 0
+	failing := false
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{{
+		Metadata: metadata,
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			if failing {
+				return QueueMetrics{}, errors.New("Failed")
+			}
+			return QueueMetrics{Metadata: metadata, CurrentDepth: depths[scrape]}, nil
+		}),
+	}}, DefaultLabelNames, nil)
+
+	now := time.Unix(1700000000, 0)
+	collector.now = func() time.Time { return now }
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	integral := func(value string) string {
+		return `# HELP mq_queue_depth_integral_messages_seconds Time-weighted queue depth (integral of the current depth over time) in message seconds.
+# TYPE mq_queue_depth_integral_messages_seconds counter
+mq_queue_depth_integral_messages_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} ` + value + `
+`
+	}
+
+	steps := []struct {
+		elapsed time.Duration
+		want    string
+	}{
+		{elapsed: 0, want: "0"},
+		// (10 + 30) / 2 * 10s
+		{elapsed: 10 * time.Second, want: "200"},
+		// 200 + (30 + 0) / 2 * 5s
+		{elapsed: 5 * time.Second, want: "275"},
+	}
+
+	for i, step := range steps {
+		scrape = i
+		now = now.Add(step.elapsed)
+
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(integral(step.want)), "mq_queue_depth_integral_messages_seconds"); err != nil {
+			t.Fatalf("scrape %d: %s", i, err)
+		}
+	}
+
+	failing = true
+	now = now.Add(10 * time.Second)
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+
+	failing = false
+	scrape = 1
+	now = now.Add(10 * time.Second)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(integral("0")), "mq_queue_depth_integral_messages_seconds"); err != nil {
+		t.Fatalf("Should reset integral after the queue was down: %s", err)
+	}
+}
+
+func TestCollectorClusterWorkloadRank(t *testing.T) {
+
+	testcase := `# HELP mq_queue_cluster_workload_rank Rank (0-9) of the queue for cluster workload management.
+# TYPE mq_queue_cluster_workload_rank gauge
+mq_queue_cluster_workload_rank{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 7
+mq_queue_cluster_workload_rank{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{ClusterName: "CLUSTER1", ClusterWorkloadRank: 7}),
+		q2.succeedingWith(QueueMetrics{}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_cluster_workload_rank")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorDepthObservations(t *testing.T) {
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	depths := []int32{0, 0, 1, 5, 10, 50, 100, 150, 1000, 20000}
+	scrape := 0
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{{
+		Metadata: metadata,
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			return QueueMetrics{Metadata: metadata, CurrentDepth: depths[scrape]}, nil
+		}),
+	}}, DefaultLabelNames, nil)
+	collector.SetDepthHistogramBuckets([]float64{0, 10, 100, 1000})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	for scrape = range depths {
+		if _, err := reg.Gather(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testcase := `# HELP mq_queue_depth_observations Histogram of the current queue depths observed on each scrape.
+# TYPE mq_queue_depth_observations histogram
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="0"} 2
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="10"} 5
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="100"} 7
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="1000"} 9
+mq_queue_depth_observations_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="",le="+Inf"} 11
+mq_queue_depth_observations_sum{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 41316
+mq_queue_depth_observations_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 11
+`
+
+	// GatherAndCompare collects once more, which observes the last depth again.
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_depth_observations")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorWithExtraLabels(t *testing.T) {
+
+	testcase := `# HELP mq_queue_info Information about the queue.
+# TYPE mq_queue_info gauge
+mq_queue_info{channel="DEV.APP.SVRCONN",cluster="",connection="localhost(1414)",domain="",index_type="",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",team="",usage=""} 1
+mq_queue_info{channel="DEV.APP.SVRCONN",cluster="",connection="localhost(1414)",domain="",index_type="",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",team="payments",usage=""} 1
+# HELP mq_queue_up Was the last scrape of the queue successful.
+# TYPE mq_queue_up gauge
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",domain="",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",team="",usage=""} 1
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",domain="",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",team="payments",usage=""} 1
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",domain="invoices",name="DEV.QUEUE.3",queue_manager="QM1",storage_class="",team="billing",usage=""} 0
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN", ExtraLabels: map[string]string{"team": "payments"}}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN", ExtraLabels: map[string]string{"team": "billing", "domain": "invoices"}}
+
+	queues := []Queue{
+		q1.succeeding(),
+		q2.succeeding(),
+		q3.failingWith(errors.New("Failed")),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_info", "mq_queue_up")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorWithCollectMetrics(t *testing.T) {
+
+	testcase := `# HELP mq_exporter_last_scrape_timestamp Unix timestamp of the last scrape of the queues.
+# TYPE mq_exporter_last_scrape_timestamp gauge
+mq_exporter_last_scrape_timestamp 1.7e+09
+# HELP mq_exporter_last_successful_scrape_timestamp Unix timestamp of the last scrape of the queues with at least one successful queue read.
+# TYPE mq_exporter_last_successful_scrape_timestamp gauge
+mq_exporter_last_successful_scrape_timestamp 1.7e+09
+# HELP mq_exporter_pruned_queues_total Number of queues whose metrics are deleted as the queue is no longer read.
+# TYPE mq_exporter_pruned_queues_total counter
+mq_exporter_pruned_queues_total 0
+# HELP mq_exporter_scrape_skipped_total Number of scrapes which provided the metrics of the last scrape as another scrape was in progress.
+# TYPE mq_exporter_scrape_skipped_total counter
+mq_exporter_scrape_skipped_total 0
+# HELP mq_queue_current_depth Current number of messages on queue.
+# TYPE mq_queue_current_depth gauge
+mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="DEFAULT",usage=""} 42
+# HELP mq_queue_open_handles_total Number of MQOPEN calls that have any of the queues open for input or output.
+# TYPE mq_queue_open_handles_total gauge
+mq_queue_open_handles_total 0
+# HELP mq_queue_up Was the last scrape of the queue successful.
+# TYPE mq_queue_up gauge
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="DEFAULT",usage=""} 1
+`
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		metadata.succeedingWith(QueueMetrics{CollectMetrics: []string{"currentDepth"}, CurrentDepth: 42, StorageClass: "DEFAULT"}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+	collector.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorServiceInterval(t *testing.T) {
+
+	testcase := `# HELP mq_queue_service_interval_high_event_enabled Are service interval high events enabled (1) or not (0).
+# TYPE mq_queue_service_interval_high_event_enabled gauge
+mq_queue_service_interval_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_service_interval_high_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+# HELP mq_queue_service_interval_ok_event_enabled Are service interval OK events enabled (1) or not (0).
+# TYPE mq_queue_service_interval_ok_event_enabled gauge
+mq_queue_service_interval_ok_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_service_interval_ok_event_enabled{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+# HELP mq_queue_service_interval_seconds Target time between a put and the next get on the queue for service interval events in seconds.
+# TYPE mq_queue_service_interval_seconds gauge
+mq_queue_service_interval_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1.5
+mq_queue_service_interval_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 999999.999
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{ServiceInterval: 1500 * time.Millisecond, ServiceIntervalHighEventEnabled: true}),
+		q2.succeedingWith(QueueMetrics{ServiceInterval: 999999999 * time.Millisecond, ServiceIntervalOkEventEnabled: true}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_service_interval_seconds", "mq_queue_service_interval_high_event_enabled", "mq_queue_service_interval_ok_event_enabled")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorScrapeTimestamps(t *testing.T) {
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	failing := false
+	queue := Queue{
+		Metadata: q1,
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			if failing {
+				return QueueMetrics{}, errors.New("Failed")
+			}
+			return QueueMetrics{Metadata: q1}, nil
+		}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{queue}, DefaultLabelNames, nil)
+
+	now := time.Unix(1700000000, 0)
+	collector.now = func() time.Time { return now }
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	expected := func(last int64, lastSuccessful int64) string {
+		return fmt.Sprintf(`# HELP mq_exporter_last_scrape_timestamp Unix timestamp of the last scrape of the queues.
+# TYPE mq_exporter_last_scrape_timestamp gauge
+mq_exporter_last_scrape_timestamp %d
+# HELP mq_exporter_last_successful_scrape_timestamp Unix timestamp of the last scrape of the queues with at least one successful queue read.
+# TYPE mq_exporter_last_successful_scrape_timestamp gauge
+mq_exporter_last_successful_scrape_timestamp %d
+`, last, lastSuccessful)
+	}
+
+	scrapes := []struct {
+		failing        bool
+		last           int64
+		lastSuccessful int64
+	}{
+		{failing: false, last: 1700000000, lastSuccessful: 1700000000},
+		{failing: false, last: 1700000015, lastSuccessful: 1700000015},
+		{failing: true, last: 1700000030, lastSuccessful: 1700000015},
+	}
+
+	for i, scrape := range scrapes {
+		now = time.Unix(1700000000, 0).Add(time.Duration(i) * 15 * time.Second)
+		failing = scrape.failing
+
+		err := testutil.GatherAndCompare(reg, strings.NewReader(expected(scrape.last, scrape.lastSuccessful)), "mq_exporter_last_scrape_timestamp", "mq_exporter_last_successful_scrape_timestamp")
+		if err != nil {
+			t.Fatalf("scrape %d: %s", i, err)
+		}
+	}
+}
+
+func TestCollectorWithQueueTimeoutAndDepthWarnThreshold(t *testing.T) {
+
+	testcase := `# HELP mq_queue_depth_warn_threshold Configured warn threshold of the current number of messages on queue.
+# TYPE mq_queue_depth_warn_threshold gauge
+mq_queue_depth_warn_threshold{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",team="payments",usage=""} 1000
+# HELP mq_queue_up Was the last scrape of the queue successful.
+# TYPE mq_queue_up gauge
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",team="payments",usage=""} 1
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",team="billing",usage=""} 0
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN", ExtraLabels: map[string]string{"team": "payments"}}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN", ExtraLabels: map[string]string{"team": "billing"}}
+
+	payments := q1.slowBy(200 * time.Millisecond)
+	payments.Timeout = 1 * time.Second
+	payments.DepthWarnThreshold = 1000
+
+	billing := q2.slowBy(200 * time.Millisecond)
+
+	collector := NewQueueCollector(logger, 100*time.Millisecond, []Queue{payments, billing}, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_up", "mq_queue_depth_warn_threshold")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorDepthAboveThresholdDuration(t *testing.T) {
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	depths := []int32{150, 200, 120, 80, 300, 300}
+	scrape := 0
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{{
+		Metadata: metadata,
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			return QueueMetrics{Metadata: metadata, CurrentDepth: depths[scrape]}, nil
+		}),
+		DepthWarnThreshold: 100,
+	}}, DefaultLabelNames, nil)
+
+	now := time.Unix(1700000000, 0)
+	collector.now = func() time.Time { return now }
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	duration := func(value string) string {
+		return `# HELP mq_queue_depth_above_threshold_duration_seconds Total time the current number of messages on queue was above the configured warn threshold in seconds.
+# TYPE mq_queue_depth_above_threshold_duration_seconds counter
+mq_queue_depth_above_threshold_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} ` + value + `
+`
+	}
+
+	// the depth is above the threshold for three scrapes in 1s gaps, drops
+	// below it and exceeds it again
+	for i, want := range []string{"0", "1", "2", "2", "2", "3"} {
+		scrape = i
+		if i > 0 {
+			now = now.Add(1 * time.Second)
+		}
+
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(duration(want)), "mq_queue_depth_above_threshold_duration_seconds"); err != nil {
+			t.Fatalf("scrape %d: %s", i, err)
+		}
+	}
+}
+
+func TestCollectorErrorsByReasonCode(t *testing.T) {
+
+	testcase := `# HELP mq_queue_error_total Number of failed reads of the queue by reason code (MQRC) or 'timeout'.
+# TYPE mq_queue_error_total counter
+mq_queue_error_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",mqrc="2009",name="DEV.QUEUE.2",queue_manager="QM1"} 2
+mq_queue_error_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",mqrc="2085",name="DEV.QUEUE.3",queue_manager="QM1"} 2
+mq_queue_error_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",mqrc="unknown",name="DEV.QUEUE.4",queue_manager="QM1"} 2
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q4 := QueueMetadata{QueueName: "DEV.QUEUE.4", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeeding(),
+		q2.failingWith(fmt.Errorf("inquire: %w", reasonCodeError(2009))),
+		q3.failingWith(reasonCodeError(2085)),
+		q4.failingWith(errors.New("Failed")),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	// each failed read is counted on both scrapes
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_error_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorMaxDepthRatioExceeded(t *testing.T) {
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	depths := []int32{50, 90, 95, 100, 10}
+	scrape := 0
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{
+		{
+			Metadata: q1,
+			Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+				return QueueMetrics{Metadata: q1, CurrentDepth: depths[scrape], MaxDepth: 100}, nil
+			}),
+		},
+		{
+			// without max depth the ratio is unknown
+			Metadata: q2,
+			Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+				return QueueMetrics{Metadata: q2, CurrentDepth: depths[scrape]}, nil
+			}),
+		},
+	}, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	exceeded := func(value string) string {
+		return `# HELP mq_queue_max_depth_ratio_exceeded_total Number of scrapes whose ratio of the current to the maximum number of messages on queue was above the alert threshold.
+# TYPE mq_queue_max_depth_ratio_exceeded_total counter
+mq_queue_max_depth_ratio_exceeded_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} ` + value + `
+mq_queue_max_depth_ratio_exceeded_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+`
+	}
+
+	// the default threshold is 0.9, which is not exceeded by a ratio of 0.9
+	for i, want := range []string{"0", "0", "1", "2", "2"} {
+		scrape = i
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(exceeded(want)), "mq_queue_max_depth_ratio_exceeded_total"); err != nil {
+			t.Fatalf("scrape %d: %s", i, err)
+		}
+	}
+
+	collector.SetDepthRatioAlertThreshold(0.05)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(exceeded("3")), "mq_queue_max_depth_ratio_exceeded_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorHardenBackout(t *testing.T) {
+
+	testcase := `# HELP mq_queue_harden_backout Is the backout count of messages hardened (1) or not (0).
+# TYPE mq_queue_harden_backout gauge
+mq_queue_harden_backout{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_harden_backout{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{HardenBackout: 1}),
+		q2.succeedingWith(QueueMetrics{HardenBackout: 0}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_harden_backout")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorRetentionInterval(t *testing.T) {
+
+	testcase := `# HELP mq_queue_retention_interval_days Retention interval of the queue in days, i.e. the time the queue is needed for.
+# TYPE mq_queue_retention_interval_days gauge
+mq_queue_retention_interval_days{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 41666.625
+mq_queue_retention_interval_days{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 7
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{RetentionInterval: 999999}),
+		q2.succeedingWith(QueueMetrics{RetentionInterval: 168}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_retention_interval_days")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorStatisticsLevel(t *testing.T) {
+
+	testcase := `# HELP mq_queue_statistics_level Statistics collection level of the queue: 0 off, 1 low, 2 medium, 3 high or -1 inherited from the queue manager.
+# TYPE mq_queue_statistics_level gauge
+mq_queue_statistics_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} -1
+mq_queue_statistics_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{StatisticsQ: -1}),
+		q2.succeedingWith(QueueMetrics{StatisticsQ: 1, CollectMetrics: []string{"statisticsQ"}}),
+		q3.succeedingWith(QueueMetrics{StatisticsQ: 1, CollectMetrics: []string{"currentDepth"}}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_statistics_level")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorMaxMessageSize(t *testing.T) {
+
+	testcase := `# HELP mq_queue_max_message_size_bytes Maximum size of a message on queue in bytes.
+# TYPE mq_queue_max_message_size_bytes gauge
+mq_queue_max_message_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 4.194304e+06
+mq_queue_max_message_size_bytes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1.048576e+08
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{MaxMessageLength: 4194304}),
+		q2.succeedingWith(QueueMetrics{MaxMessageLength: 104857600, CollectMetrics: []string{"maxMessageLength"}}),
+		q3.succeedingWith(QueueMetrics{MaxMessageLength: 4194304, CollectMetrics: []string{"maxDepth"}}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_max_message_size_bytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorScope(t *testing.T) {
+
+	testcase := `# HELP mq_queue_scope Scope of the queue definition: 0 queue manager or 1 cell.
+# TYPE mq_queue_scope gauge
+mq_queue_scope{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_scope{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{Scope: 0}),
+		q2.succeedingWith(QueueMetrics{Scope: 1, CollectMetrics: []string{"scope"}}),
+		q3.succeedingWith(QueueMetrics{Scope: 1, CollectMetrics: []string{"maxDepth"}}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorDefaultPriority(t *testing.T) {
+
+	testcase := `# HELP mq_queue_default_priority Default priority of messages put to queue.
+# TYPE mq_queue_default_priority gauge
+mq_queue_default_priority{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_default_priority{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 5
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{DefaultPriority: 0}),
+		q2.succeedingWith(QueueMetrics{DefaultPriority: 5, CollectMetrics: []string{"defaultPriority"}}),
+		q3.succeedingWith(QueueMetrics{DefaultPriority: 9, CollectMetrics: []string{"maxDepth"}}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_default_priority")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorAccountingLevel(t *testing.T) {
+
+	testcase := `# HELP mq_queue_accounting_level Accounting level of the queue: 0 off, 1 low, 2 medium, 3 high or -1 inherited from the queue manager.
+# TYPE mq_queue_accounting_level gauge
+mq_queue_accounting_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} -1
+mq_queue_accounting_level{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 3
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{AccountingLevel: -1}),
+		q2.succeedingWith(QueueMetrics{AccountingLevel: 3, CollectMetrics: []string{"accountingLevel"}}),
+		q3.succeedingWith(QueueMetrics{AccountingLevel: 1, CollectMetrics: []string{"maxDepth"}}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_accounting_level")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorSetQueuesWithNewGeneration(t *testing.T) {
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	depths := []int32{10, 30, 50}
+	scrape := 0
+
+	queues := []Queue{{
+		Metadata: q1,
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			return QueueMetrics{Metadata: q1, CurrentDepth: depths[scrape]}, nil
+		}),
+	}}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+	collector.SetQueues(queues, 1)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	expected := func(delta int) string {
+		return fmt.Sprintf(`# HELP mq_queue_message_net_rate Change of the current queue depth since the last scrape.
+# TYPE mq_queue_message_net_rate gauge
+mq_queue_message_net_rate{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} %d
+`, delta)
+	}
+
+	for i, delta := range []int{0, 20} {
+		scrape = i
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(expected(delta)), "mq_queue_message_net_rate"); err != nil {
+			t.Fatalf("scrape %d: %s", i, err)
+		}
+	}
+
+	// reconnect
+	collector.SetQueues(queues, 2)
+	scrape = 2
+
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected(0)), "mq_queue_message_net_rate"); err != nil {
+		t.Fatalf("Should compute delta from scratch after reconnect: %s", err)
+	}
+}
+
+func TestCollectorSetQueuesPrunesRemovedQueues(t *testing.T) {
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{
+		q1.succeedingWith(QueueMetrics{CurrentDepth: 10}),
+		q2.succeedingWith(QueueMetrics{CurrentDepth: 20}),
+	}, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	before := `# HELP mq_exporter_pruned_queues_total Number of queues whose metrics are deleted as the queue is no longer read.
+# TYPE mq_exporter_pruned_queues_total counter
+mq_exporter_pruned_queues_total 0
+# HELP mq_queue_depth_increase_total Total increase of the current number of messages on queue between scrapes.
+# TYPE mq_queue_depth_increase_total counter
+mq_queue_depth_increase_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_depth_increase_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(before), "mq_exporter_pruned_queues_total", "mq_queue_depth_increase_total"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the counters of the removed queue would be kept otherwise
+	collector.SetQueues([]Queue{q1.succeedingWith(QueueMetrics{CurrentDepth: 10})}, 0)
+
+	after := `# HELP mq_exporter_pruned_queues_total Number of queues whose metrics are deleted as the queue is no longer read.
+# TYPE mq_exporter_pruned_queues_total counter
+mq_exporter_pruned_queues_total 1
+# HELP mq_queue_depth_increase_total Total increase of the current number of messages on queue between scrapes.
+# TYPE mq_queue_depth_increase_total counter
+mq_queue_depth_increase_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(after), "mq_exporter_pruned_queues_total", "mq_queue_depth_increase_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorSkipsOverlappingScrape(t *testing.T) {
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	var depth atomic.Int32
+	depth.Store(10)
+	var block atomic.Bool
+	reading := make(chan struct{})
+	release := make(chan struct{})
+
+	collector := NewQueueCollector(logger, 5*time.Second, []Queue{{
+		Metadata: metadata,
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			if block.Load() {
+				reading <- struct{}{}
+				<-release
+			}
+			return QueueMetrics{Metadata: metadata, CurrentDepth: depth.Load()}, nil
+		}),
+	}}, DefaultLabelNames, nil)
+	collector.SetScrapeMode(ScrapeModeSkip)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	expected := func(depth int, skipped int) string {
+		return fmt.Sprintf(`# HELP mq_exporter_scrape_skipped_total Number of scrapes which provided the metrics of the last scrape as another scrape was in progress.
+# TYPE mq_exporter_scrape_skipped_total counter
+mq_exporter_scrape_skipped_total %d
+# HELP mq_queue_current_depth Current number of messages on queue.
+# TYPE mq_queue_current_depth gauge
+mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} %d
+`, skipped, depth)
+	}
+	names := []string{"mq_exporter_scrape_skipped_total", "mq_queue_current_depth"}
+
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected(10, 0)), names...); err != nil {
+		t.Fatal(err)
+	}
+
+	depth.Store(20)
+	block.Store(true)
+	done := make(chan error)
+	go func() {
+		done <- testutil.GatherAndCompare(reg, strings.NewReader(expected(20, 1)), names...)
+	}()
+	<-reading
+
+	// the overlapping scrape provides the metrics of the last one
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected(10, 1)), names...); err != nil {
+		t.Fatal(err)
+	}
+
+	block.Store(false)
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorBackgroundScrape(t *testing.T) {
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	var reads atomic.Int32
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{{
+		Metadata: metadata,
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			return QueueMetrics{Metadata: metadata, CurrentDepth: reads.Add(1)}, nil
+		}),
+	}}, DefaultLabelNames, nil)
+	collector.SetBackgroundScrapeInterval(1 * time.Minute)
+
+	now := time.Unix(1700000000, 0)
+	collector.now = func() time.Time { return now }
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	expected := func(up int, depth int) string {
+		testcase := fmt.Sprintf(`# HELP mq_queue_up Was the last scrape of the queue successful.
+# TYPE mq_queue_up gauge
+mq_queue_up{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} %d
+`, up)
+		if depth > 0 {
+			testcase = fmt.Sprintf(`# HELP mq_queue_current_depth Current number of messages on queue.
+# TYPE mq_queue_current_depth gauge
+mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} %d
+`, depth) + testcase
+		}
+		return testcase
+	}
+	names := []string{"mq_queue_current_depth", "mq_queue_up"}
+
+	// no queue is read on collect
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected(0, 0)), names...); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	close(done)
+	collector.RunBackgroundScrape(done)
+
+	for range 2 {
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(expected(1, 1)), names...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := reads.Load(); got != 1 {
+		t.Errorf("Should read queue once in background, got %d read(s).", got)
+	}
+
+	// the last background read is fresh for two intervals
+	now = now.Add(2 * time.Minute)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected(1, 1)), names...); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(1 * time.Second)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected(0, 0)), names...); err != nil {
+		t.Fatal(err)
+	}
+
+	collector.readInBackground()
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected(1, 2)), names...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorOpenHandlesTotal(t *testing.T) {
+
+	testcase := `# HELP mq_queue_open_handles_total Number of MQOPEN calls that have any of the queues open for input or output.
+# TYPE mq_queue_open_handles_total gauge
+mq_queue_open_handles_total 10
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{OpenInputCount: 1, OpenOutputCount: 2}),
+		q2.succeedingWith(QueueMetrics{OpenInputCount: 3, OpenOutputCount: 4}),
+		q3.failingWith(errors.New("Failed")),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_open_handles_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorUsageOfTransmissionQueue(t *testing.T) {
+
+	testcase := `# HELP mq_queue_current_depth Current number of messages on queue.
+# TYPE mq_queue_current_depth gauge
+mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage="normal"} 3
+mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="QM2",queue_manager="QM1",storage_class="",usage="transmission"} 7
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "QM2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{CurrentDepth: 3, Usage: "normal"}),
+		q2.succeedingWith(QueueMetrics{CurrentDepth: 7, Usage: "transmission"}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_current_depth")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorDepthIncreaseAndDecrease(t *testing.T) {
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	depths := []int32{10, 30, 5, 20}
+	scrape := 0
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{{
+		Metadata: metadata,
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			return QueueMetrics{Metadata: metadata, CurrentDepth: depths[scrape]}, nil
+		}),
+	}}, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	counters := func(decrease string, increase string) string {
+		return `# HELP mq_queue_depth_decrease_total Total decrease of the current number of messages on queue between scrapes.
+# TYPE mq_queue_depth_decrease_total counter
+mq_queue_depth_decrease_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} ` + decrease + `
+# HELP mq_queue_depth_increase_total Total increase of the current number of messages on queue between scrapes.
+# TYPE mq_queue_depth_increase_total counter
+mq_queue_depth_increase_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} ` + increase + `
+`
+	}
+
+	steps := []struct {
+		decrease string
+		increase string
+	}{
+		{decrease: "0", increase: "0"},
+		{decrease: "0", increase: "20"},
+		{decrease: "25", increase: "20"},
+		{decrease: "25", increase: "35"},
+	}
+
+	for i, step := range steps {
+		scrape = i
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(counters(step.decrease, step.increase)), "mq_queue_depth_decrease_total", "mq_queue_depth_increase_total"); err != nil {
+			t.Fatalf("scrape %d: %s", i, err)
+		}
+	}
+}
+
+func TestCollectorDefaultPutResponseType(t *testing.T) {
+
+	testcase := `# HELP mq_queue_default_put_response_type Default put response type (MQPRT_*) of the queue: 0 as parent, 1 synchronous, 2 asynchronous.
+# TYPE mq_queue_default_put_response_type gauge
+mq_queue_default_put_response_type{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_default_put_response_type{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 2
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{DefaultPutResponseType: 1}),
+		q2.succeedingWith(QueueMetrics{DefaultPutResponseType: 2}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_default_put_response_type")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorShareInputAllowed(t *testing.T) {
+
+	testcase := `# HELP mq_queue_share_input_allowed Can the queue be opened for input by multiple handles at the same time (1) or not (0).
+# TYPE mq_queue_share_input_allowed gauge
+mq_queue_share_input_allowed{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+mq_queue_share_input_allowed{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 0
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{Shareability: 1}),
+		q2.succeedingWith(QueueMetrics{Shareability: 0}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_share_input_allowed")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFillForecastMinutes(t *testing.T) {
+
+	start := time.Unix(1700000000, 0)
+	observations := func(depths ...int32) []depthObservation {
+		xs := make([]depthObservation, 0, len(depths))
+		for i, depth := range depths {
+			xs = append(xs, depthObservation{depth: depth, time: start.Add(time.Duration(i) * time.Minute)})
+		}
+		return xs
+	}
+
+	tests := []struct {
+		name         string
+		observations []depthObservation
+		maxDepth     int32
+		want         float64
+		wantOk       bool
+	}{
+		{name: "single observation", observations: observations(10), maxDepth: 100},
+		{name: "no time span", observations: []depthObservation{{depth: 10, time: start}, {depth: 20, time: start}}, maxDepth: 100},
+		{name: "linear increase", observations: observations(10, 20, 30), maxDepth: 100, want: 7, wantOk: true},
+		// slope 2/15 messages per second and regression depth 37 at 3 minutes
+		{name: "noisy increase", observations: observations(10, 30, 20, 40), maxDepth: 100, want: 7.875, wantOk: true},
+		{name: "decrease", observations: observations(30, 20, 10), maxDepth: 100, want: -1, wantOk: true},
+		{name: "constant", observations: observations(10, 10, 10), maxDepth: 100, want: -1, wantOk: true},
+		{name: "max depth exceeded", observations: observations(10, 20, 30), maxDepth: 25, want: 0, wantOk: true},
+		{name: "order of ring buffer", observations: []depthObservation{observations(10, 20, 30)[2], observations(10, 20, 30)[0], observations(10, 20, 30)[1]}, maxDepth: 100, want: 7, wantOk: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := fillForecastMinutes(tt.observations, tt.maxDepth)
+			if ok != tt.wantOk {
+				t.Fatalf("Want ok %v. But found %v.", tt.wantOk, ok)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Want forecast %v minutes. But found %v.", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCollectorDepthFillForecast(t *testing.T) {
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	depths := []int32{10, 50, 30}
+	scrape := 0
+
+	newCollector := func(capacity int) *prometheus.Registry {
+		collector := NewQueueCollector(logger, 1*time.Second, []Queue{{
+			Metadata: metadata,
+			Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+				return QueueMetrics{Metadata: metadata, CurrentDepth: depths[scrape], MaxDepth: 100}, nil
+			}),
+		}}, DefaultLabelNames, nil)
+		collector.SetDepthHistoryCapacity(capacity)
+
+		now := time.Unix(1700000000, 0)
+		collector.now = func() time.Time {
+			now = now.Add(time.Minute)
+			return now
+		}
+
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(collector)
+		return reg
+	}
+
+	forecast := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return `# HELP mq_queue_depth_fill_forecast_minutes Forecast of the minutes until the queue is full by linear regression of the recent depths, -1 if the depth is not increasing.
+# TYPE mq_queue_depth_fill_forecast_minutes gauge
+mq_queue_depth_fill_forecast_minutes{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} ` + value + `
+`
+	}
+
+	tests := []struct {
+		name     string
+		capacity int
+		want     []string
+	}{
+		// 50 remaining messages at 40 messages per minute, then 60 remaining
+		// messages at 10 messages per minute by regression of all three
+		// depths (depth 40 at the latest observation)
+		{name: "default capacity", capacity: DefaultDepthHistoryCapacity, want: []string{"", "1.25", "6"}},
+		{name: "capacity of two", capacity: 2, want: []string{"", "1.25", "-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := newCollector(tt.capacity)
+			for i, want := range tt.want {
+				scrape = i
+				if err := testutil.GatherAndCompare(reg, strings.NewReader(forecast(want)), "mq_queue_depth_fill_forecast_minutes"); err != nil {
+					t.Fatalf("scrape %d: %s", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCollectorMetricDescriptions(t *testing.T) {
+
+	descriptions := map[string]string{
+		"queue_current_depth": "Aktuelle Anzahl der Nachrichten in der Queue.",
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, nil, DefaultLabelNames, descriptions)
+
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		collector.Describe(ch)
+		close(ch)
+	}()
+
+	descs := make(map[string]string)
+	for desc := range ch {
+		name, _, _ := strings.Cut(strings.TrimPrefix(desc.String(), `Desc{fqName: "`), `"`)
+		descs[name] = desc.String()
+	}
+
+	if desc := descs["mq_queue_current_depth"]; !strings.Contains(desc, `help: "Aktuelle Anzahl der Nachrichten in der Queue."`) {
+		t.Errorf("Want overridden help text of mq_queue_current_depth. But found '%s'.", desc)
+	}
+	if desc := descs["mq_queue_max_depth"]; !strings.Contains(desc, `help: "Maximum number of messages allowed on queue."`) {
+		t.Errorf("Want default help text of mq_queue_max_depth. But found '%s'.", desc)
+	}
+}
+
+func TestQueueMetricNames(t *testing.T) {
+
+	names := QueueMetricNames()
+
+	for _, name := range []string{"queue_up", "queue_current_depth", "queue_depth_fill_forecast_minutes"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("Want metric name '%s'. But found none in %v.", name, names)
+		}
+	}
+}
+
+func TestStddev(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{name: "no values", want: 0},
+		{name: "single value", values: []float64{42}, want: 0},
+		{name: "constant values", values: []float64{1, 1, 1, 1}, want: 0},
+		{name: "two values", values: []float64{0, 100}, want: 50},
+		{name: "population", values: []float64{2, 4, 4, 4, 5, 5, 7, 9}, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stddev(tt.values); got != tt.want {
+				t.Errorf("Want standard deviation %v. But found %v.", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCollectorDepthPredictionError(t *testing.T) {
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	depths := []int32{10, 30, 45}
+	scrape := 0
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{{
+		Metadata: metadata,
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			return QueueMetrics{Metadata: metadata, CurrentDepth: depths[scrape], MaxDepth: 5000}, nil
+		}),
+	}}, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	// no prediction on the first scrape, the constant depth of the first
+	// scrape (10) on the second and the line through 10 and 30 (50) on the
+	// third one
+	for i, want := range []string{"", "20", "5"} {
+		scrape = i
+		collector.now = func() time.Time { return time.Unix(1700000000+int64(i)*60, 0) }
+		expected := ""
+		if want != "" {
+			expected = `# HELP mq_queue_depth_prediction_error Absolute difference of the current number of messages on queue and the one predicted by the linear regression of the recent depths of the last scrape.
+# TYPE mq_queue_depth_prediction_error gauge
+mq_queue_depth_prediction_error{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} ` + want + `
+`
+		}
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "mq_queue_depth_prediction_error"); err != nil {
+			t.Fatalf("scrape %d: %s", i, err)
+		}
+	}
+}
+
+func TestCollectorDepthStddev(t *testing.T) {
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	depths := []int32{0, 100, 100}
+	scrape := 0
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{{
+		Metadata: metadata,
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			return QueueMetrics{Metadata: metadata, CurrentDepth: depths[scrape]}, nil
+		}),
+	}}, DefaultLabelNames, nil)
+	collector.SetDepthWindowSize(2)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	// the first depth drops out of the window of size two on the third scrape
+	for i, want := range []string{"0", "50", "0"} {
+		scrape = i
+		expected := `# HELP mq_queue_depth_stddev Population standard deviation of the recent queue depths.
+# TYPE mq_queue_depth_stddev gauge
+mq_queue_depth_stddev{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} ` + want + `
+`
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "mq_queue_depth_stddev"); err != nil {
+			t.Fatalf("scrape %d: %s", i, err)
+		}
+	}
+}
+
+func TestCollectorDepthSlope(t *testing.T) {
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	depths := []int32{100, 130, 160, 160, 40}
+	scrape := 0
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{{
+		Metadata: metadata,
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			return QueueMetrics{Metadata: metadata, CurrentDepth: depths[scrape]}, nil
+		}),
+	}}, DefaultLabelNames, nil)
+	collector.SetDepthSlopeWindowSize(2)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	// the scrapes are 15s apart, the slope of a single depth is 0 and the
+	// window of size two only contains the last two depths
+	for i, want := range []string{"0", "2", "2", "0", "-8"} {
+		scrape = i
+		collector.now = func() time.Time { return time.Unix(1700000000+int64(i)*15, 0) }
+		expected := `# HELP mq_queue_depth_slope_messages_per_second Slope of the recent queue depths by linear regression in messages per second, positive if the queue is filling and negative if it's draining.
+# TYPE mq_queue_depth_slope_messages_per_second gauge
+mq_queue_depth_slope_messages_per_second{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} ` + want + `
+`
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "mq_queue_depth_slope_messages_per_second"); err != nil {
+			t.Fatalf("scrape %d: %s", i, err)
+		}
+	}
+}
+
+func TestDepthSlopeOfLeastSquaresRegression(t *testing.T) {
+
+	start := time.Unix(1700000000, 0)
+	observations := func(depths ...int32) []depthObservation {
+		xs := make([]depthObservation, 0, len(depths))
+		for i, depth := range depths {
+			xs = append(xs, depthObservation{depth: depth, time: start.Add(time.Duration(i) * 10 * time.Second)})
+		}
+		return xs
+	}
+
+	// the slope of 10, 30, 20, 40 is the one of the least squares line, not
+	// the one of the first and the last depth
+	for _, tt := range []struct {
+		depths []int32
+		want   float64
+	}{
+		{depths: []int32{10, 30, 20, 40}, want: 0.8},
+		{depths: []int32{50, 40, 30}, want: -1},
+		{depths: []int32{7, 7, 7}, want: 0},
+	} {
+		line, ok := fitDepthLine(observations(tt.depths...))
+		if !ok {
+			t.Fatalf("depths %v: no line fitted", tt.depths)
+		}
+		if math.Abs(line.slope-tt.want) > 1e-9 {
+			t.Errorf("depths %v: want slope %v, got %v", tt.depths, tt.want, line.slope)
+		}
+	}
+}
+
+func TestCollectorDepthUnchangedDuration(t *testing.T) {
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	depths := []int32{10, 10, 10, 20, 20}
+	scrape := 0
+
+	collector := NewQueueCollector(logger, 1*time.Second, []Queue{{
+		Metadata: metadata,
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			return QueueMetrics{Metadata: metadata, CurrentDepth: depths[scrape]}, nil
+		}),
+	}}, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	// the duration increases while the depth is unchanged and starts anew on
+	// the change of the fourth scrape
+	for i, want := range []struct{ timestamp, duration string }{
+		{"0", "0"},
+		{"1700000000", "15"},
+		{"1700000000", "30"},
+		{"1700000045", "0"},
+		{"1700000045", "15"},
+	} {
+		scrape = i
+		collector.now = func() time.Time { return time.Unix(1700000000+int64(i)*15, 0) }
+		expected := `# HELP mq_queue_depth_last_change_timestamp Unix time of the last change of the current number of messages on queue, 0 if not known yet.
+# TYPE mq_queue_depth_last_change_timestamp gauge
+mq_queue_depth_last_change_timestamp{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} ` + want.timestamp + `
+# HELP mq_queue_depth_unchanged_duration_seconds Duration in seconds since the last change of the current number of messages on queue, 0 if not known yet.
+# TYPE mq_queue_depth_unchanged_duration_seconds gauge
+mq_queue_depth_unchanged_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} ` + want.duration + `
+`
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "mq_queue_depth_last_change_timestamp", "mq_queue_depth_unchanged_duration_seconds"); err != nil {
+			t.Fatalf("scrape %d: %s", i, err)
+		}
+	}
+}
+
+func TestCollectorOpenTotal(t *testing.T) {
+
+	testcase := `# HELP mq_queue_open_total Number of MQOPEN calls that have the queue open for input or output.
+# TYPE mq_queue_open_total gauge
+mq_queue_open_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 5
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{OpenInputCount: 2, OpenOutputCount: 3}),
+		q2.succeedingWith(QueueMetrics{OpenInputCount: 2, OpenOutputCount: 3, CollectMetrics: []string{"openInputCount", "openOutputCount"}}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_open_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorUsingCachedMetrics(t *testing.T) {
+
+	testcase := `# HELP mq_queue_request_duration_seconds Duration for request queue metrics in seconds.
+# TYPE mq_queue_request_duration_seconds gauge
+mq_queue_request_duration_seconds{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0.25
+# HELP mq_queue_using_cached_metrics Are the metrics of the queue the cached ones of the last successful read (1) or not (0), e.g. while re-connecting.
+# TYPE mq_queue_using_cached_metrics gauge
+mq_queue_using_cached_metrics{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 0
+mq_queue_using_cached_metrics{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 1
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{RequestDuration: 250 * time.Millisecond}),
+		q2.succeedingWith(QueueMetrics{RequestDuration: -1}),
+	}
+
+	collector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_request_duration_seconds", "mq_queue_using_cached_metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
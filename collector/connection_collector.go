@@ -0,0 +1,186 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type ConnectionMetadata struct {
+	ConnectionName string
+	QMgrName       string
+	ChannelName    string
+}
+
+type ConnectionMetricsReader interface {
+	ConnectionMetrics() ConnectionMetrics
+}
+
+type ConnectionMetrics struct {
+	Metadata             ConnectionMetadata
+	LastKeepaliveSuccess time.Time
+	PoolSize             int
+	PoolAvailable        int
+	LastConnect          time.Time
+	CertExpiries         []CertExpiry
+	QueueLimitExceeded   bool
+
+	// ConnectDuration is the duration of MQCONNX of the last (re-)connect,
+	// ReconnectDurationTotal the sum of these durations of all re-connects.
+	ConnectDuration        time.Duration
+	ReconnectDurationTotal time.Duration
+}
+
+// CertExpiry is the expiry of a TLS certificate used for the connection.
+type CertExpiry struct {
+	Subject  string
+	Issuer   string
+	NotAfter time.Time
+}
+
+type ConnectionCollector struct {
+	sync.Mutex
+	logger *slog.Logger
+	reader ConnectionMetricsReader
+
+	lastKeepaliveSuccess *prometheus.GaugeVec
+	poolSize             *prometheus.GaugeVec
+	poolAvailable        *prometheus.GaugeVec
+	lastReconnect        *prometheus.GaugeVec
+	tlsCertExpiry        *prometheus.GaugeVec
+	queueLimitExceeded   *prometheus.GaugeVec
+
+	sslHandshakeDuration *prometheus.GaugeVec
+	sslReconnectDuration *prometheus.Desc
+}
+
+func (m *ConnectionMetadata) prometheusLabelValues() []string {
+	return []string{
+		m.ConnectionName,
+		m.QMgrName,
+		m.ChannelName,
+	}
+}
+
+func NewConnectionCollector(logger *slog.Logger, reader ConnectionMetricsReader) *ConnectionCollector {
+
+	newConnectionMetric := func(name string, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "connection",
+			Name:      name,
+			Help:      help,
+		}, []string{"connection", "queue_manager", "channel"})
+	}
+
+	return &ConnectionCollector{
+		logger: logger,
+		reader: reader,
+
+		lastKeepaliveSuccess: newConnectionMetric("last_keepalive_success_timestamp", "Unix timestamp of the last successful keepalive inquiry."),
+		poolSize:             newConnectionMetric("pool_size", "Number of handles of the connection pool."),
+		poolAvailable:        newConnectionMetric("pool_available", "Number of available (not in use) handles of the connection pool."),
+		lastReconnect: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "last_reconnect_timestamp",
+			Help:      "Unix timestamp of the last (re-)connect to the queue manager, which resets the queue statistics.",
+		}, []string{"connection", "queue_manager", "channel"}),
+		tlsCertExpiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "connection",
+			Name:      "tls_cert_expiry_seconds",
+			Help:      "Unix timestamp of the expiry (not after) of the TLS certificate.",
+		}, []string{"connection", "queue_manager", "subject", "issuer"}),
+		queueLimitExceeded: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "queue_limit_exceeded",
+			Help:      "Are the configured queues truncated to 'maxQueues' (1) or not (0).",
+		}, []string{"connection", "queue_manager"}),
+		sslHandshakeDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "connection",
+			Name:      "ssl_handshake_duration_seconds",
+			Help:      "Duration of the connect (MQCONNX) including the TLS handshake of the last (re-)connect in seconds.",
+		}, []string{"connection", "queue_manager"}),
+		sslReconnectDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "connection", "ssl_reconnect_duration_seconds_total"),
+			"Total duration of the connects (MQCONNX) including the TLS handshake of all re-connects in seconds.",
+			[]string{"connection", "queue_manager"}, nil,
+		),
+	}
+}
+
+func (c *ConnectionCollector) reset() {
+	c.lastKeepaliveSuccess.Reset()
+	c.poolSize.Reset()
+	c.poolAvailable.Reset()
+	c.lastReconnect.Reset()
+	c.tlsCertExpiry.Reset()
+	c.queueLimitExceeded.Reset()
+	c.sslHandshakeDuration.Reset()
+}
+
+func (c *ConnectionCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.lastKeepaliveSuccess.Describe(ch)
+	c.poolSize.Describe(ch)
+	c.poolAvailable.Describe(ch)
+	c.lastReconnect.Describe(ch)
+	c.tlsCertExpiry.Describe(ch)
+	c.queueLimitExceeded.Describe(ch)
+	c.sslHandshakeDuration.Describe(ch)
+	ch <- c.sslReconnectDuration
+}
+
+func (c *ConnectionCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.reset()
+
+	m := c.reader.ConnectionMetrics()
+	lvs := m.Metadata.prometheusLabelValues()
+
+	if !m.LastKeepaliveSuccess.IsZero() {
+		c.lastKeepaliveSuccess.WithLabelValues(lvs...).Set(float64(m.LastKeepaliveSuccess.Unix()))
+	}
+	c.poolSize.WithLabelValues(lvs...).Set(float64(m.PoolSize))
+	c.poolAvailable.WithLabelValues(lvs...).Set(float64(m.PoolAvailable))
+	if !m.LastConnect.IsZero() {
+		c.lastReconnect.WithLabelValues(lvs...).Set(float64(m.LastConnect.Unix()))
+	}
+	for _, cert := range m.CertExpiries {
+		c.tlsCertExpiry.WithLabelValues(m.Metadata.ConnectionName, m.Metadata.QMgrName, cert.Subject, cert.Issuer).Set(float64(cert.NotAfter.Unix()))
+	}
+	c.queueLimitExceeded.WithLabelValues(m.Metadata.ConnectionName, m.Metadata.QMgrName).Set(boolToFloat64(m.QueueLimitExceeded))
+	if m.ConnectDuration > 0 {
+		c.sslHandshakeDuration.WithLabelValues(m.Metadata.ConnectionName, m.Metadata.QMgrName).Set(m.ConnectDuration.Seconds())
+	}
+
+	c.lastKeepaliveSuccess.Collect(ch)
+	c.poolSize.Collect(ch)
+	c.poolAvailable.Collect(ch)
+	c.lastReconnect.Collect(ch)
+	c.tlsCertExpiry.Collect(ch)
+	c.queueLimitExceeded.Collect(ch)
+	c.sslHandshakeDuration.Collect(ch)
+	ch <- prometheus.MustNewConstMetric(c.sslReconnectDuration, prometheus.CounterValue, m.ReconnectDurationTotal.Seconds(), m.Metadata.ConnectionName, m.Metadata.QMgrName)
+}
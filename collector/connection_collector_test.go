@@ -0,0 +1,190 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type staticConnectionMetricsReader struct {
+	value ConnectionMetrics
+}
+
+func (r staticConnectionMetricsReader) ConnectionMetrics() ConnectionMetrics {
+	return r.value
+}
+
+var connectionMetadata = ConnectionMetadata{ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+func TestConnectionCollectorKeepalive(t *testing.T) {
+
+	testcase := `# HELP mq_connection_last_keepalive_success_timestamp Unix timestamp of the last successful keepalive inquiry.
+# TYPE mq_connection_last_keepalive_success_timestamp gauge
+mq_connection_last_keepalive_success_timestamp{channel="DEV.APP.SVRCONN",connection="localhost(1414)",queue_manager="QM1"} 1.7e+09
+# HELP mq_connection_pool_available Number of available (not in use) handles of the connection pool.
+# TYPE mq_connection_pool_available gauge
+mq_connection_pool_available{channel="DEV.APP.SVRCONN",connection="localhost(1414)",queue_manager="QM1"} 1
+# HELP mq_connection_pool_size Number of handles of the connection pool.
+# TYPE mq_connection_pool_size gauge
+mq_connection_pool_size{channel="DEV.APP.SVRCONN",connection="localhost(1414)",queue_manager="QM1"} 2
+# HELP mq_connection_ssl_reconnect_duration_seconds_total Total duration of the connects (MQCONNX) including the TLS handshake of all re-connects in seconds.
+# TYPE mq_connection_ssl_reconnect_duration_seconds_total counter
+mq_connection_ssl_reconnect_duration_seconds_total{connection="localhost(1414)",queue_manager="QM1"} 0
+# HELP mq_exporter_queue_limit_exceeded Are the configured queues truncated to 'maxQueues' (1) or not (0).
+# TYPE mq_exporter_queue_limit_exceeded gauge
+mq_exporter_queue_limit_exceeded{connection="localhost(1414)",queue_manager="QM1"} 0
+# HELP mq_queue_last_reconnect_timestamp Unix timestamp of the last (re-)connect to the queue manager, which resets the queue statistics.
+# TYPE mq_queue_last_reconnect_timestamp gauge
+mq_queue_last_reconnect_timestamp{channel="DEV.APP.SVRCONN",connection="localhost(1414)",queue_manager="QM1"} 1.69e+09
+`
+
+	collector := NewConnectionCollector(logger, staticConnectionMetricsReader{
+		value: ConnectionMetrics{
+			Metadata:             connectionMetadata,
+			LastKeepaliveSuccess: time.Unix(1700000000, 0),
+			PoolSize:             2,
+			PoolAvailable:        1,
+			LastConnect:          time.Unix(1690000000, 0),
+		},
+	})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionCollectorWithoutKeepalive(t *testing.T) {
+
+	collector := NewConnectionCollector(logger, staticConnectionMetricsReader{
+		value: ConnectionMetrics{Metadata: connectionMetadata},
+	})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(""), "mq_connection_last_keepalive_success_timestamp")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionCollectorTLSCertExpiry(t *testing.T) {
+
+	testcase := `# HELP mq_connection_tls_cert_expiry_seconds Unix timestamp of the expiry (not after) of the TLS certificate.
+# TYPE mq_connection_tls_cert_expiry_seconds gauge
+mq_connection_tls_cert_expiry_seconds{connection="localhost(1414)",issuer="CN=CA",queue_manager="QM1",subject="CN=CA"} 2e+09
+mq_connection_tls_cert_expiry_seconds{connection="localhost(1414)",issuer="CN=CA",queue_manager="QM1",subject="CN=app"} 1.8e+09
+`
+
+	collector := NewConnectionCollector(logger, staticConnectionMetricsReader{
+		value: ConnectionMetrics{
+			Metadata: connectionMetadata,
+			CertExpiries: []CertExpiry{
+				{Subject: "CN=CA", Issuer: "CN=CA", NotAfter: time.Unix(2000000000, 0)},
+				{Subject: "CN=app", Issuer: "CN=CA", NotAfter: time.Unix(1800000000, 0)},
+			},
+		},
+	})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_connection_tls_cert_expiry_seconds")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionCollectorQueueLimitExceeded(t *testing.T) {
+
+	testcase := `# HELP mq_exporter_queue_limit_exceeded Are the configured queues truncated to 'maxQueues' (1) or not (0).
+# TYPE mq_exporter_queue_limit_exceeded gauge
+mq_exporter_queue_limit_exceeded{connection="localhost(1414)",queue_manager="QM1"} 1
+`
+
+	collector := NewConnectionCollector(logger, staticConnectionMetricsReader{
+		value: ConnectionMetrics{Metadata: connectionMetadata, QueueLimitExceeded: true},
+	})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_exporter_queue_limit_exceeded")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionCollectorSSLHandshakeDuration(t *testing.T) {
+
+	testcase := `# HELP mq_connection_ssl_handshake_duration_seconds Duration of the connect (MQCONNX) including the TLS handshake of the last (re-)connect in seconds.
+# TYPE mq_connection_ssl_handshake_duration_seconds gauge
+mq_connection_ssl_handshake_duration_seconds{connection="localhost(1414)",queue_manager="QM1"} 0.25
+# HELP mq_connection_ssl_reconnect_duration_seconds_total Total duration of the connects (MQCONNX) including the TLS handshake of all re-connects in seconds.
+# TYPE mq_connection_ssl_reconnect_duration_seconds_total counter
+mq_connection_ssl_reconnect_duration_seconds_total{connection="localhost(1414)",queue_manager="QM1"} 1.5
+`
+
+	collector := NewConnectionCollector(logger, staticConnectionMetricsReader{
+		value: ConnectionMetrics{
+			Metadata:               connectionMetadata,
+			ConnectDuration:        250 * time.Millisecond,
+			ReconnectDurationTotal: 1500 * time.Millisecond,
+		},
+	})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_connection_ssl_handshake_duration_seconds", "mq_connection_ssl_reconnect_duration_seconds_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the values are stable across scrapes
+	err = testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_connection_ssl_handshake_duration_seconds", "mq_connection_ssl_reconnect_duration_seconds_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionCollectorSSLReconnectDurationWithoutReconnect(t *testing.T) {
+
+	testcase := `# HELP mq_connection_ssl_reconnect_duration_seconds_total Total duration of the connects (MQCONNX) including the TLS handshake of all re-connects in seconds.
+# TYPE mq_connection_ssl_reconnect_duration_seconds_total counter
+mq_connection_ssl_reconnect_duration_seconds_total{connection="localhost(1414)",queue_manager="QM1"} 0
+`
+
+	collector := NewConnectionCollector(logger, staticConnectionMetricsReader{
+		value: ConnectionMetrics{Metadata: connectionMetadata},
+	})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_connection_ssl_handshake_duration_seconds", "mq_connection_ssl_reconnect_duration_seconds_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// QueueDepthEventReader reads the queue depth events which arrived since the
+// last read.
+type QueueDepthEventReader interface {
+	Read() ([]QueueDepthEvent, error)
+}
+
+// QueueDepthEvent is a queue depth event of a queue, which is either 'high',
+// 'low' or 'full' (max depth reached).
+type QueueDepthEvent struct {
+	QueueName string
+	EventType string
+}
+
+// DepthEventCollector counts the queue depth events, which are read in the
+// background by Run.
+type DepthEventCollector struct {
+	logger *slog.Logger
+	reader QueueDepthEventReader
+
+	events *prometheus.CounterVec
+}
+
+func NewDepthEventCollector(logger *slog.Logger, reader QueueDepthEventReader) *DepthEventCollector {
+	return &DepthEventCollector{
+		logger: logger,
+		reader: reader,
+
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "depth_event_total",
+			Help:      "Number of queue depth events by event type (high, low or full).",
+		}, []string{"queue_name", "event_type"}),
+	}
+}
+
+func (c *DepthEventCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.events.Describe(ch)
+}
+
+func (c *DepthEventCollector) Collect(ch chan<- prometheus.Metric) {
+	c.events.Collect(ch)
+}
+
+// Run reads the events in the given interval until done is closed.
+func (c *DepthEventCollector) Run(interval time.Duration, done <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.read()
+		}
+	}
+}
+
+func (c *DepthEventCollector) read() {
+
+	events, err := c.reader.Read()
+	if err != nil {
+		c.logger.Error("Failed to read queue depth events", "err", err)
+	}
+
+	for _, event := range events {
+		c.events.WithLabelValues(event.QueueName, event.EventType).Inc()
+	}
+}
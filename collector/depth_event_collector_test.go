@@ -0,0 +1,66 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type queueDepthEventReaderFunc func() ([]QueueDepthEvent, error)
+
+func (f queueDepthEventReaderFunc) Read() ([]QueueDepthEvent, error) {
+	return f()
+}
+
+func TestDepthEventCollector(t *testing.T) {
+
+	testcase := `# HELP mq_queue_depth_event_total Number of queue depth events by event type (high, low or full).
+# TYPE mq_queue_depth_event_total counter
+mq_queue_depth_event_total{event_type="full",queue_name="DEV.QUEUE.2"} 1
+mq_queue_depth_event_total{event_type="high",queue_name="DEV.QUEUE.1"} 2
+mq_queue_depth_event_total{event_type="low",queue_name="DEV.QUEUE.1"} 1
+`
+
+	reads := [][]QueueDepthEvent{
+		{{QueueName: "DEV.QUEUE.1", EventType: "high"}, {QueueName: "DEV.QUEUE.1", EventType: "low"}},
+		{{QueueName: "DEV.QUEUE.1", EventType: "high"}, {QueueName: "DEV.QUEUE.2", EventType: "full"}},
+	}
+	read := 0
+
+	collector := NewDepthEventCollector(logger, queueDepthEventReaderFunc(func() ([]QueueDepthEvent, error) {
+		if read >= len(reads) {
+			return nil, errors.New("Failed")
+		}
+		read++
+		return reads[read-1], nil
+	}))
+
+	for i := 0; i <= len(reads); i++ {
+		collector.read()
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// QueueManagerEventReader reads the events which arrived on the event queue of
+// the queue manager since the last read.
+type QueueManagerEventReader interface {
+	Read() ([]QueueManagerEvent, error)
+}
+
+// QueueManagerEvent is an event emitted by the queue manager, e.g. 'q_full'.
+type QueueManagerEvent struct {
+	QMgrName  string
+	EventType string
+}
+
+// EventCollector counts the events of the queue manager, which are read in
+// the background by Run.
+type EventCollector struct {
+	logger *slog.Logger
+	reader QueueManagerEventReader
+
+	events *prometheus.CounterVec
+}
+
+func NewEventCollector(logger *slog.Logger, reader QueueManagerEventReader) *EventCollector {
+	return &EventCollector{
+		logger: logger,
+		reader: reader,
+
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "queue_manager",
+			Name:      "event_total",
+			Help:      "Number of events emitted by the queue manager by event type.",
+		}, []string{"queue_manager", "event_type"}),
+	}
+}
+
+func (c *EventCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.events.Describe(ch)
+}
+
+func (c *EventCollector) Collect(ch chan<- prometheus.Metric) {
+	c.events.Collect(ch)
+}
+
+// Run reads the events in the given interval until done is closed.
+func (c *EventCollector) Run(interval time.Duration, done <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.read()
+		}
+	}
+}
+
+func (c *EventCollector) read() {
+
+	events, err := c.reader.Read()
+	if err != nil {
+		c.logger.Error("Failed to read queue manager events", "err", err)
+	}
+
+	for _, event := range events {
+		c.events.WithLabelValues(event.QMgrName, event.EventType).Inc()
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type queueManagerEventReaderFunc func() ([]QueueManagerEvent, error)
+
+func (f queueManagerEventReaderFunc) Read() ([]QueueManagerEvent, error) {
+	return f()
+}
+
+func TestEventCollector(t *testing.T) {
+
+	testcase := `# HELP mq_queue_manager_event_total Number of events emitted by the queue manager by event type.
+# TYPE mq_queue_manager_event_total counter
+mq_queue_manager_event_total{event_type="not_authorized",queue_manager="QM1"} 1
+mq_queue_manager_event_total{event_type="q_full",queue_manager="QM1"} 3
+`
+
+	reads := [][]QueueManagerEvent{
+		{{QMgrName: "QM1", EventType: "q_full"}, {QMgrName: "QM1", EventType: "not_authorized"}},
+		{},
+		{{QMgrName: "QM1", EventType: "q_full"}, {QMgrName: "QM1", EventType: "q_full"}},
+	}
+	read := 0
+
+	collector := NewEventCollector(logger, queueManagerEventReaderFunc(func() ([]QueueManagerEvent, error) {
+		if read >= len(reads) {
+			return nil, errors.New("Failed")
+		}
+		read++
+		return reads[read-1], nil
+	}))
+
+	for i := 0; i <= len(reads); i++ {
+		collector.read()
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// FanoutCollector routes the metrics of the queues to a registry per tenant,
+// so a tenant only sees the metrics of its own queues. Metrics which don't
+// belong to a single queue, e.g. mq_queue_open_handles_total, are not routed
+// to any tenant. The queues are collected once for the requests of all
+// tenants within DefaultFanoutSnapshotMaxAge, whose snapshot of the metrics is
+// routed to the tenants.
+type FanoutCollector struct {
+	logger     *slog.Logger
+	collector  *QueueCollector
+	route      func(QueueMetadata) string
+	registries map[string]*prometheus.Registry
+
+	// snapshot of the metrics per tenant of the last collect of the queues,
+	// which is collected again if older than maxAge.
+	mutex      sync.Mutex
+	maxAge     time.Duration
+	snapshot   map[string][]prometheus.Metric
+	snapshotAt time.Time
+	now        func() time.Time
+}
+
+// DefaultFanoutSnapshotMaxAge is the default maximum age of the snapshot of
+// the metrics which is routed to the tenants.
+const DefaultFanoutSnapshotMaxAge = 15 * time.Second
+
+// tenantCollector collects the metrics of the queues of a single tenant.
+type tenantCollector struct {
+	fanout *FanoutCollector
+	tenant string
+}
+
+func NewFanoutCollector(logger *slog.Logger, collector *QueueCollector, tenants []string, route func(QueueMetadata) string) *FanoutCollector {
+
+	f := &FanoutCollector{
+		logger:     logger,
+		collector:  collector,
+		route:      route,
+		registries: make(map[string]*prometheus.Registry),
+		maxAge:     DefaultFanoutSnapshotMaxAge,
+		now:        time.Now,
+	}
+	for _, tenant := range tenants {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(&tenantCollector{fanout: f, tenant: tenant})
+		f.registries[tenant] = reg
+	}
+	return f
+}
+
+// Registry returns the registry of the tenant.
+func (f *FanoutCollector) Registry(tenant string) (*prometheus.Registry, bool) {
+	reg, ok := f.registries[tenant]
+	return reg, ok
+}
+
+// SetSnapshotMaxAge sets the maximum age of the snapshot of the metrics which
+// is routed to the tenants, 0 collects the queues on each request.
+func (f *FanoutCollector) SetSnapshotMaxAge(maxAge time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.maxAge = maxAge
+}
+
+// Describe sends no descriptors, so the tenant collector is unchecked as the
+// metrics of a tenant depend on the queues routed to it.
+func (c *tenantCollector) Describe(chan<- *prometheus.Desc) {
+}
+
+func (c *tenantCollector) Collect(ch chan<- prometheus.Metric) {
+	c.fanout.collect(c.tenant, ch)
+}
+
+// collect sends the metrics of the queues of the snapshot which are routed to
+// the tenant.
+func (f *FanoutCollector) collect(tenant string, ch chan<- prometheus.Metric) {
+	for _, metric := range f.tenantSnapshot(tenant) {
+		ch <- metric
+	}
+}
+
+// tenantSnapshot returns the metrics of the snapshot which are routed to the
+// tenant. The queues are collected if the snapshot is older than maxAge,
+// concurrent requests wait for this collect.
+func (f *FanoutCollector) tenantSnapshot(tenant string) []prometheus.Metric {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	now := f.now()
+	if f.snapshot != nil && now.Sub(f.snapshotAt) < f.maxAge {
+		return f.snapshot[tenant]
+	}
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		f.collector.Collect(metrics)
+		close(metrics)
+	}()
+
+	snapshot := make(map[string][]prometheus.Metric)
+	for metric := range metrics {
+		metadata, ok := f.queueMetadata(metric)
+		if !ok {
+			continue
+		}
+		route := f.route(metadata)
+		if _, ok := f.registries[route]; !ok {
+			continue
+		}
+		if s, err := newSnapshotMetric(metric); err != nil {
+			f.logger.Error("Failed to snapshot metric", "err", err)
+		} else {
+			snapshot[route] = append(snapshot[route], s)
+		}
+	}
+	f.snapshot = snapshot
+	f.snapshotAt = now
+
+	return f.snapshot[tenant]
+}
+
+// queueMetadata returns the metadata of the queue of the metric by its label
+// values. It's not ok if the metric doesn't belong to a single queue.
+func (f *FanoutCollector) queueMetadata(metric prometheus.Metric) (QueueMetadata, bool) {
+
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		f.logger.Error("Failed to write metric", "err", err)
+		return QueueMetadata{}, false
+	}
+
+	labels := make(map[string]string)
+	for _, lp := range m.GetLabel() {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+
+	names := f.collector.queueLabelNames
+	queueName, ok := labels[names[0]]
+	if !ok {
+		return QueueMetadata{}, false
+	}
+	return QueueMetadata{
+		QueueName:      queueName,
+		ConnectionName: labels[names[1]],
+		QMgrName:       labels[names[2]],
+		ChannelName:    labels[names[3]],
+	}, true
+}
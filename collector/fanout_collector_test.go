@@ -0,0 +1,117 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+)
+
+func TestFanoutCollector(t *testing.T) {
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.3", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queues := []Queue{
+		q1.succeedingWith(QueueMetrics{CurrentDepth: 1}),
+		q2.succeedingWith(QueueMetrics{CurrentDepth: 2}),
+		q3.succeedingWith(QueueMetrics{CurrentDepth: 3}),
+	}
+
+	tenants := map[string]string{"DEV.QUEUE.1": "payments", "DEV.QUEUE.2": "billing"}
+	fanout := NewFanoutCollector(logger, NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil), []string{"billing", "payments"}, func(m QueueMetadata) string {
+		return tenants[m.QueueName]
+	})
+
+	tests := []struct {
+		tenant string
+		want   string
+	}{
+		{
+			tenant: "payments",
+			want: `# HELP mq_queue_current_depth Current number of messages on queue.
+# TYPE mq_queue_current_depth gauge
+mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",storage_class="",usage=""} 1
+`,
+		},
+		{
+			tenant: "billing",
+			want: `# HELP mq_queue_current_depth Current number of messages on queue.
+# TYPE mq_queue_current_depth gauge
+mq_queue_current_depth{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",storage_class="",usage=""} 2
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tenant, func(t *testing.T) {
+			reg, ok := fanout.Registry(tt.tenant)
+			if !ok {
+				t.Fatalf("Want registry of tenant '%s'.", tt.tenant)
+			}
+			if err := testutil.GatherAndCompare(reg, strings.NewReader(tt.want), "mq_queue_current_depth", "mq_queue_open_handles_total"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	if _, ok := fanout.Registry("shipping"); ok {
+		t.Error("Want no registry of unknown tenant 'shipping'.")
+	}
+}
+
+func TestFanoutCollectorCollectsQueuesOnceForAllTenants(t *testing.T) {
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	var reads atomic.Int32
+	counting := func(metadata QueueMetadata) Queue {
+		return Queue{Metadata: metadata, Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			reads.Add(1)
+			return QueueMetrics{Metadata: metadata}, nil
+		})}
+	}
+
+	tenants := map[string]string{"DEV.QUEUE.1": "payments", "DEV.QUEUE.2": "billing"}
+	fanout := NewFanoutCollector(logger, NewQueueCollector(logger, 1*time.Second, []Queue{counting(q1), counting(q2)}, DefaultLabelNames, nil), []string{"billing", "payments"}, func(m QueueMetadata) string {
+		return tenants[m.QueueName]
+	})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fanout.now = func() time.Time { return now }
+
+	gather := func(tenant string) int {
+		reg, _ := fanout.Registry(tenant)
+		count, err := testutil.GatherAndCount(reg, "mq_queue_current_depth")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	assert.Equal(t, gather("payments"), 1)
+	assert.Equal(t, gather("billing"), 1)
+	assert.Equal(t, reads.Load(), int32(2))
+
+	now = now.Add(DefaultFanoutSnapshotMaxAge)
+	assert.Equal(t, gather("billing"), 1)
+	assert.Equal(t, reads.Load(), int32(4))
+}
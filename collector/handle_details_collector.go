@@ -0,0 +1,95 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type QueueHandleDetailsReader interface {
+	Read() ([]QueueHandleDetails, error)
+}
+
+// QueueHandleDetails is the number of handles of a queue which are open for
+// exclusive and shared input.
+type QueueHandleDetails struct {
+	Metadata                QueueMetadata
+	OpenInputExclusiveCount int
+	OpenInputSharedCount    int
+}
+
+type HandleDetailsCollector struct {
+	sync.Mutex
+	logger *slog.Logger
+	reader QueueHandleDetailsReader
+
+	openInputExclusiveCount *prometheus.GaugeVec
+	openInputSharedCount    *prometheus.GaugeVec
+}
+
+func NewHandleDetailsCollector(logger *slog.Logger, reader QueueHandleDetailsReader, labelNames LabelNames) *HandleDetailsCollector {
+
+	newHandleDetailsMetric := func(name string, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      name,
+			Help:      help,
+		}, labelNames.names())
+	}
+
+	return &HandleDetailsCollector{
+		logger: logger,
+		reader: reader,
+
+		openInputExclusiveCount: newHandleDetailsMetric("open_input_exclusive_count", "Number of handles which have the queue open for exclusive input."),
+		openInputSharedCount:    newHandleDetailsMetric("open_input_shared_count", "Number of handles which have the queue open for shared input."),
+	}
+}
+
+func (c *HandleDetailsCollector) reset() {
+	c.openInputExclusiveCount.Reset()
+	c.openInputSharedCount.Reset()
+}
+
+func (c *HandleDetailsCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.openInputExclusiveCount.Describe(ch)
+	c.openInputSharedCount.Describe(ch)
+}
+
+func (c *HandleDetailsCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.reset()
+
+	details, err := c.reader.Read()
+	if err != nil {
+		c.logger.Error("Failed to read queue handle details", "err", err)
+	}
+
+	for _, d := range details {
+		lvs := d.Metadata.prometheusLabelValues()
+		c.openInputExclusiveCount.WithLabelValues(lvs...).Set(float64(d.OpenInputExclusiveCount))
+		c.openInputSharedCount.WithLabelValues(lvs...).Set(float64(d.OpenInputSharedCount))
+	}
+
+	c.openInputExclusiveCount.Collect(ch)
+	c.openInputSharedCount.Collect(ch)
+}
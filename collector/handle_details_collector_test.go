@@ -0,0 +1,95 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type queueHandleDetailsReaderFunc func() ([]QueueHandleDetails, error)
+
+func (f queueHandleDetailsReaderFunc) Read() ([]QueueHandleDetails, error) {
+	return f()
+}
+
+func TestHandleDetailsCollector(t *testing.T) {
+
+	testcase := `# HELP mq_queue_open_input_exclusive_count Number of handles which have the queue open for exclusive input.
+# TYPE mq_queue_open_input_exclusive_count gauge
+mq_queue_open_input_exclusive_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 1
+mq_queue_open_input_exclusive_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 0
+# HELP mq_queue_open_input_shared_count Number of handles which have the queue open for shared input.
+# TYPE mq_queue_open_input_shared_count gauge
+mq_queue_open_input_shared_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 0
+mq_queue_open_input_shared_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 3
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	collector := NewHandleDetailsCollector(logger, queueHandleDetailsReaderFunc(func() ([]QueueHandleDetails, error) {
+		return []QueueHandleDetails{
+			{Metadata: q1, OpenInputExclusiveCount: 1},
+			{Metadata: q2, OpenInputSharedCount: 3},
+		}, nil
+	}), DefaultLabelNames)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleDetailsCollectorWithLabelNames(t *testing.T) {
+
+	testcase := `# HELP mq_queue_open_input_exclusive_count Number of handles which have the queue open for exclusive input.
+# TYPE mq_queue_open_input_exclusive_count gauge
+mq_queue_open_input_exclusive_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",qmgr="QM1",queue_name="DEV.QUEUE.1"} 1
+`
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	labelNames := LabelNames{Name: "queue_name", Connection: "connection", QueueManager: "qmgr", Channel: "channel"}
+
+	collector := NewHandleDetailsCollector(logger, queueHandleDetailsReaderFunc(func() ([]QueueHandleDetails, error) {
+		return []QueueHandleDetails{{Metadata: metadata, OpenInputExclusiveCount: 1}}, nil
+	}), labelNames)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_open_input_exclusive_count")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleDetailsCollectorWithReadError(t *testing.T) {
+
+	collector := NewHandleDetailsCollector(logger, queueHandleDetailsReaderFunc(func() ([]QueueHandleDetails, error) {
+		return nil, errors.New("Failed")
+	}), DefaultLabelNames)
+
+	if count := testutil.CollectAndCount(collector); count != 0 {
+		t.Errorf("Should not emit metrics on read error, got %d.", count)
+	}
+}
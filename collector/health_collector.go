@@ -0,0 +1,64 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HealthCollector provides the ratio of the queues which are up as a single
+// health score of the exporter, from 0 (all queues down) to 1 (all queues
+// up). The score is the one of the last collect of the queue collector, which
+// is not collected again.
+type HealthCollector struct {
+	logger    *slog.Logger
+	collector *QueueCollector
+
+	score prometheus.Gauge
+}
+
+func NewHealthCollector(logger *slog.Logger, collector *QueueCollector) *HealthCollector {
+	return &HealthCollector{
+		logger:    logger,
+		collector: collector,
+
+		score: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "health_score",
+			Help:      "Ratio of the queues which are up from 0 (all down) to 1 (all up), 0 if there are no queues.",
+		}),
+	}
+}
+
+func (c *HealthCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.score.Describe(ch)
+}
+
+func (c *HealthCollector) Collect(ch chan<- prometheus.Metric) {
+	c.score.Set(healthScore(c.collector.Health()))
+	c.score.Collect(ch)
+}
+
+// healthScore returns the ratio of the queues which are up, which is 0 if
+// there are no queues.
+func healthScore(up, queues int) float64 {
+	if queues == 0 {
+		return 0
+	}
+	return float64(up) / float64(queues)
+}
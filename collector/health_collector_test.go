@@ -0,0 +1,90 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHealthCollector(t *testing.T) {
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	tests := []struct {
+		name   string
+		queues []Queue
+		want   string
+	}{
+		{name: "all queues up", queues: []Queue{q1.succeeding(), q2.succeeding()}, want: "1"},
+		{name: "half of the queues up", queues: []Queue{q1.succeeding(), q2.failingWith(errors.New("Failed"))}, want: "0.5"},
+		{name: "all queues down", queues: []Queue{q1.failingWith(errors.New("Failed")), q2.failingWith(errors.New("Failed"))}, want: "0"},
+		{name: "no queues", want: "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			testcase := `# HELP mq_exporter_health_score Ratio of the queues which are up from 0 (all down) to 1 (all up), 0 if there are no queues.
+# TYPE mq_exporter_health_score gauge
+mq_exporter_health_score ` + tt.want + `
+`
+			queueCollector := NewQueueCollector(logger, 1*time.Second, tt.queues, DefaultLabelNames, nil)
+			testutil.CollectAndCount(queueCollector)
+
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(NewHealthCollector(logger, queueCollector))
+
+			err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestHealthCollectorDoesNotCollectQueues(t *testing.T) {
+
+	reads := 0
+	queues := []Queue{{
+		Metadata: QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"},
+		Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			reads++
+			return QueueMetrics{}, nil
+		}),
+	}}
+	queueCollector := NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(queueCollector, NewHealthCollector(logger, queueCollector))
+
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	if reads != 1 {
+		t.Errorf("Should read the queue once per scrape, got %d reads.", reads)
+	}
+
+	// the score of the last collect before the first one is 0
+	if score := testutil.ToFloat64(NewHealthCollector(logger, NewQueueCollector(logger, 1*time.Second, queues, DefaultLabelNames, nil))); score != 0 {
+		t.Errorf("Should have score 0 before the first collect, got %f.", score)
+	}
+}
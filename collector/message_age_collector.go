@@ -0,0 +1,109 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultMessageAgeBuckets are the buckets (in seconds) of the histogram of
+// the ages of the browsed messages.
+var DefaultMessageAgeBuckets = []float64{1, 10, 60, 300, 900, 3600, 21600, 86400}
+
+// MessageAgeReader reads the ages of the first messages of the queues by
+// browsing them.
+type MessageAgeReader interface {
+	Read() ([]QueueMessageAges, error)
+}
+
+// QueueMessageAges are the ages of the first messages on a queue and the
+// priority of the first one, which is 0 if the queue is empty.
+type QueueMessageAges struct {
+	Metadata              QueueMetadata
+	Ages                  []time.Duration
+	OldestMessagePriority int32
+}
+
+type MessageAgeCollector struct {
+	sync.Mutex
+	logger *slog.Logger
+	reader MessageAgeReader
+
+	messageAge            *prometheus.HistogramVec
+	oldestMessagePriority *prometheus.GaugeVec
+}
+
+func NewMessageAgeCollector(logger *slog.Logger, reader MessageAgeReader, labelNames LabelNames) *MessageAgeCollector {
+	return &MessageAgeCollector{
+		logger: logger,
+		reader: reader,
+
+		messageAge: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "message_age_seconds",
+			Help:      "Ages of the first messages on the queue in seconds, which are browsed on each scrape.",
+			Buckets:   DefaultMessageAgeBuckets,
+		}, labelNames.names()),
+
+		oldestMessagePriority: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "oldest_message_priority",
+			Help:      "Priority of the first browsed message on the queue, 0 if the queue is empty.",
+		}, labelNames.names()),
+	}
+}
+
+func (c *MessageAgeCollector) reset() {
+	c.messageAge.Reset()
+	c.oldestMessagePriority.Reset()
+}
+
+func (c *MessageAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.messageAge.Describe(ch)
+	c.oldestMessagePriority.Describe(ch)
+}
+
+// Collect provides the ages of the messages on the queues at the time of the
+// scrape, the observations of the previous scrapes are discarded.
+func (c *MessageAgeCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.reset()
+
+	queues, err := c.reader.Read()
+	if err != nil {
+		c.logger.Error("Failed to browse messages of queues", "err", err)
+	}
+
+	for _, q := range queues {
+		lvs := q.Metadata.prometheusLabelValues()
+		histogram := c.messageAge.WithLabelValues(lvs...)
+		for _, age := range q.Ages {
+			histogram.Observe(age.Seconds())
+		}
+		c.oldestMessagePriority.WithLabelValues(lvs...).Set(float64(q.OldestMessagePriority))
+	}
+
+	c.messageAge.Collect(ch)
+	c.oldestMessagePriority.Collect(ch)
+}
@@ -0,0 +1,132 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type messageAgeReaderFunc func() ([]QueueMessageAges, error)
+
+func (f messageAgeReaderFunc) Read() ([]QueueMessageAges, error) {
+	return f()
+}
+
+func TestMessageAgeCollector(t *testing.T) {
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	reads := [][]QueueMessageAges{
+		{{Metadata: q1, Ages: []time.Duration{5 * time.Second, 2 * time.Minute}, OldestMessagePriority: 4}, {Metadata: q2, Ages: []time.Duration{}}},
+		{{Metadata: q1, Ages: []time.Duration{2 * time.Hour}, OldestMessagePriority: 9}},
+	}
+	read := 0
+
+	collector := NewMessageAgeCollector(logger, messageAgeReaderFunc(func() ([]QueueMessageAges, error) {
+		read++
+		if read == len(reads) {
+			return reads[read-1], errors.New("Failed to browse DEV.QUEUE.2")
+		}
+		return reads[read-1], nil
+	}), DefaultLabelNames)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	testcases := []string{`# HELP mq_queue_message_age_seconds Ages of the first messages on the queue in seconds, which are browsed on each scrape.
+# TYPE mq_queue_message_age_seconds histogram
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="1"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="10"} 1
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="60"} 1
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="300"} 2
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="900"} 2
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="3600"} 2
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="21600"} 2
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="86400"} 2
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="+Inf"} 2
+mq_queue_message_age_seconds_sum{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 125
+mq_queue_message_age_seconds_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 2
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",le="1"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",le="10"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",le="60"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",le="300"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",le="900"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",le="3600"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",le="21600"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",le="86400"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1",le="+Inf"} 0
+mq_queue_message_age_seconds_sum{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 0
+mq_queue_message_age_seconds_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 0
+# HELP mq_queue_oldest_message_priority Priority of the first browsed message on the queue, 0 if the queue is empty.
+# TYPE mq_queue_oldest_message_priority gauge
+mq_queue_oldest_message_priority{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 4
+mq_queue_oldest_message_priority{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 0
+`,
+		// the ages of the previous scrape are discarded, the queues which
+		// failed to browse are omitted
+		`# HELP mq_queue_message_age_seconds Ages of the first messages on the queue in seconds, which are browsed on each scrape.
+# TYPE mq_queue_message_age_seconds histogram
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="1"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="10"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="60"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="300"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="900"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="3600"} 0
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="21600"} 1
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="86400"} 1
+mq_queue_message_age_seconds_bucket{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1",le="+Inf"} 1
+mq_queue_message_age_seconds_sum{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 7200
+mq_queue_message_age_seconds_count{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 1
+# HELP mq_queue_oldest_message_priority Priority of the first browsed message on the queue, 0 if the queue is empty.
+# TYPE mq_queue_oldest_message_priority gauge
+mq_queue_oldest_message_priority{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 9
+`}
+
+	for i, testcase := range testcases {
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(testcase)); err != nil {
+			t.Fatalf("scrape %d: %s", i, err)
+		}
+	}
+}
+
+func TestMessageAgeCollectorWithLabelNames(t *testing.T) {
+
+	testcase := `# HELP mq_queue_oldest_message_priority Priority of the first browsed message on the queue, 0 if the queue is empty.
+# TYPE mq_queue_oldest_message_priority gauge
+mq_queue_oldest_message_priority{channel="DEV.APP.SVRCONN",connection="localhost(1414)",qmgr="QM1",queue_name="DEV.QUEUE.1"} 4
+`
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	labelNames := LabelNames{Name: "queue_name", Connection: "connection", QueueManager: "qmgr", Channel: "channel"}
+
+	collector := NewMessageAgeCollector(logger, messageAgeReaderFunc(func() ([]QueueMessageAges, error) {
+		return []QueueMessageAges{{Metadata: metadata, Ages: []time.Duration{5 * time.Second}, OldestMessagePriority: 4}}, nil
+	}), labelNames)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_oldest_message_priority")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
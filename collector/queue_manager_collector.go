@@ -0,0 +1,104 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type QueueManagerMetricsReader interface {
+	Read() (QueueManagerMetrics, error)
+}
+
+// QueueManagerMetrics are the attributes of the queue manager, which are
+// inquired once per scrape.
+type QueueManagerMetrics struct {
+	Metadata     ConnectionMetadata
+	MaxHandles   int32
+	InhibitEvent bool
+
+	// DefaultTransmitQueue and ClusterWorkloadExit are empty if not set.
+	DefaultTransmitQueue string
+	ClusterWorkloadExit  string
+}
+
+type QueueManagerCollector struct {
+	sync.Mutex
+	logger *slog.Logger
+	reader QueueManagerMetricsReader
+
+	maxHandles   *prometheus.GaugeVec
+	inhibitEvent *prometheus.GaugeVec
+	info         *prometheus.GaugeVec
+}
+
+func NewQueueManagerCollector(logger *slog.Logger, reader QueueManagerMetricsReader, labelNames LabelNames) *QueueManagerCollector {
+
+	newQueueManagerMetric := func(name string, help string, labels ...string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "queue_manager",
+			Name:      name,
+			Help:      help,
+		}, append([]string{labelNames.Connection, labelNames.QueueManager}, labels...))
+	}
+
+	return &QueueManagerCollector{
+		logger: logger,
+		reader: reader,
+
+		maxHandles:   newQueueManagerMetric("max_handles", "Maximum number of open handles that any one connection can have at the same time."),
+		inhibitEvent: newQueueManagerMetric("inhibit_event", "Are inhibit (get and put) events enabled (1) or not (0)."),
+		info:         newQueueManagerMetric("info", "Information about the queue manager.", "default_transmit_queue", "cluster_workload_exit"),
+	}
+}
+
+func (c *QueueManagerCollector) reset() {
+	c.maxHandles.Reset()
+	c.inhibitEvent.Reset()
+	c.info.Reset()
+}
+
+func (c *QueueManagerCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.maxHandles.Describe(ch)
+	c.inhibitEvent.Describe(ch)
+	c.info.Describe(ch)
+}
+
+func (c *QueueManagerCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.reset()
+
+	m, err := c.reader.Read()
+	if err != nil {
+		c.logger.Error("Failed to read queue manager", "err", err)
+		return
+	}
+
+	lvs := []string{m.Metadata.ConnectionName, m.Metadata.QMgrName}
+	c.maxHandles.WithLabelValues(lvs...).Set(float64(m.MaxHandles))
+	c.inhibitEvent.WithLabelValues(lvs...).Set(boolToFloat64(m.InhibitEvent))
+	c.info.WithLabelValues(append(lvs, m.DefaultTransmitQueue, m.ClusterWorkloadExit)...).Set(1)
+
+	c.maxHandles.Collect(ch)
+	c.inhibitEvent.Collect(ch)
+	c.info.Collect(ch)
+}
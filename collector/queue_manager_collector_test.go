@@ -0,0 +1,99 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type queueManagerMetricsReaderFunc func() (QueueManagerMetrics, error)
+
+func (f queueManagerMetricsReaderFunc) Read() (QueueManagerMetrics, error) {
+	return f()
+}
+
+func TestQueueManagerCollector(t *testing.T) {
+
+	testcase := `# HELP mq_queue_manager_inhibit_event Are inhibit (get and put) events enabled (1) or not (0).
+# TYPE mq_queue_manager_inhibit_event gauge
+mq_queue_manager_inhibit_event{connection="localhost(1414)",queue_manager="QM1"} 1
+# HELP mq_queue_manager_info Information about the queue manager.
+# TYPE mq_queue_manager_info gauge
+mq_queue_manager_info{cluster_workload_exit="/var/mqm/exits/clwl(ClwlExit)",connection="localhost(1414)",default_transmit_queue="SYSTEM.CLUSTER.TRANSMIT.QUEUE",queue_manager="QM1"} 1
+# HELP mq_queue_manager_max_handles Maximum number of open handles that any one connection can have at the same time.
+# TYPE mq_queue_manager_max_handles gauge
+mq_queue_manager_max_handles{connection="localhost(1414)",queue_manager="QM1"} 256
+`
+
+	reads := 0
+	collector := NewQueueManagerCollector(logger, queueManagerMetricsReaderFunc(func() (QueueManagerMetrics, error) {
+		reads++
+		return QueueManagerMetrics{
+			Metadata:             connectionMetadata,
+			MaxHandles:           256,
+			InhibitEvent:         true,
+			DefaultTransmitQueue: "SYSTEM.CLUSTER.TRANSMIT.QUEUE",
+			ClusterWorkloadExit:  "/var/mqm/exits/clwl(ClwlExit)",
+		}, nil
+	}), DefaultLabelNames)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reads != 1 {
+		t.Errorf("Should read the queue manager once per scrape, got %d reads.", reads)
+	}
+}
+
+func TestQueueManagerCollectorWithLabelNames(t *testing.T) {
+
+	testcase := `# HELP mq_queue_manager_max_handles Maximum number of open handles that any one connection can have at the same time.
+# TYPE mq_queue_manager_max_handles gauge
+mq_queue_manager_max_handles{connection="localhost(1414)",qmgr="QM1"} 256
+`
+
+	labelNames := LabelNames{Name: "queue_name", Connection: "connection", QueueManager: "qmgr", Channel: "channel"}
+	collector := NewQueueManagerCollector(logger, queueManagerMetricsReaderFunc(func() (QueueManagerMetrics, error) {
+		return QueueManagerMetrics{Metadata: connectionMetadata, MaxHandles: 256}, nil
+	}), labelNames)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_manager_max_handles")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueueManagerCollectorWithReadError(t *testing.T) {
+
+	collector := NewQueueManagerCollector(logger, queueManagerMetricsReaderFunc(func() (QueueManagerMetrics, error) {
+		return QueueManagerMetrics{}, errors.New("Failed")
+	}), DefaultLabelNames)
+
+	if count := testutil.CollectAndCount(collector); count != 0 {
+		t.Errorf("Should not emit metrics on read error, got %d.", count)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type QueueStatisticsReader interface {
+	Read() ([]QueueStatistics, error)
+}
+
+// QueueStatistics are the number of messages put to and got from a queue
+// since the last reset of its statistics.
+type QueueStatistics struct {
+	Metadata QueueMetadata
+	PutCount int32
+	GetCount int32
+}
+
+// QueueStatisticsCollector reads and resets the statistics of the queues once
+// per collect. The reset is destructive, so the collector must be the only
+// reader of the statistics, i.e. it's only registered for the scrape of all
+// metrics.
+type QueueStatisticsCollector struct {
+	sync.Mutex
+	logger *slog.Logger
+	reader QueueStatisticsReader
+
+	putCountSinceReset *prometheus.GaugeVec
+	getCountSinceReset *prometheus.GaugeVec
+}
+
+func NewQueueStatisticsCollector(logger *slog.Logger, reader QueueStatisticsReader, labelNames LabelNames) *QueueStatisticsCollector {
+
+	newStatisticsMetric := func(name string, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      name,
+			Help:      help,
+		}, labelNames.names())
+	}
+
+	return &QueueStatisticsCollector{
+		logger: logger,
+		reader: reader,
+
+		putCountSinceReset: newStatisticsMetric("put_count_since_reset", "Number of messages put to queue since the last reset of queue statistics."),
+		getCountSinceReset: newStatisticsMetric("get_count_since_reset", "Number of messages got from queue since the last reset of queue statistics."),
+	}
+}
+
+func (c *QueueStatisticsCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.putCountSinceReset.Describe(ch)
+	c.getCountSinceReset.Describe(ch)
+}
+
+func (c *QueueStatisticsCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.putCountSinceReset.Reset()
+	c.getCountSinceReset.Reset()
+
+	statistics, err := c.reader.Read()
+	if err != nil {
+		c.logger.Error("Failed to reset queue statistics", "err", err)
+	}
+
+	for _, s := range statistics {
+		lvs := s.Metadata.prometheusLabelValues()
+		c.putCountSinceReset.WithLabelValues(lvs...).Set(float64(s.PutCount))
+		c.getCountSinceReset.WithLabelValues(lvs...).Set(float64(s.GetCount))
+	}
+
+	c.putCountSinceReset.Collect(ch)
+	c.getCountSinceReset.Collect(ch)
+}
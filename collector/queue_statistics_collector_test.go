@@ -0,0 +1,89 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type queueStatisticsReaderFunc func() ([]QueueStatistics, error)
+
+func (f queueStatisticsReaderFunc) Read() ([]QueueStatistics, error) {
+	return f()
+}
+
+func TestQueueStatisticsCollector(t *testing.T) {
+
+	testcase := `# HELP mq_queue_get_count_since_reset Number of messages got from queue since the last reset of queue statistics.
+# TYPE mq_queue_get_count_since_reset gauge
+mq_queue_get_count_since_reset{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 38
+mq_queue_get_count_since_reset{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 0
+# HELP mq_queue_put_count_since_reset Number of messages put to queue since the last reset of queue statistics.
+# TYPE mq_queue_put_count_since_reset gauge
+mq_queue_put_count_since_reset{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 42
+mq_queue_put_count_since_reset{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 0
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	reads := 0
+	collector := NewQueueStatisticsCollector(logger, queueStatisticsReaderFunc(func() ([]QueueStatistics, error) {
+		reads++
+		return []QueueStatistics{
+			{Metadata: q1, PutCount: 42, GetCount: 38},
+			{Metadata: q2},
+		}, nil
+	}), DefaultLabelNames)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reads != 1 {
+		t.Errorf("Should reset the queue statistics once per scrape, got %d resets.", reads)
+	}
+}
+
+func TestQueueStatisticsCollectorWithReadError(t *testing.T) {
+
+	testcase := `# HELP mq_queue_put_count_since_reset Number of messages put to queue since the last reset of queue statistics.
+# TYPE mq_queue_put_count_since_reset gauge
+mq_queue_put_count_since_reset{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 42
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	// the statistics of the queues which were reset are provided
+	collector := NewQueueStatisticsCollector(logger, queueStatisticsReaderFunc(func() ([]QueueStatistics, error) {
+		return []QueueStatistics{{Metadata: q1, PutCount: 42}}, errors.New("Failed")
+	}), DefaultLabelNames)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase), "mq_queue_put_count_since_reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
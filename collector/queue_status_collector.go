@@ -0,0 +1,95 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type QueueDepthStatusReader interface {
+	Read() ([]QueueDepthStatus, error)
+}
+
+// QueueDepthStatus is the current and the max depth of a queue.
+type QueueDepthStatus struct {
+	Metadata     QueueMetadata
+	CurrentDepth int32
+	MaxDepth     int32
+}
+
+// full reports whether the max depth of the queue is reached, so puts to the
+// queue are blocked.
+func (s QueueDepthStatus) full() bool {
+	return s.MaxDepth > 0 && s.CurrentDepth >= s.MaxDepth
+}
+
+// QueueStatusCollector counts the times the queues became full, which are
+// detected by the queue depth reaching the max depth between two reads like
+// a queue depth max event.
+type QueueStatusCollector struct {
+	sync.Mutex
+	logger *slog.Logger
+	reader QueueDepthStatusReader
+
+	// full are the queues which were full on the last read keyed by
+	// QueueMetadata.key.
+	full map[string]bool
+
+	putBlocked *prometheus.CounterVec
+}
+
+func NewQueueStatusCollector(logger *slog.Logger, reader QueueDepthStatusReader, labelNames LabelNames) *QueueStatusCollector {
+	return &QueueStatusCollector{
+		logger: logger,
+		reader: reader,
+		full:   make(map[string]bool),
+
+		putBlocked: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "put_blocked_total",
+			Help:      "Number of times the current number of messages on queue reached the maximum, so puts to the queue were blocked.",
+		}, labelNames.names()),
+	}
+}
+
+func (c *QueueStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.putBlocked.Describe(ch)
+}
+
+func (c *QueueStatusCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	statuses, err := c.reader.Read()
+	if err != nil {
+		c.logger.Error("Failed to read queue depth status", "err", err)
+	}
+
+	for _, s := range statuses {
+		counter := c.putBlocked.WithLabelValues(s.Metadata.prometheusLabelValues()...)
+		key := s.Metadata.key()
+		if s.full() && !c.full[key] {
+			counter.Inc()
+		}
+		c.full[key] = s.full()
+	}
+
+	c.putBlocked.Collect(ch)
+}
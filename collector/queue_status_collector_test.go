@@ -0,0 +1,102 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type queueDepthStatusReaderFunc func() ([]QueueDepthStatus, error)
+
+func (f queueDepthStatusReaderFunc) Read() ([]QueueDepthStatus, error) {
+	return f()
+}
+
+func TestQueueStatusCollectorPutBlocked(t *testing.T) {
+
+	testcase := `# HELP mq_queue_put_blocked_total Number of times the current number of messages on queue reached the maximum, so puts to the queue were blocked.
+# TYPE mq_queue_put_blocked_total counter
+mq_queue_put_blocked_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.1",queue_manager="QM1"} 2
+mq_queue_put_blocked_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",name="DEV.QUEUE.2",queue_manager="QM1"} 0
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	// DEV.QUEUE.1 becomes full twice, DEV.QUEUE.2 has no max depth
+	depths := []int32{5000, 5000, 4999, 5000}
+	read := 0
+	collector := NewQueueStatusCollector(logger, queueDepthStatusReaderFunc(func() ([]QueueDepthStatus, error) {
+		depth := depths[read]
+		read++
+		return []QueueDepthStatus{
+			{Metadata: q1, CurrentDepth: depth, MaxDepth: 5000},
+			{Metadata: q2, CurrentDepth: 10},
+		}, nil
+	}), DefaultLabelNames)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	for range len(depths) - 1 {
+		if _, err := reg.Gather(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueueStatusCollectorWithLabelNames(t *testing.T) {
+
+	testcase := `# HELP mq_queue_put_blocked_total Number of times the current number of messages on queue reached the maximum, so puts to the queue were blocked.
+# TYPE mq_queue_put_blocked_total counter
+mq_queue_put_blocked_total{channel="DEV.APP.SVRCONN",connection="localhost(1414)",qmgr="QM1",queue_name="DEV.QUEUE.1"} 1
+`
+
+	metadata := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	labelNames := LabelNames{Name: "queue_name", Connection: "connection", QueueManager: "qmgr", Channel: "channel"}
+
+	collector := NewQueueStatusCollector(logger, queueDepthStatusReaderFunc(func() ([]QueueDepthStatus, error) {
+		return []QueueDepthStatus{{Metadata: metadata, CurrentDepth: 5000, MaxDepth: 5000}}, nil
+	}), labelNames)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(testcase))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueueStatusCollectorWithReadError(t *testing.T) {
+
+	collector := NewQueueStatusCollector(logger, queueDepthStatusReaderFunc(func() ([]QueueDepthStatus, error) {
+		return nil, errors.New("Failed")
+	}), DefaultLabelNames)
+
+	if count := testutil.CollectAndCount(collector); count != 0 {
+		t.Errorf("Should not emit metrics on read error, got %d.", count)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// recordingRuleExpr is the subset of PromQL supported by recording rules: an
+// aggregation by labels of a single metric, e.g.
+// 'sum by (queue_manager) (mq_queue_current_depth)'.
+var recordingRuleExpr = regexp.MustCompile(`^\s*(sum|max)\s+by\s*\(([^()]*)\)\s*\(\s*([a-zA-Z_:][a-zA-Z0-9_:]*)\s*\)\s*$`)
+
+// RecordingRule aggregates a queue metric by labels to a new metric, which is
+// provided with the constant labels of the rule.
+type RecordingRule struct {
+	Name        string
+	Aggregation string
+	By          []string
+	Metric      string
+	Labels      map[string]string
+}
+
+// ParseRecordingRule parses the expression of a recording rule, which is
+// either 'sum by (labels) (metric)' or 'max by (labels) (metric)' of a queue
+// metric.
+func ParseRecordingRule(name string, expr string, labels map[string]string) (RecordingRule, error) {
+
+	if !model.IsValidMetricName(model.LabelValue(name)) {
+		return RecordingRule{}, fmt.Errorf("invalid name '%s' of recording rule", name)
+	}
+
+	match := recordingRuleExpr.FindStringSubmatch(expr)
+	if match == nil {
+		return RecordingRule{}, fmt.Errorf("unsupported expression '%s' of recording rule '%s'", expr, name)
+	}
+
+	metric := match[3]
+	if !slices.Contains(QueueMetricNames(), strings.TrimPrefix(metric, namespace+"_")) {
+		return RecordingRule{}, fmt.Errorf("unknown metric '%s' of recording rule '%s'", metric, name)
+	}
+
+	by := make([]string, 0)
+	for _, label := range strings.Split(match[2], ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		if !model.LabelName(label).IsValid() || slices.Contains(by, label) {
+			return RecordingRule{}, fmt.Errorf("invalid label '%s' of recording rule '%s'", label, name)
+		}
+		by = append(by, label)
+	}
+	for label := range labels {
+		if !model.LabelName(label).IsValid() || slices.Contains(by, label) {
+			return RecordingRule{}, fmt.Errorf("invalid label '%s' of recording rule '%s'", label, name)
+		}
+	}
+
+	return RecordingRule{Name: name, Aggregation: match[1], By: by, Metric: metric, Labels: labels}, nil
+}
+
+func (r RecordingRule) help() string {
+	return fmt.Sprintf("Recording rule %s by (%s) (%s).", r.Aggregation, strings.Join(r.By, ", "), r.Metric)
+}
+
+// RecordingGatherer provides the recording rules evaluated in-process on the
+// metrics of the wrapped gatherer, e.g. for deployments without Prometheus.
+// The rules are evaluated on the gathered metrics, so the queues are not
+// collected again.
+type RecordingGatherer struct {
+	logger   *slog.Logger
+	gatherer prometheus.Gatherer
+	rules    []RecordingRule
+	descs    []*prometheus.Desc
+}
+
+// NewRecordingGatherer returns the gatherer of the recording rules, whose
+// names must be unique.
+func NewRecordingGatherer(logger *slog.Logger, gatherer prometheus.Gatherer, rules []RecordingRule) (*RecordingGatherer, error) {
+
+	seen := make(map[string]bool)
+	descs := make([]*prometheus.Desc, 0, len(rules))
+	for _, rule := range rules {
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("duplicate recording rule '%s'", rule.Name)
+		}
+		if slices.Contains(QueueMetricNames(), strings.TrimPrefix(rule.Name, namespace+"_")) {
+			return nil, fmt.Errorf("recording rule '%s' has the name of a queue metric", rule.Name)
+		}
+		seen[rule.Name] = true
+
+		descs = append(descs, prometheus.NewDesc(rule.Name, rule.help(), rule.By, rule.Labels))
+	}
+
+	return &RecordingGatherer{
+		logger:   logger,
+		gatherer: gatherer,
+		rules:    rules,
+		descs:    descs,
+	}, nil
+}
+
+// Gather gathers the metrics of the wrapped gatherer and adds the metrics of
+// the recording rules. A rule whose name is the one of a gathered metric is
+// skipped.
+func (g *RecordingGatherer) Gather() ([]*dto.MetricFamily, error) {
+
+	families, err := g.gatherer.Gather()
+
+	byName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+
+	for i, rule := range g.rules {
+		if _, ok := byName[rule.Name]; ok {
+			g.logger.Error("Recording rule is skipped as its name is the one of a metric", "rule", rule.Name)
+			continue
+		}
+		family, ok := byName[rule.Metric]
+		if !ok {
+			continue
+		}
+
+		recorded := &dto.MetricFamily{
+			Name: proto.String(rule.Name),
+			Help: proto.String(rule.help()),
+			Type: dto.MetricType_GAUGE.Enum(),
+		}
+		for _, group := range evaluate(rule, family.GetMetric()) {
+			var m dto.Metric
+			if err := prometheus.MustNewConstMetric(g.descs[i], prometheus.GaugeValue, group.value, group.labelValues...).Write(&m); err != nil {
+				g.logger.Error("Failed to write metric of recording rule", "err", err, "rule", rule.Name)
+				continue
+			}
+			recorded.Metric = append(recorded.Metric, &m)
+		}
+		if len(recorded.Metric) > 0 {
+			families = append(families, recorded)
+		}
+	}
+
+	slices.SortFunc(families, func(a, b *dto.MetricFamily) int {
+		return strings.Compare(a.GetName(), b.GetName())
+	})
+	return families, err
+}
+
+type recordedGroup struct {
+	labelValues []string
+	value       float64
+}
+
+// evaluate aggregates the metrics by the label values of the rule in order of
+// their first occurrence. A missing label has the empty value.
+func evaluate(rule RecordingRule, metrics []*dto.Metric) []recordedGroup {
+
+	groups := make([]recordedGroup, 0)
+	index := make(map[string]int)
+
+	for _, m := range metrics {
+		labels := make(map[string]string)
+		for _, lp := range m.GetLabel() {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		lvs := make([]string, 0, len(rule.By))
+		for _, name := range rule.By {
+			lvs = append(lvs, labels[name])
+		}
+		value := metricValue(m)
+
+		key := strings.Join(lvs, "\xff")
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(groups)
+			groups = append(groups, recordedGroup{labelValues: lvs, value: value})
+			continue
+		}
+		switch rule.Aggregation {
+		case "sum":
+			groups[i].value += value
+		case "max":
+			groups[i].value = math.Max(groups[i].value, value)
+		}
+	}
+	return groups
+}
+
+// metricValue returns the value of a gauge, counter or untyped metric.
+func metricValue(m *dto.Metric) float64 {
+	switch {
+	case m.Gauge != nil:
+		return m.GetGauge().GetValue()
+	case m.Counter != nil:
+		return m.GetCounter().GetValue()
+	default:
+		return m.GetUntyped().GetValue()
+	}
+}
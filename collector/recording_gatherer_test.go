@@ -0,0 +1,117 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+)
+
+func TestRecordingGatherer(t *testing.T) {
+
+	testcase := `# HELP mq:queue_current_depth:max Recording rule max by (queue_manager) (mq_queue_current_depth).
+# TYPE mq:queue_current_depth:max gauge
+mq:queue_current_depth:max{queue_manager="QM1"} 5
+mq:queue_current_depth:max{queue_manager="QM2"} 7
+# HELP mq:queue_current_depth:sum Recording rule sum by (queue_manager) (mq_queue_current_depth).
+# TYPE mq:queue_current_depth:sum gauge
+mq:queue_current_depth:sum{env="dev",queue_manager="QM1"} 8
+mq:queue_current_depth:sum{env="dev",queue_manager="QM2"} 7
+`
+
+	q1 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q3 := QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1415)", QMgrName: "QM2", ChannelName: "DEV.APP.SVRCONN"}
+
+	var reads atomic.Int32
+	counting := func(metadata QueueMetadata, metrics QueueMetrics) Queue {
+		metrics.Metadata = metadata
+		return Queue{Metadata: metadata, Reader: queueMetricReaderFunc(func() (QueueMetrics, error) {
+			reads.Add(1)
+			return metrics, nil
+		})}
+	}
+
+	queueCollector := NewQueueCollector(logger, 1*time.Second, []Queue{
+		counting(q1, QueueMetrics{CurrentDepth: 3}),
+		counting(q2, QueueMetrics{CurrentDepth: 5}),
+		counting(q3, QueueMetrics{CurrentDepth: 7}),
+	}, DefaultLabelNames, nil)
+
+	sumRule, err := ParseRecordingRule("mq:queue_current_depth:sum", "sum by (queue_manager) (mq_queue_current_depth)", map[string]string{"env": "dev"})
+	assert.NilError(t, err)
+	maxRule, err := ParseRecordingRule("mq:queue_current_depth:max", "max by(queue_manager)(mq_queue_current_depth)", nil)
+	assert.NilError(t, err)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(queueCollector)
+	gatherer, err := NewRecordingGatherer(logger, reg, []RecordingRule{sumRule, maxRule})
+	assert.NilError(t, err)
+
+	err = testutil.GatherAndCompare(gatherer, strings.NewReader(testcase), sumRule.Name, maxRule.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, reads.Load(), int32(3))
+}
+
+func TestRecordingGathererRejectsRuleNames(t *testing.T) {
+
+	rule, err := ParseRecordingRule("mq:queue_current_depth:sum", "sum by (queue_manager) (mq_queue_current_depth)", nil)
+	assert.NilError(t, err)
+	_, err = NewRecordingGatherer(logger, prometheus.NewRegistry(), []RecordingRule{rule, rule})
+	assert.Error(t, err, "duplicate recording rule 'mq:queue_current_depth:sum'")
+
+	rule, err = ParseRecordingRule("mq_queue_max_depth", "sum by (queue_manager) (mq_queue_current_depth)", nil)
+	assert.NilError(t, err)
+	_, err = NewRecordingGatherer(logger, prometheus.NewRegistry(), []RecordingRule{rule})
+	assert.Error(t, err, "recording rule 'mq_queue_max_depth' has the name of a queue metric")
+}
+
+func TestParseRecordingRule(t *testing.T) {
+
+	tests := []struct {
+		name string
+		expr string
+		want RecordingRule
+		err  string
+	}{
+		{name: "sum", expr: "sum by (queue_manager, name) (mq_queue_current_depth)", want: RecordingRule{Name: "sum", Aggregation: "sum", By: []string{"queue_manager", "name"}, Metric: "mq_queue_current_depth"}},
+		{name: "max", expr: " max by () ( mq_queue_max_depth ) ", want: RecordingRule{Name: "max", Aggregation: "max", By: []string{}, Metric: "mq_queue_max_depth"}},
+		{name: "invalid name", expr: "sum by (name) (mq_queue_current_depth)", err: "invalid name 'invalid name' of recording rule"},
+		{name: "avg", expr: "avg by (name) (mq_queue_current_depth)", err: "unsupported expression 'avg by (name) (mq_queue_current_depth)' of recording rule 'avg'"},
+		{name: "without", expr: "sum without (name) (mq_queue_current_depth)", err: "unsupported expression 'sum without (name) (mq_queue_current_depth)' of recording rule 'without'"},
+		{name: "unknown", expr: "sum by (name) (up)", err: "unknown metric 'up' of recording rule 'unknown'"},
+		{name: "label", expr: "sum by (name, name) (mq_queue_current_depth)", err: "invalid label 'name' of recording rule 'label'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRecordingRule(tt.name, tt.expr, nil)
+			if tt.err != "" {
+				assert.Error(t, err, tt.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// snapshotMetric is the immutable copy of a metric at the time of a collect,
+// e.g. of a counter which is increased later on.
+type snapshotMetric struct {
+	desc   *prometheus.Desc
+	metric *dto.Metric
+}
+
+func newSnapshotMetric(metric prometheus.Metric) (*snapshotMetric, error) {
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		return nil, err
+	}
+	return &snapshotMetric{desc: metric.Desc(), metric: &m}, nil
+}
+
+func (m *snapshotMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *snapshotMetric) Write(out *dto.Metric) error {
+	proto.Reset(out)
+	proto.Merge(out, m.metric)
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/agebhar1/mq_exporter/collector"
+	"github.com/ibm-messaging/mq-golang/v5/ibmmq"
+)
+
+// messageBrowser gets the messages of an opened queue, e.g. ibmmq.MQObject.
+type messageBrowser interface {
+	Get(md *ibmmq.MQMD, gmo *ibmmq.MQGMO, buffer []byte) (int, error)
+}
+
+// MessageAgeReader reads the ages of the first messages of the queues by
+// browsing them, so the messages are not consumed.
+type MessageAgeReader struct {
+	connection  *MqConnection
+	logger      *slog.Logger
+	maxMessages int
+}
+
+func (c *MqConnection) MessageAgeReader(maxMessages int) *MessageAgeReader {
+	return &MessageAgeReader{connection: c, logger: c.logger, maxMessages: maxMessages}
+}
+
+// Read returns the ages of the first messages of the queues and the priority
+// of the first one. The queues which failed to browse are omitted.
+func (r *MessageAgeReader) Read() ([]collector.QueueMessageAges, error) {
+
+	queues := make([]collector.QueueMessageAges, 0)
+	var errs []error
+
+	for _, queue := range r.connection.limitedQueues() {
+		ages, priority, err := r.connection.browseMessageAges(queue.Name, r.maxMessages, time.Now())
+		if err != nil {
+			r.logger.Error("error browse queue", "err", err, "queue", queue.Name)
+			errs = append(errs, err)
+			continue
+		}
+		queues = append(queues, collector.QueueMessageAges{
+			Metadata: collector.QueueMetadata{
+				QueueName:      r.connection.cfg.queueAlias(queue.Name),
+				ConnectionName: r.connection.cfg.connectionName(),
+				QMgrName:       r.connection.cfg.QueueManager,
+				ChannelName:    r.connection.cfg.Channel,
+			},
+			Ages:                  ages,
+			OldestMessagePriority: priority,
+		})
+	}
+
+	return queues, errors.Join(errs...)
+}
+
+func (c *MqConnection) browseMessageAges(name string, maxMessages int, now time.Time) ([]time.Duration, int32, error) {
+
+	c.pcfMutex.Lock()
+	defer c.pcfMutex.Unlock()
+
+	od := ibmmq.NewMQOD()
+	od.ObjectType = ibmmq.MQOT_Q
+	od.ObjectName = name
+	object, err := c.qMgr.Open(od, ibmmq.MQOO_BROWSE|ibmmq.MQOO_FAIL_IF_QUIESCING)
+	if err != nil {
+		return nil, 0, c.handleReturnValue(err)
+	}
+	defer func() {
+		if err := object.Close(0); err != nil {
+			c.logger.Error("failed to close browsed queue", "err", err, "queue", name)
+		}
+	}()
+
+	ages, priority, err := messageAges(object, maxMessages, now)
+	if err != nil {
+		return nil, 0, c.handleReturnValue(err)
+	}
+	return ages, priority, nil
+}
+
+// messageAges browses up to maxMessages messages from the first one on and
+// returns their ages by the put date and time of the message descriptor and
+// the priority of the first message, which is 0 if the queue is empty. The
+// message data is not read, so the truncated messages are accepted.
+func messageAges(browser messageBrowser, maxMessages int, now time.Time) ([]time.Duration, int32, error) {
+
+	ages := make([]time.Duration, 0, maxMessages)
+	var priority int32
+	options := ibmmq.MQGMO_BROWSE_FIRST
+	for len(ages) < maxMessages {
+		md := ibmmq.NewMQMD()
+		gmo := ibmmq.NewMQGMO()
+		gmo.Options = options | ibmmq.MQGMO_NO_WAIT | ibmmq.MQGMO_NO_SYNCPOINT | ibmmq.MQGMO_FAIL_IF_QUIESCING | ibmmq.MQGMO_ACCEPT_TRUNCATED_MSG
+
+		_, err := browser.Get(md, gmo, nil)
+		if err != nil {
+			if errors.Is(newMQError(err), ErrNoMessageAvailable) {
+				return ages, priority, nil
+			}
+			var mqret *ibmmq.MQReturn
+			if !errors.As(err, &mqret) || mqret.MQCC != ibmmq.MQCC_WARNING {
+				return ages, priority, err
+			}
+		}
+		if len(ages) == 0 {
+			priority = md.Priority
+		}
+		ages = append(ages, max(now.Sub(md.PutDateTime), 0))
+		options = ibmmq.MQGMO_BROWSE_NEXT
+	}
+	return ages, priority, nil
+}
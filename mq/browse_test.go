@@ -0,0 +1,95 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/v5/ibmmq"
+	"gotest.tools/v3/assert"
+)
+
+// mockBrowser is a queue of messages put at the given times with the given
+// priorities, which are browsed by the get options.
+type mockBrowser struct {
+	putDateTimes []time.Time
+	priorities   []int32
+	cursor       int
+	options      []int32
+}
+
+func (b *mockBrowser) Get(md *ibmmq.MQMD, gmo *ibmmq.MQGMO, buffer []byte) (int, error) {
+
+	b.options = append(b.options, gmo.Options&(ibmmq.MQGMO_BROWSE_FIRST|ibmmq.MQGMO_BROWSE_NEXT))
+	if gmo.Options&ibmmq.MQGMO_BROWSE_FIRST != 0 {
+		b.cursor = 0
+	}
+	if b.cursor >= len(b.putDateTimes) {
+		return 0, &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_NO_MSG_AVAILABLE}
+	}
+	md.PutDateTime = b.putDateTimes[b.cursor]
+	if b.cursor < len(b.priorities) {
+		md.Priority = b.priorities[b.cursor]
+	}
+	b.cursor++
+	return 100, &ibmmq.MQReturn{MQCC: ibmmq.MQCC_WARNING, MQRC: ibmmq.MQRC_TRUNCATED_MSG_ACCEPTED}
+}
+
+func TestMessageAges(t *testing.T) {
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	putDateTimes := []time.Time{now.Add(-time.Hour), now.Add(-time.Minute), now.Add(time.Second)}
+
+	tests := []struct {
+		name        string
+		maxMessages int
+		want        []time.Duration
+		options     []int32
+	}{
+		{
+			name:        "until no more messages",
+			maxMessages: 10,
+			// the clock of the queue manager may be ahead
+			want:    []time.Duration{time.Hour, time.Minute, 0},
+			options: []int32{ibmmq.MQGMO_BROWSE_FIRST, ibmmq.MQGMO_BROWSE_NEXT, ibmmq.MQGMO_BROWSE_NEXT, ibmmq.MQGMO_BROWSE_NEXT},
+		},
+		{
+			name:        "max messages",
+			maxMessages: 2,
+			want:        []time.Duration{time.Hour, time.Minute},
+			options:     []int32{ibmmq.MQGMO_BROWSE_FIRST, ibmmq.MQGMO_BROWSE_NEXT},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			browser := &mockBrowser{putDateTimes: putDateTimes, priorities: []int32{2, 9, 5}}
+			ages, priority, err := messageAges(browser, tt.maxMessages, now)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, ages, tt.want)
+			assert.Equal(t, priority, int32(2))
+			assert.DeepEqual(t, browser.options, tt.options)
+		})
+	}
+}
+
+func TestMessageAgesOfEmptyQueue(t *testing.T) {
+
+	ages, priority, err := messageAges(&mockBrowser{}, 10, time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, len(ages), 0)
+	assert.Equal(t, priority, int32(0))
+}
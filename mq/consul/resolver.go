@@ -0,0 +1,87 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package consul resolves the connection name (host and port) of a queue
+// manager by the Consul health API.
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultAddress = "http://localhost:8500"
+
+// ConsulResolver resolves the connection name `host(port)` of a service.
+type ConsulResolver interface {
+	Resolve(serviceName string) (string, error)
+}
+
+// DefaultConsulResolver queries the health API of the local Consul agent for
+// passing instances of a service.
+type DefaultConsulResolver struct {
+	Address string
+	Client  *http.Client
+}
+
+func NewDefaultConsulResolver() *DefaultConsulResolver {
+	return &DefaultConsulResolver{
+		Address: defaultAddress,
+		Client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+type serviceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+// Resolve returns the connection name of the first healthy instance of the
+// service. The address of the service falls back to the address of the node.
+func (r *DefaultConsulResolver) Resolve(serviceName string) (string, error) {
+
+	endpoint := fmt.Sprintf("%s/v1/health/service/%s?passing=true", r.Address, url.PathEscape(serviceName))
+
+	resp, err := r.Client.Get(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("failed to query consul for service '%s': %w", serviceName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to query consul for service '%s': %s", serviceName, resp.Status)
+	}
+
+	var entries []serviceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return "", fmt.Errorf("failed to decode consul response for service '%s': %w", serviceName, err)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("no healthy instance of service '%s'", serviceName)
+	}
+
+	host := entries[0].Service.Address
+	if host == "" {
+		host = entries[0].Node.Address
+	}
+	return fmt.Sprintf("%s(%d)", host, entries[0].Service.Port), nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func newConsul(t *testing.T, status int, body string) *DefaultConsulResolver {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/mq" || r.URL.Query().Get("passing") != "true" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	resolver := NewDefaultConsulResolver()
+	resolver.Address = server.URL
+	return resolver
+}
+
+func TestResolve(t *testing.T) {
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "service address",
+			body: `[{"Node":{"Address":"10.0.0.1"},"Service":{"Address":"10.0.0.2","Port":1414}},{"Node":{"Address":"10.0.0.3"},"Service":{"Address":"10.0.0.4","Port":1415}}]`,
+			want: "10.0.0.2(1414)",
+		},
+		{
+			name: "node address if service address is empty",
+			body: `[{"Node":{"Address":"10.0.0.1"},"Service":{"Address":"","Port":1414}}]`,
+			want: "10.0.0.1(1414)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newConsul(t, http.StatusOK, tt.body).Resolve("mq")
+			assert.NilError(t, err)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{
+			name:   "no healthy instance",
+			status: http.StatusOK,
+			body:   `[]`,
+			want:   "no healthy instance of service 'mq'",
+		},
+		{
+			name:   "unexpected status",
+			status: http.StatusInternalServerError,
+			body:   ``,
+			want:   "failed to query consul for service 'mq': 500 Internal Server Error",
+		},
+		{
+			name:   "invalid response",
+			status: http.StatusOK,
+			body:   `{`,
+			want:   "failed to decode consul response for service 'mq': unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newConsul(t, tt.status, tt.body).Resolve("mq")
+			assert.Error(t, err, tt.want)
+		})
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agebhar1/mq_exporter/collector"
+	"github.com/ibm-messaging/mq-golang/v5/ibmmq"
+)
+
+const (
+	defaultEventQueueName     = "SYSTEM.ADMIN.QMGR.EVENT"
+	performanceEventQueueName = "SYSTEM.ADMIN.PERFM.EVENT"
+)
+
+// depthEventTypes are the names of the queue depth events by their reason
+// code. A queue full event is raised if the max depth is reached.
+var depthEventTypes = map[int32]string{
+	ibmmq.MQRC_Q_DEPTH_HIGH: "high",
+	ibmmq.MQRC_Q_DEPTH_LOW:  "low",
+	ibmmq.MQRC_Q_FULL:       "full",
+}
+
+// browsedQueue is an event queue which is browsed, so the events are left for
+// other consumers. The first browse starts with the oldest event on the
+// queue, each following browse continues after the last browsed one.
+//
+// The browse cursor belongs to the handle of the opened queue, so the queue
+// browsed again from the start after a re-connect. The message id and the
+// put time of the last browsed event are kept to skip the events which were
+// already browsed before.
+type browsedQueue struct {
+	name   string
+	open   bool
+	object ibmmq.MQObject
+
+	browsed     bool
+	lastMsgId   []byte
+	lastPutTime time.Time
+
+	// resync is set on reopen of the queue until the already browsed events
+	// are skipped.
+	resync bool
+}
+
+// EventReader reads the events of the queue manager by browsing its event
+// queue.
+type EventReader struct {
+	connection *MqConnection
+	logger     *slog.Logger
+}
+
+func (c *MqConnection) EventReader() *EventReader {
+	return &EventReader{connection: c, logger: c.logger.With("queue", c.eventQueueName())}
+}
+
+// EventMonitoringEnabled reports whether the events of the queue manager are
+// read.
+func (c *MqConnection) EventMonitoringEnabled() bool {
+	return c.cfg.EnableEventMonitoring
+}
+
+func (c *MqConnection) eventQueueName() string {
+	if c.cfg.EventQueueName != "" {
+		return c.cfg.EventQueueName
+	}
+	return defaultEventQueueName
+}
+
+func (r *EventReader) Read() ([]collector.QueueManagerEvent, error) {
+
+	messages, err := r.connection.browseEvents(&r.connection.eventQueue)
+
+	events := make([]collector.QueueManagerEvent, 0, len(messages))
+	for _, message := range messages {
+		event, ok := parseEvent(message, r.connection.cfg.QueueManager)
+		if !ok {
+			r.logger.Warn("Skipped message which is no event")
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, err
+}
+
+// DepthEventReader reads the queue depth events of the queue manager by
+// browsing its performance event queue.
+type DepthEventReader struct {
+	connection *MqConnection
+	logger     *slog.Logger
+}
+
+func (c *MqConnection) DepthEventReader() *DepthEventReader {
+	return &DepthEventReader{connection: c, logger: c.logger.With("queue", performanceEventQueueName)}
+}
+
+// DepthEventCountingEnabled reports whether the queue depth events are read.
+func (c *MqConnection) DepthEventCountingEnabled() bool {
+	return c.cfg.EnableDepthEventCounting
+}
+
+func (r *DepthEventReader) Read() ([]collector.QueueDepthEvent, error) {
+
+	messages, err := r.connection.browseEvents(&r.connection.depthEventQueue)
+
+	events := make([]collector.QueueDepthEvent, 0, len(messages))
+	for _, message := range messages {
+		if event, ok := parseDepthEvent(message); ok {
+			events = append(events, event)
+		}
+	}
+	return events, err
+}
+
+// browseEvents returns the messages which arrived on the event queue since
+// the last browse.
+func (c *MqConnection) browseEvents(q *browsedQueue) ([][]byte, error) {
+
+	c.pcfMutex.Lock()
+	defer c.pcfMutex.Unlock()
+
+	if !q.open {
+		od := ibmmq.NewMQOD()
+		od.ObjectType = ibmmq.MQOT_Q
+		od.ObjectName = q.name
+		object, err := c.qMgr.Open(od, ibmmq.MQOO_BROWSE|ibmmq.MQOO_FAIL_IF_QUIESCING)
+		if err != nil {
+			return nil, c.handleReturnValue(err)
+		}
+		q.opened(object)
+	}
+
+	messages, err := q.browse(q.object)
+	if err != nil {
+		return messages, c.handleReturnValue(err)
+	}
+	return messages, nil
+}
+
+// opened sets the opened queue, which is browsed from the start.
+func (q *browsedQueue) opened(object ibmmq.MQObject) {
+	q.object = object
+	q.open = true
+	q.resync = q.browsed
+}
+
+// browse returns the messages after the last browsed one. After a reopen of
+// the queue, the messages up to the last browsed one are skipped, which are
+// the ones put before it if it's no longer on the queue.
+func (q *browsedQueue) browse(browser messageBrowser) ([][]byte, error) {
+
+	messages := make([][]byte, 0)
+	buf := make([]byte, pcfBufferSize)
+	for {
+		md := ibmmq.NewMQMD()
+		gmo := ibmmq.NewMQGMO()
+		gmo.Options = ibmmq.MQGMO_BROWSE_NEXT | ibmmq.MQGMO_NO_WAIT | ibmmq.MQGMO_NO_SYNCPOINT | ibmmq.MQGMO_FAIL_IF_QUIESCING | ibmmq.MQGMO_CONVERT | ibmmq.MQGMO_ACCEPT_TRUNCATED_MSG
+
+		datalen, err := browser.Get(md, gmo, buf)
+		if err != nil {
+			if errors.Is(newMQError(err), ErrNoMessageAvailable) {
+				q.resync = false
+				return messages, nil
+			}
+			// the header of a truncated event is still available
+			var mqret *ibmmq.MQReturn
+			if !errors.As(err, &mqret) || mqret.MQCC != ibmmq.MQCC_WARNING {
+				return messages, err
+			}
+		}
+
+		if q.resync {
+			if bytes.Equal(md.MsgId, q.lastMsgId) {
+				q.resync = false
+				continue
+			}
+			if !md.PutDateTime.After(q.lastPutTime) {
+				continue
+			}
+			q.resync = false
+		}
+
+		q.browsed = true
+		q.lastMsgId = append([]byte(nil), md.MsgId...)
+		q.lastPutTime = md.PutDateTime
+
+		// the data length of a truncated event is the one of the whole message
+		messages = append(messages, append([]byte(nil), buf[:min(datalen, len(buf))]...))
+	}
+}
+
+func (c *MqConnection) closeBrowsedQueue(q *browsedQueue) {
+
+	if !q.open {
+		return
+	}
+
+	if err := q.object.Close(0); err != nil {
+		c.logger.Error("failed to close event queue", "err", err, "queue", q.name)
+	}
+	q.open = false
+}
+
+// parseEvent parses an event message of the queue manager, whose type is
+// given by the reason code of the PCF header. The queue manager is the one of
+// the event if provided.
+func parseEvent(buf []byte, qMgrName string) (collector.QueueManagerEvent, bool) {
+
+	event, _ := parsePCFResponse(buf)
+	if event.Type != ibmmq.MQCFT_EVENT {
+		return collector.QueueManagerEvent{}, false
+	}
+	if name, ok := event.stringValue(ibmmq.MQCA_Q_MGR_NAME); ok {
+		qMgrName = name
+	}
+
+	return collector.QueueManagerEvent{QMgrName: qMgrName, EventType: eventTypeName(event.Reason)}, true
+}
+
+// parseDepthEvent parses a queue depth event of the queue given by the base
+// object name. Other (performance) events are not ok.
+func parseDepthEvent(buf []byte) (collector.QueueDepthEvent, bool) {
+
+	event, _ := parsePCFResponse(buf)
+	if event.Type != ibmmq.MQCFT_EVENT {
+		return collector.QueueDepthEvent{}, false
+	}
+	eventType, ok := depthEventTypes[event.Reason]
+	if !ok {
+		return collector.QueueDepthEvent{}, false
+	}
+	queueName, _ := event.stringValue(ibmmq.MQCA_BASE_OBJECT_NAME)
+
+	return collector.QueueDepthEvent{QueueName: queueName, EventType: eventType}, true
+}
+
+// eventTypeName returns the name of the reason code of an event without
+// prefix in lower case, e.g. 'q_full' for MQRC_Q_FULL.
+func eventTypeName(reason int32) string {
+	name := ibmmq.MQItoString("RC", int(reason))
+	if name == "" {
+		return strconv.Itoa(int(reason))
+	}
+	return strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(name, "MQRCCF_"), "MQRC_"))
+}
@@ -0,0 +1,269 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/agebhar1/mq_exporter/collector"
+	"github.com/ibm-messaging/mq-golang/v5/ibmmq"
+	"gotest.tools/v3/assert"
+)
+
+func eventBytes(command int32, reason int32, parameters ...*ibmmq.PCFParameter) []byte {
+	cfh := ibmmq.NewMQCFH()
+	cfh.Type = ibmmq.MQCFT_EVENT
+	cfh.Command = command
+	cfh.Reason = reason
+	cfh.CompCode = ibmmq.MQCC_WARNING
+	cfh.Control = ibmmq.MQCFC_LAST
+	cfh.ParameterCount = int32(len(parameters))
+
+	buf := cfh.Bytes()
+	for _, p := range parameters {
+		buf = append(buf, p.Bytes()...)
+	}
+	return buf
+}
+
+func TestParseEvent(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		message []byte
+		want    collector.QueueManagerEvent
+		ok      bool
+	}{
+		{
+			name: "queue full",
+			message: eventBytes(ibmmq.MQCMD_PERFM_EVENT, ibmmq.MQRC_Q_FULL,
+				stringParameter(ibmmq.MQCA_Q_MGR_NAME, "QM2                                             "),
+				stringParameter(ibmmq.MQCA_BASE_OBJECT_NAME, "DEV.QUEUE.1"),
+			),
+			want: collector.QueueManagerEvent{QMgrName: "QM2", EventType: "q_full"},
+			ok:   true,
+		},
+		{
+			name:    "not authorized without queue manager",
+			message: eventBytes(ibmmq.MQCMD_Q_MGR_EVENT, ibmmq.MQRC_NOT_AUTHORIZED),
+			want:    collector.QueueManagerEvent{QMgrName: "QM1", EventType: "not_authorized"},
+			ok:      true,
+		},
+		{
+			name:    "no event",
+			message: pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRC_NONE),
+		},
+		{
+			name:    "no PCF message",
+			message: []byte("hello"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseEvent(tt.message, "QM1")
+			assert.Equal(t, ok, tt.ok)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestParseDepthEvent(t *testing.T) {
+
+	depthEvent := func(reason int32) []byte {
+		return eventBytes(ibmmq.MQCMD_PERFM_EVENT, reason,
+			stringParameter(ibmmq.MQCA_Q_MGR_NAME, "QM1"),
+			stringParameter(ibmmq.MQCA_BASE_OBJECT_NAME, "DEV.QUEUE.1                                     "),
+			intParameter(ibmmq.MQIA_HIGH_Q_DEPTH, 4000),
+		)
+	}
+
+	tests := []struct {
+		name    string
+		message []byte
+		want    collector.QueueDepthEvent
+		ok      bool
+	}{
+		{name: "queue depth high", message: depthEvent(ibmmq.MQRC_Q_DEPTH_HIGH), want: collector.QueueDepthEvent{QueueName: "DEV.QUEUE.1", EventType: "high"}, ok: true},
+		{name: "queue depth low", message: depthEvent(ibmmq.MQRC_Q_DEPTH_LOW), want: collector.QueueDepthEvent{QueueName: "DEV.QUEUE.1", EventType: "low"}, ok: true},
+		{name: "queue full", message: depthEvent(ibmmq.MQRC_Q_FULL), want: collector.QueueDepthEvent{QueueName: "DEV.QUEUE.1", EventType: "full"}, ok: true},
+		{name: "service interval high", message: depthEvent(ibmmq.MQRC_Q_SERVICE_INTERVAL_HIGH)},
+		{name: "no event", message: pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRC_Q_DEPTH_HIGH)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseDepthEvent(tt.message)
+			assert.Equal(t, ok, tt.ok)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+// mockEventQueue is an event queue with events put at the given times, which
+// is browsed from the start after each reopen.
+type mockEventQueue struct {
+	msgIds   [][]byte
+	putTimes []time.Time
+	data     [][]byte
+	cursor   int
+}
+
+// put puts an event with its message id as data.
+func (m *mockEventQueue) put(msgId string, putTime time.Time) {
+	m.putEvent(msgId, putTime, []byte(msgId))
+}
+
+func (m *mockEventQueue) putEvent(msgId string, putTime time.Time, data []byte) {
+	m.msgIds = append(m.msgIds, []byte(msgId))
+	m.putTimes = append(m.putTimes, putTime)
+	m.data = append(m.data, data)
+}
+
+func (m *mockEventQueue) remove(i int) {
+	m.msgIds = append(m.msgIds[:i], m.msgIds[i+1:]...)
+	m.putTimes = append(m.putTimes[:i], m.putTimes[i+1:]...)
+	m.data = append(m.data[:i], m.data[i+1:]...)
+}
+
+func (m *mockEventQueue) Get(md *ibmmq.MQMD, gmo *ibmmq.MQGMO, buffer []byte) (int, error) {
+	if m.cursor >= len(m.msgIds) {
+		return 0, &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_NO_MSG_AVAILABLE}
+	}
+	md.MsgId = m.msgIds[m.cursor]
+	md.PutDateTime = m.putTimes[m.cursor]
+	n := copy(buffer, m.data[m.cursor])
+	m.cursor++
+	return n, nil
+}
+
+func TestBrowseEventsAfterReconnect(t *testing.T) {
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		reconnect func(m *mockEventQueue)
+		want      []string
+	}{
+		{
+			name:      "no new events",
+			reconnect: func(m *mockEventQueue) {},
+			want:      []string{},
+		},
+		{
+			name: "new events",
+			reconnect: func(m *mockEventQueue) {
+				m.put("3", start.Add(2*time.Second))
+				m.put("4", start.Add(2*time.Second))
+			},
+			want: []string{"3", "4"},
+		},
+		{
+			name: "last browsed event removed",
+			reconnect: func(m *mockEventQueue) {
+				m.remove(1)
+				m.put("3", start.Add(2*time.Second))
+			},
+			want: []string{"3"},
+		},
+		{
+			name: "all browsed events removed",
+			reconnect: func(m *mockEventQueue) {
+				m.remove(1)
+				m.remove(0)
+				m.put("3", start.Add(2*time.Second))
+			},
+			want: []string{"3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockEventQueue{}
+			m.put("1", start)
+			m.put("2", start.Add(time.Second))
+
+			q := &browsedQueue{name: defaultEventQueueName}
+			q.opened(ibmmq.MQObject{})
+			messages, err := q.browse(m)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, messages, [][]byte{[]byte("1"), []byte("2")})
+
+			tt.reconnect(m)
+			m.cursor = 0
+			q.opened(ibmmq.MQObject{})
+
+			messages, err = q.browse(m)
+			assert.NilError(t, err)
+			got := make([]string, 0, len(messages))
+			for _, message := range messages {
+				got = append(got, string(message))
+			}
+			assert.DeepEqual(t, got, tt.want)
+
+			m.put("5", start.Add(3*time.Second))
+			messages, err = q.browse(m)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, messages, [][]byte{[]byte("5")})
+		})
+	}
+}
+
+func TestBrowseDepthEventsAfterReconnect(t *testing.T) {
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	depthEvent := func(reason int32) []byte {
+		return eventBytes(ibmmq.MQCMD_PERFM_EVENT, reason,
+			stringParameter(ibmmq.MQCA_Q_MGR_NAME, "QM1"),
+			stringParameter(ibmmq.MQCA_BASE_OBJECT_NAME, "DEV.QUEUE.1"),
+			intParameter(ibmmq.MQIA_HIGH_Q_DEPTH, 4000),
+		)
+	}
+	depthEvents := func(messages [][]byte) []collector.QueueDepthEvent {
+		events := make([]collector.QueueDepthEvent, 0, len(messages))
+		for _, message := range messages {
+			if event, ok := parseDepthEvent(message); ok {
+				events = append(events, event)
+			}
+		}
+		return events
+	}
+
+	m := &mockEventQueue{}
+	m.putEvent("1", start, depthEvent(ibmmq.MQRC_Q_DEPTH_HIGH))
+	m.putEvent("2", start.Add(time.Second), depthEvent(ibmmq.MQRC_Q_FULL))
+
+	q := &browsedQueue{name: performanceEventQueueName}
+	q.opened(ibmmq.MQObject{})
+	messages, err := q.browse(m)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, depthEvents(messages), []collector.QueueDepthEvent{
+		{QueueName: "DEV.QUEUE.1", EventType: "high"},
+		{QueueName: "DEV.QUEUE.1", EventType: "full"},
+	})
+
+	// reconnect
+	m.putEvent("3", start.Add(2*time.Second), depthEvent(ibmmq.MQRC_Q_DEPTH_LOW))
+	m.cursor = 0
+	q.opened(ibmmq.MQObject{})
+
+	messages, err = q.browse(m)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, depthEvents(messages), []collector.QueueDepthEvent{
+		{QueueName: "DEV.QUEUE.1", EventType: "low"},
+	})
+}
@@ -0,0 +1,244 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kubernetes reads the list of queues from a ConfigMap by the
+// Kubernetes API and watches it for changes.
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	readTimeout       = 5 * time.Second
+)
+
+// ConfigMapSource reads the queue list of the data key of a ConfigMap, which
+// has one queue name per line.
+type ConfigMapSource struct {
+	Address string
+	Token   string
+	Client  *http.Client
+
+	Namespace string
+	Name      string
+	DataKey   string
+}
+
+// NewInClusterConfigMapSource returns a source which uses the API server and
+// the service account of the pod the exporter is running in. The namespace
+// falls back to the one of the pod.
+func NewInClusterConfigMapSource(namespace, name, dataKey string) (*ConfigMapSource, error) {
+	return newConfigMapSource(serviceAccountDir, namespace, name, dataKey)
+}
+
+func newConfigMapSource(dir, namespace, name, dataKey string) (*ConfigMapSource, error) {
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+
+	token, err := os.ReadFile(filepath.Join(dir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	ca, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in service account CA certificate")
+	}
+
+	if namespace == "" {
+		data, err := os.ReadFile(filepath.Join(dir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read namespace of service account: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	return &ConfigMapSource{
+		Address: "https://" + net.JoinHostPort(host, port),
+		Token:   strings.TrimSpace(string(token)),
+		Client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		Namespace: namespace,
+		Name:      name,
+		DataKey:   dataKey,
+	}, nil
+}
+
+type configMap struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data"`
+}
+
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+type status struct {
+	Message string `json:"message"`
+}
+
+// Read returns the queues of the ConfigMap and its resource version, from
+// which on the ConfigMap is watched.
+func (s *ConfigMapSource) Read() ([]string, string, error) {
+
+	endpoint := fmt.Sprintf("%s/api/v1/namespaces/%s/configmaps/%s", s.Address, url.PathEscape(s.Namespace), url.PathEscape(s.Name))
+
+	ctx, cancel := context.WithTimeout(context.Background(), readTimeout)
+	defer cancel()
+
+	resp, err := s.get(ctx, endpoint)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	var cm configMap
+	if err := json.NewDecoder(resp.Body).Decode(&cm); err != nil {
+		return nil, "", fmt.Errorf("failed to decode configmap '%s/%s': %w", s.Namespace, s.Name, err)
+	}
+	queues, err := s.queues(cm)
+	return queues, cm.Metadata.ResourceVersion, err
+}
+
+// Watch calls onChange with the queues of each change of the ConfigMap after
+// the resource version until the watch is closed by the API server, fails or
+// done is closed. A deleted ConfigMap is no change, so the last queues are
+// kept.
+func (s *ConfigMapSource) Watch(resourceVersion string, onChange func(queues []string), done <-chan struct{}) error {
+
+	query := url.Values{}
+	query.Set("watch", "true")
+	query.Set("fieldSelector", "metadata.name="+s.Name)
+	query.Set("resourceVersion", resourceVersion)
+	endpoint := fmt.Sprintf("%s/api/v1/namespaces/%s/configmaps?%s", s.Address, url.PathEscape(s.Namespace), query.Encode())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	resp, err := s.get(ctx, endpoint)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event watchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("watch of configmap '%s/%s' failed: %w", s.Namespace, s.Name, err)
+		}
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			var cm configMap
+			if err := json.Unmarshal(event.Object, &cm); err != nil {
+				return fmt.Errorf("failed to decode configmap '%s/%s': %w", s.Namespace, s.Name, err)
+			}
+			queues, err := s.queues(cm)
+			if err != nil {
+				return err
+			}
+			onChange(queues)
+		case "ERROR":
+			var st status
+			_ = json.Unmarshal(event.Object, &st)
+			return fmt.Errorf("watch of configmap '%s/%s' failed: %s", s.Namespace, s.Name, st.Message)
+		}
+	}
+}
+
+// get requests the endpoint with the token of the service account.
+func (s *ConfigMapSource) get(ctx context.Context, endpoint string) (*http.Response, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query configmap '%s/%s': %w", s.Namespace, s.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to query configmap '%s/%s': %s", s.Namespace, s.Name, resp.Status)
+	}
+	return resp, nil
+}
+
+// queues returns the queues of the data key of the ConfigMap.
+func (s *ConfigMapSource) queues(cm configMap) ([]string, error) {
+	data, ok := cm.Data[s.DataKey]
+	if !ok {
+		return nil, fmt.Errorf("configmap '%s/%s' has no key '%s'", s.Namespace, s.Name, s.DataKey)
+	}
+	return ParseQueueList(data), nil
+}
+
+// ParseQueueList returns the queue names of a list with one name per line in
+// order of their first occurrence. Empty lines and comments starting with '#'
+// are skipped.
+func ParseQueueList(data string) []string {
+	names := make([]string, 0)
+	for _, line := range strings.Split(data, "\n") {
+		name := strings.TrimSpace(line)
+		if name == "" || strings.HasPrefix(name, "#") || slices.Contains(names, name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
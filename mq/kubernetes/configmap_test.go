@@ -0,0 +1,203 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const configMapPath = "/api/v1/namespaces/mq/configmaps/queues"
+
+func newSource(t *testing.T, handler http.HandlerFunc) *ConfigMapSource {
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return &ConfigMapSource{
+		Address:   server.URL,
+		Token:     "secret",
+		Client:    server.Client(),
+		Namespace: "mq",
+		Name:      "queues",
+		DataKey:   "queues.txt",
+	}
+}
+
+func configMapJSON(resourceVersion string, data string) string {
+	return fmt.Sprintf(`{"kind":"ConfigMap","metadata":{"name":"queues","namespace":"mq","resourceVersion":%q},"data":{"queues.txt":%q}}`, resourceVersion, data)
+}
+
+func TestRead(t *testing.T) {
+
+	source := newSource(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != configMapPath || r.Header.Get("Authorization") != "Bearer secret" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(configMapJSON("42", "DEV.QUEUE.1\nDEV.QUEUE.2\n")))
+	})
+
+	queues, resourceVersion, err := source.Read()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, queues, []string{"DEV.QUEUE.1", "DEV.QUEUE.2"})
+	assert.Equal(t, resourceVersion, "42")
+}
+
+func TestReadErrors(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{
+			name:   "not found",
+			status: http.StatusNotFound,
+			body:   `{"kind":"Status","message":"configmaps \"queues\" not found"}`,
+			want:   "failed to query configmap 'mq/queues': 404 Not Found",
+		},
+		{
+			name:   "missing data key",
+			status: http.StatusOK,
+			body:   `{"metadata":{"resourceVersion":"42"},"data":{"other":"DEV.QUEUE.1"}}`,
+			want:   "configmap 'mq/queues' has no key 'queues.txt'",
+		},
+		{
+			name:   "invalid response",
+			status: http.StatusOK,
+			body:   `[`,
+			want:   "failed to decode configmap 'mq/queues': unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newSource(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			_, _, err := source.Read()
+			assert.Error(t, err, tt.want)
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+
+	var query url.Values
+	source := newSource(t, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		fmt.Fprintf(w, `{"type":"MODIFIED","object":%s}`+"\n", configMapJSON("43", "DEV.QUEUE.1\nDEV.QUEUE.3"))
+		fmt.Fprintf(w, `{"type":"DELETED","object":%s}`+"\n", configMapJSON("44", "DEV.QUEUE.1\nDEV.QUEUE.3"))
+		fmt.Fprintf(w, `{"type":"ADDED","object":%s}`+"\n", configMapJSON("45", "DEV.QUEUE.2"))
+	})
+
+	changes := make([][]string, 0)
+	err := source.Watch("42", func(queues []string) {
+		changes = append(changes, queues)
+	}, make(chan struct{}))
+
+	assert.ErrorContains(t, err, "watch of configmap 'mq/queues' failed: EOF")
+	assert.DeepEqual(t, changes, [][]string{{"DEV.QUEUE.1", "DEV.QUEUE.3"}, {"DEV.QUEUE.2"}})
+	assert.Equal(t, query.Get("watch"), "true")
+	assert.Equal(t, query.Get("fieldSelector"), "metadata.name=queues")
+	assert.Equal(t, query.Get("resourceVersion"), "42")
+}
+
+func TestWatchFailsOnErrorEvent(t *testing.T) {
+
+	source := newSource(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"type":"ERROR","object":{"kind":"Status","message":"too old resource version: 42 (43)","code":410}}` + "\n"))
+	})
+
+	err := source.Watch("42", func([]string) {
+		t.Fatal("unexpected change")
+	}, make(chan struct{}))
+	assert.Error(t, err, "watch of configmap 'mq/queues' failed: too old resource version: 42 (43)")
+}
+
+func TestWatchReturnsIfDone(t *testing.T) {
+
+	source := newSource(t, func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	done := make(chan struct{})
+	result := make(chan error)
+	go func() {
+		result <- source.Watch("42", func([]string) {}, done)
+	}()
+	close(done)
+
+	assert.NilError(t, <-result)
+}
+
+func TestNewInClusterConfigMapSource(t *testing.T) {
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != configMapPath || r.Header.Get("Authorization") != "Bearer secret" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(configMapJSON("42", "DEV.QUEUE.1")))
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	assert.NilError(t, err)
+	t.Setenv("KUBERNETES_SERVICE_HOST", u.Hostname())
+	t.Setenv("KUBERNETES_SERVICE_PORT", u.Port())
+
+	dir := t.TempDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), ca, 0600))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("secret\n"), 0600))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "namespace"), []byte("mq"), 0600))
+
+	source, err := newConfigMapSource(dir, "", "queues", "queues.txt")
+	assert.NilError(t, err)
+	assert.Equal(t, source.Namespace, "mq")
+
+	queues, _, err := source.Read()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, queues, []string{"DEV.QUEUE.1"})
+}
+
+func TestNewInClusterConfigMapSourceOutsideOfCluster(t *testing.T) {
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "")
+
+	_, err := newConfigMapSource(t.TempDir(), "mq", "queues", "queues.txt")
+	assert.ErrorContains(t, err, "not running in a Kubernetes cluster")
+}
+
+func TestParseQueueList(t *testing.T) {
+
+	got := ParseQueueList("DEV.QUEUE.1\r\n\n  DEV.QUEUE.2  \n# DEV.QUEUE.3\nDEV.QUEUE.1\n")
+	assert.DeepEqual(t, got, []string{"DEV.QUEUE.1", "DEV.QUEUE.2"})
+}
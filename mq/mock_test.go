@@ -0,0 +1,89 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import (
+	"sync"
+
+	"github.com/ibm-messaging/mq-golang/v5/ibmmq"
+)
+
+// MockMQQueueManager is a connected queue manager whose MQI calls return the
+// configured errors. It records the names of the opened objects and the
+// number of disconnects. The opened objects are no real ones, so they can't
+// be used for MQI calls, e.g. MQCLOSE.
+type MockMQQueueManager struct {
+	sync.Mutex
+
+	OpenErr error
+	DiscErr error
+
+	opened []string
+	discs  int
+}
+
+func (m *MockMQQueueManager) Open(od *ibmmq.MQOD, openOptions int32) (ibmmq.MQObject, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.OpenErr != nil {
+		return ibmmq.MQObject{}, m.OpenErr
+	}
+	m.opened = append(m.opened, od.ObjectName)
+	return ibmmq.MQObject{Name: od.ObjectName}, nil
+}
+
+func (m *MockMQQueueManager) Disc() error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.discs++
+	return m.DiscErr
+}
+
+func (m *MockMQQueueManager) Opened() []string {
+	m.Lock()
+	defer m.Unlock()
+
+	return append([]string(nil), m.opened...)
+}
+
+func (m *MockMQQueueManager) Discs() int {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.discs
+}
+
+// mockConnx returns a connx which connects to the queue managers one after
+// another and fails with err once all are connected. The names of the
+// connected queue managers are sent to connected if not nil.
+func mockConnx(err error, connected chan<- string, qMgrs ...*MockMQQueueManager) func(string, *ibmmq.MQCNO) (MQQueueManager, error) {
+	var mutex sync.Mutex
+	return func(qMgrName string, cno *ibmmq.MQCNO) (MQQueueManager, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if connected != nil {
+			connected <- qMgrName
+		}
+		if len(qMgrs) == 0 {
+			return nil, err
+		}
+		qMgr := qMgrs[0]
+		qMgrs = qMgrs[1:]
+		return qMgr, nil
+	}
+}
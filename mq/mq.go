@@ -15,20 +15,34 @@
 package mq
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/agebhar1/mq_exporter/collector"
+	"github.com/agebhar1/mq_exporter/mq/consul"
+	"github.com/agebhar1/mq_exporter/mq/kubernetes"
 	"github.com/ibm-messaging/mq-golang/v5/ibmmq"
 	"gopkg.in/yaml.v2"
 )
 
 var (
-	defaultTimeout = 3 * time.Second
+	defaultTimeout                   = 3 * time.Second
+	defaultPoolSize                  = 1
+	defaultCertExpiryRefreshInterval = 1 * time.Hour
+	configMapWatchRetryInterval      = 5 * time.Second
+
+	labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	tenantPattern    = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 
 	selectors = []int32{
 		ibmmq.MQCA_Q_NAME,
@@ -36,6 +50,57 @@ var (
 		ibmmq.MQIA_CURRENT_Q_DEPTH,
 		ibmmq.MQIA_OPEN_INPUT_COUNT,
 		ibmmq.MQIA_OPEN_OUTPUT_COUNT,
+		ibmmq.MQCA_STORAGE_CLASS,
+		ibmmq.MQCA_CLUSTER_NAME,
+		ibmmq.MQIA_Q_DEPTH_HIGH_EVENT,
+		ibmmq.MQIA_Q_DEPTH_LOW_EVENT,
+		ibmmq.MQIA_Q_DEPTH_MAX_EVENT,
+		ibmmq.MQIA_DEF_PERSISTENCE,
+		ibmmq.MQIA_MSG_DELIVERY_SEQUENCE,
+		ibmmq.MQIA_DEF_INPUT_OPEN_OPTION,
+		ibmmq.MQIA_DEF_PUT_RESPONSE_TYPE,
+		ibmmq.MQIA_CLWL_Q_RANK,
+		ibmmq.MQIA_Q_SERVICE_INTERVAL,
+		ibmmq.MQIA_Q_SERVICE_INTERVAL_EVENT,
+		ibmmq.MQIA_HARDEN_GET_BACKOUT,
+		ibmmq.MQIA_SHAREABILITY,
+		ibmmq.MQIA_RETENTION_INTERVAL,
+		ibmmq.MQIA_USAGE,
+		ibmmq.MQIA_INDEX_TYPE,
+		ibmmq.MQIA_STATISTICS_Q,
+		ibmmq.MQIA_MAX_MSG_LENGTH,
+		ibmmq.MQIA_SCOPE,
+		ibmmq.MQIA_DEF_PRIORITY,
+		ibmmq.MQIA_ACCOUNTING_Q,
+	}
+
+	// selectorsByMetricName are the selectors of the metrics which can be
+	// configured by 'collectMetrics' of a queue.
+	selectorsByMetricName = map[string]int32{
+		"currentDepth":           ibmmq.MQIA_CURRENT_Q_DEPTH,
+		"maxDepth":               ibmmq.MQIA_MAX_Q_DEPTH,
+		"openInputCount":         ibmmq.MQIA_OPEN_INPUT_COUNT,
+		"openOutputCount":        ibmmq.MQIA_OPEN_OUTPUT_COUNT,
+		"clusterName":            ibmmq.MQCA_CLUSTER_NAME,
+		"depthHighEventEnabled":  ibmmq.MQIA_Q_DEPTH_HIGH_EVENT,
+		"depthLowEventEnabled":   ibmmq.MQIA_Q_DEPTH_LOW_EVENT,
+		"depthMaxEventEnabled":   ibmmq.MQIA_Q_DEPTH_MAX_EVENT,
+		"defaultPersistence":     ibmmq.MQIA_DEF_PERSISTENCE,
+		"msgDeliverySequence":    ibmmq.MQIA_MSG_DELIVERY_SEQUENCE,
+		"defaultInputOpenOption": ibmmq.MQIA_DEF_INPUT_OPEN_OPTION,
+		"defaultPutResponseType": ibmmq.MQIA_DEF_PUT_RESPONSE_TYPE,
+		"clusterWorkloadRank":    ibmmq.MQIA_CLWL_Q_RANK,
+		"serviceInterval":        ibmmq.MQIA_Q_SERVICE_INTERVAL,
+		"serviceIntervalEvent":   ibmmq.MQIA_Q_SERVICE_INTERVAL_EVENT,
+		"hardenBackout":          ibmmq.MQIA_HARDEN_GET_BACKOUT,
+		"shareability":           ibmmq.MQIA_SHAREABILITY,
+		"retentionInterval":      ibmmq.MQIA_RETENTION_INTERVAL,
+		"indexType":              ibmmq.MQIA_INDEX_TYPE,
+		"statisticsQ":            ibmmq.MQIA_STATISTICS_Q,
+		"maxMessageLength":       ibmmq.MQIA_MAX_MSG_LENGTH,
+		"scope":                  ibmmq.MQIA_SCOPE,
+		"defaultPriority":        ibmmq.MQIA_DEF_PRIORITY,
+		"accountingLevel":        ibmmq.MQIA_ACCOUNTING_Q,
 	}
 )
 
@@ -44,6 +109,53 @@ const (
 	NO  = 0
 )
 
+var (
+	ErrConnectionBroken      = newSentinelError(ibmmq.MQRC_CONNECTION_BROKEN)
+	ErrQueueNotFound         = newSentinelError(ibmmq.MQRC_UNKNOWN_OBJECT_NAME)
+	ErrQueueManagerQuiescing = newSentinelError(ibmmq.MQRC_Q_MGR_QUIESCING)
+	ErrQueueManagerStopping  = newSentinelError(ibmmq.MQRC_Q_MGR_STOPPING)
+	ErrNoMessageAvailable    = newSentinelError(ibmmq.MQRC_NO_MSG_AVAILABLE)
+)
+
+// MQError wraps the *ibmmq.MQReturn of a failed MQI call. Two MQErrors are
+// considered equal by errors.Is if completion and reason code match.
+type MQError struct {
+	MQReturn *ibmmq.MQReturn
+}
+
+func newSentinelError(mqrc int32) *MQError {
+	return &MQError{MQReturn: &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: mqrc}}
+}
+
+func newMQError(err error) error {
+	var mqret *ibmmq.MQReturn
+	if err == nil || !errors.As(err, &mqret) {
+		return err
+	}
+	return &MQError{MQReturn: mqret}
+}
+
+func (e *MQError) Error() string {
+	return e.MQReturn.Error()
+}
+
+// ReasonCode returns the reason code (MQRC) of the failed MQI call.
+func (e *MQError) ReasonCode() int32 {
+	return e.MQReturn.MQRC
+}
+
+func (e *MQError) Unwrap() error {
+	return e.MQReturn
+}
+
+func (e *MQError) Is(target error) bool {
+	t, ok := target.(*MQError)
+	if !ok {
+		return false
+	}
+	return e.MQReturn.MQCC == t.MQReturn.MQCC && e.MQReturn.MQRC == t.MQReturn.MQRC
+}
+
 type MqConfiguration struct {
 	QueueManager  string `yaml:"queueManager"`
 	User          string
@@ -53,9 +165,152 @@ type MqConfiguration struct {
 	SSLCipherSpec string `yaml:"sslCipherSpec"`
 	KeyRepository string `yaml:"keyRepository"`
 	Timeout       *time.Duration
-	Queues        []string
+	PoolSize      int `yaml:"poolSize"`
+
+	// MaxConcurrentReadsPerQueueManager limits the queue inquiries in
+	// progress, defaults to the number of queues.
+	MaxConcurrentReadsPerQueueManager int `yaml:"maxConcurrentReads"`
+
+	Queues    []QueueConfig
+	QueueSets []QueueSet `yaml:"queueSets"`
+	MaxQueues int        `yaml:"maxQueues"`
+	Channels  []string
+
+	KeepaliveQueue string `yaml:"keepaliveQueue"`
+
+	TLSCACertFile     string `yaml:"tlsCACertFile"`
+	TLSClientCertFile string `yaml:"tlsClientCertFile"`
+	TLSClientKeyFile  string `yaml:"tlsClientKeyFile"`
+
+	CertExpiryCheckPath       string         `yaml:"certExpiryCheckPath"`
+	CertExpiryRefreshInterval *time.Duration `yaml:"certExpiryRefreshInterval"`
+
+	LabelNames collector.LabelNames `yaml:"labelNames"`
+
+	// MetricDescriptions override the help texts of the queue metrics keyed
+	// by the metric name without namespace, e.g. 'queue_current_depth'.
+	MetricDescriptions map[string]string `yaml:"metricDescriptions"`
+
+	// MaxQueueDepthOverride replaces the max depth of the queues keyed by the
+	// queue name, e.g. for queues which report a max depth of 0.
+	MaxQueueDepthOverride map[string]int32 `yaml:"maxQueueDepthOverride"`
+
+	// Aliases map the queue names to the names of the queues in the metrics,
+	// so the metrics are stable if a queue is renamed.
+	Aliases map[string]string `yaml:"aliases"`
+
+	// RecordingRules are evaluated in-process on the queue metrics and
+	// provided as additional metrics.
+	RecordingRules []RecordingRule `yaml:"recordingRules"`
+
+	// ResetQueueStatistics resets the statistics of the queues on each
+	// scrape, which is destructive for any other reader of the statistics.
+	ResetQueueStatistics bool `yaml:"resetQueueStatistics"`
+	InquireQueueStatus   bool `yaml:"inquireQueueStatus"`
+
+	EnableEventMonitoring    bool   `yaml:"enableEventMonitoring"`
+	EventQueueName           string `yaml:"eventQueueName"`
+	EnableDepthEventCounting bool   `yaml:"enableDepthEventCounting"`
+
+	ConsulServiceName string `yaml:"consulServiceName"`
+
+	// QueueSourceKubernetesConfigMap replaces the queues configured by
+	// 'queues' by the ones of a ConfigMap, which is watched for changes.
+	QueueSourceKubernetesConfigMap *QueueSourceKubernetesConfigMap `yaml:"queueSourceKubernetesConfigMap"`
+}
+
+// QueueSourceKubernetesConfigMap is a ConfigMap whose data key has one queue
+// name per line. The namespace defaults to the one of the exporter's pod.
+type QueueSourceKubernetesConfigMap struct {
+	Namespace string
+	Name      string
+	DataKey   string `yaml:"dataKey"`
+}
+
+// QueueConfig is a queue whose metrics are inquired. It's either configured by
+// its name only or by a map of its name, additional labels, the metrics to
+// collect and the tenant whose endpoint exposes its metrics.
+type QueueConfig struct {
+	Name           string
+	Labels         map[string]string
+	CollectMetrics []string `yaml:"collectMetrics"`
+	Tenant         string
+
+	// Timeout and DepthWarnThreshold are applied from the queue set of the
+	// queue.
+	Timeout            *time.Duration `yaml:"-"`
+	DepthWarnThreshold *int32         `yaml:"-"`
+}
+
+// QueueSet is a named group of queues which share the same settings. The
+// timeout of a set overrides the global 'timeout' for its queues and the
+// labels of a set are added to the labels of each queue.
+type QueueSet struct {
+	Name               string
+	Queues             []QueueConfig
+	Timeout            *Duration
+	Labels             map[string]string
+	DepthWarnThreshold *int32 `yaml:"depthWarnThreshold"`
+}
+
+// RecordingRule aggregates a queue metric to a new metric by an expression
+// like 'sum by (queue_manager) (mq_queue_current_depth)'.
+type RecordingRule struct {
+	Name   string
+	Expr   string
+	Labels map[string]string
+}
+
+func (q *QueueConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&q.Name); err == nil {
+		return nil
+	}
+	type plain QueueConfig
+	return unmarshal((*plain)(q))
 }
 
+// selectors returns the selectors to inquire the queue, which are all unless
+// the metrics to collect are configured.
+func (q *QueueConfig) selectors() []int32 {
+	if len(q.CollectMetrics) == 0 {
+		return selectors
+	}
+	xs := []int32{ibmmq.MQCA_Q_NAME, ibmmq.MQCA_STORAGE_CLASS, ibmmq.MQIA_USAGE}
+	for _, name := range q.CollectMetrics {
+		xs = append(xs, selectorsByMetricName[name])
+	}
+	return xs
+}
+
+// Duration is a time.Duration which is configured either by a string like
+// '1500ms' or '1.5s' or by an integer in milliseconds.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case int:
+		*d = Duration(time.Duration(v) * time.Millisecond)
+	case string:
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(duration)
+	default:
+		return fmt.Errorf("invalid duration '%v'", value)
+	}
+	return nil
+}
+
+// readConfigYaml reads the configuration file. The timeout of the queue
+// manager is looked up in the order: environment variable
+// 'MQCONNECTION_TIMEOUT_<QUEUE MANAGER>', 'timeout' of the configuration file,
+// defaultTimeout. The environment variable takes precedence over the file, so
+// the timeout of a deployment can be set without changing the file.
 func readConfigYaml(filename string) (*MqConfiguration, error) {
 
 	data, err := os.ReadFile(filename)
@@ -63,28 +318,174 @@ func readConfigYaml(filename string) (*MqConfiguration, error) {
 		return nil, fmt.Errorf("configuration file '%s' does not exists or is not readable", filename)
 	}
 
-	var cfg MqConfiguration
+	cfg := MqConfiguration{LabelNames: collector.DefaultLabelNames}
 
 	err = yaml.Unmarshal(data, &cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	// the timeout is read again as Duration, which accepts milliseconds too
+	var timeout struct {
+		Timeout *Duration
+	}
+	if err := yaml.Unmarshal(data, &timeout); err != nil {
+		return nil, err
+	}
+	cfg.Timeout = (*time.Duration)(timeout.Timeout)
+
+	// the timeout of the queue manager can be overridden by the environment,
+	// which takes precedence over the configuration file
+	name := timeoutEnvName(cfg.QueueManager)
+	if value, ok := os.LookupEnv(name); ok && cfg.QueueManager != "" {
+		var timeout Duration
+		if err := yaml.Unmarshal([]byte(value), &timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout '%s' of environment variable '%s': %w", value, name, err)
+		}
+		cfg.Timeout = (*time.Duration)(&timeout)
+	}
+
 	if cfg.Timeout == nil {
 		cfg.Timeout = &defaultTimeout
 	}
+	if cfg.PoolSize == 0 {
+		cfg.PoolSize = defaultPoolSize
+	}
+	if cfg.CertExpiryRefreshInterval == nil {
+		cfg.CertExpiryRefreshInterval = &defaultCertExpiryRefreshInterval
+	}
 
 	return &cfg, nil
 }
 
+// timeoutEnvName returns the name of the environment variable to override the
+// timeout of the queue manager, which is its name in upper case with all
+// characters other than letters and digits replaced by underscores, e.g.
+// 'MQCONNECTION_TIMEOUT_QM_1' for queue manager 'qm.1'.
+func timeoutEnvName(qMgrName string) string {
+	name := strings.Map(func(r rune) rune {
+		if ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(qMgrName))
+	return "MQCONNECTION_TIMEOUT_" + name
+}
+
+// maxConcurrentReads returns the limit of the queue inquiries in progress,
+// which is the number of queues unless configured.
+func (cfg *MqConfiguration) maxConcurrentReads() int {
+	if cfg.MaxConcurrentReadsPerQueueManager > 0 {
+		return cfg.MaxConcurrentReadsPerQueueManager
+	}
+	return len(cfg.limitedQueues())
+}
+
+// queueSets returns the configured queue sets preceded by the unnamed default
+// set of the queues configured by 'queues'.
+func (cfg *MqConfiguration) queueSets() []QueueSet {
+	return append([]QueueSet{{Queues: cfg.Queues}}, cfg.QueueSets...)
+}
+
+// queues returns the queues of all queue sets with the settings of their set
+// applied. The labels of a queue take precedence over the labels of its set.
+func (cfg *MqConfiguration) queues() []QueueConfig {
+	xs := make([]QueueConfig, 0)
+	for _, set := range cfg.queueSets() {
+		for _, queue := range set.Queues {
+			if len(set.Labels) > 0 {
+				labels := maps.Clone(set.Labels)
+				maps.Copy(labels, queue.Labels)
+				queue.Labels = labels
+			}
+			queue.Timeout = (*time.Duration)(set.Timeout)
+			queue.DepthWarnThreshold = set.DepthWarnThreshold
+			xs = append(xs, queue)
+		}
+	}
+	return xs
+}
+
+// queueAlias returns the name of the queue in the metrics, which is the queue
+// name unless an alias is configured.
+func (cfg *MqConfiguration) queueAlias(name string) string {
+	if alias, ok := cfg.Aliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// unknownAliases returns the (sorted) queue names of the aliases which are not
+// configured queues, so the alias is never used.
+func (cfg *MqConfiguration) unknownAliases() []string {
+
+	known := make(map[string]bool)
+	for _, queue := range cfg.queues() {
+		known[queue.Name] = true
+	}
+
+	names := make([]string, 0)
+	for name := range cfg.Aliases {
+		if !known[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// limitedQueues returns the queues limited to the first 'maxQueues' ones,
+// which are all if 'maxQueues' is 0.
+func (cfg *MqConfiguration) limitedQueues() []QueueConfig {
+	queues := cfg.queues()
+	if cfg.queueLimitExceeded() {
+		return queues[:cfg.MaxQueues]
+	}
+	return queues
+}
+
+func (cfg *MqConfiguration) queueLimitExceeded() bool {
+	return cfg.MaxQueues > 0 && len(cfg.queues()) > cfg.MaxQueues
+}
+
+// connectionName is the name of the connection used for labels and logging,
+// which is the service name if the connection name is resolved by Consul.
+func (cfg *MqConfiguration) connectionName() string {
+	if cfg.ConnName != "" {
+		return cfg.ConnName
+	}
+	return cfg.ConsulServiceName
+}
+
+// ValidationErrors are all problems of a configuration found by its
+// validation, which are reported at once.
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	problems := make([]string, 0, len(e))
+	for i, err := range e {
+		problems = append(problems, fmt.Sprintf("%d) %s", i+1, err))
+	}
+	return fmt.Sprintf("%d configuration errors: %s", len(e), strings.Join(problems, "; "))
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	return e
+}
+
 func (cfg *MqConfiguration) validateReadFromYaml() error {
 
+	var errs ValidationErrors
+
 	missingMandatoryFields := make([]string, 0, 4)
 
 	if cfg.QueueManager == "" {
 		missingMandatoryFields = append(missingMandatoryFields, "'queueManager'")
 	}
-	if cfg.ConnName == "" {
+	if cfg.ConnName == "" && cfg.ConsulServiceName == "" {
 		missingMandatoryFields = append(missingMandatoryFields, "'connName'")
 	}
 	if cfg.Channel == "" {
@@ -92,202 +493,1819 @@ func (cfg *MqConfiguration) validateReadFromYaml() error {
 	}
 
 	if len(missingMandatoryFields) > 0 {
-		return fmt.Errorf("missing mandatory fields: %s", strings.Join(missingMandatoryFields, ", "))
+		errs = append(errs, fmt.Errorf("missing mandatory fields: %s", strings.Join(missingMandatoryFields, ", ")))
 	}
 
 	if cfg.User == "" && cfg.Password != "" || (cfg.User != "" && cfg.Password == "") {
-		return fmt.Errorf("requires both 'user' and 'password'")
+		errs = append(errs, fmt.Errorf("requires both 'user' and 'password'"))
+	}
+	if cfg.KeyRepository != "" && cfg.usesPEMFiles() {
+		errs = append(errs, fmt.Errorf("requires either 'keyRepository' or 'tlsCACertFile', 'tlsClientCertFile' and 'tlsClientKeyFile'"))
 	}
-	if cfg.SSLCipherSpec == "" && cfg.KeyRepository != "" || (cfg.SSLCipherSpec != "" && cfg.KeyRepository == "") {
-		return fmt.Errorf("requires both 'sslCipherSpec' and 'keyRepository'")
+	if cfg.usesPEMFiles() {
+		if cfg.SSLCipherSpec == "" || cfg.TLSCACertFile == "" {
+			errs = append(errs, fmt.Errorf("requires both 'sslCipherSpec' and 'tlsCACertFile'"))
+		}
+		if cfg.TLSClientCertFile == "" && cfg.TLSClientKeyFile != "" || (cfg.TLSClientCertFile != "" && cfg.TLSClientKeyFile == "") {
+			errs = append(errs, fmt.Errorf("requires both 'tlsClientCertFile' and 'tlsClientKeyFile'"))
+		}
+	} else if cfg.SSLCipherSpec == "" && cfg.KeyRepository != "" || (cfg.SSLCipherSpec != "" && cfg.KeyRepository == "") {
+		errs = append(errs, fmt.Errorf("requires both 'sslCipherSpec' and 'keyRepository'"))
 	}
 
 	if cfg.Timeout == nil || cfg.Timeout.Milliseconds() <= 0 {
-		return fmt.Errorf("requires strict positive 'timeout'")
+		errs = append(errs, fmt.Errorf("requires strict positive 'timeout'"))
+	}
+
+	if cfg.PoolSize <= 0 {
+		errs = append(errs, fmt.Errorf("requires strict positive 'poolSize'"))
+	}
+	if cfg.MaxConcurrentReadsPerQueueManager < 0 {
+		errs = append(errs, fmt.Errorf("requires non negative 'maxConcurrentReads'"))
+	}
+
+	if cfg.MaxQueues < 0 {
+		errs = append(errs, fmt.Errorf("requires non negative 'maxQueues'"))
+	}
+
+	if cfg.CertExpiryRefreshInterval != nil && *cfg.CertExpiryRefreshInterval <= 0 {
+		errs = append(errs, fmt.Errorf("requires strict positive 'certExpiryRefreshInterval'"))
+	}
+
+	if err := validateLabelNames(cfg.LabelNames); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateQueueSets(cfg.QueueSets); err != nil {
+		errs = append(errs, err)
+	}
+
+	if source := cfg.QueueSourceKubernetesConfigMap; source != nil {
+		if source.Name == "" || source.DataKey == "" {
+			errs = append(errs, fmt.Errorf("requires both 'name' and 'dataKey' of 'queueSourceKubernetesConfigMap'"))
+		}
+		if len(cfg.Queues) > 0 {
+			errs = append(errs, fmt.Errorf("requires either 'queues' or 'queueSourceKubernetesConfigMap'"))
+		}
+	}
+
+	if err := validateMetricDescriptions(cfg.MetricDescriptions); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateMaxQueueDepthOverride(cfg.MaxQueueDepthOverride); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateQueues(cfg.queues(), cfg.LabelNames); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateAliases(cfg.queues(), cfg.Aliases); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := cfg.recordingRules(); err != nil {
+		errs = append(errs, err)
 	}
 
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
-type MqConnection struct {
-	isConnecting *int64
-	cfg          *MqConfiguration
-	logger       *slog.Logger
-	qMgr         ibmmq.MQQueueManager
-	queues       map[string]ibmmq.MQObject
-}
+func validateMetricDescriptions(descriptions map[string]string) error {
 
-func NewMqConnection(logger *slog.Logger, cfgFilename string) (*MqConnection, error) {
+	known := make(map[string]bool)
+	for _, name := range collector.QueueMetricNames() {
+		known[name] = true
+	}
 
-	cfg, err := readConfigYaml(cfgFilename)
-	if err != nil {
-		return nil, err
+	names := make([]string, 0, len(descriptions))
+	for name := range descriptions {
+		names = append(names, name)
 	}
-	if err := cfg.validateReadFromYaml(); err != nil {
-		return nil, err
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !known[name] {
+			return fmt.Errorf("unknown metric '%s' in 'metricDescriptions'", name)
+		}
 	}
 
-	c := MqConnection{
-		isConnecting: new(int64),
-		cfg:          cfg,
-		logger:       logger.With("connName", cfg.ConnName, "channel", cfg.Channel, "queueManager", cfg.QueueManager),
+	return nil
+}
+
+func validateMaxQueueDepthOverride(overrides map[string]int32) error {
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
 	}
-	*c.isConnecting = NO
+	sort.Strings(names)
 
-	err = c.connect()
-	if err != nil {
-		return nil, err
+	for _, name := range names {
+		if overrides[name] <= 0 {
+			return fmt.Errorf("requires strict positive 'maxQueueDepthOverride' of queue '%s'", name)
+		}
 	}
 
-	return &c, nil
+	return nil
 }
 
-func (c *MqConnection) connect() error {
+// recordingRules returns the parsed recording rules, whose names must be
+// unique.
+func (cfg *MqConfiguration) recordingRules() ([]collector.RecordingRule, error) {
 
-	if !atomic.CompareAndSwapInt64(c.isConnecting, NO, YES) {
-		return fmt.Errorf("connect still in progress")
+	rules := make([]collector.RecordingRule, 0, len(cfg.RecordingRules))
+	seen := make(map[string]bool)
+	for _, r := range cfg.RecordingRules {
+		if seen[r.Name] {
+			return nil, fmt.Errorf("duplicate recording rule '%s'", r.Name)
+		}
+		seen[r.Name] = true
+
+		rule, err := collector.ParseRecordingRule(r.Name, r.Expr, r.Labels)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
 	}
-	defer func() {
-		atomic.StoreInt64(c.isConnecting, NO)
-		c.logger.Info("connected to queue manager")
-	}()
+	return rules, nil
+}
+
+// validateAliases validates the queue names in the metrics are non empty and
+// unique, e.g. an alias is not the name of another queue.
+func validateAliases(queues []QueueConfig, aliases map[string]string) error {
 
-	if len(c.cfg.Queues) > 0 {
+	seen := make(map[string]string)
+	for _, queue := range queues {
+		alias, ok := aliases[queue.Name]
+		if !ok {
+			alias = queue.Name
+		}
+		if alias == "" {
+			return fmt.Errorf("requires non empty alias of queue '%s'", queue.Name)
+		}
+		if other, ok := seen[alias]; ok {
+			return fmt.Errorf("duplicate name '%s' of queues '%s' and '%s' by 'aliases'", alias, other, queue.Name)
+		}
+		seen[alias] = queue.Name
+	}
 
-		cd := ibmmq.NewMQCD()
-		cd.ChannelName = c.cfg.Channel
-		cd.ConnectionName = c.cfg.ConnName
+	return nil
+}
 
-		cno := ibmmq.NewMQCNO()
-		cno.ClientConn = cd
-		cno.Options = ibmmq.MQCNO_CLIENT_BINDING
+func validateQueueSets(sets []QueueSet) error {
 
-		if c.cfg.User != "" {
-			csp := ibmmq.NewMQCSP()
-			csp.AuthenticationType = ibmmq.MQCSP_AUTH_USER_ID_AND_PWD
-			csp.UserId = c.cfg.User
-			csp.Password = c.cfg.Password
+	seen := make(map[string]bool)
+	for _, set := range sets {
+		if set.Name == "" {
+			return fmt.Errorf("requires non empty queue set 'name'")
+		}
+		if seen[set.Name] {
+			return fmt.Errorf("duplicate queue set '%s'", set.Name)
+		}
+		seen[set.Name] = true
 
-			cno.SecurityParms = csp
+		if set.Timeout != nil && time.Duration(*set.Timeout).Milliseconds() <= 0 {
+			return fmt.Errorf("requires strict positive 'timeout' of queue set '%s'", set.Name)
 		}
+		if set.DepthWarnThreshold != nil && *set.DepthWarnThreshold <= 0 {
+			return fmt.Errorf("requires strict positive 'depthWarnThreshold' of queue set '%s'", set.Name)
+		}
+	}
+
+	return nil
+}
 
-		if c.cfg.SSLCipherSpec != "" {
-			cd.SSLCipherSpec = c.cfg.SSLCipherSpec
-			cd.SSLClientAuth = ibmmq.MQSCA_OPTIONAL
+func validateQueues(queues []QueueConfig, labelNames collector.LabelNames) error {
 
-			sco := ibmmq.NewMQSCO()
-			sco.KeyRepository = c.cfg.KeyRepository
+	builtin := map[string]bool{
+		labelNames.Name:         true,
+		labelNames.Connection:   true,
+		labelNames.QueueManager: true,
+		labelNames.Channel:      true,
+		"storage_class":         true,
+		"usage":                 true,
+		"cluster":               true,
+		"index_type":            true,
+		"le":                    true,
+	}
 
-			cno.SSLConfig = sco
+	seen := make(map[string]bool)
+	for _, queue := range queues {
+		if queue.Name == "" {
+			return fmt.Errorf("requires non empty queue 'name'")
 		}
+		if seen[queue.Name] {
+			return fmt.Errorf("duplicate queue '%s'", queue.Name)
+		}
+		seen[queue.Name] = true
 
-		qMgr, err := ibmmq.Connx(c.cfg.QueueManager, cno)
-		if err != nil {
-			return err
+		for _, name := range queue.CollectMetrics {
+			if _, ok := selectorsByMetricName[name]; !ok {
+				return fmt.Errorf("unknown metric '%s' in 'collectMetrics' of queue '%s'", name, queue.Name)
+			}
 		}
-		c.qMgr = qMgr
 
-		c.queues = make(map[string]ibmmq.MQObject)
-		for _, qName := range c.cfg.Queues {
-			od := ibmmq.NewMQOD()
-			od.ObjectType = ibmmq.MQOT_Q
-			od.ObjectName = qName
-			queue, err := qMgr.Open(od, ibmmq.MQOO_INQUIRE)
-			if err != nil {
-				return err
+		if queue.Tenant != "" && !tenantPattern.MatchString(queue.Tenant) {
+			return fmt.Errorf("invalid tenant '%s' of queue '%s'", queue.Tenant, queue.Name)
+		}
+
+		for name := range queue.Labels {
+			if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+				return fmt.Errorf("invalid label name '%s' for queue '%s'", name, queue.Name)
+			}
+			if builtin[name] {
+				return fmt.Errorf("label name '%s' for queue '%s' conflicts with built-in label", name, queue.Name)
 			}
-			c.queues[qName] = queue
 		}
 	}
+
 	return nil
 }
 
-func (c *MqConnection) handleReturnValue(mqret *ibmmq.MQReturn) {
-	if mqret.MQCC == ibmmq.MQCC_FAILED && mqret.MQRC == ibmmq.MQRC_CONNECTION_BROKEN {
-		go func() {
-			err := c.connect()
-			if err != nil {
-				c.logger.Error("failed re-connect", "err", err)
-			}
-		}()
+func validateLabelNames(labelNames collector.LabelNames) error {
+
+	names := []struct {
+		attribute string
+		value     string
+	}{
+		{"name", labelNames.Name},
+		{"connection", labelNames.Connection},
+		{"queueManager", labelNames.QueueManager},
+		{"channel", labelNames.Channel},
 	}
-	// syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+
+	seen := map[string]bool{"storage_class": true, "usage": true}
+	for _, n := range names {
+		if n.value == "" {
+			return fmt.Errorf("requires non empty 'labelNames.%s'", n.attribute)
+		}
+		if !labelNamePattern.MatchString(n.value) || strings.HasPrefix(n.value, "__") {
+			return fmt.Errorf("invalid label name '%s' for 'labelNames.%s'", n.value, n.attribute)
+		}
+		if seen[n.value] {
+			return fmt.Errorf("duplicate label name '%s' for 'labelNames.%s'", n.value, n.attribute)
+		}
+		seen[n.value] = true
+	}
+
+	return nil
 }
 
-func (c *MqConnection) resolveQueue(q *MqQueue) ibmmq.MQObject {
-	return c.queues[q.metadata.QueueName]
+// MQQueueManager are the MQI calls of a connected *ibmmq.MQQueueManager used
+// by the connection, so they can be replaced in tests.
+type MQQueueManager interface {
+	Open(od *ibmmq.MQOD, openOptions int32) (ibmmq.MQObject, error)
+	Disc() error
 }
 
-func (c *MqConnection) inqQueue(q *MqQueue, goSelectors []int32) (map[int32]interface{}, error) {
-	values, err := c.resolveQueue(q).Inq(goSelectors)
+// connx connects to the queue manager by MQCONNX.
+func connx(qMgrName string, cno *ibmmq.MQCNO) (MQQueueManager, error) {
+	qMgr, err := ibmmq.Connx(qMgrName, cno)
 	if err != nil {
-		go c.handleReturnValue(err.(*ibmmq.MQReturn))
+		return nil, err
 	}
-	return values, err
+	return &qMgr, nil
 }
 
-func (c *MqConnection) Queues() []collector.Queue {
-	xs := make([]collector.Queue, 0)
-	for queue := range c.queues {
-		metadata := collector.QueueMetadata{
-			QueueName:      queue,
-			ConnectionName: c.cfg.ConnName,
-			QMgrName:       c.cfg.QueueManager,
-			ChannelName:    c.cfg.Channel,
-		}
-		xs = append(xs, collector.Queue{
-			Metadata: metadata,
-			Reader: &MqQueue{
-				connection: c,
-				logger:     c.logger.With("queue", queue),
-				metadata:   metadata,
-			},
-		})
+// poolHandle is a connection to the queue manager with its own open queues.
+type poolHandle struct {
+	qMgr   MQQueueManager
+	queues map[string]ibmmq.MQObject
+
+	// connectDuration is the duration of MQCONNX including the TLS handshake.
+	connectDuration time.Duration
+
+	// poisoned is set once the handle is disconnected, e.g. by a canceled
+	// inquiry, so it's never acquired again.
+	poisoned atomic.Bool
+}
+
+// errPoolExhausted is returned on acquire if all handles of the pool are
+// poisoned.
+var errPoolExhausted = errors.New("all handles of the connection pool are disconnected")
+
+// ConnectionPool maintains the handles of a MQ connection. A handle is
+// acquired for exclusive use and must be released afterwards. A poisoned
+// handle is discarded on release or acquire instead of being handed out.
+type ConnectionPool struct {
+	handles   []*poolHandle
+	available chan *poolHandle
+
+	// exhausted is closed once all handles are poisoned.
+	exhausted     chan struct{}
+	exhaustedOnce sync.Once
+}
+
+func newConnectionPool(handles []*poolHandle) *ConnectionPool {
+	p := &ConnectionPool{
+		handles:   handles,
+		available: make(chan *poolHandle, len(handles)),
+		exhausted: make(chan struct{}),
 	}
-	return xs
+	for _, handle := range handles {
+		p.available <- handle
+	}
+	return p
 }
 
-func (c *MqConnection) Close() {
-	for _, queue := range c.queues {
-		err := queue.Close(0)
-		if err == nil {
-			c.logger.Info("closed queue", "queue", queue.Name)
-		} else {
-			c.logger.Error("failed to close queue", "err", err, "queue", queue.Name)
+// acquire returns an available handle which is not poisoned, it fails if all
+// handles of the pool are poisoned.
+func (p *ConnectionPool) acquire() (*poolHandle, error) {
+	for {
+		select {
+		case handle := <-p.available:
+			if !handle.poisoned.Load() {
+				return handle, nil
+			}
+			p.discard()
+		case <-p.exhausted:
+			return nil, errPoolExhausted
 		}
 	}
-	err := c.qMgr.Disc()
-	if err == nil {
-		c.logger.Info("disconnected from queue manager")
-	} else {
-		c.logger.Error("failed to disconnect from queue manager", "err", err)
+}
+
+func (p *ConnectionPool) release(handle *poolHandle) {
+	if handle.poisoned.Load() {
+		p.discard()
+		return
 	}
+	p.available <- handle
 }
 
-func (c *MqConnection) Timeout() time.Duration {
-	return *c.cfg.Timeout
+// discard drops a poisoned handle and closes exhausted if no handle is left.
+func (p *ConnectionPool) discard() {
+	for _, handle := range p.handles {
+		if !handle.poisoned.Load() {
+			return
+		}
+	}
+	p.exhaustedOnce.Do(func() { close(p.exhausted) })
 }
 
-type MqQueue struct {
-	connection *MqConnection
-	logger     *slog.Logger
-	metadata   collector.QueueMetadata
+func (p *ConnectionPool) Size() int {
+	return len(p.handles)
 }
 
-func (q *MqQueue) Read() (collector.QueueMetrics, error) {
-	start := time.Now()
-	values, err := q.connection.inqQueue(q, selectors)
-	if err != nil {
-		err := err.(*ibmmq.MQReturn)
-		q.logger.Error("error inquire queue", "err", err, "mqcc", err.MQCC, "mqcr", err.MQRC)
-		return collector.QueueMetrics{}, err
-	}
-	return collector.QueueMetrics{
+func (p *ConnectionPool) Available() int {
+	return len(p.available)
+}
+
+type MqConnection struct {
+	isConnecting *int64
+	cfg          *MqConfiguration
+	logger       *slog.Logger
+	resolver     consul.ConsulResolver
+	connName     string
+
+	// configMapSource provides the queues if configured by
+	// 'queueSourceKubernetesConfigMap', configMapQueues are the queue names
+	// of its last read which are connected.
+	configMapSource *kubernetes.ConfigMapSource
+	configMapQueues []string
+	connx           func(qMgrName string, cno *ibmmq.MQCNO) (MQQueueManager, error)
+	done            chan struct{}
+
+	// poolMutex guards the swap of the pool, its first handle qMgr, the
+	// queues, the keepalive queue and the queues of the configuration on
+	// (re-)connect. The queue manager
+	// handle is used by PCF commands and browsing under pcfMutex, which is
+	// held on the swap as well.
+	poolMutex sync.RWMutex
+	qMgr      MQQueueManager
+	queues    map[string]ibmmq.MQObject
+	pool      *ConnectionPool
+
+	// reads limits the queue inquiries in progress of all generations of
+	// the queues.
+	reads chan struct{}
+
+	pemKeyRepository  *pemKeyRepository
+	certExpiryChecker *CertExpiryChecker
+
+	keepaliveQueue       ibmmq.MQObject
+	lastKeepaliveSuccess int64
+	lastConnect          int64
+
+	// reconnectGeneration is incremented on each successful (re-)connect.
+	reconnectGeneration atomic.Uint64
+	onReconnect         func(queues []collector.Queue, generation int64)
+
+	// connectDuration is the duration of the slowest MQCONNX of the handles
+	// of the last (re-)connect, reconnectDuration the sum of these durations
+	// of all re-connects.
+	connectDuration   atomic.Int64
+	reconnectDuration atomic.Int64
+
+	pcfMutex      sync.Mutex
+	pcfQueuesOpen bool
+	commandQueue  ibmmq.MQObject
+	replyQueue    ibmmq.MQObject
+
+	// The event queues are opened for browsing on the first read of the
+	// events and guarded by pcfMutex as they share the queue manager handle.
+	eventQueue      browsedQueue
+	depthEventQueue browsedQueue
+}
+
+// StartupRetry configures the retries of the initial connect while the queue
+// manager is stopping or quiescing. The interval is doubled on each retry.
+type StartupRetry struct {
+	Count    int
+	Interval time.Duration
+}
+
+func NewMqConnection(logger *slog.Logger, cfgFilename string, keepaliveInterval time.Duration, retry StartupRetry) (*MqConnection, error) {
+
+	cfg, err := readConfigYaml(cfgFilename)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.validateReadFromYaml(); err != nil {
+		return nil, err
+	}
+
+	// the queues of the ConfigMap are read before the connection is set up,
+	// e.g. the limit of the concurrent reads depends on them
+	var configMapSource *kubernetes.ConfigMapSource
+	var configMapQueues []string
+	var resourceVersion string
+	if source := cfg.QueueSourceKubernetesConfigMap; source != nil {
+		configMapSource, err = kubernetes.NewInClusterConfigMapSource(source.Namespace, source.Name, source.DataKey)
+		if err != nil {
+			return nil, err
+		}
+		configMapQueues, resourceVersion, err = configMapSource.Read()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Queues = queueConfigs(configMapQueues)
+		if err := validateQueues(cfg.queues(), cfg.LabelNames); err != nil {
+			return nil, err
+		}
+	}
+
+	c := MqConnection{
+		isConnecting: new(int64),
+		cfg:          cfg,
+		logger:       logger.With("connName", cfg.connectionName(), "channel", cfg.Channel, "queueManager", cfg.QueueManager),
+		connx:        connx,
+		done:         make(chan struct{}),
+		reads:        make(chan struct{}, cfg.maxConcurrentReads()),
+
+		configMapSource: configMapSource,
+		configMapQueues: configMapQueues,
+	}
+	*c.isConnecting = NO
+	for _, name := range cfg.unknownAliases() {
+		c.logger.Warn("alias of unknown queue is ignored", "queue", name, "alias", cfg.Aliases[name])
+	}
+	c.eventQueue.name = c.eventQueueName()
+	c.depthEventQueue.name = performanceEventQueueName
+
+	if cfg.ConsulServiceName != "" {
+		c.resolver = consul.NewDefaultConsulResolver()
+	}
+
+	if cfg.usesPEMFiles() {
+		c.pemKeyRepository, err = cfg.createPEMKeyRepository()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = c.connectOnStartup(retry)
+	if err != nil {
+		c.removePEMKeyRepository()
+		return nil, err
+	}
+
+	if keepaliveInterval > 0 && len(cfg.limitedQueues()) > 0 {
+		go c.keepalive(keepaliveInterval)
+	}
+
+	if paths := cfg.certExpiryCheckPaths(); len(paths) > 0 {
+		c.certExpiryChecker = newCertExpiryChecker(c.logger, paths)
+		c.certExpiryChecker.check()
+		go c.certExpiryChecker.run(*cfg.CertExpiryRefreshInterval, c.done)
+	}
+
+	if c.configMapSource != nil {
+		go c.watchConfigMap(resourceVersion)
+	}
+
+	return &c, nil
+}
+
+// keepaliveQueueName returns the name of the keepalive queue, which is the
+// first of the queues unless configured.
+func (c *MqConnection) keepaliveQueueName(queues []QueueConfig) string {
+	if c.cfg.KeepaliveQueue != "" {
+		return c.cfg.KeepaliveQueue
+	}
+	return queues[0].Name
+}
+
+// limitedQueues returns the queues of the configuration limited to the first
+// 'maxQueues' ones, which are replaced on a reload of the queues.
+func (c *MqConnection) limitedQueues() []QueueConfig {
+	c.poolMutex.RLock()
+	defer c.poolMutex.RUnlock()
+
+	return c.cfg.limitedQueues()
+}
+
+// queueLimitExceeded reports whether the number of queues of the
+// configuration exceeds 'maxQueues'.
+func (c *MqConnection) queueLimitExceeded() bool {
+	c.poolMutex.RLock()
+	defer c.poolMutex.RUnlock()
+
+	return c.cfg.queueLimitExceeded()
+}
+
+func (c *MqConnection) keepalive(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.poolMutex.RLock()
+			keepaliveQueue := c.keepaliveQueue
+			c.poolMutex.RUnlock()
+			if _, err := keepaliveQueue.Inq([]int32{ibmmq.MQIA_CURRENT_Q_DEPTH}); err != nil {
+				c.logger.Warn("keepalive failed", "err", err, "queue", keepaliveQueue.Name)
+				c.handleReturnValue(err)
+				continue
+			}
+			atomic.StoreInt64(&c.lastKeepaliveSuccess, time.Now().UnixNano())
+		}
+	}
+}
+
+func (c *MqConnection) connect() error {
+	c.poolMutex.RLock()
+	queues := c.cfg.Queues
+	c.poolMutex.RUnlock()
+
+	return c.connectQueues(queues)
+}
+
+// connectQueues (re-)connects to the queue manager with the queues, which
+// replace the queues of the configuration once the connect succeeded.
+func (c *MqConnection) connectQueues(queues []QueueConfig) error {
+
+	if !atomic.CompareAndSwapInt64(c.isConnecting, NO, YES) {
+		return fmt.Errorf("connect still in progress")
+	}
+	defer atomic.StoreInt64(c.isConnecting, NO)
+
+	c.poolMutex.RLock()
+	cfg := *c.cfg
+	c.poolMutex.RUnlock()
+	cfg.Queues = queues
+	limitedQueues := cfg.limitedQueues()
+
+	if cfg.queueLimitExceeded() {
+		c.logger.Warn("number of queues exceeds 'maxQueues', queues are truncated", "queues", len(cfg.queues()), "maxQueues", cfg.MaxQueues)
+	}
+
+	if len(limitedQueues) > 0 || len(cfg.Channels) > 0 || cfg.EnableEventMonitoring || cfg.EnableDepthEventCounting {
+
+		if err := c.resolveConnName(); err != nil {
+			return err
+		}
+
+		handles := make([]*poolHandle, 0, cfg.PoolSize)
+		for i := 0; i < cfg.PoolSize; i++ {
+			handle, err := c.connectHandle(limitedQueues)
+			if err != nil {
+				c.discHandles(handles)
+				return err
+			}
+			handles = append(handles, handle)
+		}
+		c.recordConnectDuration(handles)
+
+		var keepaliveQueue ibmmq.MQObject
+		if len(limitedQueues) > 0 {
+			if queue, ok := handles[0].queues[c.keepaliveQueueName(limitedQueues)]; ok {
+				keepaliveQueue = queue
+			} else {
+				queue, err := openQueue(handles[0].qMgr, c.keepaliveQueueName(limitedQueues))
+				if err != nil {
+					c.discHandles(handles)
+					return err
+				}
+				keepaliveQueue = queue
+			}
+		}
+
+		c.pcfMutex.Lock()
+		c.pcfQueuesOpen = false
+		c.eventQueue.open = false
+		c.depthEventQueue.open = false
+
+		c.poolMutex.Lock()
+		previous := c.pool
+		c.pool = newConnectionPool(handles)
+		c.qMgr = handles[0].qMgr
+		c.queues = handles[0].queues
+		c.keepaliveQueue = keepaliveQueue
+		c.cfg.Queues = queues
+		c.poolMutex.Unlock()
+		c.pcfMutex.Unlock()
+
+		// the PCF and event queues of the previous connection are closed
+		// by the disconnect of its first handle
+		if previous != nil {
+			go c.closePool(previous)
+		}
+
+		atomic.StoreInt64(&c.lastConnect, time.Now().UnixNano())
+
+		generation := int64(c.reconnectGeneration.Add(1))
+		if c.onReconnect != nil {
+			c.onReconnect(c.Queues(), generation)
+		}
+	}
+	c.logger.Info("connected to queue manager")
+	return nil
+}
+
+// discHandles disconnects the handles of a failed connect, which closes their
+// open queues as well.
+func (c *MqConnection) discHandles(handles []*poolHandle) {
+	for _, handle := range handles {
+		if err := handle.qMgr.Disc(); err != nil {
+			c.logger.Debug("failed to disconnect handle of failed connect from queue manager", "err", err)
+		}
+	}
+}
+
+// connectOnStartup connects to the queue manager and retries the connect if
+// the queue manager is stopping or quiescing, other errors fail immediately.
+func (c *MqConnection) connectOnStartup(retry StartupRetry) error {
+
+	interval := retry.Interval
+	for remaining := retry.Count; ; remaining-- {
+		err := c.connect()
+		if err == nil || remaining <= 0 || !retryOnStartup(err) {
+			return err
+		}
+		c.logger.Warn("queue manager not available, retry connect", "err", err, "interval", interval, "remainingRetries", remaining-1)
+		time.Sleep(interval)
+		interval *= 2
+	}
+}
+
+// retryOnStartup reports whether the initial connect is retried on the error,
+// which is the case if the queue manager is stopping or quiescing.
+func retryOnStartup(err error) bool {
+	mqerr := newMQError(err)
+	return errors.Is(mqerr, ErrQueueManagerStopping) || errors.Is(mqerr, ErrQueueManagerQuiescing)
+}
+
+// recordConnectDuration records the connect duration of the handles of a
+// successful (re-)connect.
+func (c *MqConnection) recordConnectDuration(handles []*poolHandle) {
+	var d time.Duration
+	for _, handle := range handles {
+		d = max(d, handle.connectDuration)
+	}
+	c.connectDuration.Store(int64(d))
+	if c.reconnectGeneration.Load() > 0 {
+		c.reconnectDuration.Add(int64(d))
+	}
+}
+
+// OnReconnect sets the function which is called with the queues and the
+// generation of the connection after each successful re-connect, e.g.
+// QueueCollector.SetQueues.
+func (c *MqConnection) OnReconnect(f func(queues []collector.Queue, generation int64)) {
+	c.onReconnect = f
+}
+
+// Generation returns the number of successful (re-)connects.
+func (c *MqConnection) Generation() int64 {
+	return int64(c.reconnectGeneration.Load())
+}
+
+// queueConfigs returns the configuration of the queues by their names.
+func queueConfigs(names []string) []QueueConfig {
+	xs := make([]QueueConfig, 0, len(names))
+	for _, name := range names {
+		xs = append(xs, QueueConfig{Name: name})
+	}
+	return xs
+}
+
+// watchConfigMap reloads the queues on each change of the ConfigMap until the
+// connection is closed. The watch is restarted after a failure with the
+// queues of the ConfigMap read again.
+func (c *MqConnection) watchConfigMap(resourceVersion string) {
+
+	for {
+		err := c.configMapSource.Watch(resourceVersion, c.reloadQueues, c.done)
+		if err != nil {
+			c.logger.Warn("watch of configmap failed", "err", err)
+		}
+
+		select {
+		case <-c.done:
+			return
+		case <-time.After(configMapWatchRetryInterval):
+		}
+
+		queues, version, err := c.configMapSource.Read()
+		if err != nil {
+			c.logger.Error("failed to read configmap", "err", err)
+			continue
+		}
+		resourceVersion = version
+		c.reloadQueues(queues)
+	}
+}
+
+// reloadQueues re-connects with the queues of the ConfigMap if they changed,
+// so the queues are opened and passed to OnReconnect, e.g. the collector. The
+// handles of the previous connection are closed afterwards. An empty or
+// invalid list of queues is ignored, the queues of a failed re-connect are
+// retried on the next change or read of the ConfigMap.
+func (c *MqConnection) reloadQueues(names []string) {
+
+	if slices.Equal(names, c.configMapQueues) {
+		return
+	}
+	if len(names) == 0 {
+		c.logger.Warn("configmap without queues is ignored")
+		return
+	}
+
+	c.poolMutex.RLock()
+	cfg := *c.cfg
+	c.poolMutex.RUnlock()
+	cfg.Queues = queueConfigs(names)
+	if err := validateQueues(cfg.queues(), cfg.LabelNames); err != nil {
+		c.logger.Error("invalid queues of configmap are ignored", "err", err)
+		return
+	}
+
+	c.logger.Info("queues of configmap changed", "queues", len(names))
+	if err := c.connectQueues(cfg.Queues); err != nil {
+		c.logger.Error("failed re-connect with queues of configmap", "err", err)
+		return
+	}
+	c.configMapQueues = names
+}
+
+// resolveConnName sets the connection name of the queue manager, which is
+// re-resolved by Consul on each (re-)connect if configured.
+func (c *MqConnection) resolveConnName() error {
+	if c.resolver == nil {
+		c.connName = c.cfg.ConnName
+		return nil
+	}
+
+	connName, err := c.resolver.Resolve(c.cfg.ConsulServiceName)
+	if err != nil {
+		if c.cfg.ConnName == "" {
+			return err
+		}
+		c.logger.Warn("failed to resolve connection name by consul, fall back to 'connName'", "err", err)
+		connName = c.cfg.ConnName
+	}
+	c.connName = connName
+	return nil
+}
+
+// connectHandle connects to the queue manager and opens the configured
+// queues for a handle of the connection pool.
+func (c *MqConnection) connectHandle(limitedQueues []QueueConfig) (*poolHandle, error) {
+
+	cd := ibmmq.NewMQCD()
+	cd.ChannelName = c.cfg.Channel
+	cd.ConnectionName = c.connName
+
+	cno := ibmmq.NewMQCNO()
+	cno.ClientConn = cd
+	cno.Options = ibmmq.MQCNO_CLIENT_BINDING | ibmmq.MQCNO_HANDLE_SHARE_BLOCK
+
+	if c.cfg.User != "" {
+		csp := ibmmq.NewMQCSP()
+		csp.AuthenticationType = ibmmq.MQCSP_AUTH_USER_ID_AND_PWD
+		csp.UserId = c.cfg.User
+		csp.Password = c.cfg.Password
+
+		cno.SecurityParms = csp
+	}
+
+	if c.cfg.SSLCipherSpec != "" {
+		cd.SSLCipherSpec = c.cfg.SSLCipherSpec
+		cd.SSLClientAuth = ibmmq.MQSCA_OPTIONAL
+
+		sco := ibmmq.NewMQSCO()
+		sco.KeyRepository = c.cfg.KeyRepository
+		if c.pemKeyRepository != nil {
+			sco.KeyRepository = c.pemKeyRepository.path
+			sco.KeyRepoPassword = c.pemKeyRepository.password
+		}
+
+		cno.SSLConfig = sco
+	}
+
+	start := time.Now()
+	qMgr, err := c.connx(c.cfg.QueueManager, cno)
+	if err != nil {
+		return nil, err
+	}
+	connectDuration := time.Since(start)
+
+	queues := make(map[string]ibmmq.MQObject)
+	for _, q := range limitedQueues {
+		queue, err := openQueue(qMgr, q.Name)
+		if err != nil {
+			if err := qMgr.Disc(); err != nil {
+				c.logger.Debug("failed to disconnect from queue manager", "err", err)
+			}
+			return nil, err
+		}
+		queues[q.Name] = queue
+	}
+
+	return &poolHandle{qMgr: qMgr, queues: queues, connectDuration: connectDuration}, nil
+}
+
+func openQueue(qMgr MQQueueManager, qName string) (ibmmq.MQObject, error) {
+	od := ibmmq.NewMQOD()
+	od.ObjectType = ibmmq.MQOT_Q
+	od.ObjectName = qName
+	return qMgr.Open(od, ibmmq.MQOO_INQUIRE)
+}
+
+func (c *MqConnection) handleReturnValue(err error) error {
+	mqerr := newMQError(err)
+	if errors.Is(mqerr, ErrConnectionBroken) {
+		go c.reconnect()
+	}
+	// syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	return mqerr
+}
+
+func (c *MqConnection) reconnect() {
+	if err := c.connect(); err != nil {
+		c.logger.Error("failed re-connect", "err", err)
+	}
+}
+
+// currentPool returns the connection pool of the last (re-)connect.
+func (c *MqConnection) currentPool() *ConnectionPool {
+	c.poolMutex.RLock()
+	defer c.poolMutex.RUnlock()
+
+	return c.pool
+}
+
+func (c *MqConnection) inqQueue(q *MqQueue, goSelectors []int32) (map[int32]interface{}, error) {
+	pool := c.currentPool()
+	handle, err := pool.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer pool.release(handle)
+
+	q.inquiring.Store(handle)
+	defer q.inquiring.Store(nil)
+
+	queue, ok := handle.queues[q.name]
+	if !ok {
+		return nil, fmt.Errorf("queue '%s' is not open on the connection", q.name)
+	}
+	values, err := queue.Inq(goSelectors)
+	if err != nil {
+		return nil, c.handleReturnValue(err)
+	}
+	return values, nil
+}
+
+func (c *MqConnection) Queues() []collector.Queue {
+	xs := make([]collector.Queue, 0)
+	for _, queue := range c.limitedQueues() {
+		metadata := collector.QueueMetadata{
+			QueueName:      c.cfg.queueAlias(queue.Name),
+			ConnectionName: c.cfg.connectionName(),
+			QMgrName:       c.cfg.QueueManager,
+			ChannelName:    c.cfg.Channel,
+			ExtraLabels:    queue.Labels,
+		}
+		var reader collector.QueueMetricsReader = NewStickyQueueMetricsReader(&MqQueue{
+			connection:     c,
+			logger:         c.logger.With("queue", queue.Name),
+			name:           queue.Name,
+			metadata:       metadata,
+			selectors:      queue.selectors(),
+			collectMetrics: queue.CollectMetrics,
+		})
+		if maxDepth, ok := c.cfg.MaxQueueDepthOverride[queue.Name]; ok {
+			reader = NewOverridingQueueMetricsReader(reader, maxDepth)
+		}
+		q := collector.Queue{
+			Metadata:  metadata,
+			Reader:    reader,
+			ReadLimit: c.reads,
+		}
+		if queue.Timeout != nil {
+			q.Timeout = *queue.Timeout
+		}
+		if queue.DepthWarnThreshold != nil {
+			q.DepthWarnThreshold = *queue.DepthWarnThreshold
+		}
+		xs = append(xs, q)
+	}
+	return xs
+}
+
+func (c *MqConnection) Close() {
+	close(c.done)
+
+	c.poolMutex.RLock()
+	pool, queues, keepaliveQueue := c.pool, c.queues, c.keepaliveQueue
+	c.poolMutex.RUnlock()
+
+	if limitedQueues := c.limitedQueues(); len(limitedQueues) > 0 {
+		if _, ok := queues[c.keepaliveQueueName(limitedQueues)]; !ok {
+			err := keepaliveQueue.Close(0)
+			if err != nil {
+				c.logger.Error("failed to close keepalive queue", "err", err, "queue", keepaliveQueue.Name)
+			}
+		}
+	}
+	c.closePCFQueues()
+	c.closeBrowsedQueue(&c.eventQueue)
+	c.closeBrowsedQueue(&c.depthEventQueue)
+
+	if pool != nil {
+		for _, handle := range pool.handles {
+			c.closeHandle(handle)
+		}
+	}
+	c.removePEMKeyRepository()
+}
+
+// closePool disconnects the handles of the connection pool of a previous
+// connect one after another once they are released by the inquiries in
+// progress. The disconnect closes the open queues of the handle as well. The
+// handles are poisoned, the ones already poisoned are disconnected by their
+// cancel.
+func (c *MqConnection) closePool(pool *ConnectionPool) {
+	for {
+		handle, err := pool.acquire()
+		if err != nil {
+			return
+		}
+		handle.poisoned.Store(true)
+		// the connection of the handle is usually broken already
+		if err := handle.qMgr.Disc(); err != nil {
+			c.logger.Debug("failed to disconnect previous connection from queue manager", "err", err)
+		}
+		pool.release(handle)
+	}
+}
+
+func (c *MqConnection) closeHandle(handle *poolHandle) {
+	for _, queue := range handle.queues {
+		err := queue.Close(0)
+		if err == nil {
+			c.logger.Info("closed queue", "queue", queue.Name)
+		} else {
+			c.logger.Error("failed to close queue", "err", err, "queue", queue.Name)
+		}
+	}
+
+	err := handle.qMgr.Disc()
+	if err == nil {
+		c.logger.Info("disconnected from queue manager")
+	} else {
+		c.logger.Error("failed to disconnect from queue manager", "err", err)
+	}
+}
+
+func (c *MqConnection) removePEMKeyRepository() {
+	if c.pemKeyRepository == nil {
+		return
+	}
+	if err := os.Remove(c.pemKeyRepository.path); err != nil {
+		c.logger.Error("failed to remove key repository", "err", err, "path", c.pemKeyRepository.path)
+	}
+}
+
+func (c *MqConnection) Timeout() time.Duration {
+	return *c.cfg.Timeout
+}
+
+func (c *MqConnection) LabelNames() collector.LabelNames {
+	return c.cfg.LabelNames
+}
+
+func (c *MqConnection) MetricDescriptions() map[string]string {
+	return c.cfg.MetricDescriptions
+}
+
+// RecordingRules returns the (validated) recording rules.
+func (c *MqConnection) RecordingRules() []collector.RecordingRule {
+	rules, _ := c.cfg.recordingRules()
+	return rules
+}
+
+// Tenants returns the sorted, distinct tenants of the queues.
+func (c *MqConnection) Tenants() []string {
+	seen := make(map[string]bool)
+	tenants := make([]string, 0)
+	for _, queue := range c.limitedQueues() {
+		if queue.Tenant != "" && !seen[queue.Tenant] {
+			seen[queue.Tenant] = true
+			tenants = append(tenants, queue.Tenant)
+		}
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// Tenant returns the tenant of the queue, which is empty if the queue is
+// unknown or has no tenant.
+func (c *MqConnection) Tenant(metadata collector.QueueMetadata) string {
+	for _, queue := range c.limitedQueues() {
+		if c.cfg.queueAlias(queue.Name) == metadata.QueueName {
+			return queue.Tenant
+		}
+	}
+	return ""
+}
+
+func (c *MqConnection) ConnectionMetrics() collector.ConnectionMetrics {
+	m := collector.ConnectionMetrics{
+		Metadata: collector.ConnectionMetadata{
+			ConnectionName: c.cfg.connectionName(),
+			QMgrName:       c.cfg.QueueManager,
+			ChannelName:    c.cfg.Channel,
+		},
+		QueueLimitExceeded:     c.queueLimitExceeded(),
+		ConnectDuration:        time.Duration(c.connectDuration.Load()),
+		ReconnectDurationTotal: time.Duration(c.reconnectDuration.Load()),
+	}
+	if t := atomic.LoadInt64(&c.lastKeepaliveSuccess); t != 0 {
+		m.LastKeepaliveSuccess = time.Unix(0, t)
+	}
+	if t := atomic.LoadInt64(&c.lastConnect); t != 0 {
+		m.LastConnect = time.Unix(0, t)
+	}
+	if pool := c.currentPool(); pool != nil {
+		m.PoolSize = pool.Size()
+		m.PoolAvailable = pool.Available()
+	}
+	if c.certExpiryChecker != nil {
+		m.CertExpiries = c.certExpiryChecker.Expiries()
+	}
+	return m
+}
+
+type MqQueue struct {
+	connection *MqConnection
+	logger     *slog.Logger
+	// name of the queue, the one of the metadata may be an alias
+	name           string
+	metadata       collector.QueueMetadata
+	selectors      []int32
+	collectMetrics []string
+
+	// inquiring is the handle of the connection pool of the inquiry in
+	// progress, nil otherwise.
+	inquiring atomic.Pointer[poolHandle]
+}
+
+// Cancel abandons the handle of the connection pool of the inquiry of the
+// queue in progress. The handle is poisoned, so it's never acquired again,
+// and disconnected, and the connection is re-established. The MQINQ itself
+// isn't interrupted, as the disconnect of a handle shared with blocking
+// (MQCNO_HANDLE_SHARE_BLOCK) waits for it.
+func (q *MqQueue) Cancel() {
+
+	handle := q.inquiring.Load()
+	if handle == nil || !handle.poisoned.CompareAndSwap(false, true) {
+		return
+	}
+
+	q.logger.Warn("abandon handle of inquiry of queue and re-connect to queue manager")
+	go func() {
+		if err := handle.qMgr.Disc(); err != nil {
+			q.logger.Error("failed to disconnect from queue manager", "err", err)
+		}
+		q.connection.reconnect()
+	}()
+}
+
+func (q *MqQueue) Read() (collector.QueueMetrics, error) {
+	start := time.Now()
+	values, err := q.connection.inqQueue(q, q.selectors)
+	if err != nil {
+		var mqret *ibmmq.MQReturn
+		if errors.As(err, &mqret) {
+			q.logger.Error("error inquire queue", "err", err, "mqcc", mqret.MQCC, "mqcr", mqret.MQRC)
+		} else {
+			q.logger.Error("error inquire queue", "err", err)
+		}
+		return collector.QueueMetrics{}, err
+	}
+	m := collector.QueueMetrics{
 		Metadata:        q.metadata,
-		MaxDepth:        values[ibmmq.MQIA_MAX_Q_DEPTH].(int32),
-		CurrentDepth:    values[ibmmq.MQIA_CURRENT_Q_DEPTH].(int32),
-		OpenInputCount:  values[ibmmq.MQIA_OPEN_INPUT_COUNT].(int32),
-		OpenOutputCount: values[ibmmq.MQIA_OPEN_OUTPUT_COUNT].(int32),
+		CollectMetrics:  q.collectMetrics,
+		MaxDepth:        int32Value(values, ibmmq.MQIA_MAX_Q_DEPTH),
+		CurrentDepth:    int32Value(values, ibmmq.MQIA_CURRENT_Q_DEPTH),
+		OpenInputCount:  int32Value(values, ibmmq.MQIA_OPEN_INPUT_COUNT),
+		OpenOutputCount: int32Value(values, ibmmq.MQIA_OPEN_OUTPUT_COUNT),
+		StorageClass:    stringValue(values, ibmmq.MQCA_STORAGE_CLASS),
+		Usage:           queueUsageName(int32Value(values, ibmmq.MQIA_USAGE)),
+		ClusterName:     stringValue(values, ibmmq.MQCA_CLUSTER_NAME),
+		IndexType:       indexTypeName(int32Value(values, ibmmq.MQIA_INDEX_TYPE)),
 		RequestDuration: time.Since(start),
+
+		DepthHighEventEnabled: int32Value(values, ibmmq.MQIA_Q_DEPTH_HIGH_EVENT) == ibmmq.MQEVR_ENABLED,
+		DepthLowEventEnabled:  int32Value(values, ibmmq.MQIA_Q_DEPTH_LOW_EVENT) == ibmmq.MQEVR_ENABLED,
+		DepthMaxEventEnabled:  int32Value(values, ibmmq.MQIA_Q_DEPTH_MAX_EVENT) == ibmmq.MQEVR_ENABLED,
+
+		DefaultPersistence:     int32Value(values, ibmmq.MQIA_DEF_PERSISTENCE),
+		MsgDeliverySequence:    int32Value(values, ibmmq.MQIA_MSG_DELIVERY_SEQUENCE),
+		DefaultInputOpenOption: int32Value(values, ibmmq.MQIA_DEF_INPUT_OPEN_OPTION),
+		DefaultPutResponseType: int32Value(values, ibmmq.MQIA_DEF_PUT_RESPONSE_TYPE),
+
+		ClusterWorkloadRank: int32Value(values, ibmmq.MQIA_CLWL_Q_RANK),
+
+		ServiceInterval:                 time.Duration(int32Value(values, ibmmq.MQIA_Q_SERVICE_INTERVAL)) * time.Millisecond,
+		ServiceIntervalHighEventEnabled: int32Value(values, ibmmq.MQIA_Q_SERVICE_INTERVAL_EVENT) == ibmmq.MQQSIE_HIGH,
+		ServiceIntervalOkEventEnabled:   int32Value(values, ibmmq.MQIA_Q_SERVICE_INTERVAL_EVENT) == ibmmq.MQQSIE_OK,
+
+		HardenBackout:     int32Value(values, ibmmq.MQIA_HARDEN_GET_BACKOUT),
+		Shareability:      int32Value(values, ibmmq.MQIA_SHAREABILITY),
+		RetentionInterval: int32Value(values, ibmmq.MQIA_RETENTION_INTERVAL),
+		StatisticsQ:       monitoringLevel(int32Value(values, ibmmq.MQIA_STATISTICS_Q)),
+		MaxMessageLength:  int32Value(values, ibmmq.MQIA_MAX_MSG_LENGTH),
+		Scope:             queueScope(int32Value(values, ibmmq.MQIA_SCOPE)),
+		DefaultPriority:   int32Value(values, ibmmq.MQIA_DEF_PRIORITY),
+		AccountingLevel:   monitoringLevel(int32Value(values, ibmmq.MQIA_ACCOUNTING_Q)),
+	}
+
+	if q.connection.cfg.InquireQueueStatus && len(q.collectMetrics) == 0 {
+		status, err := q.connection.inquireQueueStatus(q.name)
+		if err != nil {
+			q.logger.Error("error inquire queue status", "err", err)
+			return collector.QueueMetrics{}, err
+		}
+		m.QueueTimeIndicator, m.QueueFileSize, m.LastPutTime = status.timeIndicator, status.fileSize, status.lastPutTime
+		m.RequestDuration = time.Since(start)
+	}
+
+	return m, nil
+}
+
+// int32Value returns the integer attribute of the inquiry, 0 if it was not
+// inquired.
+func int32Value(values map[int32]interface{}, selector int32) int32 {
+	v, _ := values[selector].(int32)
+	return v
+}
+
+// stringValue returns the character attribute of the inquiry, empty if it was
+// not inquired.
+func stringValue(values map[int32]interface{}, selector int32) string {
+	v, _ := values[selector].(string)
+	return v
+}
+
+// QueueStatisticsReader resets the statistics of the configured queues by PCF
+// command MQCMD_RESET_Q_STATS. The queues with 'collectMetrics' are skipped.
+type QueueStatisticsReader struct {
+	connection *MqConnection
+	logger     *slog.Logger
+}
+
+func (c *MqConnection) QueueStatisticsReader() *QueueStatisticsReader {
+	return &QueueStatisticsReader{connection: c, logger: c.logger}
+}
+
+// ResetQueueStatisticsEnabled reports whether the statistics of the queues
+// are reset by 'resetQueueStatistics'.
+func (c *MqConnection) ResetQueueStatisticsEnabled() bool {
+	return c.cfg.ResetQueueStatistics
+}
+
+// Read returns the statistics of the queues and resets them. The queues which
+// failed to reset are omitted.
+func (r *QueueStatisticsReader) Read() ([]collector.QueueStatistics, error) {
+
+	statistics := make([]collector.QueueStatistics, 0)
+	var errs []error
+
+	for _, queue := range r.connection.limitedQueues() {
+		if len(queue.CollectMetrics) > 0 {
+			continue
+		}
+		put, get, err := r.connection.resetQueueStatistics(queue.Name)
+		if err != nil {
+			r.logger.Error("error reset queue statistics", "err", err, "queue", queue.Name)
+			errs = append(errs, err)
+			continue
+		}
+		statistics = append(statistics, collector.QueueStatistics{
+			Metadata: collector.QueueMetadata{
+				QueueName:      r.connection.cfg.queueAlias(queue.Name),
+				ConnectionName: r.connection.cfg.connectionName(),
+				QMgrName:       r.connection.cfg.QueueManager,
+				ChannelName:    r.connection.cfg.Channel,
+			},
+			PutCount: put,
+			GetCount: get,
+		})
+	}
+
+	return statistics, errors.Join(errs...)
+}
+
+// resetQueueStatistics returns the number of messages put to and got from
+// the queue since the last reset of the queue statistics and resets them by
+// PCF command MQCMD_RESET_Q_STATS.
+func (c *MqConnection) resetQueueStatistics(name string) (int32, int32, error) {
+
+	responses, err := c.pcfCommand(ibmmq.MQCMD_RESET_Q_STATS, stringParameter(ibmmq.MQCA_Q_NAME, name))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, response := range responses {
+		if response.CompCode != ibmmq.MQCC_OK {
+			return 0, 0, newMQError(&ibmmq.MQReturn{MQCC: response.CompCode, MQRC: response.Reason})
+		}
+		enq, _ := response.intValue(ibmmq.MQIA_MSG_ENQ_COUNT)
+		deq, _ := response.intValue(ibmmq.MQIA_MSG_DEQ_COUNT)
+		return int32(enq), int32(deq), nil
+	}
+
+	return 0, 0, fmt.Errorf("no response for reset of queue statistics")
+}
+
+// queueStatusAttributes are the attributes of the status of a queue which
+// are provided by PCF command MQCMD_INQUIRE_Q_STATUS only.
+type queueStatusAttributes struct {
+	timeIndicator int32
+	fileSize      int64
+	lastPutTime   time.Time
+}
+
+// inquireQueueStatus returns the short-term queue time indicator in
+// microseconds, the size of the queue file in bytes and the time of the last
+// put by PCF command MQCMD_INQUIRE_Q_STATUS.
+func (c *MqConnection) inquireQueueStatus(name string) (queueStatusAttributes, error) {
+
+	responses, err := c.pcfCommand(ibmmq.MQCMD_INQUIRE_Q_STATUS,
+		stringParameter(ibmmq.MQCA_Q_NAME, name),
+		intParameter(ibmmq.MQIACF_Q_STATUS_TYPE, ibmmq.MQIACF_Q_STATUS),
+		intListParameter(ibmmq.MQIACF_Q_STATUS_ATTRS, ibmmq.MQIACF_Q_TIME_INDICATOR, ibmmq.MQIACF_CUR_Q_FILE_SIZE,
+			ibmmq.MQCACF_LAST_PUT_DATE, ibmmq.MQCACF_LAST_PUT_TIME),
+	)
+	if err != nil {
+		return queueStatusAttributes{}, err
+	}
+	return queueStatus(responses)
+}
+
+// queueStatus returns the short-term queue time indicator, which is -1
+// (MQMON_NOT_AVAILABLE) if queue monitoring is off, the size of the queue
+// file in bytes, which is 0 if not provided by the queue manager (before MQ
+// 9.1.5), and the time of the last put, which is the zero time if no message
+// was put since the queue manager started or queue monitoring is off.
+func queueStatus(responses []*pcfResponse) (queueStatusAttributes, error) {
+
+	for _, response := range responses {
+		if response.CompCode != ibmmq.MQCC_OK {
+			return queueStatusAttributes{}, newMQError(&ibmmq.MQReturn{MQCC: response.CompCode, MQRC: response.Reason})
+		}
+		timeIndicator, _ := response.intValue(ibmmq.MQIACF_Q_TIME_INDICATOR)
+		fileSize, _ := response.intValue(ibmmq.MQIACF_CUR_Q_FILE_SIZE)
+		date, _ := response.stringValue(ibmmq.MQCACF_LAST_PUT_DATE)
+		tod, _ := response.stringValue(ibmmq.MQCACF_LAST_PUT_TIME)
+		return queueStatusAttributes{
+			timeIndicator: int32(timeIndicator),
+			fileSize:      fileSize * 1024 * 1024,
+			lastPutTime:   parseStatusDateTime(date, tod),
+		}, nil
+	}
+
+	return queueStatusAttributes{}, fmt.Errorf("no response for inquiry of queue status")
+}
+
+// queueUsageName decodes the usage (MQIA_USAGE) of a local queue.
+func queueUsageName(usage int32) string {
+	if usage == ibmmq.MQUS_TRANSMISSION {
+		return "transmission"
+	}
+	return "normal"
+}
+
+var monitoringLevels = map[int32]int32{
+	ibmmq.MQMON_OFF:    0,
+	ibmmq.MQMON_ON:     1,
+	ibmmq.MQMON_LOW:    1,
+	ibmmq.MQMON_MEDIUM: 2,
+	ibmmq.MQMON_HIGH:   3,
+	ibmmq.MQMON_Q_MGR:  -1,
+}
+
+// monitoringLevel decodes the statistics (MQIA_STATISTICS_Q) or accounting
+// (MQIA_ACCOUNTING_Q) collection of a queue to the level 0 (off) to 3 (high)
+// or -1 if inherited from the queue manager. A queue only provides on (level
+// 1), off or inherited.
+func monitoringLevel(value int32) int32 {
+	if level, ok := monitoringLevels[value]; ok {
+		return level
+	}
+	return -1
+}
+
+// queueScope decodes the scope (MQIA_SCOPE) of a queue to 0 (queue manager)
+// or 1 (cell).
+func queueScope(scope int32) int32 {
+	if scope == ibmmq.MQSCO_CELL {
+		return 1
+	}
+	return 0
+}
+
+var indexTypeText = map[int32]string{
+	ibmmq.MQIT_NONE:      "none",
+	ibmmq.MQIT_MSG_ID:    "msg_id",
+	ibmmq.MQIT_CORREL_ID: "correl_id",
+	ibmmq.MQIT_MSG_TOKEN: "msg_token",
+	ibmmq.MQIT_GROUP_ID:  "group_id",
+}
+
+// indexTypeName decodes the index type (MQIA_INDEX_TYPE) of a local queue.
+func indexTypeName(indexType int32) string {
+	if text, ok := indexTypeText[indexType]; ok {
+		return text
+	}
+	return "unknown"
+}
+
+var channelStatusText = map[int32]string{
+	ibmmq.MQCHS_INACTIVE:     "inactive",
+	ibmmq.MQCHS_BINDING:      "binding",
+	ibmmq.MQCHS_STARTING:     "starting",
+	ibmmq.MQCHS_RUNNING:      "running",
+	ibmmq.MQCHS_STOPPING:     "stopping",
+	ibmmq.MQCHS_RETRYING:     "retrying",
+	ibmmq.MQCHS_STOPPED:      "stopped",
+	ibmmq.MQCHS_REQUESTING:   "requesting",
+	ibmmq.MQCHS_PAUSED:       "paused",
+	ibmmq.MQCHS_DISCONNECTED: "disconnected",
+	ibmmq.MQCHS_INITIALIZING: "initializing",
+	ibmmq.MQCHS_SWITCHING:    "switching",
+}
+
+func channelStatusName(status int32) string {
+	if text, ok := channelStatusText[status]; ok {
+		return text
+	}
+	return "unknown"
+}
+
+// QueueManagerReader inquires the attributes of the queue manager by PCF
+// command MQCMD_INQUIRE_Q_MGR.
+type QueueManagerReader struct {
+	connection *MqConnection
+	logger     *slog.Logger
+}
+
+func (c *MqConnection) QueueManagerReader() *QueueManagerReader {
+	return &QueueManagerReader{connection: c, logger: c.logger}
+}
+
+func (r *QueueManagerReader) Read() (collector.QueueManagerMetrics, error) {
+
+	responses, err := r.connection.pcfCommand(ibmmq.MQCMD_INQUIRE_Q_MGR,
+		intListParameter(ibmmq.MQIACF_Q_MGR_ATTRS, ibmmq.MQIA_MAX_HANDLES, ibmmq.MQIA_INHIBIT_EVENT, ibmmq.MQCA_DEF_XMIT_Q_NAME, ibmmq.MQCA_CLUSTER_WORKLOAD_EXIT),
+	)
+	if err != nil {
+		r.logger.Error("error inquire queue manager", "err", err)
+		return collector.QueueManagerMetrics{}, err
+	}
+	return r.queueManagerMetrics(responses)
+}
+
+// queueManagerMetrics returns the attributes of the PCF responses of a queue
+// manager inquiry.
+func (r *QueueManagerReader) queueManagerMetrics(responses []*pcfResponse) (collector.QueueManagerMetrics, error) {
+
+	maxHandles, err := firstIntValue(responses, ibmmq.MQIA_MAX_HANDLES)
+	if err != nil {
+		return collector.QueueManagerMetrics{}, err
+	}
+	inhibitEvent, err := firstIntValue(responses, ibmmq.MQIA_INHIBIT_EVENT)
+	if err != nil {
+		return collector.QueueManagerMetrics{}, err
+	}
+
+	return collector.QueueManagerMetrics{
+		Metadata: collector.ConnectionMetadata{
+			ConnectionName: r.connection.cfg.connectionName(),
+			QMgrName:       r.connection.cfg.QueueManager,
+			ChannelName:    r.connection.cfg.Channel,
+		},
+		MaxHandles:   int32(maxHandles),
+		InhibitEvent: inhibitEvent == int64(ibmmq.MQEVR_ENABLED),
+
+		DefaultTransmitQueue: firstStringValue(responses, ibmmq.MQCA_DEF_XMIT_Q_NAME),
+		ClusterWorkloadExit:  firstStringValue(responses, ibmmq.MQCA_CLUSTER_WORKLOAD_EXIT),
 	}, nil
 }
+
+// ChannelStatusReader inquires the status of the configured channels by
+// PCF command MQCMD_INQUIRE_CHANNEL_STATUS.
+type ChannelStatusReader struct {
+	connection *MqConnection
+	logger     *slog.Logger
+}
+
+func (c *MqConnection) ChannelStatusReader() *ChannelStatusReader {
+	return &ChannelStatusReader{connection: c, logger: c.logger}
+}
+
+func (r *ChannelStatusReader) Read() ([]collector.ChannelMetrics, error) {
+
+	metrics := make([]collector.ChannelMetrics, 0)
+
+	for _, name := range r.connection.cfg.Channels {
+		responses, err := r.connection.pcfCommand(ibmmq.MQCMD_INQUIRE_CHANNEL_STATUS,
+			stringParameter(ibmmq.MQCACH_CHANNEL_NAME, name),
+			intListParameter(ibmmq.MQIACH_CHANNEL_INSTANCE_ATTRS, ibmmq.MQIACF_ALL),
+		)
+		if err != nil {
+			r.logger.Error("error inquire channel status", "err", err, "channel", name)
+			return nil, err
+		}
+		metrics = append(metrics, r.channelMetrics(name, responses)...)
+	}
+
+	return metrics, nil
+}
+
+// channelMetrics converts the PCF responses of a channel status inquiry. A
+// channel with multiple instances is reported as running if any instance is
+// running, the last message time is the latest of all instances and the
+// network time is the highest of all running instances and the TLS key
+// resets, messages and instances in doubt are the sums of all instances. If
+// no status exists for a non-generic channel name, it is reported as inactive.
+func (r *ChannelStatusReader) channelMetrics(name string, responses []*pcfResponse) []collector.ChannelMetrics {
+
+	metadata := func(channelName string) collector.ChannelMetadata {
+		return collector.ChannelMetadata{
+			ChannelName:    channelName,
+			ConnectionName: r.connection.cfg.connectionName(),
+			QMgrName:       r.connection.cfg.QueueManager,
+		}
+	}
+
+	byName := make(map[string]*collector.ChannelMetrics)
+	names := make([]string, 0)
+
+	for _, response := range responses {
+		if response.CompCode != ibmmq.MQCC_OK {
+			if response.Reason != ibmmq.MQRCCF_CHL_STATUS_NOT_FOUND {
+				r.logger.Error("error inquire channel status", "channel", name, "mqcc", response.CompCode, "mqrc", response.Reason)
+			}
+			continue
+		}
+
+		channelName, ok := response.stringValue(ibmmq.MQCACH_CHANNEL_NAME)
+		if !ok {
+			continue
+		}
+		status, _ := response.intValue(ibmmq.MQIACH_CHANNEL_STATUS)
+		date, _ := response.stringValue(ibmmq.MQCACH_LAST_MSG_DATE)
+		tod, _ := response.stringValue(ibmmq.MQCACH_LAST_MSG_TIME)
+
+		m := collector.ChannelMetrics{
+			Metadata:    metadata(channelName),
+			Status:      int32(status),
+			LastMsgTime: parseStatusDateTime(date, tod),
+		}
+		if networkTime, ok := response.intValue(ibmmq.MQIACH_NETWORK_TIME_INDICATOR); ok && m.Status == ibmmq.MQCHS_RUNNING && networkTime > 0 {
+			m.NetworkTime = time.Duration(networkTime) * time.Microsecond
+		}
+		m.SSLKeyResets, _ = response.intValue(ibmmq.MQIACH_SSL_KEY_RESETS)
+		m.Messages, _ = response.intValue(ibmmq.MQIACH_MSGS)
+		if inDoubt, _ := response.intValue(ibmmq.MQIACH_INDOUBT_STATUS); inDoubt == int64(ibmmq.MQCHIDS_INDOUBT) {
+			m.InDoubtInstances = 1
+		}
+
+		existing, ok := byName[channelName]
+		if !ok {
+			byName[channelName] = &m
+			names = append(names, channelName)
+			continue
+		}
+		if existing.Status != ibmmq.MQCHS_RUNNING && m.Status == ibmmq.MQCHS_RUNNING {
+			existing.Status = m.Status
+		}
+		if m.LastMsgTime.After(existing.LastMsgTime) {
+			existing.LastMsgTime = m.LastMsgTime
+		}
+		if m.NetworkTime > existing.NetworkTime {
+			existing.NetworkTime = m.NetworkTime
+		}
+		existing.SSLKeyResets += m.SSLKeyResets
+		existing.Messages += m.Messages
+		existing.InDoubtInstances += m.InDoubtInstances
+	}
+
+	if len(names) == 0 && !strings.Contains(name, "*") {
+		byName[name] = &collector.ChannelMetrics{Metadata: metadata(name), Status: ibmmq.MQCHS_INACTIVE}
+		names = append(names, name)
+	}
+
+	metrics := make([]collector.ChannelMetrics, 0, len(names))
+	for _, channelName := range names {
+		m := byName[channelName]
+		m.StatusText = channelStatusName(m.Status)
+		metrics = append(metrics, *m)
+	}
+	return metrics
+}
+
+// parseStatusDateTime parses date 'YYYY-MM-DD' and time 'HH.MM.SS' of a
+// channel or queue status in local time of the exporter. It returns the zero time if
+// no (valid) date and time is given.
+func parseStatusDateTime(date string, tod string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15.04.05", date+" "+tod, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// QueueHandlesReader inquires the open handles of the configured queues by
+// PCF command MQCMD_INQUIRE_Q_STATUS and aggregates them by application.
+type QueueHandlesReader struct {
+	connection *MqConnection
+	logger     *slog.Logger
+}
+
+func (c *MqConnection) QueueHandlesReader() *QueueHandlesReader {
+	return &QueueHandlesReader{connection: c, logger: c.logger}
+}
+
+func (r *QueueHandlesReader) Read() ([]collector.QueueHandles, error) {
+
+	handles := make([]collector.QueueHandles, 0)
+
+	for _, queue := range r.connection.limitedQueues() {
+		responses, err := r.connection.inquireQueueHandles(queue.Name)
+		if err != nil {
+			r.logger.Error("error inquire queue status", "err", err, "queue", queue.Name)
+			return nil, err
+		}
+		handles = append(handles, r.queueHandles(queue.Name, responses)...)
+	}
+
+	return handles, nil
+}
+
+// inquireQueueHandles inquires the open handles of the queue by PCF command
+// MQCMD_INQUIRE_Q_STATUS.
+func (c *MqConnection) inquireQueueHandles(name string) ([]*pcfResponse, error) {
+	return c.pcfCommand(ibmmq.MQCMD_INQUIRE_Q_STATUS,
+		stringParameter(ibmmq.MQCA_Q_NAME, name),
+		intParameter(ibmmq.MQIACF_Q_STATUS_TYPE, ibmmq.MQIACF_Q_HANDLE),
+		intListParameter(ibmmq.MQIACF_Q_STATUS_ATTRS, ibmmq.MQCACF_APPL_NAME, ibmmq.MQIACF_OPEN_INPUT_TYPE, ibmmq.MQIACF_OPEN_OUTPUT),
+	)
+}
+
+// queueHandles counts the handles of the PCF responses of a queue status
+// inquiry per application and open type. A handle which is open for input
+// and output is counted for both.
+func (r *QueueHandlesReader) queueHandles(name string, responses []*pcfResponse) []collector.QueueHandles {
+
+	metadata := collector.QueueMetadata{
+		QueueName:      r.connection.cfg.queueAlias(name),
+		ConnectionName: r.connection.cfg.connectionName(),
+		QMgrName:       r.connection.cfg.QueueManager,
+		ChannelName:    r.connection.cfg.Channel,
+	}
+
+	type key struct {
+		applicationName string
+		openType        string
+	}
+	counts := make(map[key]int)
+	keys := make([]key, 0)
+
+	count := func(k key) {
+		if _, ok := counts[k]; !ok {
+			keys = append(keys, k)
+		}
+		counts[k]++
+	}
+
+	for _, response := range responses {
+		if response.CompCode != ibmmq.MQCC_OK {
+			r.logger.Error("error inquire queue status", "queue", name, "mqcc", response.CompCode, "mqrc", response.Reason)
+			continue
+		}
+
+		applicationName, ok := response.stringValue(ibmmq.MQCACF_APPL_NAME)
+		if !ok {
+			continue
+		}
+		if input, _ := response.intValue(ibmmq.MQIACF_OPEN_INPUT_TYPE); input != int64(ibmmq.MQQSO_NO) {
+			count(key{applicationName, collector.OpenTypeInput})
+		}
+		if output, _ := response.intValue(ibmmq.MQIACF_OPEN_OUTPUT); output == int64(ibmmq.MQQSO_YES) {
+			count(key{applicationName, collector.OpenTypeOutput})
+		}
+	}
+
+	handles := make([]collector.QueueHandles, 0, len(keys))
+	for _, k := range keys {
+		handles = append(handles, collector.QueueHandles{
+			Metadata:        metadata,
+			ApplicationName: k.applicationName,
+			OpenType:        k.openType,
+			Count:           counts[k],
+		})
+	}
+	return handles
+}
+
+// QueueHandleDetailsReader inquires the open handles of the configured queues
+// by PCF command MQCMD_INQUIRE_Q_STATUS and counts the handles open for input
+// by share option.
+type QueueHandleDetailsReader struct {
+	connection *MqConnection
+	logger     *slog.Logger
+}
+
+func (c *MqConnection) QueueHandleDetailsReader() *QueueHandleDetailsReader {
+	return &QueueHandleDetailsReader{connection: c, logger: c.logger}
+}
+
+func (r *QueueHandleDetailsReader) Read() ([]collector.QueueHandleDetails, error) {
+
+	details := make([]collector.QueueHandleDetails, 0, len(r.connection.limitedQueues()))
+
+	for _, queue := range r.connection.limitedQueues() {
+		responses, err := r.connection.inquireQueueHandles(queue.Name)
+		if err != nil {
+			r.logger.Error("error inquire queue status", "err", err, "queue", queue.Name)
+			return nil, err
+		}
+		details = append(details, r.handleDetails(queue.Name, responses))
+	}
+
+	return details, nil
+}
+
+// handleDetails counts the handles of the PCF responses of a queue status
+// inquiry which are open for exclusive and shared input.
+func (r *QueueHandleDetailsReader) handleDetails(name string, responses []*pcfResponse) collector.QueueHandleDetails {
+
+	details := collector.QueueHandleDetails{
+		Metadata: collector.QueueMetadata{
+			QueueName:      r.connection.cfg.queueAlias(name),
+			ConnectionName: r.connection.cfg.connectionName(),
+			QMgrName:       r.connection.cfg.QueueManager,
+			ChannelName:    r.connection.cfg.Channel,
+		},
+	}
+
+	for _, response := range responses {
+		if response.CompCode != ibmmq.MQCC_OK {
+			r.logger.Error("error inquire queue status", "queue", name, "mqcc", response.CompCode, "mqrc", response.Reason)
+			continue
+		}
+
+		switch input, _ := response.intValue(ibmmq.MQIACF_OPEN_INPUT_TYPE); input {
+		case int64(ibmmq.MQQSO_EXCLUSIVE):
+			details.OpenInputExclusiveCount++
+		case int64(ibmmq.MQQSO_SHARED):
+			details.OpenInputSharedCount++
+		}
+	}
+
+	return details
+}
+
+// QueueDepthStatusReader inquires the current depth of the configured queues
+// by PCF command MQCMD_INQUIRE_Q_STATUS and their max depth by PCF command
+// MQCMD_INQUIRE_Q.
+type QueueDepthStatusReader struct {
+	connection *MqConnection
+	logger     *slog.Logger
+}
+
+func (c *MqConnection) QueueDepthStatusReader() *QueueDepthStatusReader {
+	return &QueueDepthStatusReader{connection: c, logger: c.logger}
+}
+
+func (r *QueueDepthStatusReader) Read() ([]collector.QueueDepthStatus, error) {
+
+	statuses := make([]collector.QueueDepthStatus, 0, len(r.connection.limitedQueues()))
+
+	for _, queue := range r.connection.limitedQueues() {
+		status, err := r.connection.inquireQueueDepthStatus(queue.Name)
+		if err != nil {
+			r.logger.Error("error inquire queue depth status", "err", err, "queue", queue.Name)
+			return nil, err
+		}
+		status.Metadata = collector.QueueMetadata{
+			QueueName:      r.connection.cfg.queueAlias(queue.Name),
+			ConnectionName: r.connection.cfg.connectionName(),
+			QMgrName:       r.connection.cfg.QueueManager,
+			ChannelName:    r.connection.cfg.Channel,
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// inquireQueueDepthStatus returns the current and the max depth of the queue.
+func (c *MqConnection) inquireQueueDepthStatus(name string) (collector.QueueDepthStatus, error) {
+
+	statusResponses, err := c.pcfCommand(ibmmq.MQCMD_INQUIRE_Q_STATUS,
+		stringParameter(ibmmq.MQCA_Q_NAME, name),
+		intParameter(ibmmq.MQIACF_Q_STATUS_TYPE, ibmmq.MQIACF_Q_STATUS),
+		intListParameter(ibmmq.MQIACF_Q_STATUS_ATTRS, ibmmq.MQIA_CURRENT_Q_DEPTH),
+	)
+	if err != nil {
+		return collector.QueueDepthStatus{}, err
+	}
+	queueResponses, err := c.pcfCommand(ibmmq.MQCMD_INQUIRE_Q,
+		stringParameter(ibmmq.MQCA_Q_NAME, name),
+		intListParameter(ibmmq.MQIACF_Q_ATTRS, ibmmq.MQIA_MAX_Q_DEPTH),
+	)
+	if err != nil {
+		return collector.QueueDepthStatus{}, err
+	}
+	return queueDepthStatus(statusResponses, queueResponses)
+}
+
+// queueDepthStatus returns the current depth of the responses of the queue
+// status inquiry and the max depth of the ones of the queue inquiry.
+func queueDepthStatus(statusResponses []*pcfResponse, queueResponses []*pcfResponse) (collector.QueueDepthStatus, error) {
+
+	var status collector.QueueDepthStatus
+
+	currentDepth, err := firstIntValue(statusResponses, ibmmq.MQIA_CURRENT_Q_DEPTH)
+	if err != nil {
+		return status, err
+	}
+	maxDepth, err := firstIntValue(queueResponses, ibmmq.MQIA_MAX_Q_DEPTH)
+	if err != nil {
+		return status, err
+	}
+
+	status.CurrentDepth = int32(currentDepth)
+	status.MaxDepth = int32(maxDepth)
+	return status, nil
+}
+
+// firstIntValue returns the value of the parameter of the first PCF
+// response, which is 0 if the parameter is missing.
+func firstIntValue(responses []*pcfResponse, parameter int32) (int64, error) {
+
+	for _, response := range responses {
+		if response.CompCode != ibmmq.MQCC_OK {
+			return 0, newMQError(&ibmmq.MQReturn{MQCC: response.CompCode, MQRC: response.Reason})
+		}
+		value, _ := response.intValue(parameter)
+		return value, nil
+	}
+
+	return 0, fmt.Errorf("no response for inquiry of %s", ibmmq.MQItoString("IA", int(parameter)))
+}
+
+// firstStringValue returns the string value of the parameter of the first
+// response, which is empty if there is none.
+func firstStringValue(responses []*pcfResponse, parameter int32) string {
+	for _, response := range responses {
+		value, _ := response.stringValue(parameter)
+		return value
+	}
+	return ""
+}
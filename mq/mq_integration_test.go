@@ -0,0 +1,113 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build integration
+
+package mq
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"gotest.tools/v3/assert"
+)
+
+// mqImage is the successor of the (discontinued) 'ibmcom/mq' image.
+var mqImage = "icr.io/ibm-messaging/mq:latest"
+
+func startQueueManager(t *testing.T) string {
+
+	ctx := context.Background()
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image: mqImage,
+			Env: map[string]string{
+				"LICENSE":         "accept",
+				"MQ_QMGR_NAME":    "QM1",
+				"MQ_APP_PASSWORD": "passw0rd",
+			},
+			ExposedPorts: []string{"1414/tcp"},
+			WaitingFor: wait.ForAll(
+				wait.ForListeningPort("1414/tcp"),
+				wait.ForLog("AMQ5026I"),
+			).WithDeadline(3 * time.Minute),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := container.Terminate(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := container.MappedPort(ctx, "1414/tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fmt.Sprintf("%s(%s)", host, port.Port())
+}
+
+func writeConfig(t *testing.T, connName string) string {
+
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	config := `---
+queueManager: QM1
+user: app
+password: passw0rd
+connName: ` + connName + `
+channel: DEV.APP.SVRCONN
+queues:
+  - DEV.QUEUE.1
+`
+	if err := os.WriteFile(filename, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestIntegration_ReadQueue(t *testing.T) {
+
+	connName := startQueueManager(t)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	connection, err := NewMqConnection(logger, writeConfig(t, connName), 0, StartupRetry{})
+	assert.NilError(t, err)
+	defer connection.Close()
+
+	queues := connection.Queues()
+	assert.Equal(t, len(queues), 1)
+
+	metrics, err := queues[0].Reader.Read()
+	assert.NilError(t, err)
+	assert.Equal(t, metrics.Metadata.QueueName, "DEV.QUEUE.1")
+	assert.Assert(t, metrics.MaxDepth > 0, "Should have positive max depth: %d", metrics.MaxDepth)
+}
@@ -15,12 +15,22 @@
 package mq
 
 import (
+	"errors"
+	"io"
+	"log/slog"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/agebhar1/mq_exporter/collector"
+	"github.com/agebhar1/mq_exporter/mq/consul"
 	"github.com/google/go-cmp/cmp"
+	"github.com/ibm-messaging/mq-golang/v5/ibmmq"
+	"gopkg.in/yaml.v2"
 	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
 )
 
 var fixturesPath = "fixtures"
@@ -33,6 +43,7 @@ func TestReadConfig_Full(t *testing.T) {
 	}
 
 	timeout := 1500 * time.Millisecond
+	certExpiryRefreshInterval := 30 * time.Minute
 
 	want := &MqConfiguration{
 		QueueManager:  "QM1",
@@ -43,7 +54,16 @@ func TestReadConfig_Full(t *testing.T) {
 		SSLCipherSpec: "TLS_RSA_WITH_AES_128_CBC_SHA256",
 		KeyRepository: "./",
 		Timeout:       &timeout,
-		Queues:        []string{"DEV.QUEUE.1", "DEV.QUEUE.2", "DEV.QUEUE.3"},
+		PoolSize:      2,
+		Queues:        []QueueConfig{{Name: "DEV.QUEUE.1"}, {Name: "DEV.QUEUE.2"}, {Name: "DEV.QUEUE.3"}},
+		Channels:      []string{"DEV.APP.SVRCONN"},
+
+		KeepaliveQueue: "DEV.QUEUE.1",
+
+		CertExpiryCheckPath:       "keys/qm1.pem",
+		CertExpiryRefreshInterval: &certExpiryRefreshInterval,
+
+		LabelNames: collector.DefaultLabelNames,
 	}
 
 	if diff := cmp.Diff(want, got); diff != "" {
@@ -59,7 +79,11 @@ func TestReadConfig_DefaultValues(t *testing.T) {
 	}
 
 	want := &MqConfiguration{
-		Timeout: &defaultTimeout,
+		Timeout:    &defaultTimeout,
+		PoolSize:   defaultPoolSize,
+		LabelNames: collector.DefaultLabelNames,
+
+		CertExpiryRefreshInterval: &defaultCertExpiryRefreshInterval,
 	}
 
 	assert.Equal(t, defaultTimeout, 3*time.Second)
@@ -69,103 +93,1399 @@ func TestReadConfig_DefaultValues(t *testing.T) {
 	}
 }
 
-func TestReadConfig_NonExisting(t *testing.T) {
+func TestReadConfig_TimeoutInMilliseconds(t *testing.T) {
 
-	_, err := readConfigYaml(filepath.Join(fixturesPath, "does-not-exists.yaml"))
-	assert.Error(t, err, "configuration file 'fixtures/does-not-exists.yaml' does not exists or is not readable")
+	got, err := readConfigYaml(filepath.Join(fixturesPath, "config-timeout-millis.yaml"))
+	assert.NilError(t, err)
+
+	assert.Equal(t, *got.Timeout, 1500*time.Millisecond)
 }
 
-func TestValidate(t *testing.T) {
+func TestReadConfig_TimeoutFromEnv(t *testing.T) {
 
-	type args struct {
-		cfg *MqConfiguration
+	t.Setenv("MQCONNECTION_TIMEOUT_QM1", "5s")
+
+	got, err := readConfigYaml(filepath.Join(fixturesPath, "config-full.yaml"))
+	assert.NilError(t, err)
+
+	assert.Equal(t, *got.Timeout, 5*time.Second)
+
+	t.Setenv("MQCONNECTION_TIMEOUT_QM1", "2500")
+
+	got, err = readConfigYaml(filepath.Join(fixturesPath, "config-full.yaml"))
+	assert.NilError(t, err)
+
+	assert.Equal(t, *got.Timeout, 2500*time.Millisecond)
+
+	t.Setenv("MQCONNECTION_TIMEOUT_QM1", "soon")
+
+	_, err = readConfigYaml(filepath.Join(fixturesPath, "config-full.yaml"))
+	assert.Error(t, err, `invalid timeout 'soon' of environment variable 'MQCONNECTION_TIMEOUT_QM1': time: invalid duration "soon"`)
+}
+
+func TestReadConfig_TimeoutLookupOrder(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		fixture string
+		env     string
+		want    time.Duration
+	}{
+		{name: "environment over file", fixture: "config-full.yaml", env: "5s", want: 5 * time.Second},
+		{name: "file over default", fixture: "config-full.yaml", want: 1500 * time.Millisecond},
+		{name: "environment over default", fixture: "config-queue-manager.yaml", env: "5s", want: 5 * time.Second},
+		{name: "default", fixture: "config-queue-manager.yaml", want: defaultTimeout},
 	}
 
-	zero := 0 * time.Second
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("MQCONNECTION_TIMEOUT_QM1", tt.env)
+			}
+
+			got, err := readConfigYaml(filepath.Join(fixturesPath, tt.fixture))
+			assert.NilError(t, err)
+
+			assert.Equal(t, *got.Timeout, tt.want)
+		})
+	}
+}
+
+func TestReadConfig_TimeoutFromFileOverEnvOfOtherQueueManager(t *testing.T) {
+
+	t.Setenv("MQCONNECTION_TIMEOUT_QM2", "5s")
+
+	got, err := readConfigYaml(filepath.Join(fixturesPath, "config-full.yaml"))
+	assert.NilError(t, err)
+
+	assert.Equal(t, *got.Timeout, 1500*time.Millisecond)
+
+	got, err = readConfigYaml(filepath.Join(fixturesPath, "config-empty.yaml"))
+	assert.NilError(t, err)
+
+	assert.Equal(t, *got.Timeout, defaultTimeout)
+}
+
+func TestTimeoutEnvName(t *testing.T) {
+
+	assert.Equal(t, timeoutEnvName("QM1"), "MQCONNECTION_TIMEOUT_QM1")
+	assert.Equal(t, timeoutEnvName("qm.1"), "MQCONNECTION_TIMEOUT_QM_1")
+	assert.Equal(t, timeoutEnvName("QM_A/B%1"), "MQCONNECTION_TIMEOUT_QM_A_B_1")
+}
+
+func TestDurationUnmarshalYAML(t *testing.T) {
 
 	tests := []struct {
 		name string
-		args args
-		want string
+		yaml string
+		want time.Duration
+		err  string
+	}{
+		{name: "integer in milliseconds", yaml: "timeout: 1500", want: 1500 * time.Millisecond},
+		{name: "string with unit", yaml: "timeout: 1500ms", want: 1500 * time.Millisecond},
+		{name: "string with fractional unit", yaml: `timeout: "1.5s"`, want: 1500 * time.Millisecond},
+		{name: "string without unit", yaml: `timeout: "1500"`, err: `time: missing unit in duration "1500"`},
+		{name: "invalid string", yaml: "timeout: soon", err: `time: invalid duration "soon"`},
+		{name: "float", yaml: "timeout: 1.5", err: "invalid duration '1.5'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				Timeout Duration
+			}
+			err := yaml.Unmarshal([]byte(tt.yaml), &got)
+			if tt.err != "" {
+				assert.Error(t, err, tt.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, time.Duration(got.Timeout), tt.want)
+		})
+	}
+}
+
+func TestReadConfig_LabelNames(t *testing.T) {
+
+	got, err := readConfigYaml(filepath.Join(fixturesPath, "config-label-names.yaml"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	want := collector.LabelNames{
+		Name:         "queue_name",
+		Connection:   "connection",
+		QueueManager: "qmgr",
+		Channel:      "channel",
+	}
+
+	if diff := cmp.Diff(want, got.LabelNames); diff != "" {
+		t.Errorf("Should contain expected label names (-want, +got):\n%s", diff)
+	}
+}
+
+func TestReadConfig_QueueLabels(t *testing.T) {
+
+	got, err := readConfigYaml(filepath.Join(fixturesPath, "config-queue-labels.yaml"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	want := []QueueConfig{
+		{Name: "DEV.QUEUE.1"},
+		{Name: "DEV.QUEUE.2", Labels: map[string]string{"team": "payments"}},
+		{Name: "DEV.QUEUE.3", Labels: map[string]string{"team": "billing", "domain": "invoices"}},
+		{Name: "DEV.QUEUE.4", CollectMetrics: []string{"currentDepth", "maxDepth"}},
+	}
+
+	if diff := cmp.Diff(want, got.Queues); diff != "" {
+		t.Errorf("Should contain expected queues (-want, +got):\n%s", diff)
+	}
+}
+
+func TestReadConfig_QueueSetTimeoutInMilliseconds(t *testing.T) {
+
+	got, err := readConfigYaml(filepath.Join(fixturesPath, "config-queue-sets-timeout-millis.yaml"))
+	assert.NilError(t, err)
+	assert.NilError(t, validateQueueSets(got.QueueSets))
+
+	queues := got.queues()
+	assert.Equal(t, len(queues), 1)
+	assert.Equal(t, *queues[0].Timeout, 2500*time.Millisecond)
+}
+
+func TestReadConfig_QueueSets(t *testing.T) {
+
+	got, err := readConfigYaml(filepath.Join(fixturesPath, "config-queue-sets.yaml"))
+	if err != nil {
+		t.Error(err)
+	}
+	assert.NilError(t, validateQueueSets(got.QueueSets))
+
+	timeout := 10 * time.Second
+	threshold := int32(1000)
+
+	want := []QueueConfig{
+		{Name: "DEV.QUEUE.1"},
+		{Name: "DEV.QUEUE.2", Labels: map[string]string{"team": "payments"}, Timeout: &timeout, DepthWarnThreshold: &threshold},
+		{Name: "DEV.QUEUE.3", Labels: map[string]string{"team": "payments", "domain": "invoices"}, Timeout: &timeout, DepthWarnThreshold: &threshold},
+		{Name: "DEV.QUEUE.4", Labels: map[string]string{"team": "billing"}},
+	}
+
+	if diff := cmp.Diff(want, got.queues()); diff != "" {
+		t.Errorf("Should contain expected queues of all queue sets (-want, +got):\n%s", diff)
+	}
+}
+
+func TestQueuesOfQueueSets(t *testing.T) {
+
+	cfg, err := readConfigYaml(filepath.Join(fixturesPath, "config-queue-sets.yaml"))
+	assert.NilError(t, err)
+
+	connection := &MqConnection{cfg: cfg, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	queues := connection.Queues()
+	assert.Equal(t, len(queues), 4)
+
+	assert.Equal(t, queues[0].Timeout, time.Duration(0))
+	assert.Equal(t, queues[1].Timeout, 10*time.Second)
+	assert.Equal(t, queues[1].DepthWarnThreshold, int32(1000))
+	assert.Equal(t, queues[3].Timeout, time.Duration(0))
+
+	assert.Equal(t, queues[1].Metadata.ExtraLabels["team"], "payments")
+	assert.Equal(t, queues[3].Metadata.ExtraLabels["team"], "billing")
+}
+
+func TestQueuesTruncatedToMaxQueues(t *testing.T) {
+
+	cfg, err := readConfigYaml(filepath.Join(fixturesPath, "config-queue-sets.yaml"))
+	assert.NilError(t, err)
+	cfg.MaxQueues = 3
+
+	connection := &MqConnection{cfg: cfg, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	queues := connection.Queues()
+	assert.Equal(t, len(queues), 3)
+	assert.Equal(t, queues[2].Metadata.QueueName, "DEV.QUEUE.3")
+	assert.Equal(t, connection.ConnectionMetrics().QueueLimitExceeded, true)
+
+	cfg.MaxQueues = 4
+
+	assert.Equal(t, len(connection.Queues()), 4)
+	assert.Equal(t, connection.ConnectionMetrics().QueueLimitExceeded, false)
+}
+
+func TestQueuesWithAliases(t *testing.T) {
+
+	cfg := &MqConfiguration{
+		Queues:  []QueueConfig{{Name: "APP.V2.IN", Tenant: "payments"}, {Name: "DEV.QUEUE.1"}},
+		Aliases: map[string]string{"APP.V2.IN": "APP.V1.IN", "APP.V3.IN": "APP.IN"},
+	}
+	connection := &MqConnection{cfg: cfg, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	queues := connection.Queues()
+	assert.Equal(t, len(queues), 2)
+
+	// the alias is the name label of the metrics, the queue name is opened
+	assert.Equal(t, queues[0].Metadata.QueueName, "APP.V1.IN")
+	assert.Equal(t, queues[0].Reader.(*StickyQueueMetricsReader).reader.(*MqQueue).name, "APP.V2.IN")
+	assert.Equal(t, queues[1].Metadata.QueueName, "DEV.QUEUE.1")
+
+	assert.Equal(t, connection.Tenant(queues[0].Metadata), "payments")
+
+	assert.DeepEqual(t, cfg.unknownAliases(), []string{"APP.V3.IN"})
+
+	handle, _ := parsePCFResponse(pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRC_NONE,
+		stringParameter(ibmmq.MQCA_Q_NAME, "APP.V2.IN"),
+		stringParameter(ibmmq.MQCACF_APPL_NAME, "amqsget"),
+		intParameter(ibmmq.MQIACF_OPEN_INPUT_TYPE, ibmmq.MQQSO_SHARED),
+		intParameter(ibmmq.MQIACF_OPEN_OUTPUT, ibmmq.MQQSO_NO),
+	))
+	responses := []*pcfResponse{handle}
+
+	handles := connection.QueueHandlesReader().queueHandles("APP.V2.IN", responses)
+	assert.Equal(t, len(handles), 1)
+	assert.Equal(t, handles[0].Metadata.QueueName, "APP.V1.IN")
+
+	details := connection.QueueHandleDetailsReader().handleDetails("APP.V2.IN", responses)
+	assert.Equal(t, details.Metadata.QueueName, "APP.V1.IN")
+	assert.Equal(t, details.OpenInputSharedCount, 1)
+}
+
+func TestValidateAliases(t *testing.T) {
+
+	queues := []QueueConfig{{Name: "DEV.QUEUE.1"}, {Name: "DEV.QUEUE.2"}}
+
+	tests := []struct {
+		name    string
+		aliases map[string]string
+		want    string
+	}{
+		{name: "none"},
+		{name: "alias", aliases: map[string]string{"DEV.QUEUE.1": "DEV.QUEUE.OLD"}},
+		{name: "alias of unknown queue", aliases: map[string]string{"DEV.QUEUE.3": "DEV.QUEUE.OLD"}},
+		{name: "empty alias", aliases: map[string]string{"DEV.QUEUE.2": ""}, want: "requires non empty alias of queue 'DEV.QUEUE.2'"},
+		{name: "alias of another queue", aliases: map[string]string{"DEV.QUEUE.2": "DEV.QUEUE.1"}, want: "duplicate name 'DEV.QUEUE.1' of queues 'DEV.QUEUE.1' and 'DEV.QUEUE.2' by 'aliases'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAliases(queues, tt.aliases)
+			if tt.want == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordingRules(t *testing.T) {
+
+	cfg := MqConfiguration{RecordingRules: []RecordingRule{
+		{Name: "mq:queue_current_depth:sum", Expr: "sum by (queue_manager) (mq_queue_current_depth)", Labels: map[string]string{"env": "dev"}},
+	}}
+
+	rules, err := cfg.recordingRules()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, rules, []collector.RecordingRule{
+		{Name: "mq:queue_current_depth:sum", Aggregation: "sum", By: []string{"queue_manager"}, Metric: "mq_queue_current_depth", Labels: map[string]string{"env": "dev"}},
+	})
+
+	cfg.RecordingRules = append(cfg.RecordingRules, RecordingRule{Name: "mq:queue_current_depth:sum", Expr: "max by (queue_manager) (mq_queue_current_depth)"})
+
+	_, err = cfg.recordingRules()
+	assert.Error(t, err, "duplicate recording rule 'mq:queue_current_depth:sum'")
+}
+
+func TestMaxConcurrentReads(t *testing.T) {
+
+	cfg := MqConfiguration{Queues: []QueueConfig{{Name: "DEV.QUEUE.1"}, {Name: "DEV.QUEUE.2"}, {Name: "DEV.QUEUE.3"}}}
+	assert.Equal(t, cfg.maxConcurrentReads(), 3)
+
+	cfg.MaxConcurrentReadsPerQueueManager = 1
+	assert.Equal(t, cfg.maxConcurrentReads(), 1)
+}
+
+func TestTenants(t *testing.T) {
+
+	connection := &MqConnection{cfg: &MqConfiguration{Queues: []QueueConfig{
+		{Name: "DEV.QUEUE.1", Tenant: "payments"},
+		{Name: "DEV.QUEUE.2"},
+		{Name: "DEV.QUEUE.3", Tenant: "billing"},
+		{Name: "DEV.QUEUE.4", Tenant: "payments"},
+	}}}
+
+	assert.DeepEqual(t, connection.Tenants(), []string{"billing", "payments"})
+
+	assert.Equal(t, connection.Tenant(collector.QueueMetadata{QueueName: "DEV.QUEUE.1"}), "payments")
+	assert.Equal(t, connection.Tenant(collector.QueueMetadata{QueueName: "DEV.QUEUE.2"}), "")
+	assert.Equal(t, connection.Tenant(collector.QueueMetadata{QueueName: "DEV.QUEUE.5"}), "")
+}
+
+func TestRecordConnectDuration(t *testing.T) {
+
+	connection := &MqConnection{cfg: &MqConfiguration{ConnName: "localhost(1414)", QueueManager: "QM1"}}
+
+	connection.recordConnectDuration([]*poolHandle{{connectDuration: 200 * time.Millisecond}, {connectDuration: 300 * time.Millisecond}})
+	connection.reconnectGeneration.Add(1)
+
+	m := connection.ConnectionMetrics()
+	assert.Equal(t, m.ConnectDuration, 300*time.Millisecond)
+	assert.Equal(t, m.ReconnectDurationTotal, time.Duration(0))
+
+	connection.recordConnectDuration([]*poolHandle{{connectDuration: 100 * time.Millisecond}})
+	connection.reconnectGeneration.Add(1)
+	connection.recordConnectDuration([]*poolHandle{{connectDuration: 400 * time.Millisecond}})
+	connection.reconnectGeneration.Add(1)
+
+	m = connection.ConnectionMetrics()
+	assert.Equal(t, m.ConnectDuration, 400*time.Millisecond)
+	assert.Equal(t, m.ReconnectDurationTotal, 500*time.Millisecond)
+}
+
+func TestQueueConfigSelectors(t *testing.T) {
+
+	all := QueueConfig{Name: "DEV.QUEUE.1"}
+	if diff := cmp.Diff(selectors, all.selectors()); diff != "" {
+		t.Errorf("Should inquire all selectors (-want, +got):\n%s", diff)
+	}
+
+	restricted := QueueConfig{Name: "DEV.QUEUE.1", CollectMetrics: []string{"currentDepth"}}
+	want := []int32{ibmmq.MQCA_Q_NAME, ibmmq.MQCA_STORAGE_CLASS, ibmmq.MQIA_USAGE, ibmmq.MQIA_CURRENT_Q_DEPTH}
+	if diff := cmp.Diff(want, restricted.selectors()); diff != "" {
+		t.Errorf("Should inquire selectors of configured metrics only (-want, +got):\n%s", diff)
+	}
+}
+
+func TestValidateQueues(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		queues []QueueConfig
+		want   string
 	}{
 		{
-			name: "missing mandatory fields",
-			args: args{
-				cfg: &MqConfiguration{},
-			},
-			want: "missing mandatory fields: 'queueManager', 'connName', 'channel'",
+			name:   "queues with labels",
+			queues: []QueueConfig{{Name: "DEV.QUEUE.1"}, {Name: "DEV.QUEUE.2", Labels: map[string]string{"team": "payments"}}},
 		},
 		{
-			name: "requires password if user is provided",
-			args: args{
-				cfg: &MqConfiguration{
-					QueueManager: "QM1",
-					User:         "app",
-					ConnName:     "localhost(1414)",
-					Channel:      "DEV.APP.SVRCONN",
-				},
-			},
-			want: "requires both 'user' and 'password'",
+			name:   "empty queue name",
+			queues: []QueueConfig{{Labels: map[string]string{"team": "payments"}}},
+			want:   "requires non empty queue 'name'",
 		},
 		{
-			name: "requires user if password is provided",
-			args: args{
-				cfg: &MqConfiguration{
-					QueueManager: "QM1",
-					Password:     "passw0rd",
-					ConnName:     "localhost(1414)",
-					Channel:      "DEV.APP.SVRCONN",
-				},
-			},
-			want: "requires both 'user' and 'password'",
+			name:   "duplicate queue",
+			queues: []QueueConfig{{Name: "DEV.QUEUE.1"}, {Name: "DEV.QUEUE.1"}},
+			want:   "duplicate queue 'DEV.QUEUE.1'",
 		},
 		{
-			name: "requires keyRepository if sslCipherSpec is provided",
-			args: args{
-				cfg: &MqConfiguration{
-					QueueManager:  "QM1",
-					ConnName:      "localhost(1414)",
-					Channel:       "DEV.APP.SVRCONN",
-					SSLCipherSpec: "TLS_RSA_WITH_AES_128_CBC_SHA256",
-				},
-			},
-			want: "requires both 'sslCipherSpec' and 'keyRepository'",
+			name:   "queue with metrics to collect",
+			queues: []QueueConfig{{Name: "DEV.QUEUE.1", CollectMetrics: []string{"currentDepth", "maxDepth"}}},
 		},
 		{
-			name: "requires sslCipherSpec if keyRepository is provided",
-			args: args{
-				cfg: &MqConfiguration{
-					QueueManager:  "QM1",
-					ConnName:      "localhost(1414)",
-					Channel:       "DEV.APP.SVRCONN",
-					SSLCipherSpec: "TLS_RSA_WITH_AES_128_CBC_SHA256",
-				},
-			},
-			want: "requires both 'sslCipherSpec' and 'keyRepository'",
+			name:   "unknown metric to collect",
+			queues: []QueueConfig{{Name: "DEV.QUEUE.1", CollectMetrics: []string{"currentDepth", "depth"}}},
+			want:   "unknown metric 'depth' in 'collectMetrics' of queue 'DEV.QUEUE.1'",
 		},
 		{
-			name: "requires strict positive timeout",
-			args: args{
-				cfg: &MqConfiguration{
-					QueueManager: "QM1",
-					ConnName:     "localhost(1414)",
-					Channel:      "DEV.APP.SVRCONN",
-					Timeout:      &zero,
-				},
-			},
-			want: "requires strict positive 'timeout'",
+			name:   "queues with tenants",
+			queues: []QueueConfig{{Name: "DEV.QUEUE.1", Tenant: "payments"}, {Name: "DEV.QUEUE.2", Tenant: "team-billing_2"}},
+		},
+		{
+			name:   "invalid tenant",
+			queues: []QueueConfig{{Name: "DEV.QUEUE.1", Tenant: "payments/eu"}},
+			want:   "invalid tenant 'payments/eu' of queue 'DEV.QUEUE.1'",
+		},
+		{
+			name:   "invalid label name",
+			queues: []QueueConfig{{Name: "DEV.QUEUE.1", Labels: map[string]string{"business-domain": "payments"}}},
+			want:   "invalid label name 'business-domain' for queue 'DEV.QUEUE.1'",
+		},
+		{
+			name:   "reserved label name",
+			queues: []QueueConfig{{Name: "DEV.QUEUE.1", Labels: map[string]string{"__team": "payments"}}},
+			want:   "invalid label name '__team' for queue 'DEV.QUEUE.1'",
+		},
+		{
+			name:   "conflicts with label name of queue metadata",
+			queues: []QueueConfig{{Name: "DEV.QUEUE.1", Labels: map[string]string{"queue_manager": "QM2"}}},
+			want:   "label name 'queue_manager' for queue 'DEV.QUEUE.1' conflicts with built-in label",
+		},
+		{
+			name:   "conflicts with storage class",
+			queues: []QueueConfig{{Name: "DEV.QUEUE.1", Labels: map[string]string{"storage_class": "DEFAULT"}}},
+			want:   "label name 'storage_class' for queue 'DEV.QUEUE.1' conflicts with built-in label",
+		},
+		{
+			name:   "conflicts with usage",
+			queues: []QueueConfig{{Name: "DEV.QUEUE.1", Labels: map[string]string{"usage": "transmission"}}},
+			want:   "label name 'usage' for queue 'DEV.QUEUE.1' conflicts with built-in label",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			err := validateQueues(tt.queues, collector.DefaultLabelNames)
+			if tt.want == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err, tt.want)
+			}
+		})
+	}
+}
 
-			err := tt.args.cfg.validateReadFromYaml()
-			if err == nil {
-				t.Error("Expect error due to incomplete/faulty configuration.")
+func TestValidateMetricDescriptions(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		descriptions map[string]string
+		want         string
+	}{
+		{name: "none"},
+		{name: "known metric", descriptions: map[string]string{"queue_current_depth": "Aktuelle Anzahl der Nachrichten in der Queue."}},
+		{name: "unknown metric", descriptions: map[string]string{"queue_current_depth": "Aktuelle Tiefe", "queue_depth": "Tiefe"}, want: "unknown metric 'queue_depth' in 'metricDescriptions'"},
+		{name: "metric name with namespace", descriptions: map[string]string{"mq_queue_current_depth": "Aktuelle Tiefe"}, want: "unknown metric 'mq_queue_current_depth' in 'metricDescriptions'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMetricDescriptions(tt.descriptions)
+			if tt.want == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err, tt.want)
 			}
-			assert.Error(t, err, tt.want)
+		})
+	}
+}
+
+func TestValidateMaxQueueDepthOverride(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		overrides map[string]int32
+		want      string
+	}{
+		{name: "none"},
+		{name: "positive max depth", overrides: map[string]int32{"DEV.QUEUE.1": 5000}},
+		{name: "zero max depth", overrides: map[string]int32{"DEV.QUEUE.1": 5000, "DEV.QUEUE.2": 0}, want: "requires strict positive 'maxQueueDepthOverride' of queue 'DEV.QUEUE.2'"},
+		{name: "negative max depth", overrides: map[string]int32{"DEV.QUEUE.1": -1}, want: "requires strict positive 'maxQueueDepthOverride' of queue 'DEV.QUEUE.1'"},
+	}
 
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMaxQueueDepthOverride(tt.overrides)
+			if tt.want == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err, tt.want)
+			}
 		})
 	}
 }
+
+func TestValidateQueueSets(t *testing.T) {
+
+	timeout := Duration(10 * time.Second)
+	zero := Duration(0)
+	threshold := int32(0)
+
+	tests := []struct {
+		name string
+		sets []QueueSet
+		want string
+	}{
+		{
+			name: "queue sets",
+			sets: []QueueSet{{Name: "payments", Timeout: &timeout}, {Name: "billing"}},
+		},
+		{
+			name: "empty queue set name",
+			sets: []QueueSet{{Queues: []QueueConfig{{Name: "DEV.QUEUE.1"}}}},
+			want: "requires non empty queue set 'name'",
+		},
+		{
+			name: "duplicate queue set",
+			sets: []QueueSet{{Name: "payments"}, {Name: "payments"}},
+			want: "duplicate queue set 'payments'",
+		},
+		{
+			name: "non positive timeout",
+			sets: []QueueSet{{Name: "payments", Timeout: &zero}},
+			want: "requires strict positive 'timeout' of queue set 'payments'",
+		},
+		{
+			name: "non positive depth warn threshold",
+			sets: []QueueSet{{Name: "payments", DepthWarnThreshold: &threshold}},
+			want: "requires strict positive 'depthWarnThreshold' of queue set 'payments'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateQueueSets(tt.sets)
+			if tt.want == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateQueuesOfQueueSets(t *testing.T) {
+
+	cfg := MqConfiguration{
+		Queues:    []QueueConfig{{Name: "DEV.QUEUE.1"}},
+		QueueSets: []QueueSet{{Name: "payments", Queues: []QueueConfig{{Name: "DEV.QUEUE.1"}}}},
+	}
+
+	assert.Error(t, validateQueues(cfg.queues(), collector.DefaultLabelNames), "duplicate queue 'DEV.QUEUE.1'")
+}
+
+func TestValidateLabelNames(t *testing.T) {
+
+	withLabelNames := func(f func(*collector.LabelNames)) collector.LabelNames {
+		labelNames := collector.DefaultLabelNames
+		f(&labelNames)
+		return labelNames
+	}
+
+	tests := []struct {
+		name       string
+		labelNames collector.LabelNames
+		want       string
+	}{
+		{
+			name:       "default label names",
+			labelNames: collector.DefaultLabelNames,
+		},
+		{
+			name:       "custom label names",
+			labelNames: collector.LabelNames{Name: "queue_name", Connection: "conn", QueueManager: "qmgr", Channel: "chl"},
+		},
+		{
+			name:       "empty label name",
+			labelNames: withLabelNames(func(l *collector.LabelNames) { l.QueueManager = "" }),
+			want:       "requires non empty 'labelNames.queueManager'",
+		},
+		{
+			name:       "invalid label name",
+			labelNames: withLabelNames(func(l *collector.LabelNames) { l.Name = "queue-name" }),
+			want:       "invalid label name 'queue-name' for 'labelNames.name'",
+		},
+		{
+			name:       "reserved label name",
+			labelNames: withLabelNames(func(l *collector.LabelNames) { l.Channel = "__channel" }),
+			want:       "invalid label name '__channel' for 'labelNames.channel'",
+		},
+		{
+			name:       "duplicate label name",
+			labelNames: withLabelNames(func(l *collector.LabelNames) { l.Channel = "name" }),
+			want:       "duplicate label name 'name' for 'labelNames.channel'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLabelNames(tt.labelNames)
+			if tt.want == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadConfig_NonExisting(t *testing.T) {
+
+	_, err := readConfigYaml(filepath.Join(fixturesPath, "does-not-exists.yaml"))
+	assert.Error(t, err, "configuration file 'fixtures/does-not-exists.yaml' does not exists or is not readable")
+}
+
+func TestValidate(t *testing.T) {
+
+	type args struct {
+		cfg *MqConfiguration
+	}
+
+	zero := 0 * time.Second
+	timeout := 1 * time.Second
+
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "missing mandatory fields",
+			args: args{
+				cfg: &MqConfiguration{},
+			},
+			want: "missing mandatory fields: 'queueManager', 'connName', 'channel'",
+		},
+		{
+			name: "requires password if user is provided",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager: "QM1",
+					User:         "app",
+					ConnName:     "localhost(1414)",
+					Channel:      "DEV.APP.SVRCONN",
+				},
+			},
+			want: "requires both 'user' and 'password'",
+		},
+		{
+			name: "requires user if password is provided",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager: "QM1",
+					Password:     "passw0rd",
+					ConnName:     "localhost(1414)",
+					Channel:      "DEV.APP.SVRCONN",
+				},
+			},
+			want: "requires both 'user' and 'password'",
+		},
+		{
+			name: "requires keyRepository if sslCipherSpec is provided",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager:  "QM1",
+					ConnName:      "localhost(1414)",
+					Channel:       "DEV.APP.SVRCONN",
+					SSLCipherSpec: "TLS_RSA_WITH_AES_128_CBC_SHA256",
+				},
+			},
+			want: "requires both 'sslCipherSpec' and 'keyRepository'",
+		},
+		{
+			name: "requires sslCipherSpec if keyRepository is provided",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager:  "QM1",
+					ConnName:      "localhost(1414)",
+					Channel:       "DEV.APP.SVRCONN",
+					SSLCipherSpec: "TLS_RSA_WITH_AES_128_CBC_SHA256",
+				},
+			},
+			want: "requires both 'sslCipherSpec' and 'keyRepository'",
+		},
+		{
+			name: "requires either keyRepository or PEM files",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager:  "QM1",
+					ConnName:      "localhost(1414)",
+					Channel:       "DEV.APP.SVRCONN",
+					SSLCipherSpec: "TLS_RSA_WITH_AES_128_CBC_SHA256",
+					KeyRepository: "./",
+					TLSCACertFile: "ca.crt",
+				},
+			},
+			want: "requires either 'keyRepository' or 'tlsCACertFile', 'tlsClientCertFile' and 'tlsClientKeyFile'",
+		},
+		{
+			name: "requires sslCipherSpec if PEM files are provided",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager:  "QM1",
+					ConnName:      "localhost(1414)",
+					Channel:       "DEV.APP.SVRCONN",
+					TLSCACertFile: "ca.crt",
+				},
+			},
+			want: "requires both 'sslCipherSpec' and 'tlsCACertFile'",
+		},
+		{
+			name: "requires tlsCACertFile if client certificate is provided",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager:      "QM1",
+					ConnName:          "localhost(1414)",
+					Channel:           "DEV.APP.SVRCONN",
+					SSLCipherSpec:     "TLS_RSA_WITH_AES_128_CBC_SHA256",
+					TLSClientCertFile: "client.crt",
+					TLSClientKeyFile:  "client.key",
+				},
+			},
+			want: "requires both 'sslCipherSpec' and 'tlsCACertFile'",
+		},
+		{
+			name: "requires tlsClientKeyFile if tlsClientCertFile is provided",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager:      "QM1",
+					ConnName:          "localhost(1414)",
+					Channel:           "DEV.APP.SVRCONN",
+					SSLCipherSpec:     "TLS_RSA_WITH_AES_128_CBC_SHA256",
+					TLSCACertFile:     "ca.crt",
+					TLSClientCertFile: "client.crt",
+				},
+			},
+			want: "requires both 'tlsClientCertFile' and 'tlsClientKeyFile'",
+		},
+		{
+			name: "requires strict positive timeout",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager: "QM1",
+					ConnName:     "localhost(1414)",
+					Channel:      "DEV.APP.SVRCONN",
+					Timeout:      &zero,
+				},
+			},
+			want: "requires strict positive 'timeout'",
+		},
+		{
+			name: "requires strict positive pool size",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager: "QM1",
+					ConnName:     "localhost(1414)",
+					Channel:      "DEV.APP.SVRCONN",
+					Timeout:      &timeout,
+					PoolSize:     -1,
+				},
+			},
+			want: "requires strict positive 'poolSize'",
+		},
+		{
+			name: "requires non negative max queues",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager: "QM1",
+					ConnName:     "localhost(1414)",
+					Channel:      "DEV.APP.SVRCONN",
+					Timeout:      &timeout,
+					PoolSize:     1,
+					MaxQueues:    -1,
+				},
+			},
+			want: "requires non negative 'maxQueues'",
+		},
+		{
+			name: "requires non negative max concurrent reads",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager:                      "QM1",
+					ConnName:                          "localhost(1414)",
+					Channel:                           "DEV.APP.SVRCONN",
+					Timeout:                           &timeout,
+					PoolSize:                          1,
+					MaxConcurrentReadsPerQueueManager: -1,
+				},
+			},
+			want: "requires non negative 'maxConcurrentReads'",
+		},
+		{
+			name: "requires strict positive cert expiry refresh interval",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager:              "QM1",
+					ConnName:                  "localhost(1414)",
+					Channel:                   "DEV.APP.SVRCONN",
+					Timeout:                   &timeout,
+					PoolSize:                  1,
+					CertExpiryRefreshInterval: &zero,
+				},
+			},
+			want: "requires strict positive 'certExpiryRefreshInterval'",
+		},
+		{
+			name: "requires name and data key of configmap",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager:                   "QM1",
+					ConnName:                       "localhost(1414)",
+					Channel:                        "DEV.APP.SVRCONN",
+					Timeout:                        &timeout,
+					PoolSize:                       1,
+					QueueSourceKubernetesConfigMap: &QueueSourceKubernetesConfigMap{Name: "queues"},
+				},
+			},
+			want: "requires both 'name' and 'dataKey' of 'queueSourceKubernetesConfigMap'",
+		},
+		{
+			name: "requires either queues or configmap",
+			args: args{
+				cfg: &MqConfiguration{
+					QueueManager:                   "QM1",
+					ConnName:                       "localhost(1414)",
+					Channel:                        "DEV.APP.SVRCONN",
+					Timeout:                        &timeout,
+					PoolSize:                       1,
+					Queues:                         []QueueConfig{{Name: "DEV.QUEUE.1"}},
+					QueueSourceKubernetesConfigMap: &QueueSourceKubernetesConfigMap{Name: "queues", DataKey: "queues.txt"},
+				},
+			},
+			want: "requires either 'queues' or 'queueSourceKubernetesConfigMap'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			err := tt.args.cfg.validateReadFromYaml()
+			if err == nil {
+				t.Error("Expect error due to incomplete/faulty configuration.")
+			}
+			assert.ErrorContains(t, err, tt.want)
+
+		})
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+
+	zero := 0 * time.Second
+
+	cfg := &MqConfiguration{
+		QueueManager: "QM1",
+		User:         "app",
+		ConnName:     "localhost(1414)",
+		Channel:      "DEV.APP.SVRCONN",
+		Timeout:      &zero,
+		LabelNames:   collector.DefaultLabelNames,
+	}
+
+	err := cfg.validateReadFromYaml()
+	assert.Error(t, err, "3 configuration errors: 1) requires both 'user' and 'password'; 2) requires strict positive 'timeout'; 3) requires strict positive 'poolSize'")
+
+	var errs ValidationErrors
+	assert.Assert(t, errors.As(err, &errs))
+	assert.Equal(t, len(errs), 3)
+}
+
+type consulResolverFunc func(serviceName string) (string, error)
+
+func (f consulResolverFunc) Resolve(serviceName string) (string, error) {
+	return f(serviceName)
+}
+
+func TestResolveConnName(t *testing.T) {
+
+	resolved := consulResolverFunc(func(serviceName string) (string, error) {
+		return serviceName + ".service.consul(1414)", nil
+	})
+	failed := consulResolverFunc(func(serviceName string) (string, error) {
+		return "", errors.New("no healthy instance of service 'mq'")
+	})
+
+	tests := []struct {
+		name     string
+		cfg      *MqConfiguration
+		resolver consul.ConsulResolver
+		want     string
+		wantErr  string
+	}{
+		{
+			name: "without consul",
+			cfg:  &MqConfiguration{ConnName: "localhost(1414)"},
+			want: "localhost(1414)",
+		},
+		{
+			name:     "resolved by consul",
+			cfg:      &MqConfiguration{ConnName: "localhost(1414)", ConsulServiceName: "mq"},
+			resolver: resolved,
+			want:     "mq.service.consul(1414)",
+		},
+		{
+			name:     "fall back to connName",
+			cfg:      &MqConfiguration{ConnName: "localhost(1414)", ConsulServiceName: "mq"},
+			resolver: failed,
+			want:     "localhost(1414)",
+		},
+		{
+			name:     "failed without connName",
+			cfg:      &MqConfiguration{ConsulServiceName: "mq"},
+			resolver: failed,
+			wantErr:  "no healthy instance of service 'mq'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &MqConnection{cfg: tt.cfg, resolver: tt.resolver, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+			err := c.resolveConnName()
+			if tt.wantErr != "" {
+				assert.Error(t, err, tt.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, c.connName, tt.want)
+		})
+	}
+}
+
+func TestMQErrorIsSentinel(t *testing.T) {
+
+	sentinels := []error{ErrConnectionBroken, ErrQueueNotFound, ErrQueueManagerQuiescing, ErrQueueManagerStopping}
+
+	tests := []struct {
+		name string
+		mqrc int32
+		want error
+	}{
+		{
+			name: "connection broken",
+			mqrc: ibmmq.MQRC_CONNECTION_BROKEN,
+			want: ErrConnectionBroken,
+		},
+		{
+			name: "queue not found",
+			mqrc: ibmmq.MQRC_UNKNOWN_OBJECT_NAME,
+			want: ErrQueueNotFound,
+		},
+		{
+			name: "queue manager quiescing",
+			mqrc: ibmmq.MQRC_Q_MGR_QUIESCING,
+			want: ErrQueueManagerQuiescing,
+		},
+		{
+			name: "queue manager stopping",
+			mqrc: ibmmq.MQRC_Q_MGR_STOPPING,
+			want: ErrQueueManagerStopping,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			err := newMQError(&ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: tt.mqrc})
+
+			for _, sentinel := range sentinels {
+				if want, got := sentinel == tt.want, errors.Is(err, sentinel); want != got {
+					t.Errorf("errors.Is(err, %v) = %t, want %t", sentinel.(*MQError).MQReturn.MQRC, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMQErrorIsRequiresFailedCompletionCode(t *testing.T) {
+
+	err := newMQError(&ibmmq.MQReturn{MQCC: ibmmq.MQCC_WARNING, MQRC: ibmmq.MQRC_CONNECTION_BROKEN})
+
+	if errors.Is(err, ErrConnectionBroken) {
+		t.Error("Should not match sentinel with different completion code.")
+	}
+}
+
+func TestMQErrorAs(t *testing.T) {
+
+	err := newMQError(&ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_UNKNOWN_OBJECT_NAME})
+
+	var mqerr *MQError
+	assert.Assert(t, errors.As(err, &mqerr))
+
+	var mqret *ibmmq.MQReturn
+	assert.Assert(t, errors.As(err, &mqret))
+	assert.Equal(t, mqret.MQRC, ibmmq.MQRC_UNKNOWN_OBJECT_NAME)
+}
+
+func TestMQErrorReasonCode(t *testing.T) {
+
+	var err error = newMQError(&ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_UNKNOWN_OBJECT_NAME})
+
+	var rc collector.ReasonCoder
+	assert.Assert(t, errors.As(err, &rc))
+	assert.Equal(t, rc.ReasonCode(), int32(ibmmq.MQRC_UNKNOWN_OBJECT_NAME))
+}
+
+func TestNewMQErrorKeepsNonMQErrors(t *testing.T) {
+
+	err := errors.New("Failed")
+
+	assert.Equal(t, newMQError(err), err)
+	assert.NilError(t, newMQError(nil))
+}
+
+// newMockConnection returns a connection to the queue manager QM1 with two
+// queues and a pool of two handles, which connects by connx.
+func newMockConnection(connx func(string, *ibmmq.MQCNO) (MQQueueManager, error)) *MqConnection {
+	return &MqConnection{
+		isConnecting: new(int64),
+		cfg: &MqConfiguration{
+			QueueManager: "QM1",
+			PoolSize:     2,
+			Queues:       []QueueConfig{{Name: "DEV.QUEUE.1"}, {Name: "DEV.QUEUE.2"}},
+		},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		connx:  connx,
+		done:   make(chan struct{}),
+	}
+}
+
+func TestConnectWithMockQueueManager(t *testing.T) {
+
+	h1, h2 := &MockMQQueueManager{}, &MockMQQueueManager{}
+	c := newMockConnection(mockConnx(nil, nil, h1, h2))
+
+	assert.NilError(t, c.connect())
+
+	assert.DeepEqual(t, h1.Opened(), []string{"DEV.QUEUE.1", "DEV.QUEUE.2"})
+	assert.DeepEqual(t, h2.Opened(), []string{"DEV.QUEUE.1", "DEV.QUEUE.2"})
+	assert.Equal(t, c.pool.Size(), 2)
+	assert.Equal(t, c.qMgr, MQQueueManager(h1))
+	assert.Equal(t, c.keepaliveQueue.Name, "DEV.QUEUE.1")
+	assert.Equal(t, c.Generation(), int64(1))
+}
+
+func TestConnectFailsIfConnxFails(t *testing.T) {
+
+	failed := &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_Q_MGR_NOT_AVAILABLE}
+	c := newMockConnection(mockConnx(failed, nil))
+
+	err := c.connect()
+	assert.Assert(t, errors.Is(err, failed))
+	assert.Assert(t, c.pool == nil)
+	assert.Equal(t, c.Generation(), int64(0))
+}
+
+func TestConnectFailsIfQueueCannotBeOpened(t *testing.T) {
+
+	failed := &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_UNKNOWN_OBJECT_NAME}
+	qMgr := &MockMQQueueManager{OpenErr: failed}
+	c := newMockConnection(mockConnx(nil, nil, qMgr))
+
+	err := c.connect()
+	assert.Assert(t, errors.Is(err, failed))
+	assert.Assert(t, c.pool == nil)
+	assert.Equal(t, qMgr.Discs(), 1)
+}
+
+func TestConnectDisconnectsHandlesOfFailedConnect(t *testing.T) {
+
+	failed := &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_UNKNOWN_OBJECT_NAME}
+	h1, h2 := &MockMQQueueManager{}, &MockMQQueueManager{OpenErr: failed}
+	c := newMockConnection(mockConnx(nil, nil, h1, h2))
+
+	err := c.connect()
+	assert.Assert(t, errors.Is(err, failed))
+	assert.Assert(t, c.pool == nil)
+	assert.Equal(t, h1.Discs(), 1)
+	assert.Equal(t, h2.Discs(), 1)
+}
+
+func TestCloseDisconnectsPoolHandles(t *testing.T) {
+
+	h1 := &MockMQQueueManager{}
+	h2 := &MockMQQueueManager{DiscErr: &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_CONNECTION_BROKEN}}
+
+	// the objects opened by the mock can't be closed, so the handles have
+	// no open queues
+	c := newMockConnection(nil)
+	c.cfg.Queues = nil
+	c.pool = newConnectionPool([]*poolHandle{{qMgr: h1}, {qMgr: h2}})
+
+	c.Close()
+
+	// a failed disconnect doesn't stop the disconnect of the other handles
+	assert.Equal(t, h1.Discs(), 1)
+	assert.Equal(t, h2.Discs(), 1)
+}
+
+func TestReconnectDisconnectsPreviousPoolHandlesOnceReleased(t *testing.T) {
+
+	h1, h2 := &MockMQQueueManager{}, &MockMQQueueManager{}
+	c := newMockConnection(mockConnx(nil, nil, h1, h2, &MockMQQueueManager{}, &MockMQQueueManager{}))
+	assert.NilError(t, c.connect())
+
+	// the inquiry in progress holds the first handle
+	previous := c.pool
+	handle, err := previous.acquire()
+	assert.NilError(t, err)
+
+	assert.NilError(t, c.connect())
+	assert.Assert(t, c.pool != previous)
+
+	disconnected := func(qMgr *MockMQQueueManager) func(poll.LogT) poll.Result {
+		return func(poll.LogT) poll.Result {
+			if qMgr.Discs() == 1 {
+				return poll.Success()
+			}
+			return poll.Continue("handle is not disconnected")
+		}
+	}
+	poll.WaitOn(t, disconnected(h2), poll.WithTimeout(time.Second))
+	assert.Equal(t, h1.Discs(), 0)
+
+	previous.release(handle)
+	poll.WaitOn(t, disconnected(h1), poll.WithTimeout(time.Second))
+}
+
+func TestHandleReturnValueReconnectsOnConnectionBroken(t *testing.T) {
+
+	connected := make(chan string, 4)
+	c := newMockConnection(mockConnx(nil, connected, &MockMQQueueManager{}, &MockMQQueueManager{}, &MockMQQueueManager{}, &MockMQQueueManager{}))
+	assert.NilError(t, c.connect())
+	<-connected
+	<-connected
+
+	err := c.handleReturnValue(&ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_UNKNOWN_OBJECT_NAME})
+	assert.Assert(t, errors.Is(err, ErrQueueNotFound))
+	select {
+	case <-connected:
+		t.Fatal("Should not re-connect on other errors than a broken connection.")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	err = c.handleReturnValue(&ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_CONNECTION_BROKEN})
+	assert.Assert(t, errors.Is(err, ErrConnectionBroken))
+	select {
+	case qMgrName := <-connected:
+		assert.Equal(t, qMgrName, "QM1")
+	case <-time.After(1 * time.Second):
+		t.Fatal("Should re-connect on a broken connection.")
+	}
+}
+
+func TestConnectionPool(t *testing.T) {
+
+	handles := []*poolHandle{{}, {}, {}}
+	pool := newConnectionPool(handles)
+
+	assert.Equal(t, pool.Size(), 3)
+	assert.Equal(t, pool.Available(), 3)
+
+	var inUse, maxInUse int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			handle, err := pool.acquire()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer pool.release(handle)
+
+			n := atomic.AddInt64(&inUse, 1)
+			for {
+				m := atomic.LoadInt64(&maxInUse)
+				if n <= m || atomic.CompareAndSwapInt64(&maxInUse, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt64(&inUse, -1)
+		}()
+	}
+	wg.Wait()
+
+	assert.Assert(t, maxInUse <= 3, "Should not use more handles than pool size: %d", maxInUse)
+	assert.Equal(t, pool.Available(), 3)
+}
+
+func TestConnectionPoolDiscardsPoisonedHandles(t *testing.T) {
+
+	h1, h2 := &poolHandle{}, &poolHandle{}
+	pool := newConnectionPool([]*poolHandle{h1, h2})
+
+	handle, err := pool.acquire()
+	assert.NilError(t, err)
+	handle.poisoned.Store(true)
+	pool.release(handle)
+	assert.Equal(t, pool.Available(), 1)
+
+	other, err := pool.acquire()
+	assert.NilError(t, err)
+	assert.Assert(t, other != handle)
+
+	// a handle poisoned while it's available is discarded on acquire
+	pool.release(other)
+	other.poisoned.Store(true)
+	_, err = pool.acquire()
+	assert.Assert(t, errors.Is(err, errPoolExhausted))
+}
+
+func TestCancelPoisonsHandleOfInquiry(t *testing.T) {
+
+	h1, h2 := &MockMQQueueManager{}, &MockMQQueueManager{}
+	c := newMockConnection(mockConnx(nil, nil, h1, h2, &MockMQQueueManager{}, &MockMQQueueManager{}))
+	assert.NilError(t, c.connect())
+
+	previous := c.pool
+	handle, err := previous.acquire()
+	assert.NilError(t, err)
+
+	q := &MqQueue{connection: c, logger: c.logger, name: "DEV.QUEUE.1"}
+	q.inquiring.Store(handle)
+	q.Cancel()
+	q.Cancel()
+	assert.Assert(t, handle.poisoned.Load())
+
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if c.Generation() == 2 && h1.Discs() == 1 && h2.Discs() == 1 {
+			return poll.Success()
+		}
+		return poll.Continue("handles are not disconnected")
+	}, poll.WithTimeout(time.Second))
+
+	// the poisoned handle is discarded on release, not disconnected again
+	previous.release(handle)
+	_, err = previous.acquire()
+	assert.Assert(t, errors.Is(err, errPoolExhausted))
+	assert.Equal(t, h1.Discs(), 1)
+}
+
+func TestQueueScope(t *testing.T) {
+
+	assert.Equal(t, queueScope(ibmmq.MQSCO_Q_MGR), int32(0))
+	assert.Equal(t, queueScope(ibmmq.MQSCO_CELL), int32(1))
+}
+
+func TestIndexTypeName(t *testing.T) {
+
+	tests := []struct {
+		indexType int32
+		want      string
+	}{
+		{indexType: ibmmq.MQIT_NONE, want: "none"},
+		{indexType: ibmmq.MQIT_MSG_ID, want: "msg_id"},
+		{indexType: ibmmq.MQIT_CORREL_ID, want: "correl_id"},
+		{indexType: ibmmq.MQIT_MSG_TOKEN, want: "msg_token"},
+		{indexType: ibmmq.MQIT_GROUP_ID, want: "group_id"},
+		{indexType: 42, want: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, indexTypeName(tt.indexType), tt.want)
+		})
+	}
+}
+
+func TestMonitoringLevel(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		value int32
+		want  int32
+	}{
+		{name: "off", value: ibmmq.MQMON_OFF, want: 0},
+		{name: "on", value: ibmmq.MQMON_ON, want: 1},
+		{name: "low", value: ibmmq.MQMON_LOW, want: 1},
+		{name: "medium", value: ibmmq.MQMON_MEDIUM, want: 2},
+		{name: "high", value: ibmmq.MQMON_HIGH, want: 3},
+		{name: "queue manager", value: ibmmq.MQMON_Q_MGR, want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, monitoringLevel(tt.value), tt.want)
+		})
+	}
+}
+
+func TestReloadQueuesOfConfigMap(t *testing.T) {
+
+	h1, h2 := &MockMQQueueManager{}, &MockMQQueueManager{}
+	c := newMockConnection(mockConnx(nil, nil, h1, h2))
+	c.configMapQueues = []string{"DEV.QUEUE.1", "DEV.QUEUE.2"}
+
+	var reconnected []collector.Queue
+	c.OnReconnect(func(queues []collector.Queue, generation int64) {
+		reconnected = queues
+	})
+
+	// unchanged and empty queues are no reload
+	c.reloadQueues([]string{"DEV.QUEUE.1", "DEV.QUEUE.2"})
+	c.reloadQueues([]string{})
+	assert.Equal(t, c.Generation(), int64(0))
+
+	c.reloadQueues([]string{"DEV.QUEUE.3"})
+
+	assert.Equal(t, c.Generation(), int64(1))
+	assert.DeepEqual(t, h1.Opened(), []string{"DEV.QUEUE.3"})
+	assert.DeepEqual(t, c.configMapQueues, []string{"DEV.QUEUE.3"})
+	assert.Equal(t, len(reconnected), 1)
+	assert.Equal(t, reconnected[0].Metadata.QueueName, "DEV.QUEUE.3")
+}
+
+func TestReloadQueuesOfConfigMapKeepsQueuesOnFailedConnect(t *testing.T) {
+
+	c := newMockConnection(mockConnx(errors.New("connect failed"), nil))
+	c.configMapQueues = []string{"DEV.QUEUE.1", "DEV.QUEUE.2"}
+
+	c.reloadQueues([]string{"DEV.QUEUE.3"})
+
+	assert.Equal(t, c.Generation(), int64(0))
+	assert.DeepEqual(t, c.configMapQueues, []string{"DEV.QUEUE.1", "DEV.QUEUE.2"})
+	assert.DeepEqual(t, c.cfg.Queues, []QueueConfig{{Name: "DEV.QUEUE.1"}, {Name: "DEV.QUEUE.2"}})
+}
+
+func TestInquireQueueNotOpenOnConnection(t *testing.T) {
+
+	h1, h2 := &MockMQQueueManager{}, &MockMQQueueManager{}
+	c := newMockConnection(mockConnx(nil, nil, h1, h2))
+	assert.NilError(t, c.connect())
+
+	_, err := c.inqQueue(&MqQueue{connection: c, name: "DEV.QUEUE.3"}, []int32{ibmmq.MQIA_CURRENT_Q_DEPTH})
+	assert.Error(t, err, "queue 'DEV.QUEUE.3' is not open on the connection")
+}
+
+// failingConnx returns a connx which fails with the errors one after another
+// and connects to the queue manager once all errors are returned.
+func failingConnx(qMgr *MockMQQueueManager, errs ...error) (func(string, *ibmmq.MQCNO) (MQQueueManager, error), *int) {
+	calls := 0
+	return func(qMgrName string, cno *ibmmq.MQCNO) (MQQueueManager, error) {
+		calls++
+		if len(errs) > 0 {
+			err := errs[0]
+			errs = errs[1:]
+			return nil, err
+		}
+		return qMgr, nil
+	}, &calls
+}
+
+func TestConnectOnStartupRetriesWhileQueueManagerIsQuiescing(t *testing.T) {
+
+	quiescing := &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_Q_MGR_QUIESCING}
+	stopping := &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_Q_MGR_STOPPING}
+
+	qMgr := &MockMQQueueManager{}
+	connx, calls := failingConnx(qMgr, quiescing, stopping)
+	c := newMockConnection(connx)
+	c.cfg.PoolSize = 1
+
+	assert.NilError(t, c.connectOnStartup(StartupRetry{Count: 3, Interval: time.Millisecond}))
+	assert.Equal(t, *calls, 3)
+	assert.Equal(t, c.qMgr, MQQueueManager(qMgr))
+	assert.Equal(t, c.Generation(), int64(1))
+}
+
+func TestConnectOnStartupFailsIfRetriesAreExhausted(t *testing.T) {
+
+	quiescing := &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_Q_MGR_QUIESCING}
+
+	connx, calls := failingConnx(&MockMQQueueManager{}, quiescing, quiescing, quiescing)
+	c := newMockConnection(connx)
+
+	err := c.connectOnStartup(StartupRetry{Count: 2, Interval: time.Millisecond})
+	assert.Assert(t, errors.Is(newMQError(err), ErrQueueManagerQuiescing))
+	assert.Equal(t, *calls, 3)
+	assert.Equal(t, c.Generation(), int64(0))
+}
+
+func TestConnectOnStartupFailsImmediatelyOnOtherErrors(t *testing.T) {
+
+	notAuthorized := &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_NOT_AUTHORIZED}
+
+	connx, calls := failingConnx(&MockMQQueueManager{}, notAuthorized)
+	c := newMockConnection(connx)
+
+	err := c.connectOnStartup(StartupRetry{Count: 3, Interval: time.Millisecond})
+	assert.Assert(t, errors.Is(err, notAuthorized))
+	assert.Equal(t, *calls, 1)
+}
@@ -0,0 +1,45 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import "github.com/agebhar1/mq_exporter/collector"
+
+// OverridingQueueMetricsReader replaces the max depth of the read metrics of
+// a queue by the configured one.
+type OverridingQueueMetricsReader struct {
+	reader   collector.QueueMetricsReader
+	maxDepth int32
+}
+
+func NewOverridingQueueMetricsReader(reader collector.QueueMetricsReader, maxDepth int32) *OverridingQueueMetricsReader {
+	return &OverridingQueueMetricsReader{reader: reader, maxDepth: maxDepth}
+}
+
+func (r *OverridingQueueMetricsReader) Read() (collector.QueueMetrics, error) {
+
+	m, err := r.reader.Read()
+	if err != nil {
+		return m, err
+	}
+	m.MaxDepth = r.maxDepth
+	return m, nil
+}
+
+// Cancel cancels the read in progress if the reader is cancelable.
+func (r *OverridingQueueMetricsReader) Cancel() {
+	if reader, ok := r.reader.(collector.CancelableQueueMetricsReader); ok {
+		reader.Cancel()
+	}
+}
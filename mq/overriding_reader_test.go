@@ -0,0 +1,61 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/agebhar1/mq_exporter/collector"
+	"gotest.tools/v3/assert"
+)
+
+func TestOverridingQueueMetricsReader(t *testing.T) {
+
+	var value collector.QueueMetrics
+	var err error
+	reader := NewOverridingQueueMetricsReader(queueMetricsReaderFunc(func() (collector.QueueMetrics, error) {
+		return value, err
+	}), 5000)
+
+	value = collector.QueueMetrics{Metadata: collector.QueueMetadata{QueueName: "DEV.QUEUE.1"}, CurrentDepth: 42, MaxDepth: 0}
+	m, got := reader.Read()
+	assert.NilError(t, got)
+	assert.DeepEqual(t, m, collector.QueueMetrics{Metadata: collector.QueueMetadata{QueueName: "DEV.QUEUE.1"}, CurrentDepth: 42, MaxDepth: 5000})
+
+	failed := errors.New("Failed")
+	value, err = collector.QueueMetrics{}, failed
+	m, got = reader.Read()
+	assert.Assert(t, errors.Is(got, failed))
+	assert.Equal(t, m.MaxDepth, int32(0))
+}
+
+func TestQueuesWithMaxQueueDepthOverride(t *testing.T) {
+
+	c := &MqConnection{cfg: &MqConfiguration{
+		Queues:                []QueueConfig{{Name: "DEV.QUEUE.1"}, {Name: "DEV.QUEUE.2"}},
+		MaxQueueDepthOverride: map[string]int32{"DEV.QUEUE.2": 5000},
+	}, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	queues := c.Queues()
+	assert.Equal(t, len(queues), 2)
+
+	_, ok := queues[0].Reader.(*OverridingQueueMetricsReader)
+	assert.Assert(t, !ok)
+	_, ok = queues[1].Reader.(*OverridingQueueMetricsReader)
+	assert.Assert(t, ok)
+}
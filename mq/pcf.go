@@ -0,0 +1,201 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import (
+	"strings"
+
+	"github.com/ibm-messaging/mq-golang/v5/ibmmq"
+)
+
+const (
+	commandQueueName    = "SYSTEM.ADMIN.COMMAND.QUEUE"
+	replyModelQueueName = "SYSTEM.DEFAULT.MODEL.QUEUE"
+	replyQueuePrefix    = "MQ_EXPORTER.*"
+
+	pcfBufferSize = 64 * 1024
+)
+
+// pcfResponse is a single response message of a PCF command with its
+// (top level) parameters. Event messages are parsed the same way with the
+// type MQCFT_EVENT.
+type pcfResponse struct {
+	Type       int32
+	CompCode   int32
+	Reason     int32
+	Parameters map[int32]*ibmmq.PCFParameter
+}
+
+func (r *pcfResponse) intValue(parameter int32) (int64, bool) {
+	p, ok := r.Parameters[parameter]
+	if !ok || len(p.Int64Value) == 0 {
+		return 0, false
+	}
+	return p.Int64Value[0], true
+}
+
+func (r *pcfResponse) stringValue(parameter int32) (string, bool) {
+	p, ok := r.Parameters[parameter]
+	if !ok || len(p.String) == 0 {
+		return "", false
+	}
+	return strings.TrimSpace(p.String[0]), true
+}
+
+func stringParameter(parameter int32, value string) *ibmmq.PCFParameter {
+	return &ibmmq.PCFParameter{Type: ibmmq.MQCFT_STRING, Parameter: parameter, String: []string{value}}
+}
+
+func intParameter(parameter int32, value int32) *ibmmq.PCFParameter {
+	return &ibmmq.PCFParameter{Type: ibmmq.MQCFT_INTEGER, Parameter: parameter, Int64Value: []int64{int64(value)}}
+}
+
+func intListParameter(parameter int32, values ...int32) *ibmmq.PCFParameter {
+	xs := make([]int64, 0, len(values))
+	for _, v := range values {
+		xs = append(xs, int64(v))
+	}
+	return &ibmmq.PCFParameter{Type: ibmmq.MQCFT_INTEGER_LIST, Parameter: parameter, Int64Value: xs}
+}
+
+// parsePCFResponse parses a PCF response message. It returns false as
+// second value if the message is the last one of the response.
+func parsePCFResponse(buf []byte) (*pcfResponse, bool) {
+
+	cfh, offset := ibmmq.ReadPCFHeader(buf)
+	if cfh == nil {
+		return &pcfResponse{CompCode: ibmmq.MQCC_FAILED, Reason: ibmmq.MQRC_UNEXPECTED_ERROR}, false
+	}
+
+	response := &pcfResponse{
+		Type:       cfh.Type,
+		CompCode:   cfh.CompCode,
+		Reason:     cfh.Reason,
+		Parameters: make(map[int32]*ibmmq.PCFParameter),
+	}
+	for i := 0; i < int(cfh.ParameterCount) && offset < len(buf); i++ {
+		p, n := ibmmq.ReadPCFParameter(buf[offset:])
+		response.Parameters[p.Parameter] = p
+		offset += n
+	}
+
+	return response, cfh.Control != ibmmq.MQCFC_LAST
+}
+
+func (c *MqConnection) openPCFQueues() error {
+
+	if c.pcfQueuesOpen {
+		return nil
+	}
+
+	od := ibmmq.NewMQOD()
+	od.ObjectType = ibmmq.MQOT_Q
+	od.ObjectName = commandQueueName
+	commandQueue, err := c.qMgr.Open(od, ibmmq.MQOO_OUTPUT)
+	if err != nil {
+		return err
+	}
+
+	od = ibmmq.NewMQOD()
+	od.ObjectType = ibmmq.MQOT_Q
+	od.ObjectName = replyModelQueueName
+	od.DynamicQName = replyQueuePrefix
+	replyQueue, err := c.qMgr.Open(od, ibmmq.MQOO_INPUT_EXCLUSIVE)
+	if err != nil {
+		commandQueue.Close(0)
+		return err
+	}
+
+	c.commandQueue = commandQueue
+	c.replyQueue = replyQueue
+	c.pcfQueuesOpen = true
+
+	return nil
+}
+
+func (c *MqConnection) closePCFQueues() {
+
+	if !c.pcfQueuesOpen {
+		return
+	}
+
+	if err := c.commandQueue.Close(0); err != nil {
+		c.logger.Error("failed to close command queue", "err", err)
+	}
+	if err := c.replyQueue.Close(ibmmq.MQCO_DELETE_PURGE); err != nil {
+		c.logger.Error("failed to close reply queue", "err", err)
+	}
+	c.pcfQueuesOpen = false
+}
+
+// pcfCommand sends a PCF command to the command server of the queue manager
+// and returns all response messages. Commands are serialized since the reply
+// queue is shared.
+func (c *MqConnection) pcfCommand(command int32, parameters ...*ibmmq.PCFParameter) ([]*pcfResponse, error) {
+
+	c.pcfMutex.Lock()
+	defer c.pcfMutex.Unlock()
+
+	if err := c.openPCFQueues(); err != nil {
+		return nil, c.handleReturnValue(err)
+	}
+
+	cfh := ibmmq.NewMQCFH()
+	cfh.Command = command
+	cfh.ParameterCount = int32(len(parameters))
+
+	buf := cfh.Bytes()
+	for _, p := range parameters {
+		buf = append(buf, p.Bytes()...)
+	}
+
+	putmqmd := ibmmq.NewMQMD()
+	putmqmd.Format = ibmmq.MQFMT_ADMIN
+	putmqmd.MsgType = ibmmq.MQMT_REQUEST
+	putmqmd.ReplyToQ = c.replyQueue.Name
+	putmqmd.Report = ibmmq.MQRO_PASS_DISCARD_AND_EXPIRY
+	putmqmd.Expiry = int32(c.Timeout().Milliseconds() / 100)
+
+	pmo := ibmmq.NewMQPMO()
+	pmo.Options = ibmmq.MQPMO_NO_SYNCPOINT | ibmmq.MQPMO_NEW_MSG_ID | ibmmq.MQPMO_NEW_CORREL_ID | ibmmq.MQPMO_FAIL_IF_QUIESCING
+
+	if err := c.commandQueue.Put(putmqmd, pmo, buf); err != nil {
+		return nil, c.handleReturnValue(err)
+	}
+
+	responses := make([]*pcfResponse, 0)
+	replyBuf := make([]byte, pcfBufferSize)
+
+	for more := true; more; {
+		getmqmd := ibmmq.NewMQMD()
+		getmqmd.CorrelId = putmqmd.MsgId
+
+		gmo := ibmmq.NewMQGMO()
+		gmo.Options = ibmmq.MQGMO_NO_SYNCPOINT | ibmmq.MQGMO_FAIL_IF_QUIESCING | ibmmq.MQGMO_WAIT | ibmmq.MQGMO_CONVERT
+		gmo.MatchOptions = ibmmq.MQMO_MATCH_CORREL_ID
+		gmo.WaitInterval = int32(c.Timeout().Milliseconds())
+
+		datalen, err := c.replyQueue.Get(getmqmd, gmo, replyBuf)
+		if err != nil {
+			return nil, c.handleReturnValue(err)
+		}
+
+		var response *pcfResponse
+		response, more = parsePCFResponse(replyBuf[:datalen])
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
@@ -0,0 +1,375 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/agebhar1/mq_exporter/collector"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ibm-messaging/mq-golang/v5/ibmmq"
+	"gotest.tools/v3/assert"
+)
+
+func pcfResponseBytes(control int32, reason int32, parameters ...*ibmmq.PCFParameter) []byte {
+	cfh := ibmmq.NewMQCFH()
+	cfh.Type = ibmmq.MQCFT_RESPONSE
+	cfh.Command = ibmmq.MQCMD_INQUIRE_CHANNEL_STATUS
+	cfh.Control = control
+	cfh.Reason = reason
+	if reason != ibmmq.MQRC_NONE {
+		cfh.CompCode = ibmmq.MQCC_FAILED
+	}
+	cfh.ParameterCount = int32(len(parameters))
+
+	buf := cfh.Bytes()
+	for _, p := range parameters {
+		buf = append(buf, p.Bytes()...)
+	}
+	return buf
+}
+
+func channelStatusResponse(control int32, name string, status int32, date string, tod string, parameters ...*ibmmq.PCFParameter) []byte {
+	return pcfResponseBytes(control, ibmmq.MQRC_NONE, append([]*ibmmq.PCFParameter{
+		stringParameter(ibmmq.MQCACH_CHANNEL_NAME, name),
+		intParameter(ibmmq.MQIACH_CHANNEL_STATUS, status),
+		stringParameter(ibmmq.MQCACH_LAST_MSG_DATE, date),
+		stringParameter(ibmmq.MQCACH_LAST_MSG_TIME, tod),
+	}, parameters...)...)
+}
+
+func TestParsePCFResponse(t *testing.T) {
+
+	response, more := parsePCFResponse(channelStatusResponse(ibmmq.MQCFC_NOT_LAST, "DEV.APP.SVRCONN  ", ibmmq.MQCHS_RUNNING, "2024-01-02", "03.04.05"))
+	assert.Equal(t, more, true)
+	assert.Equal(t, response.CompCode, int32(ibmmq.MQCC_OK))
+
+	name, ok := response.stringValue(ibmmq.MQCACH_CHANNEL_NAME)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, name, "DEV.APP.SVRCONN")
+
+	status, ok := response.intValue(ibmmq.MQIACH_CHANNEL_STATUS)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, status, int64(ibmmq.MQCHS_RUNNING))
+
+	_, more = parsePCFResponse(pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRCCF_CHL_STATUS_NOT_FOUND))
+	assert.Equal(t, more, false)
+}
+
+func TestChannelMetrics(t *testing.T) {
+
+	reader := &ChannelStatusReader{
+		connection: &MqConnection{cfg: &MqConfiguration{ConnName: "localhost(1414)", QueueManager: "QM1"}},
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	metadata := func(name string) collector.ChannelMetadata {
+		return collector.ChannelMetadata{ChannelName: name, ConnectionName: "localhost(1414)", QMgrName: "QM1"}
+	}
+
+	parse := func(messages ...[]byte) []*pcfResponse {
+		responses := make([]*pcfResponse, 0, len(messages))
+		for _, message := range messages {
+			response, _ := parsePCFResponse(message)
+			responses = append(responses, response)
+		}
+		return responses
+	}
+
+	tests := []struct {
+		name      string
+		channel   string
+		responses []*pcfResponse
+		want      []collector.ChannelMetrics
+	}{
+		{
+			name:      "channel without status",
+			channel:   "TO.QM2",
+			responses: parse(pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRCCF_CHL_STATUS_NOT_FOUND)),
+			want: []collector.ChannelMetrics{
+				{Metadata: metadata("TO.QM2"), Status: ibmmq.MQCHS_INACTIVE, StatusText: "inactive"},
+			},
+		},
+		{
+			name:      "generic channel name without status",
+			channel:   "TO.*",
+			responses: parse(pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRCCF_CHL_STATUS_NOT_FOUND)),
+			want:      []collector.ChannelMetrics{},
+		},
+		{
+			name:    "multiple instances of channel",
+			channel: "DEV.APP.SVRCONN",
+			responses: parse(
+				channelStatusResponse(ibmmq.MQCFC_NOT_LAST, "DEV.APP.SVRCONN", ibmmq.MQCHS_STOPPED, "2024-01-02", "03.04.05"),
+				channelStatusResponse(ibmmq.MQCFC_NOT_LAST, "DEV.APP.SVRCONN", ibmmq.MQCHS_RUNNING, "2024-01-01", "03.04.05"),
+				channelStatusResponse(ibmmq.MQCFC_LAST, "DEV.APP.SVRCONN", ibmmq.MQCHS_RETRYING, "", ""),
+			),
+			want: []collector.ChannelMetrics{
+				{
+					Metadata:    metadata("DEV.APP.SVRCONN"),
+					Status:      ibmmq.MQCHS_RUNNING,
+					StatusText:  "running",
+					LastMsgTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local),
+				},
+			},
+		},
+		{
+			name:    "ssl key resets of all instances",
+			channel: "TO.QM3",
+			responses: parse(
+				channelStatusResponse(ibmmq.MQCFC_NOT_LAST, "TO.QM3", ibmmq.MQCHS_RUNNING, "", "", intParameter(ibmmq.MQIACH_SSL_KEY_RESETS, 3)),
+				channelStatusResponse(ibmmq.MQCFC_LAST, "TO.QM3", ibmmq.MQCHS_RUNNING, "", "", intParameter(ibmmq.MQIACH_SSL_KEY_RESETS, 4)),
+			),
+			want: []collector.ChannelMetrics{
+				{
+					Metadata:     metadata("TO.QM3"),
+					Status:       ibmmq.MQCHS_RUNNING,
+					StatusText:   "running",
+					SSLKeyResets: 7,
+				},
+			},
+		},
+		{
+			name:    "messages of all instances",
+			channel: "TO.QM3",
+			responses: parse(
+				channelStatusResponse(ibmmq.MQCFC_NOT_LAST, "TO.QM3", ibmmq.MQCHS_RUNNING, "", "", intParameter(ibmmq.MQIACH_MSGS, 10)),
+				channelStatusResponse(ibmmq.MQCFC_LAST, "TO.QM3", ibmmq.MQCHS_STOPPED, "", "", intParameter(ibmmq.MQIACH_MSGS, 32)),
+			),
+			want: []collector.ChannelMetrics{
+				{
+					Metadata:   metadata("TO.QM3"),
+					Status:     ibmmq.MQCHS_RUNNING,
+					StatusText: "running",
+					Messages:   42,
+				},
+			},
+		},
+		{
+			name:    "instances in doubt",
+			channel: "TO.QM3",
+			responses: parse(
+				channelStatusResponse(ibmmq.MQCFC_NOT_LAST, "TO.QM3", ibmmq.MQCHS_RUNNING, "", "", intParameter(ibmmq.MQIACH_INDOUBT_STATUS, ibmmq.MQCHIDS_INDOUBT)),
+				channelStatusResponse(ibmmq.MQCFC_NOT_LAST, "TO.QM3", ibmmq.MQCHS_RUNNING, "", "", intParameter(ibmmq.MQIACH_INDOUBT_STATUS, ibmmq.MQCHIDS_NOT_INDOUBT)),
+				channelStatusResponse(ibmmq.MQCFC_LAST, "TO.QM3", ibmmq.MQCHS_RETRYING, "", "", intParameter(ibmmq.MQIACH_INDOUBT_STATUS, ibmmq.MQCHIDS_INDOUBT)),
+			),
+			want: []collector.ChannelMetrics{
+				{
+					Metadata:         metadata("TO.QM3"),
+					Status:           ibmmq.MQCHS_RUNNING,
+					StatusText:       "running",
+					InDoubtInstances: 2,
+				},
+			},
+		},
+		{
+			name:    "network time of running instances only",
+			channel: "TO.QM2",
+			responses: parse(
+				channelStatusResponse(ibmmq.MQCFC_NOT_LAST, "TO.QM2", ibmmq.MQCHS_RUNNING, "2024-01-02", "03.04.05", intListParameter(ibmmq.MQIACH_NETWORK_TIME_INDICATOR, 1500, 2000)),
+				channelStatusResponse(ibmmq.MQCFC_NOT_LAST, "TO.QM2", ibmmq.MQCHS_RUNNING, "2024-01-02", "03.04.05", intListParameter(ibmmq.MQIACH_NETWORK_TIME_INDICATOR, ibmmq.MQMON_NOT_AVAILABLE, ibmmq.MQMON_NOT_AVAILABLE)),
+				channelStatusResponse(ibmmq.MQCFC_LAST, "TO.QM2", ibmmq.MQCHS_STOPPED, "2024-01-02", "03.04.05", intListParameter(ibmmq.MQIACH_NETWORK_TIME_INDICATOR, 9000, 9000)),
+			),
+			want: []collector.ChannelMetrics{
+				{
+					Metadata:    metadata("TO.QM2"),
+					Status:      ibmmq.MQCHS_RUNNING,
+					StatusText:  "running",
+					LastMsgTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local),
+					NetworkTime: 1500 * time.Microsecond,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reader.channelMetrics(tt.channel, tt.responses)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Should contain expected channel metrics (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestQueueHandles(t *testing.T) {
+
+	reader := &QueueHandlesReader{
+		connection: &MqConnection{cfg: &MqConfiguration{ConnName: "localhost(1414)", QueueManager: "QM1", Channel: "DEV.APP.SVRCONN"}},
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	handle := func(control int32, applicationName string, input int32, output int32) *pcfResponse {
+		response, _ := parsePCFResponse(pcfResponseBytes(control, ibmmq.MQRC_NONE,
+			stringParameter(ibmmq.MQCA_Q_NAME, "DEV.QUEUE.1"),
+			stringParameter(ibmmq.MQCACF_APPL_NAME, applicationName),
+			intParameter(ibmmq.MQIACF_OPEN_INPUT_TYPE, input),
+			intParameter(ibmmq.MQIACF_OPEN_OUTPUT, output),
+		))
+		return response
+	}
+
+	responses := []*pcfResponse{
+		handle(ibmmq.MQCFC_NOT_LAST, "amqsget", ibmmq.MQQSO_SHARED, ibmmq.MQQSO_NO),
+		handle(ibmmq.MQCFC_NOT_LAST, "amqsput", ibmmq.MQQSO_NO, ibmmq.MQQSO_YES),
+		handle(ibmmq.MQCFC_NOT_LAST, "amqsget", ibmmq.MQQSO_EXCLUSIVE, ibmmq.MQQSO_NO),
+		handle(ibmmq.MQCFC_LAST, "amqsreq", ibmmq.MQQSO_SHARED, ibmmq.MQQSO_YES),
+	}
+
+	metadata := collector.QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	want := []collector.QueueHandles{
+		{Metadata: metadata, ApplicationName: "amqsget", OpenType: collector.OpenTypeInput, Count: 2},
+		{Metadata: metadata, ApplicationName: "amqsput", OpenType: collector.OpenTypeOutput, Count: 1},
+		{Metadata: metadata, ApplicationName: "amqsreq", OpenType: collector.OpenTypeInput, Count: 1},
+		{Metadata: metadata, ApplicationName: "amqsreq", OpenType: collector.OpenTypeOutput, Count: 1},
+	}
+
+	if diff := cmp.Diff(want, reader.queueHandles("DEV.QUEUE.1", responses)); diff != "" {
+		t.Errorf("Should contain expected queue handles (-want, +got):\n%s", diff)
+	}
+}
+
+func TestQueueHandleDetails(t *testing.T) {
+
+	reader := &QueueHandleDetailsReader{
+		connection: &MqConnection{cfg: &MqConfiguration{ConnName: "localhost(1414)", QueueManager: "QM1", Channel: "DEV.APP.SVRCONN"}},
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	handle := func(control int32, input int32, output int32) *pcfResponse {
+		response, _ := parsePCFResponse(pcfResponseBytes(control, ibmmq.MQRC_NONE,
+			stringParameter(ibmmq.MQCA_Q_NAME, "DEV.QUEUE.1"),
+			stringParameter(ibmmq.MQCACF_APPL_NAME, "amqsget"),
+			intParameter(ibmmq.MQIACF_OPEN_INPUT_TYPE, input),
+			intParameter(ibmmq.MQIACF_OPEN_OUTPUT, output),
+		))
+		return response
+	}
+	failed, _ := parsePCFResponse(pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRC_UNKNOWN_OBJECT_NAME))
+
+	responses := []*pcfResponse{
+		handle(ibmmq.MQCFC_NOT_LAST, ibmmq.MQQSO_EXCLUSIVE, ibmmq.MQQSO_NO),
+		handle(ibmmq.MQCFC_NOT_LAST, ibmmq.MQQSO_SHARED, ibmmq.MQQSO_NO),
+		handle(ibmmq.MQCFC_NOT_LAST, ibmmq.MQQSO_SHARED, ibmmq.MQQSO_YES),
+		handle(ibmmq.MQCFC_NOT_LAST, ibmmq.MQQSO_NO, ibmmq.MQQSO_YES),
+		failed,
+	}
+
+	want := collector.QueueHandleDetails{
+		Metadata:                collector.QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"},
+		OpenInputExclusiveCount: 1,
+		OpenInputSharedCount:    2,
+	}
+
+	if diff := cmp.Diff(want, reader.handleDetails("DEV.QUEUE.1", responses)); diff != "" {
+		t.Errorf("Should contain expected queue handle details (-want, +got):\n%s", diff)
+	}
+}
+
+func TestQueueStatus(t *testing.T) {
+
+	status := func(parameters ...*ibmmq.PCFParameter) []*pcfResponse {
+		response, _ := parsePCFResponse(pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRC_NONE,
+			append([]*ibmmq.PCFParameter{stringParameter(ibmmq.MQCA_Q_NAME, "DEV.QUEUE.1")}, parameters...)...))
+		return []*pcfResponse{response}
+	}
+	failed, _ := parsePCFResponse(pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRC_UNKNOWN_OBJECT_NAME))
+
+	attrs, err := queueStatus(status(
+		intListParameter(ibmmq.MQIACF_Q_TIME_INDICATOR, 1500, 2000),
+		intParameter(ibmmq.MQIACF_CUR_Q_FILE_SIZE, 2),
+		stringParameter(ibmmq.MQCACF_LAST_PUT_DATE, "2023-11-14"),
+		stringParameter(ibmmq.MQCACF_LAST_PUT_TIME, "22.13.20"),
+	))
+	assert.NilError(t, err)
+	assert.Equal(t, attrs.timeIndicator, int32(1500))
+	assert.Equal(t, attrs.fileSize, int64(2*1024*1024))
+	assert.Equal(t, attrs.lastPutTime, time.Date(2023, 11, 14, 22, 13, 20, 0, time.Local))
+
+	attrs, err = queueStatus(status(
+		intListParameter(ibmmq.MQIACF_Q_TIME_INDICATOR, ibmmq.MQMON_NOT_AVAILABLE, ibmmq.MQMON_NOT_AVAILABLE),
+		stringParameter(ibmmq.MQCACF_LAST_PUT_DATE, ""),
+		stringParameter(ibmmq.MQCACF_LAST_PUT_TIME, ""),
+	))
+	assert.NilError(t, err)
+	assert.Equal(t, attrs.timeIndicator, int32(ibmmq.MQMON_NOT_AVAILABLE))
+	assert.Equal(t, attrs.fileSize, int64(0))
+	assert.Assert(t, attrs.lastPutTime.IsZero())
+
+	_, err = queueStatus([]*pcfResponse{failed})
+	assert.Assert(t, errors.Is(err, ErrQueueNotFound))
+
+	_, err = queueStatus(nil)
+	assert.Error(t, err, "no response for inquiry of queue status")
+}
+
+func TestQueueDepthStatus(t *testing.T) {
+
+	response := func(parameter int32, value int32) []*pcfResponse {
+		response, _ := parsePCFResponse(pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRC_NONE,
+			stringParameter(ibmmq.MQCA_Q_NAME, "DEV.QUEUE.1"),
+			intParameter(parameter, value),
+		))
+		return []*pcfResponse{response}
+	}
+	failed, _ := parsePCFResponse(pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRC_UNKNOWN_OBJECT_NAME))
+
+	status, err := queueDepthStatus(response(ibmmq.MQIA_CURRENT_Q_DEPTH, 5000), response(ibmmq.MQIA_MAX_Q_DEPTH, 5000))
+	assert.NilError(t, err)
+	assert.Equal(t, status.CurrentDepth, int32(5000))
+	assert.Equal(t, status.MaxDepth, int32(5000))
+
+	_, err = queueDepthStatus([]*pcfResponse{failed}, response(ibmmq.MQIA_MAX_Q_DEPTH, 5000))
+	assert.Assert(t, errors.Is(err, ErrQueueNotFound))
+
+	_, err = queueDepthStatus(response(ibmmq.MQIA_CURRENT_Q_DEPTH, 5000), nil)
+	assert.Error(t, err, "no response for inquiry of MQIA_MAX_Q_DEPTH")
+}
+
+func TestQueueManagerMetrics(t *testing.T) {
+
+	reader := &QueueManagerReader{
+		connection: &MqConnection{cfg: &MqConfiguration{ConnName: "localhost(1414)", QueueManager: "QM1", Channel: "DEV.APP.SVRCONN"}},
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	response, _ := parsePCFResponse(pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRC_NONE,
+		stringParameter(ibmmq.MQCA_Q_MGR_NAME, "QM1"),
+		intParameter(ibmmq.MQIA_MAX_HANDLES, 256),
+		intParameter(ibmmq.MQIA_INHIBIT_EVENT, ibmmq.MQEVR_ENABLED),
+		stringParameter(ibmmq.MQCA_DEF_XMIT_Q_NAME, "SYSTEM.CLUSTER.TRANSMIT.QUEUE"),
+	))
+	failed, _ := parsePCFResponse(pcfResponseBytes(ibmmq.MQCFC_LAST, ibmmq.MQRC_NOT_AUTHORIZED))
+
+	m, err := reader.queueManagerMetrics([]*pcfResponse{response})
+	assert.NilError(t, err)
+	assert.Equal(t, m.Metadata, collector.ConnectionMetadata{ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"})
+	assert.Equal(t, m.MaxHandles, int32(256))
+	assert.Equal(t, m.InhibitEvent, true)
+	assert.Equal(t, m.DefaultTransmitQueue, "SYSTEM.CLUSTER.TRANSMIT.QUEUE")
+	assert.Equal(t, m.ClusterWorkloadExit, "")
+
+	_, err = reader.queueManagerMetrics([]*pcfResponse{failed})
+	var mqerr *MQError
+	assert.Assert(t, errors.As(err, &mqerr))
+	assert.Equal(t, mqerr.ReasonCode(), int32(ibmmq.MQRC_NOT_AUTHORIZED))
+
+	_, err = reader.queueManagerMetrics(nil)
+	assert.Error(t, err, "no response for inquiry of MQIA_MAX_HANDLES")
+}
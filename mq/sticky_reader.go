@@ -0,0 +1,61 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/agebhar1/mq_exporter/collector"
+)
+
+// StickyQueueMetricsReader returns the last successfully read metrics of a
+// queue while the connection is broken, e.g. until the re-connect succeeded.
+// The cached metrics are marked by a request duration of -1.
+type StickyQueueMetricsReader struct {
+	mutex  sync.Mutex
+	reader collector.QueueMetricsReader
+	last   *collector.QueueMetrics
+}
+
+func NewStickyQueueMetricsReader(reader collector.QueueMetricsReader) *StickyQueueMetricsReader {
+	return &StickyQueueMetricsReader{reader: reader}
+}
+
+func (r *StickyQueueMetricsReader) Read() (collector.QueueMetrics, error) {
+
+	m, err := r.reader.Read()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err == nil {
+		r.last = &m
+		return m, nil
+	}
+	if r.last != nil && errors.Is(err, ErrConnectionBroken) {
+		cached := *r.last
+		cached.RequestDuration = -1
+		return cached, nil
+	}
+	return m, err
+}
+
+// Cancel cancels the read in progress if the reader is cancelable.
+func (r *StickyQueueMetricsReader) Cancel() {
+	if reader, ok := r.reader.(collector.CancelableQueueMetricsReader); ok {
+		reader.Cancel()
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/agebhar1/mq_exporter/collector"
+	"github.com/ibm-messaging/mq-golang/v5/ibmmq"
+	"gotest.tools/v3/assert"
+)
+
+type queueMetricsReaderFunc func() (collector.QueueMetrics, error)
+
+func (f queueMetricsReaderFunc) Read() (collector.QueueMetrics, error) {
+	return f()
+}
+
+func TestStickyQueueMetricsReader(t *testing.T) {
+
+	broken := newMQError(&ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_CONNECTION_BROKEN})
+	notAuthorized := newMQError(&ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_NOT_AUTHORIZED})
+
+	metrics := collector.QueueMetrics{
+		Metadata:        collector.QueueMetadata{QueueName: "DEV.QUEUE.1"},
+		CurrentDepth:    42,
+		RequestDuration: 250 * time.Millisecond,
+	}
+
+	var value collector.QueueMetrics
+	var err error
+	reader := NewStickyQueueMetricsReader(queueMetricsReaderFunc(func() (collector.QueueMetrics, error) {
+		return value, err
+	}))
+
+	// no cached metrics before the first successful read
+	err = broken
+	_, got := reader.Read()
+	assert.Assert(t, errors.Is(got, ErrConnectionBroken))
+
+	value, err = metrics, nil
+	m, got := reader.Read()
+	assert.NilError(t, got)
+	assert.DeepEqual(t, m, metrics)
+
+	// re-connect window
+	value, err = collector.QueueMetrics{}, broken
+	m, got = reader.Read()
+	assert.NilError(t, got)
+	assert.Equal(t, m.CurrentDepth, int32(42))
+	assert.Assert(t, m.RequestDuration < 0)
+
+	// other errors are not hidden by the cached metrics
+	err = notAuthorized
+	_, got = reader.Read()
+	assert.Assert(t, errors.Is(got, notAuthorized))
+
+	value, err = collector.QueueMetrics{Metadata: metrics.Metadata, CurrentDepth: 7, RequestDuration: time.Millisecond}, nil
+	m, got = reader.Read()
+	assert.NilError(t, got)
+	assert.Equal(t, m.CurrentDepth, int32(7))
+	assert.Equal(t, m.RequestDuration, time.Millisecond)
+}
+
+type cancelableQueueMetricsReader struct {
+	queueMetricsReaderFunc
+	canceled *bool
+}
+
+func (r cancelableQueueMetricsReader) Cancel() {
+	*r.canceled = true
+}
+
+func TestQueueMetricsReadersCancel(t *testing.T) {
+
+	var canceled bool
+	reader := NewStickyQueueMetricsReader(NewOverridingQueueMetricsReader(cancelableQueueMetricsReader{canceled: &canceled}, 5000))
+
+	reader.Cancel()
+	assert.Assert(t, canceled)
+
+	// no inquiry in progress
+	(&MqQueue{}).Cancel()
+
+	// not cancelable
+	NewStickyQueueMetricsReader(queueMetricsReaderFunc(nil)).Cancel()
+}
@@ -0,0 +1,226 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/agebhar1/mq_exporter/collector"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+type pemKeyRepository struct {
+	path     string
+	password string
+}
+
+func (cfg *MqConfiguration) usesPEMFiles() bool {
+	return cfg.TLSCACertFile != "" || cfg.TLSClientCertFile != "" || cfg.TLSClientKeyFile != ""
+}
+
+// loadTLSConfig reads the PEM files of the configuration. The client
+// certificate is optional, the CA certificate(s) are required.
+func (cfg *MqConfiguration) loadTLSConfig() (*tls.Config, []*x509.Certificate, error) {
+
+	data, err := os.ReadFile(cfg.TLSCACertFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CA certificate file '%s' does not exists or is not readable", cfg.TLSCACertFile)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, nil, fmt.Errorf("CA certificate file '%s' does not contain any PEM encoded certificate", cfg.TLSCACertFile)
+	}
+
+	caCerts := make([]*x509.Certificate, 0)
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("CA certificate file '%s': %w", cfg.TLSCACertFile, err)
+		}
+		caCerts = append(caCerts, cert)
+	}
+
+	tlsConfig := &tls.Config{RootCAs: pool}
+
+	if cfg.TLSClientCertFile != "" {
+		keyPair, err := tls.LoadX509KeyPair(cfg.TLSClientCertFile, cfg.TLSClientKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("client certificate '%s' and key '%s': %w", cfg.TLSClientCertFile, cfg.TLSClientKeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{keyPair}
+	}
+
+	return tlsConfig, caCerts, nil
+}
+
+// createPEMKeyRepository converts the PEM files of the configuration into a
+// password protected PKCS#12 key repository, since the MQ client library
+// does not accept PEM files. The caller has to remove the file.
+func (cfg *MqConfiguration) createPEMKeyRepository() (*pemKeyRepository, error) {
+
+	tlsConfig, caCerts, err := cfg.loadTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	password := hex.EncodeToString(secret)
+
+	var data []byte
+	if len(tlsConfig.Certificates) > 0 {
+		keyPair := tlsConfig.Certificates[0]
+		leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+		data, err = pkcs12.Modern.Encode(keyPair.PrivateKey, leaf, caCerts, password)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		data, err = pkcs12.Modern.EncodeTrustStore(caCerts, password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.CreateTemp("", "mq_exporter-*.p12")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	return &pemKeyRepository{path: f.Name(), password: password}, nil
+}
+
+// certExpiryCheckPaths returns the PEM files whose certificates are checked
+// for expiry. The key repository (GSKit .kdb) of the MQ client library can't
+// be read, so its certificates need to be exported to 'certExpiryCheckPath'.
+func (cfg *MqConfiguration) certExpiryCheckPaths() []string {
+	paths := make([]string, 0)
+	if cfg.CertExpiryCheckPath != "" {
+		paths = append(paths, cfg.CertExpiryCheckPath)
+	}
+	if cfg.TLSCACertFile != "" {
+		paths = append(paths, cfg.TLSCACertFile)
+	}
+	if cfg.TLSClientCertFile != "" {
+		paths = append(paths, cfg.TLSClientCertFile)
+	}
+	return paths
+}
+
+// CertExpiryChecker reads the certificates of PEM files periodically and
+// keeps their expiry.
+type CertExpiryChecker struct {
+	sync.Mutex
+	logger   *slog.Logger
+	paths    []string
+	expiries []collector.CertExpiry
+}
+
+func newCertExpiryChecker(logger *slog.Logger, paths []string) *CertExpiryChecker {
+	return &CertExpiryChecker{logger: logger, paths: paths}
+}
+
+func (c *CertExpiryChecker) run(interval time.Duration, done chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.check()
+		}
+	}
+}
+
+func (c *CertExpiryChecker) check() {
+
+	expiries := make([]collector.CertExpiry, 0)
+	for _, path := range c.paths {
+		certExpiries, err := readCertExpiries(path)
+		if err != nil {
+			c.logger.Error("failed to check certificate expiry", "err", err, "path", path)
+			continue
+		}
+		expiries = append(expiries, certExpiries...)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.expiries = expiries
+}
+
+func (c *CertExpiryChecker) Expiries() []collector.CertExpiry {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.expiries
+}
+
+func readCertExpiries(path string) ([]collector.CertExpiry, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("certificate file '%s' does not exists or is not readable", path)
+	}
+
+	expiries := make([]collector.CertExpiry, 0)
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("certificate file '%s': %w", path, err)
+		}
+		expiries = append(expiries, collector.CertExpiry{
+			Subject:  cert.Subject.String(),
+			Issuer:   cert.Issuer.String(),
+			NotAfter: cert.NotAfter,
+		})
+	}
+	if len(expiries) == 0 {
+		return nil, fmt.Errorf("certificate file '%s' does not contain any PEM encoded certificate", path)
+	}
+
+	return expiries, nil
+}
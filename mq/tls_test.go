@@ -0,0 +1,218 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mq
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/agebhar1/mq_exporter/collector"
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	tlsCACertFile     string
+	tlsClientCertFile string
+	tlsClientKeyFile  string
+)
+
+func TestMain(m *testing.M) {
+
+	dir, err := os.MkdirTemp("", "mq_exporter-tls-")
+	if err != nil {
+		panic(err)
+	}
+
+	tlsCACertFile, tlsClientCertFile, tlsClientKeyFile = generateCertificates(dir)
+
+	code := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func generateCertificates(dir string) (string, string, string) {
+
+	writePEM := func(name string, blockType string, data []byte) string {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0600); err != nil {
+			panic(err)
+		}
+		return filename
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "mq_exporter test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		panic(err)
+	}
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "mq_exporter"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caTemplate, &clientKey.PublicKey, caKey)
+	if err != nil {
+		panic(err)
+	}
+	clientKeyDER, err := x509.MarshalPKCS8PrivateKey(clientKey)
+	if err != nil {
+		panic(err)
+	}
+
+	return writePEM("ca.crt", "CERTIFICATE", caDER),
+		writePEM("client.crt", "CERTIFICATE", clientDER),
+		writePEM("client.key", "PRIVATE KEY", clientKeyDER)
+}
+
+func TestCreatePEMKeyRepository(t *testing.T) {
+
+	cfg := &MqConfiguration{
+		TLSCACertFile:     tlsCACertFile,
+		TLSClientCertFile: tlsClientCertFile,
+		TLSClientKeyFile:  tlsClientKeyFile,
+	}
+
+	repository, err := cfg.createPEMKeyRepository()
+	assert.NilError(t, err)
+	defer os.Remove(repository.path)
+
+	data, err := os.ReadFile(repository.path)
+	assert.NilError(t, err)
+
+	_, cert, caCerts, err := pkcs12.DecodeChain(data, repository.password)
+	assert.NilError(t, err)
+	assert.Equal(t, cert.Subject.CommonName, "mq_exporter")
+	assert.Equal(t, len(caCerts), 1)
+	assert.Equal(t, caCerts[0].Subject.CommonName, "mq_exporter test CA")
+}
+
+func TestCreatePEMKeyRepository_CACertificateOnly(t *testing.T) {
+
+	cfg := &MqConfiguration{TLSCACertFile: tlsCACertFile}
+
+	repository, err := cfg.createPEMKeyRepository()
+	assert.NilError(t, err)
+	defer os.Remove(repository.path)
+
+	data, err := os.ReadFile(repository.path)
+	assert.NilError(t, err)
+
+	certs, err := pkcs12.DecodeTrustStore(data, repository.password)
+	assert.NilError(t, err)
+	assert.Equal(t, len(certs), 1)
+}
+
+func TestLoadTLSConfig_InvalidFiles(t *testing.T) {
+
+	tests := []struct {
+		name string
+		cfg  *MqConfiguration
+		want string
+	}{
+		{
+			name: "non existing CA certificate",
+			cfg:  &MqConfiguration{TLSCACertFile: "does-not-exists.crt"},
+			want: "CA certificate file 'does-not-exists.crt' does not exists or is not readable",
+		},
+		{
+			name: "CA certificate file without certificate",
+			cfg:  &MqConfiguration{TLSCACertFile: tlsClientKeyFile},
+			want: "CA certificate file '" + tlsClientKeyFile + "' does not contain any PEM encoded certificate",
+		},
+		{
+			name: "client key does not match",
+			cfg:  &MqConfiguration{TLSCACertFile: tlsCACertFile, TLSClientCertFile: tlsClientCertFile, TLSClientKeyFile: tlsCACertFile},
+			want: "client certificate '" + tlsClientCertFile + "' and key '" + tlsCACertFile + "': tls: found a certificate rather than a key in the PEM for the private key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tt.cfg.loadTLSConfig()
+			assert.Error(t, err, tt.want)
+		})
+	}
+}
+
+func TestReadCertExpiries(t *testing.T) {
+
+	got, err := readCertExpiries(filepath.Join(fixturesPath, "cert-expiry.pem"))
+	assert.NilError(t, err)
+
+	want := []collector.CertExpiry{
+		{Subject: "CN=QM1,O=MQ Exporter", Issuer: "CN=QM1,O=MQ Exporter", NotAfter: time.Unix(2107395210, 0).UTC()},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Should contain expected certificate expiries (-want, +got):\n%s", diff)
+	}
+}
+
+func TestReadCertExpiries_InvalidFiles(t *testing.T) {
+
+	_, err := readCertExpiries("does-not-exists.pem")
+	assert.Error(t, err, "certificate file 'does-not-exists.pem' does not exists or is not readable")
+
+	_, err = readCertExpiries(tlsClientKeyFile)
+	assert.Error(t, err, "certificate file '"+tlsClientKeyFile+"' does not contain any PEM encoded certificate")
+}
+
+func TestCertExpiryChecker(t *testing.T) {
+
+	checker := newCertExpiryChecker(slog.New(slog.NewTextHandler(io.Discard, nil)), []string{
+		filepath.Join(fixturesPath, "cert-expiry.pem"),
+		"does-not-exists.pem",
+		tlsCACertFile,
+	})
+	checker.check()
+
+	expiries := checker.Expiries()
+	assert.Equal(t, len(expiries), 2)
+	assert.Equal(t, expiries[0].Subject, "CN=QM1,O=MQ Exporter")
+	assert.Equal(t, expiries[1].Subject, "CN=mq_exporter test CA")
+}
@@ -15,19 +15,28 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
-	versionc "github.com/prometheus/client_golang/prometheus/collectors/version"
+	"encoding/json"
+	"fmt"
 	"github.com/prometheus/common/promslog"
 	"github.com/prometheus/common/promslog/flag"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/agebhar1/mq_exporter/collector"
 	"github.com/agebhar1/mq_exporter/mq"
+	"github.com/agebhar1/mq_exporter/remotewrite"
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
@@ -39,13 +48,60 @@ import (
 
 var name = "mq_exporter"
 
+// dependencyModules are the modules whose versions are exposed by the
+// `dependencies` label of the build info metric.
+var dependencyModules = []string{
+	"github.com/ibm-messaging/mq-golang/v5",
+	"github.com/prometheus/client_golang",
+}
+
+// dumpTimeout is the timeout to read the queue metrics dumped on SIGWINCH.
+var dumpTimeout = 5 * time.Second
+
+// logSubsystems are the subsystems with a logger of their own whose level is
+// configured by --log.<subsystem>.level.
+var logSubsystems = []string{"mq", "collector", "http"}
+
 type appCtx struct {
-	logger *slog.Logger
-	sigs   chan os.Signal
+	logger          *slog.Logger
+	mqLogger        *slog.Logger
+	collectorLogger *slog.Logger
+	httpLogger      *slog.Logger
 
-	configFile       *string
-	toolkitFlags     *web.FlagConfig
-	webTelemetryPath *string
+	sigs     chan os.Signal
+	dumpSigs chan os.Signal
+	stdout   io.Writer
+
+	configFile               *string
+	keepaliveInterval        *time.Duration
+	collectApplicationNames  *bool
+	collectHandleDetails     *bool
+	collectPutBlocked        *bool
+	depthHistogramBuckets    *string
+	depthForecastSamples     *int
+	depthStddevWindow        *int
+	depthSlopeWindow         *int
+	depthRatioAlertThreshold *float64
+	staleScrapeMode          *string
+	backgroundScrapeInterval *time.Duration
+	tenantSnapshotMaxAge     *time.Duration
+	browseForAge             *bool
+	browseMaxMessages        *int
+	debugMetricsEndpoint     *bool
+	debugPprof               *bool
+	debugListenAddress       *string
+	toolkitFlags             *web.FlagConfig
+	webTelemetryPath         *string
+	webEnableOpenMetrics     *bool
+	remoteWriteURL           *string
+	remoteWriteInterval      *time.Duration
+	remoteWriteTimeout       *time.Duration
+	httpProxy                *string
+	noProxy                  *string
+	eventPollInterval        *time.Duration
+	startupRetryCount        *int
+	startupRetryInterval     *time.Duration
+	startupTimeout           *time.Duration
 }
 
 func newAppCtx(args []string, usageWriter io.Writer, errorWriter io.Writer, logger *slog.Logger) *appCtx {
@@ -54,8 +110,35 @@ func newAppCtx(args []string, usageWriter io.Writer, errorWriter io.Writer, logg
 
 	var app = kingpin.New(name, "A Prometheus exporter for MQ metrics.")
 	ctx.configFile = app.Flag("config", "Path to config yaml file for MQ connections.").Required().String()
+	ctx.keepaliveInterval = app.Flag("keepalive-interval", "Interval of keepalive inquiries on the MQ connection, 0 to disable.").Default("30s").Duration()
+	ctx.collectApplicationNames = app.Flag("collect-application-names", "Collect open queue handles by application name (requires PCF MQCMD_INQUIRE_Q_STATUS).").Default("false").Bool()
+	ctx.collectHandleDetails = app.Flag("collect-handle-details", "Collect number of handles open for exclusive and shared input (requires PCF MQCMD_INQUIRE_Q_STATUS).").Default("false").Bool()
+	ctx.collectPutBlocked = app.Flag("collect-put-blocked", "Count the times the queues became full (mq_queue_put_blocked_total) (requires PCF MQCMD_INQUIRE_Q_STATUS and MQCMD_INQUIRE_Q).").Default("false").Bool()
+	ctx.depthHistogramBuckets = app.Flag("depth-histogram-buckets", "Comma separated, ascending buckets of the histogram of observed queue depths.").Default("0,1,10,100,1000,5000,10000").String()
+	ctx.depthForecastSamples = app.Flag("depth-forecast-samples", "Number of the most recent queue depths the fill forecast is based on (at least 2).").Default(strconv.Itoa(collector.DefaultDepthHistoryCapacity)).Int()
+	ctx.depthStddevWindow = app.Flag("depth-stddev-window", "Number of the most recent queue depths the standard deviation is based on (at least 1).").Default(strconv.Itoa(collector.DefaultDepthWindowSize)).Int()
+	ctx.depthSlopeWindow = app.Flag("depth-slope-window", "Number of the most recent queue depths the depth slope is based on (at least 2).").Default(strconv.Itoa(collector.DefaultDepthSlopeWindowSize)).Int()
+	ctx.depthRatioAlertThreshold = app.Flag("depth-ratio-alert-threshold", "Ratio of the current to the maximum queue depth above which a scrape is counted by mq_queue_max_depth_ratio_exceeded_total (greater than 0, at most 1).").Default(strconv.FormatFloat(collector.DefaultDepthRatioAlertThreshold, 'f', -1, 64)).Float64()
+	ctx.browseForAge = app.Flag("browse-for-age", "Browse the first messages of the queues on each scrape for the histogram of their ages (mq_queue_message_age_seconds).").Default("false").Bool()
+	ctx.browseMaxMessages = app.Flag("browse-max-messages", "Maximum number of messages of a queue which are browsed for their age (at least 1).").Default("10").Int()
+	ctx.staleScrapeMode = app.Flag("stale-scrape-mode", "Scrape while another one is in progress, which either waits for it (block) or provides the metrics of the last scrape (skip).").Default(collector.ScrapeModeBlock).Enum(collector.ScrapeModeBlock, collector.ScrapeModeSkip)
+	ctx.backgroundScrapeInterval = app.Flag("background-scrape-interval", "Interval to read the queues in the background, whose last read is provided on scrape, 0 to read the queues on each scrape.").Default("0s").Duration()
+	ctx.tenantSnapshotMaxAge = app.Flag("tenant-snapshot-max-age", "Maximum age of the metrics of the queues which are provided on the tenant endpoints, whose scrapes within this age share a single read of the queues.").Default(collector.DefaultFanoutSnapshotMaxAge.String()).Duration()
+	ctx.debugMetricsEndpoint = app.Flag("debug.metrics-endpoint", "Expose the raw queue metrics as JSON at /debug/metrics.").Default("false").Bool()
+	ctx.debugPprof = app.Flag("debug.pprof", "Expose the pprof profiling endpoints at /debug/pprof/ on --debug.listen-address.").Default("false").Bool()
+	ctx.debugListenAddress = app.Flag("debug.listen-address", "Address on which to expose the pprof profiling endpoints.").Default(":6060").String()
 	ctx.toolkitFlags = webflag.AddFlags(app, ":9873")
 	ctx.webTelemetryPath = app.Flag("web.telemetry-path", "Path under which to expose metrics.").Default("/metrics").String()
+	ctx.webEnableOpenMetrics = app.Flag("web.enable-openmetrics", "Expose metrics in the OpenMetrics format if requested by the 'Accept' header.").Default("false").Bool()
+	ctx.remoteWriteURL = app.Flag("remote-write.url", "URL of a remote-write endpoint (e.g. VictoriaMetrics) to push the metrics to, disabled if empty.").Default("").String()
+	ctx.remoteWriteInterval = app.Flag("remote-write.interval", "Interval to push the metrics to the remote-write endpoint.").Default("30s").Duration()
+	ctx.remoteWriteTimeout = app.Flag("remote-write.timeout", "Timeout of a single push to the remote-write endpoint.").Default("10s").Duration()
+	ctx.httpProxy = app.Flag("http-proxy", "Proxy of the pushes to the remote-write endpoint, overrides HTTP_PROXY and HTTPS_PROXY if not empty.").Default("").String()
+	ctx.noProxy = app.Flag("no-proxy", "Comma separated hosts which are pushed to without proxy, overrides NO_PROXY if not empty.").Default("").String()
+	ctx.eventPollInterval = app.Flag("event-poll-interval", "Interval to read the queue manager events if 'enableEventMonitoring' or 'enableDepthEventCounting' is configured.").Default("10s").Duration()
+	ctx.startupRetryCount = app.Flag("startup-retry-count", "Number of retries of the initial connect while the queue manager is stopping or quiescing (MQRC 2161, 2162), 0 to fail immediately.").Default("3").Int()
+	ctx.startupRetryInterval = app.Flag("startup-retry-interval", "Interval before the first retry of the initial connect, which is doubled on each retry.").Default("5s").Duration()
+	ctx.startupTimeout = app.Flag("startup-timeout", "Duration after start during which /startup responds with 503 (Service Unavailable).").Default("60s").Duration()
 
 	app.UsageWriter(usageWriter)
 	app.ErrorWriter(errorWriter)
@@ -66,6 +149,15 @@ func newAppCtx(args []string, usageWriter io.Writer, errorWriter io.Writer, logg
 	promslogConfig := &promslog.Config{Style: promslog.GoKitStyle}
 	flag.AddFlags(app, promslogConfig)
 
+	subsystemLevels := make(map[string]*promslog.AllowedLevel)
+	for _, subsystem := range logSubsystems {
+		level := &promslog.AllowedLevel{}
+		app.Flag("log."+subsystem+".level", "Only log messages of subsystem '"+subsystem+"' with the given severity or above, defaults to --log.level. One of: ["+strings.Join(promslog.LevelFlagOptions, ", ")+"]").
+			HintOptions(promslog.LevelFlagOptions...).
+			SetValue(level)
+		subsystemLevels[subsystem] = level
+	}
+
 	kingpin.MustParse(app.Parse(args))
 
 	if logger != nil {
@@ -73,68 +165,439 @@ func newAppCtx(args []string, usageWriter io.Writer, errorWriter io.Writer, logg
 	} else {
 		ctx.logger = promslog.New(promslogConfig)
 	}
+	ctx.mqLogger = newSubsystemLogger(logger, *promslogConfig, subsystemLevels["mq"], "mq")
+	ctx.collectorLogger = newSubsystemLogger(logger, *promslogConfig, subsystemLevels["collector"], "collector")
+	ctx.httpLogger = newSubsystemLogger(logger, *promslogConfig, subsystemLevels["http"], "http")
 
 	ctx.sigs = make(chan os.Signal)
 	signal.Notify(ctx.sigs, syscall.SIGINT, syscall.SIGTERM)
 
+	ctx.stdout = usageWriter
+	ctx.dumpSigs = make(chan os.Signal, 1)
+	signal.Notify(ctx.dumpSigs, syscall.SIGWINCH)
+
 	return &ctx
 }
 
+// newSubsystemLogger returns a logger whose entries are annotated by the
+// subsystem. Unless the logger is given, it's created by the configuration
+// with the level of the subsystem if set.
+func newSubsystemLogger(logger *slog.Logger, config promslog.Config, level *promslog.AllowedLevel, subsystem string) *slog.Logger {
+	if logger == nil {
+		if level.String() != "" {
+			config.Level = level
+		}
+		logger = promslog.New(&config)
+	}
+	return slog.New(logger.Handler().WithAttrs([]slog.Attr{slog.String("subsystem", subsystem)}))
+}
+
 func (app *appCtx) run() int {
 
+	startTime := time.Now()
+
 	app.logger.Info("Starting", "app_name", name, "version", version.Version, "branch", version.Branch, "revision", version.Revision)
 	app.logger.Info("Build context", "go", version.GoVersion, "build_user", version.BuildUser, "build_date", version.BuildDate)
 
 	reg := prometheus.NewRegistry()
-	reg.MustRegister(versionc.NewCollector(name))
+	reg.MustRegister(newBuildInfoCollector(name))
 	reg.MustRegister(collectors.NewGoCollector())
 	reg.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 
-	mqConnection, err := mq.NewMqConnection(app.logger, *app.configFile)
+	depthHistogramBuckets, err := parseBuckets(*app.depthHistogramBuckets)
+	if err != nil {
+		app.logger.Error("Invalid depth histogram buckets", "err", err)
+		return 1
+	}
+	if *app.depthForecastSamples < 2 {
+		app.logger.Error("Invalid number of depth forecast samples", "samples", *app.depthForecastSamples)
+		return 1
+	}
+	if *app.depthStddevWindow < 1 {
+		app.logger.Error("Invalid size of depth standard deviation window", "size", *app.depthStddevWindow)
+		return 1
+	}
+	if *app.depthSlopeWindow < 2 {
+		app.logger.Error("Invalid size of depth slope window", "size", *app.depthSlopeWindow)
+		return 1
+	}
+	if *app.depthRatioAlertThreshold <= 0 || *app.depthRatioAlertThreshold > 1 {
+		app.logger.Error("Invalid depth ratio alert threshold", "threshold", *app.depthRatioAlertThreshold)
+		return 1
+	}
+	if *app.startupRetryCount < 0 {
+		app.logger.Error("Invalid number of connect retries on startup", "count", *app.startupRetryCount)
+		return 1
+	}
+	if *app.startupRetryInterval <= 0 {
+		app.logger.Error("Invalid interval of connect retries on startup", "interval", *app.startupRetryInterval)
+		return 1
+	}
+	if *app.browseForAge && *app.browseMaxMessages < 1 {
+		app.logger.Error("Invalid maximum number of messages to browse", "messages", *app.browseMaxMessages)
+		return 1
+	}
+
+	startupRetry := mq.StartupRetry{Count: *app.startupRetryCount, Interval: *app.startupRetryInterval}
+	mqConnection, err := mq.NewMqConnection(app.mqLogger, *app.configFile, *app.keepaliveInterval, startupRetry)
 	if err != nil {
 		app.logger.Error(err.Error())
 		return 1
 	}
 
-	collector := collector.NewQueueCollector(app.logger, mqConnection.Timeout(), mqConnection.Queues())
-	reg.MustRegister(collector)
+	var gatherer prometheus.Gatherer = reg
+	if rules := mqConnection.RecordingRules(); len(rules) > 0 {
+		recordingGatherer, err := collector.NewRecordingGatherer(app.collectorLogger, reg, rules)
+		if err != nil {
+			app.logger.Error("Invalid recording rules", "err", err)
+			return 1
+		}
+		gatherer = recordingGatherer
+	}
+
+	queueCollector := collector.NewQueueCollector(app.collectorLogger, mqConnection.Timeout(), mqConnection.Queues(), mqConnection.LabelNames(), mqConnection.MetricDescriptions())
+	queueCollector.SetDepthHistogramBuckets(depthHistogramBuckets)
+	queueCollector.SetDepthHistoryCapacity(*app.depthForecastSamples)
+	queueCollector.SetDepthWindowSize(*app.depthStddevWindow)
+	queueCollector.SetDepthSlopeWindowSize(*app.depthSlopeWindow)
+	queueCollector.SetDepthRatioAlertThreshold(*app.depthRatioAlertThreshold)
+	queueCollector.SetScrapeMode(*app.staleScrapeMode)
+	queueCollector.SetBackgroundScrapeInterval(*app.backgroundScrapeInterval)
+	queueCollector.SetQueues(mqConnection.Queues(), mqConnection.Generation())
+	mqConnection.OnReconnect(queueCollector.SetQueues)
+
+	reg.MustRegister(queueCollector)
+	reg.MustRegister(collector.NewHealthCollector(app.collectorLogger, queueCollector))
+	reg.MustRegister(collector.NewConnectionCollector(app.collectorLogger, mqConnection))
+	reg.MustRegister(collector.NewQueueManagerCollector(app.collectorLogger, mqConnection.QueueManagerReader(), mqConnection.LabelNames()))
+	reg.MustRegister(collector.NewChannelCollector(app.collectorLogger, mqConnection.ChannelStatusReader()))
+	if *app.collectApplicationNames {
+		reg.MustRegister(collector.NewApplicationCollector(app.collectorLogger, mqConnection.QueueHandlesReader(), mqConnection.LabelNames()))
+	}
+	if *app.collectHandleDetails {
+		reg.MustRegister(collector.NewHandleDetailsCollector(app.collectorLogger, mqConnection.QueueHandleDetailsReader(), mqConnection.LabelNames()))
+	}
+	if mqConnection.ResetQueueStatisticsEnabled() {
+		reg.MustRegister(collector.NewQueueStatisticsCollector(app.collectorLogger, mqConnection.QueueStatisticsReader(), mqConnection.LabelNames()))
+	}
+	if *app.collectPutBlocked {
+		reg.MustRegister(collector.NewQueueStatusCollector(app.collectorLogger, mqConnection.QueueDepthStatusReader(), mqConnection.LabelNames()))
+	}
+	if *app.browseForAge {
+		reg.MustRegister(collector.NewMessageAgeCollector(app.collectorLogger, mqConnection.MessageAgeReader(*app.browseMaxMessages), mqConnection.LabelNames()))
+	}
+	backgroundDone := make(chan struct{})
+	if *app.backgroundScrapeInterval > 0 {
+		go queueCollector.RunBackgroundScrape(backgroundDone)
+	}
+	if mqConnection.EventMonitoringEnabled() {
+		eventCollector := collector.NewEventCollector(app.collectorLogger, mqConnection.EventReader())
+		reg.MustRegister(eventCollector)
+		go eventCollector.Run(*app.eventPollInterval, backgroundDone)
+	}
+	if mqConnection.DepthEventCountingEnabled() {
+		depthEventCollector := collector.NewDepthEventCollector(app.collectorLogger, mqConnection.DepthEventReader())
+		reg.MustRegister(depthEventCollector)
+		go depthEventCollector.Run(*app.eventPollInterval, backgroundDone)
+	}
+
+	handlerOpts := promhttp.HandlerOpts{EnableOpenMetrics: *app.webEnableOpenMetrics, DisableCompression: true}
 
 	handler := http.NewServeMux()
 	handler.Handle(*app.webTelemetryPath, promhttp.InstrumentMetricHandler(
-		reg, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}),
+		reg, gzipHandler(promhttp.HandlerFor(gatherer, handlerOpts)),
 	))
-	handler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/" {
-			http.NotFound(w, r)
-			return
-		}
-		w.Write([]byte(`<html>
-			<head><title>MQ Exporter</title></head>
-			<body>
-			<h1>MQ Exporter</h1>
-			<p><a href='` + *app.webTelemetryPath + `'>Metrics</a></p>
-			</body>
-			</html>`))
+	if tenants := mqConnection.Tenants(); len(tenants) > 0 {
+		fanout := collector.NewFanoutCollector(app.collectorLogger, queueCollector, tenants, mqConnection.Tenant)
+		fanout.SetSnapshotMaxAge(*app.tenantSnapshotMaxAge)
+		handler.Handle("GET "+strings.TrimSuffix(*app.webTelemetryPath, "/")+"/{tenant}", app.tenantMetricsHandler(fanout, handlerOpts))
+	}
+	landingPage, err := web.NewLandingPage(web.LandingConfig{
+		Name:        "MQ Exporter",
+		Description: "Prometheus exporter for IBM MQ queue metrics",
+		Version:     version.Info(),
+		Links: []web.LandingLinks{
+			{
+				Address: *app.webTelemetryPath,
+				Text:    "Metrics",
+			},
+		},
 	})
+	if err != nil {
+		app.httpLogger.Error("Failed to create landing page", "err", err)
+		return 1
+	}
+	handler.Handle("/", landingPage)
+	handler.Handle("/config/timeout", app.timeoutHandler(queueCollector))
+	handler.Handle("/startup", startupHandler(startTime, *app.startupTimeout))
+	handler.Handle("/live", liveHandler())
+	if *app.debugMetricsEndpoint {
+		handler.Handle("/debug/metrics", app.debugMetricsHandler(queueCollector))
+	}
+
+	go app.dumpQueueMetrics(queueCollector)
+
+	remoteWriteDone := make(chan struct{})
+	if *app.remoteWriteURL != "" {
+		writer := remotewrite.NewWriter(app.logger, *app.remoteWriteURL, *app.remoteWriteTimeout, gatherer)
+		writer.SetProxy(remotewrite.Proxy(*app.httpProxy, *app.noProxy))
+		reg.MustRegister(writer)
+		go writer.Run(*app.remoteWriteInterval, remoteWriteDone)
+		app.logger.Info("Pushing metrics by remote-write", "url", *app.remoteWriteURL, "interval", *app.remoteWriteInterval)
+	}
 
 	server := &http.Server{Handler: handler}
 
+	var pprofServer *http.Server
+	if *app.debugPprof {
+		listener, err := net.Listen("tcp", *app.debugListenAddress)
+		if err != nil {
+			app.httpLogger.Error("Failed to listen for pprof", "err", err)
+			return 1
+		}
+		app.httpLogger.Info("Listening for pprof", "pprof_address", listener.Addr().String())
+
+		pprofServer = &http.Server{Handler: pprofHandler()}
+		go func() {
+			if err := pprofServer.Serve(listener); err != http.ErrServerClosed {
+				app.httpLogger.Error("Serve pprof error", "err", err)
+			}
+		}()
+	}
+
 	go func() {
 		<-app.sigs
 
+		signal.Stop(app.dumpSigs)
+		close(app.dumpSigs)
+		close(remoteWriteDone)
+		close(backgroundDone)
+
 		mqConnection.Close()
 
+		if pprofServer != nil {
+			pprofServer.Shutdown(context.Background())
+		}
+
 		app.logger.Info("Shutdown server.")
 		server.Shutdown(context.Background())
 	}()
 
-	if err := web.ListenAndServe(server, app.toolkitFlags, app.logger); err != http.ErrServerClosed {
-		app.logger.Error("Serve error", "err", err)
+	if err := web.ListenAndServe(server, app.toolkitFlags, app.httpLogger); err != http.ErrServerClosed {
+		app.httpLogger.Error("Serve error", "err", err)
 		return 2
 	}
 	return 0
 }
 
+// parseBuckets parses a comma separated list of strictly ascending integers.
+func parseBuckets(s string) ([]float64, error) {
+	buckets := make([]float64, 0)
+	for _, v := range strings.Split(s, ",") {
+		bucket, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket '%s'", v)
+		}
+		if len(buckets) > 0 && float64(bucket) <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("buckets must be in strictly ascending order")
+		}
+		buckets = append(buckets, float64(bucket))
+	}
+	return buckets, nil
+}
+
+// newBuildInfoCollector is like the version collector of client_golang, but
+// additionally labeled by the versions of the dependencies.
+func newBuildInfoCollector(program string) prometheus.Collector {
+	return prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: program,
+			Name:      "build_info",
+			Help: fmt.Sprintf(
+				"A metric with a constant '1' value labeled by version, revision, branch, goversion from which %s was built, and the goos and goarch for the build.",
+				program,
+			),
+			ConstLabels: prometheus.Labels{
+				"version":      version.Version,
+				"revision":     version.GetRevision(),
+				"branch":       version.Branch,
+				"goversion":    version.GoVersion,
+				"goos":         version.GoOS,
+				"goarch":       version.GoArch,
+				"tags":         version.GetTags(),
+				"dependencies": dependencies(),
+			},
+		},
+		func() float64 { return 1 },
+	)
+}
+
+// dependencies returns the comma separated `module@version` of the dependency
+// modules the binary was built with.
+func dependencies() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	deps := make([]string, 0, len(dependencyModules))
+	for _, path := range dependencyModules {
+		for _, dep := range bi.Deps {
+			if dep.Path != path {
+				continue
+			}
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			deps = append(deps, path+"@"+dep.Version)
+		}
+	}
+	return strings.Join(deps, ",")
+}
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	writer *gzip.Writer
+}
+
+func (w gzipResponseWriter) Write(b []byte) (int, error) {
+	return w.writer.Write(b)
+}
+
+// gzipHandler compresses the response of the handler with gzip if the client
+// accepts it. It favours speed over compression ratio to keep the scrape fast.
+func gzipHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		gz, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
+		defer gz.Close()
+
+		w.Header().Set("Content-Encoding", "gzip")
+		h.ServeHTTP(gzipResponseWriter{ResponseWriter: w, writer: gz}, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if name, _, _ := strings.Cut(encoding, ";"); strings.TrimSpace(name) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// pprofHandler serves the pprof profiling endpoints. It's kept apart from
+// the metrics handler so profiling data isn't exposed on the metrics port.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+func (app *appCtx) debugMetricsHandler(c *collector.QueueCollector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(c.QueueMetrics()); err != nil {
+			app.httpLogger.Error("Failed to encode queue metrics", "err", err)
+		}
+	})
+}
+
+// tenantMetricsHandler serves the metrics of the queues of the tenant of the
+// path, which are not found if the tenant is unknown.
+func (app *appCtx) tenantMetricsHandler(f *collector.FanoutCollector, opts promhttp.HandlerOpts) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reg, ok := f.Registry(r.PathValue("tenant"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		gzipHandler(promhttp.HandlerFor(reg, opts)).ServeHTTP(w, r)
+	})
+}
+
+// dumpQueueMetrics writes the metrics of all queues as pretty-printed JSON to
+// stdout each time SIGWINCH is received, until the signal channel is closed.
+func (app *appCtx) dumpQueueMetrics(c *collector.QueueCollector) {
+	for range app.dumpSigs {
+		encoder := json.NewEncoder(app.stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(c.QueueMetricsWithTimeout(dumpTimeout)); err != nil {
+			app.logger.Error("Failed to dump queue metrics", "err", err)
+		}
+	}
+}
+
+// startupHandler responds with 503 (Service Unavailable) until the timeout
+// since start has elapsed and with 200 (OK) thereafter, regardless of the
+// state of the MQ connection.
+func startupHandler(start time.Time, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if time.Since(start) < timeout {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "started")
+	})
+}
+
+// liveHandler responds with 200 (OK) as long as the process serves HTTP.
+func liveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "alive")
+	})
+}
+
+type timeoutConfig struct {
+	Timeout string `json:"timeout"`
+}
+
+// timeoutHandler returns (GET) or sets (POST) the timeout to read the
+// metrics of all queues.
+func (app *appCtx) timeoutHandler(c *collector.QueueCollector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var cfg timeoutConfig
+			if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+				http.Error(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			timeout, err := time.ParseDuration(cfg.Timeout)
+			if err != nil {
+				http.Error(w, "invalid timeout: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if timeout <= 0 {
+				http.Error(w, "requires strict positive timeout", http.StatusBadRequest)
+				return
+			}
+			c.SetTimeout(timeout)
+			app.httpLogger.Info("Changed timeout", "timeout", timeout)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(timeoutConfig{Timeout: c.Timeout().String()}); err != nil {
+			app.httpLogger.Error("Failed to encode timeout", "err", err)
+		}
+	})
+}
+
 func main() {
 	os.Exit(newAppCtx(os.Args[1:], os.Stdout, os.Stderr, nil).run())
 }
@@ -15,13 +15,25 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/signal"
 	"regexp"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/agebhar1/mq_exporter/collector"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/promslog"
 )
 
 var configArg = "--config=fixtures/config-no-queues.yaml"
@@ -29,31 +41,41 @@ var configArg = "--config=fixtures/config-no-queues.yaml"
 type listenAddrListener struct {
 	logger *slog.Logger
 	c      chan string
+	pprofC chan string
 }
 
 func (l listenAddrListener) addr() string {
 	return <-l.c
 }
 
+func (l listenAddrListener) pprofAddr() string {
+	return <-l.pprofC
+}
+
 func (l listenAddrListener) close() {
 	close(l.c)
+	close(l.pprofC)
 }
 
 func newListenAddrListener() listenAddrListener {
 
 	c := make(chan string, 1)
+	pprofC := make(chan string, 1)
 
 	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{
 		Level: slog.LevelInfo,
 		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
-			if a.Key == "address" {
+			switch a.Key {
+			case "address":
 				c <- a.Value.String()
+			case "pprof_address":
+				pprofC <- a.Value.String()
 			}
 			return a
 		},
 	}))
 
-	return listenAddrListener{logger: logger, c: c}
+	return listenAddrListener{logger: logger, c: c, pprofC: pprofC}
 }
 
 func TestDefaultMetricsEndpoint(t *testing.T) {
@@ -101,6 +123,180 @@ func TestDefaultMetricsEndpoint(t *testing.T) {
 	app.sigs <- os.Interrupt
 }
 
+func TestMetricsEndpointContentType(t *testing.T) {
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "text format by default",
+			args: []string{},
+			want: "text/plain; version=0.0.4",
+		},
+		{
+			name: "OpenMetrics format if enabled",
+			args: []string{"--web.enable-openmetrics"},
+			want: "application/openmetrics-text; version=0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			l := newListenAddrListener()
+			defer l.close()
+
+			app := newAppCtx(append([]string{"--web.listen-address=127.0.0.1:0", configArg}, tt.args...), os.Stdout, os.Stderr, l.logger)
+
+			go app.run()
+
+			req, err := http.NewRequest(http.MethodGet, "http://"+l.addr()+"/metrics", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept", "application/openmetrics-text")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, tt.want) {
+				t.Errorf("Want content type '%s'. But found '%s'.", tt.want, contentType)
+			}
+
+			app.sigs <- os.Interrupt
+		})
+	}
+}
+
+func TestMetricsEndpointGzip(t *testing.T) {
+
+	l := newListenAddrListener()
+	defer l.close()
+
+	app := newAppCtx([]string{"--web.listen-address=127.0.0.1:0", configArg}, os.Stdout, os.Stderr, l.logger)
+
+	go app.run()
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+l.addr()+"/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if contentEncoding := resp.Header.Get("Content-Encoding"); contentEncoding != "gzip" {
+		t.Fatalf("Want content encoding 'gzip'. But found '%s'.", contentEncoding)
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseBody, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := string(responseBody)
+	if !strings.Contains(body, "# HELP go_gc_duration_seconds") {
+		t.Errorf("Want response body to contains '# HELP go_gc_duration_seconds'. But found none in:\n%s", body)
+	}
+
+	app.sigs <- os.Interrupt
+}
+
+func TestGzipHandler(t *testing.T) {
+
+	handler := gzipHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# EOF\n"))
+	}))
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		want           string
+	}{
+		{name: "without accept encoding", acceptEncoding: "", want: ""},
+		{name: "other encoding", acceptEncoding: "deflate, br", want: ""},
+		{name: "gzip", acceptEncoding: "gzip", want: "gzip"},
+		{name: "gzip with quality", acceptEncoding: "deflate, gzip;q=1.0", want: "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if contentEncoding := recorder.Header().Get("Content-Encoding"); contentEncoding != tt.want {
+				t.Errorf("Want content encoding '%s'. But found '%s'.", tt.want, contentEncoding)
+			}
+		})
+	}
+}
+
+func TestMetricsEndpointBasicAuth(t *testing.T) {
+
+	l := newListenAddrListener()
+	defer l.close()
+
+	app := newAppCtx([]string{"--web.listen-address=127.0.0.1:0", "--web.config.file=fixtures/web-config-basic-auth.yaml", configArg}, os.Stdout, os.Stderr, l.logger)
+
+	go app.run()
+
+	addr := l.addr()
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     int
+	}{
+		{name: "without credentials", want: http.StatusUnauthorized},
+		{name: "invalid password", username: "prometheus", password: "invalid", want: http.StatusUnauthorized},
+		{name: "unknown user", username: "unknown", password: "passw0rd", want: http.StatusUnauthorized},
+		{name: "valid credentials", username: "prometheus", password: "passw0rd", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/metrics", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Log("expected:", tt.want)
+				t.Log("     got:", resp.StatusCode)
+				t.Error("HTTP status code does not match.")
+			}
+		})
+	}
+
+	app.sigs <- os.Interrupt
+}
+
 func TestCustomMetricsEndpoint(t *testing.T) {
 
 	l := newListenAddrListener()
@@ -164,7 +360,7 @@ func TestLandingPageDefaultMetricsEndpoint(t *testing.T) {
 		t.Error(err)
 	}
 
-	if !strings.Contains(string(responseBody), "<a href='/metrics'>Metrics</a>") {
+	if !strings.Contains(string(responseBody), `<a href="/metrics">Metrics</a>`) {
 		t.Errorf("Want link to default metrics endpoint. But found none in:\n%s", string(responseBody))
 	}
 
@@ -199,13 +395,70 @@ func TestLandingPageCustomMetricsEndpoint(t *testing.T) {
 		t.Error(err)
 	}
 
-	if !strings.Contains(string(responseBody), "<a href='/telemetry'>Metrics</a>") {
+	if !strings.Contains(string(responseBody), `<a href="/telemetry">Metrics</a>`) {
 		t.Errorf("Want link to custom metrics endpoint. But found none in:\n%s", string(responseBody))
 	}
 
 	app.sigs <- os.Interrupt
 }
 
+func TestLandingPageHTML(t *testing.T) {
+
+	l := newListenAddrListener()
+	defer l.close()
+
+	app := newAppCtx([]string{"--web.listen-address=:0", "--web.telemetry-path=/telemetry", configArg}, os.Stdout, os.Stderr, l.logger)
+
+	go app.run()
+
+	addr := l.addr()
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	contentType := "text/html; charset=UTF-8"
+	if resp.Header.Get("Content-Type") != contentType {
+		t.Log("expected:", contentType)
+		t.Log("     got:", resp.Header.Get("Content-Type"))
+		t.Error("HTTP content type does not match.")
+	}
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Error(err)
+	}
+
+	body := strings.TrimSpace(string(responseBody))
+
+	if !strings.HasPrefix(body, "<html") || !strings.HasSuffix(body, "</html>") {
+		t.Errorf("Want response body to be a HTML document. But found:\n%s", body)
+	}
+
+	for _, want := range []string{"<title>MQ Exporter</title>", `<a href="/telemetry">Metrics</a>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Want response body to contains '%s'. But found none in:\n%s", want, body)
+		}
+	}
+
+	notFound, err := http.Get("http://" + addr + "/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notFound.Body.Close()
+
+	if notFound.StatusCode != http.StatusNotFound {
+		t.Log("expected:", http.StatusNotFound)
+		t.Log("     got:", notFound.StatusCode)
+		t.Error("HTTP status code does not match.")
+	}
+
+	app.sigs <- os.Interrupt
+}
+
 func TestBuildInfoMetric(t *testing.T) {
 
 	l := newListenAddrListener()
@@ -241,10 +494,404 @@ func TestBuildInfoMetric(t *testing.T) {
 		t.Errorf("Want response body to contains '%s'. But found none in:\n%s", want, body)
 	}
 
-	var goBuildInfo = regexp.MustCompile(`mq_exporter_build_info{branch="[^"]*",goarch="[^"]*",goos="[^"]*",goversion="[^"]*",revision="[^"]*",tags="[^"]*",version="[^"]*"} 1`)
+	var goBuildInfo = regexp.MustCompile(`mq_exporter_build_info{branch="[^"]*",dependencies="[^"]+",goarch="[^"]*",goos="[^"]*",goversion="[^"]*",revision="[^"]*",tags="[^"]*",version="[^"]*"} 1`)
 	if !goBuildInfo.MatchString(body) {
 		t.Errorf("Want response body to contains RegEx '%s'. But found none in:\n%s", goBuildInfo.String(), body)
 	}
 
 	app.sigs <- os.Interrupt
 }
+
+func TestParseBuckets(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		value   string
+		want    []float64
+		wantErr string
+	}{
+		{name: "default", value: "0,1,10,100,1000,5000,10000", want: []float64{0, 1, 10, 100, 1000, 5000, 10000}},
+		{name: "with spaces", value: "1, 10", want: []float64{1, 10}},
+		{name: "not an integer", value: "1,1.5", wantErr: "invalid bucket '1.5'"},
+		{name: "empty", value: "", wantErr: "invalid bucket ''"},
+		{name: "not ascending", value: "10,1", wantErr: "buckets must be in strictly ascending order"},
+		{name: "duplicate", value: "1,1", wantErr: "buckets must be in strictly ascending order"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBuckets(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Want error '%s'. But found '%v'.", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Should contain expected buckets (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDependencies(t *testing.T) {
+
+	deps := dependencies()
+
+	var mqGolang = regexp.MustCompile(`(^|,)github.com/ibm-messaging/mq-golang/v5@v5\.[^,]+(,|$)`)
+	if !mqGolang.MatchString(deps) {
+		t.Errorf("Want dependencies to contain the version of the MQ library. But found '%s'.", deps)
+	}
+}
+
+func TestSubsystemLoggers(t *testing.T) {
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	app := newAppCtx([]string{configArg}, os.Stdout, os.Stderr, logger)
+
+	loggers := map[string]*slog.Logger{
+		"mq":        app.mqLogger,
+		"collector": app.collectorLogger,
+		"http":      app.httpLogger,
+	}
+
+	for subsystem, logger := range loggers {
+		buf.Reset()
+		logger.Info("test")
+
+		var entry map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["subsystem"] != subsystem {
+			t.Errorf("Want attribute subsystem '%s'. But found '%v'.", subsystem, entry["subsystem"])
+		}
+	}
+}
+
+func TestSubsystemLoggerLevel(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	level := &promslog.AllowedLevel{}
+	if err := level.Set("warn"); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := newSubsystemLogger(nil, promslog.Config{Format: &promslog.AllowedFormat{}, Writer: &buf}, level, "mq")
+	logger.Info("suppressed")
+	logger.Warn("logged")
+
+	if out := buf.String(); strings.Contains(out, "suppressed") || !strings.Contains(out, "msg=logged") || !strings.Contains(out, "subsystem=mq") {
+		t.Errorf("Want only warning logged with attribute subsystem 'mq'. But found:\n%s", out)
+	}
+}
+
+func TestDebugMetricsEndpointDisabledByDefault(t *testing.T) {
+
+	l := newListenAddrListener()
+	defer l.close()
+
+	app := newAppCtx([]string{"--web.listen-address=127.0.0.1:0", configArg}, os.Stdout, os.Stderr, l.logger)
+
+	go app.run()
+
+	resp, err := http.Get("http://" + l.addr() + "/debug/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Log("expected:", http.StatusNotFound)
+		t.Log("     got:", resp.StatusCode)
+		t.Error("HTTP status code does not match.")
+	}
+
+	app.sigs <- os.Interrupt
+}
+
+func TestDebugMetricsEndpoint(t *testing.T) {
+
+	l := newListenAddrListener()
+	defer l.close()
+
+	app := newAppCtx([]string{"--web.listen-address=127.0.0.1:0", "--debug.metrics-endpoint", configArg}, os.Stdout, os.Stderr, l.logger)
+
+	go app.run()
+
+	resp, err := http.Get("http://" + l.addr() + "/debug/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Log("expected:", http.StatusOK)
+		t.Log("     got:", resp.StatusCode)
+		t.Error("HTTP status code does not match.")
+	}
+
+	var metrics []collector.QueueMetrics
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		t.Error(err)
+	}
+
+	app.sigs <- os.Interrupt
+}
+
+type staticQueueMetricsReader struct {
+	value collector.QueueMetrics
+}
+
+func (r staticQueueMetricsReader) Read() (collector.QueueMetrics, error) {
+	return r.value, nil
+}
+
+func TestDebugMetricsHandler(t *testing.T) {
+
+	metadata := collector.QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	metrics := collector.QueueMetrics{
+		Metadata:        metadata,
+		CurrentDepth:    1,
+		MaxDepth:        5000,
+		RequestDuration: 422679 * time.Nanosecond,
+	}
+
+	queueCollector := collector.NewQueueCollector(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second, []collector.Queue{
+		{Metadata: metadata, Reader: staticQueueMetricsReader{value: metrics}},
+	}, collector.DefaultLabelNames, nil)
+
+	app := &appCtx{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	recorder := httptest.NewRecorder()
+	app.debugMetricsHandler(queueCollector).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Want content type 'application/json'. But found '%s'.", contentType)
+	}
+
+	var raw []map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"metadata", "currentDepth", "maxDepth", "openInputCount", "openOutputCount", "requestDuration"} {
+		if _, ok := raw[0][field]; !ok {
+			t.Errorf("Want field '%s'. But found none in:\n%s", field, recorder.Body.String())
+		}
+	}
+
+	var got []collector.QueueMetrics
+	if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]collector.QueueMetrics{metrics}, got); diff != "" {
+		t.Errorf("Should contain expected queue metrics (-want, +got):\n%s", diff)
+	}
+}
+
+func TestTenantMetricsHandler(t *testing.T) {
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	q1 := collector.QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	q2 := collector.QueueMetadata{QueueName: "DEV.QUEUE.2", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+
+	queueCollector := collector.NewQueueCollector(logger, time.Second, []collector.Queue{
+		{Metadata: q1, Reader: staticQueueMetricsReader{value: collector.QueueMetrics{Metadata: q1}}},
+		{Metadata: q2, Reader: staticQueueMetricsReader{value: collector.QueueMetrics{Metadata: q2}}},
+	}, collector.DefaultLabelNames, nil)
+
+	tenants := map[string]string{"DEV.QUEUE.1": "payments", "DEV.QUEUE.2": "billing"}
+	fanout := collector.NewFanoutCollector(logger, queueCollector, []string{"billing", "payments"}, func(m collector.QueueMetadata) string {
+		return tenants[m.QueueName]
+	})
+
+	app := &appCtx{logger: logger, httpLogger: logger}
+
+	get := func(tenant string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/metrics/"+tenant, nil)
+		request.SetPathValue("tenant", tenant)
+		recorder := httptest.NewRecorder()
+		app.tenantMetricsHandler(fanout, promhttp.HandlerOpts{}).ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := get("payments")
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Want HTTP status code %d. But found %d.", http.StatusOK, recorder.Code)
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, `name="DEV.QUEUE.1"`) || strings.Contains(body, `name="DEV.QUEUE.2"`) {
+		t.Errorf("Want metrics of queue 'DEV.QUEUE.1' only. But found:\n%s", body)
+	}
+
+	if recorder := get("shipping"); recorder.Code != http.StatusNotFound {
+		t.Errorf("Want HTTP status code %d for unknown tenant. But found %d.", http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestDumpQueueMetricsOnSIGWINCH(t *testing.T) {
+
+	metadata := collector.QueueMetadata{QueueName: "DEV.QUEUE.1", ConnectionName: "localhost(1414)", QMgrName: "QM1", ChannelName: "DEV.APP.SVRCONN"}
+	metrics := collector.QueueMetrics{Metadata: metadata, CurrentDepth: 1, MaxDepth: 5000}
+
+	queueCollector := collector.NewQueueCollector(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second, []collector.Queue{
+		{Metadata: metadata, Reader: staticQueueMetricsReader{value: metrics}},
+	}, collector.DefaultLabelNames, nil)
+
+	r, w := io.Pipe()
+	defer r.Close()
+	app := &appCtx{logger: slog.New(slog.NewTextHandler(io.Discard, nil)), dumpSigs: make(chan os.Signal, 1), stdout: w}
+	signal.Notify(app.dumpSigs, syscall.SIGWINCH)
+	defer func() {
+		signal.Stop(app.dumpSigs)
+		close(app.dumpSigs)
+	}()
+
+	go app.dumpQueueMetrics(queueCollector)
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGWINCH); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []collector.QueueMetrics
+	if err := json.NewDecoder(r).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]collector.QueueMetrics{metrics}, got); diff != "" {
+		t.Errorf("Should dump expected queue metrics (-want, +got):\n%s", diff)
+	}
+}
+
+func TestTimeoutEndpoint(t *testing.T) {
+
+	l := newListenAddrListener()
+	defer l.close()
+
+	app := newAppCtx([]string{"--web.listen-address=127.0.0.1:0", configArg}, os.Stdout, os.Stderr, l.logger)
+
+	go app.run()
+
+	url := "http://" + l.addr() + "/config/timeout"
+
+	getTimeout := func() string {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var cfg timeoutConfig
+		if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		return cfg.Timeout
+	}
+
+	postTimeout := func(body string) int {
+		resp, err := http.Post(url, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := getTimeout(); got != "3s" {
+		t.Errorf("Want default timeout '3s'. But found '%s'.", got)
+	}
+
+	if statusCode := postTimeout(`{"timeout": "5s"}`); statusCode != http.StatusOK {
+		t.Errorf("Want HTTP status code %d. But found %d.", http.StatusOK, statusCode)
+	}
+	if got := getTimeout(); got != "5s" {
+		t.Errorf("Want changed timeout '5s'. But found '%s'.", got)
+	}
+
+	for _, body := range []string{`{"timeout": "-1s"}`, `{"timeout": "0s"}`, `{"timeout": "five seconds"}`, `timeout=5s`} {
+		if statusCode := postTimeout(body); statusCode != http.StatusBadRequest {
+			t.Errorf("Want HTTP status code %d for '%s'. But found %d.", http.StatusBadRequest, body, statusCode)
+		}
+	}
+	if got := getTimeout(); got != "5s" {
+		t.Errorf("Want unchanged timeout '5s'. But found '%s'.", got)
+	}
+
+	app.sigs <- os.Interrupt
+}
+
+func TestStartupAndLiveEndpoint(t *testing.T) {
+
+	l := newListenAddrListener()
+	defer l.close()
+
+	app := newAppCtx([]string{"--web.listen-address=127.0.0.1:0", "--startup-timeout=500ms", configArg}, os.Stdout, os.Stderr, l.logger)
+
+	go app.run()
+
+	addr := l.addr()
+
+	get := func(path string) int {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if statusCode := get("/startup"); statusCode != http.StatusServiceUnavailable {
+		t.Errorf("Want HTTP status code %d of /startup immediately after start. But found %d.", http.StatusServiceUnavailable, statusCode)
+	}
+	if statusCode := get("/live"); statusCode != http.StatusOK {
+		t.Errorf("Want HTTP status code %d of /live. But found %d.", http.StatusOK, statusCode)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	if statusCode := get("/startup"); statusCode != http.StatusOK {
+		t.Errorf("Want HTTP status code %d of /startup after the startup timeout. But found %d.", http.StatusOK, statusCode)
+	}
+
+	app.sigs <- os.Interrupt
+}
+
+func TestPprofEndpoint(t *testing.T) {
+
+	l := newListenAddrListener()
+	defer l.close()
+
+	app := newAppCtx([]string{"--web.listen-address=127.0.0.1:0", "--debug.pprof", "--debug.listen-address=127.0.0.1:0", configArg}, os.Stdout, os.Stderr, l.logger)
+
+	go app.run()
+
+	pprofAddr := l.pprofAddr()
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/symbol", "/debug/pprof/goroutine"} {
+		resp, err := http.Get("http://" + pprofAddr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Want HTTP status code %d for '%s'. But found %d.", http.StatusOK, path, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get("http://" + l.addr() + "/debug/pprof/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Want HTTP status code %d for pprof on metrics port. But found %d.", http.StatusNotFound, resp.StatusCode)
+	}
+
+	app.sigs <- os.Interrupt
+}
@@ -0,0 +1,302 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remotewrite pushes the gathered metrics by the Prometheus
+// remote-write protocol (1.0), e.g. to VictoriaMetrics.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/http/httpproxy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultBackoff    = 1 * time.Second
+)
+
+// Writer gathers the metrics of a registry and pushes them to a remote-write
+// endpoint. Requests which are rejected with 429 (Too Many Requests) or 503
+// (Service Unavailable) are retried with exponential backoff.
+type Writer struct {
+	logger   *slog.Logger
+	url      string
+	timeout  time.Duration
+	gatherer prometheus.Gatherer
+	client   *http.Client
+
+	maxRetries int
+	backoff    time.Duration
+
+	success prometheus.Counter
+	failure prometheus.Counter
+}
+
+func NewWriter(logger *slog.Logger, url string, timeout time.Duration, gatherer prometheus.Gatherer) *Writer {
+	return &Writer{
+		logger:   logger,
+		url:      url,
+		timeout:  timeout,
+		gatherer: gatherer,
+		client:   &http.Client{},
+
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+
+		success: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "mq_exporter",
+			Name:      "remote_write_success_total",
+			Help:      "Number of successful pushes of the metrics to the remote-write endpoint.",
+		}),
+		failure: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "mq_exporter",
+			Name:      "remote_write_failure_total",
+			Help:      "Number of failed pushes of the metrics to the remote-write endpoint.",
+		}),
+	}
+}
+
+// Proxy returns the proxy of the requests by the environment variables
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY. The proxy (of both HTTP and HTTPS)
+// and the hosts without proxy override the environment if not empty.
+func Proxy(proxy string, noProxy string) func(*http.Request) (*url.URL, error) {
+
+	cfg := httpproxy.FromEnvironment()
+	if proxy != "" {
+		cfg.HTTPProxy = proxy
+		cfg.HTTPSProxy = proxy
+	}
+	if noProxy != "" {
+		cfg.NoProxy = noProxy
+	}
+
+	proxyFunc := cfg.ProxyFunc()
+	return func(r *http.Request) (*url.URL, error) {
+		return proxyFunc(r.URL)
+	}
+}
+
+// SetProxy sets the proxy of the pushes. It must be called before Run.
+func (w *Writer) SetProxy(proxy func(*http.Request) (*url.URL, error)) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	w.client.Transport = transport
+}
+
+func (w *Writer) Describe(ch chan<- *prometheus.Desc) {
+	w.success.Describe(ch)
+	w.failure.Describe(ch)
+}
+
+func (w *Writer) Collect(ch chan<- prometheus.Metric) {
+	w.success.Collect(ch)
+	w.failure.Collect(ch)
+}
+
+// Run pushes the metrics in the given interval until done is closed.
+func (w *Writer) Run(interval time.Duration, done <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := w.Write(done); err != nil {
+				w.logger.Error("Failed to push metrics by remote-write", "err", err, "url", w.url)
+			}
+		}
+	}
+}
+
+// Write gathers and pushes the metrics once. A retry is aborted if done is
+// closed.
+func (w *Writer) Write(done <-chan struct{}) error {
+
+	err := w.write(done)
+	if err != nil {
+		w.failure.Inc()
+	} else {
+		w.success.Inc()
+	}
+	return err
+}
+
+func (w *Writer) write(done <-chan struct{}) error {
+
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(families, time.Now()))
+
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		status, err := w.post(body)
+		if err != nil {
+			return err
+		}
+		if status/100 == 2 {
+			return nil
+		}
+		if (status != http.StatusTooManyRequests && status != http.StatusServiceUnavailable) || attempt >= w.maxRetries {
+			return fmt.Errorf("remote-write endpoint responded with status %d", status)
+		}
+
+		w.logger.Warn("Remote-write endpoint is not ready, retry", "status", status, "backoff", backoff)
+		select {
+		case <-done:
+			return fmt.Errorf("remote-write endpoint responded with status %d", status)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (w *Writer) post(body []byte) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
+
+// sample is a single value of a time series with its labels including the
+// metric name.
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+// samples flattens the metric families into samples as they are exposed in
+// the text format, e.g. a histogram by its buckets, sum and count.
+func samples(families []*dto.MetricFamily) []sample {
+
+	xs := make([]sample, 0)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+
+			add := func(suffix string, value float64, extra ...string) {
+				labels := map[string]string{"__name__": family.GetName() + suffix}
+				for _, lp := range m.GetLabel() {
+					labels[lp.GetName()] = lp.GetValue()
+				}
+				for i := 0; i+1 < len(extra); i += 2 {
+					labels[extra[i]] = extra[i+1]
+				}
+				xs = append(xs, sample{labels: labels, value: value})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add("", q.GetValue(), "quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64))
+				}
+				add("_sum", s.GetSampleSum())
+				add("_count", float64(s.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add("_bucket", float64(b.GetCumulativeCount()), "le", strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64))
+				}
+				add("_bucket", float64(h.GetSampleCount()), "le", "+Inf")
+				add("_sum", h.GetSampleSum())
+				add("_count", float64(h.GetSampleCount()))
+			}
+		}
+	}
+	return xs
+}
+
+// encodeWriteRequest encodes the metric families as protobuf message
+// prometheus.WriteRequest with a single sample at the given time for each
+// time series.
+func encodeWriteRequest(families []*dto.MetricFamily, now time.Time) []byte {
+
+	var b []byte
+	for _, s := range samples(families) {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeTimeSeries(s, now.UnixMilli()))
+	}
+	return b
+}
+
+func encodeTimeSeries(s sample, timestamp int64) []byte {
+
+	names := make([]string, 0, len(s.labels))
+	for name := range s.labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b []byte
+	for _, name := range names {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, name)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, s.labels[name])
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, label)
+	}
+
+	var value []byte
+	value = protowire.AppendTag(value, 1, protowire.Fixed64Type)
+	value = protowire.AppendFixed64(value, math.Float64bits(s.value))
+	value = protowire.AppendTag(value, 2, protowire.VarintType)
+	value = protowire.AppendVarint(value, uint64(timestamp))
+
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
@@ -0,0 +1,264 @@
+// Copyright 2021-2022 Andreas Gebhardt
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remotewrite
+
+import (
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// timeSeries is a decoded time series of a write request with its labels
+// formatted as in the text format and the value of its single sample.
+type timeSeries struct {
+	Labels string
+	Value  float64
+}
+
+func decodeWriteRequest(t *testing.T, b []byte) []timeSeries {
+
+	fields := func(b []byte, f func(num protowire.Number, typ protowire.Type, b []byte) int) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			b = b[n:]
+			n = f(num, typ, b)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			b = b[n:]
+		}
+	}
+
+	xs := make([]timeSeries, 0)
+	fields(b, func(_ protowire.Number, _ protowire.Type, b []byte) int {
+		ts, n := protowire.ConsumeBytes(b)
+		labels := make([]string, 0)
+		var value float64
+		fields(ts, func(num protowire.Number, _ protowire.Type, b []byte) int {
+			v, n := protowire.ConsumeBytes(b)
+			switch num {
+			case 1:
+				var name, value string
+				fields(v, func(num protowire.Number, _ protowire.Type, b []byte) int {
+					s, n := protowire.ConsumeString(b)
+					if num == 1 {
+						name = s
+					} else {
+						value = s
+					}
+					return n
+				})
+				labels = append(labels, name+"="+value)
+			case 2:
+				fields(v, func(num protowire.Number, typ protowire.Type, b []byte) int {
+					if num == 1 {
+						bits, n := protowire.ConsumeFixed64(b)
+						value = math.Float64frombits(bits)
+						return n
+					}
+					return protowire.ConsumeFieldValue(num, typ, b)
+				})
+			}
+			return n
+		})
+		xs = append(xs, timeSeries{Labels: strings.Join(labels, ","), Value: value})
+		return n
+	})
+	return xs
+}
+
+func TestWrite(t *testing.T) {
+
+	var got []timeSeries
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if encoding := r.Header.Get("Content-Encoding"); encoding != "snappy" {
+			t.Errorf("Want content encoding 'snappy'. But found '%s'.", encoding)
+		}
+		if contentType := r.Header.Get("Content-Type"); contentType != "application/x-protobuf" {
+			t.Errorf("Want content type 'application/x-protobuf'. But found '%s'.", contentType)
+		}
+		body, _ := io.ReadAll(r.Body)
+		decoded, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = decodeWriteRequest(t, decoded)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	reg := prometheus.NewRegistry()
+	depth := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "mq_queue_current_depth", Help: "Current number of messages on queue."}, []string{"name"})
+	depth.WithLabelValues("DEV.QUEUE.1").Set(42)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "mq_queue_depth_observations", Help: "Histogram of the current queue depths.", Buckets: []float64{10}})
+	histogram.Observe(5)
+	reg.MustRegister(depth, histogram)
+
+	writer := NewWriter(logger, server.URL, time.Second, reg)
+	if err := writer.Write(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []timeSeries{
+		{Labels: "__name__=mq_queue_current_depth,name=DEV.QUEUE.1", Value: 42},
+		{Labels: "__name__=mq_queue_depth_observations_bucket,le=10", Value: 1},
+		{Labels: "__name__=mq_queue_depth_observations_bucket,le=+Inf", Value: 1},
+		{Labels: "__name__=mq_queue_depth_observations_sum", Value: 5},
+		{Labels: "__name__=mq_queue_depth_observations_count", Value: 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Should contain expected time series (-want, +got):\n%s", diff)
+	}
+
+	if value := testutil.ToFloat64(writer.success); value != 1 {
+		t.Errorf("Want 1 successful push. But found %v.", value)
+	}
+}
+
+func TestWriteRetriesOnTooManyRequests(t *testing.T) {
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	writer := NewWriter(logger, server.URL, time.Second, prometheus.NewRegistry())
+	writer.backoff = time.Millisecond
+
+	if err := writer.Write(nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("Want 3 requests. But found %d.", n)
+	}
+}
+
+func TestWriteByProxy(t *testing.T) {
+
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	writer := NewWriter(logger, "http://victoriametrics.example:8428/api/v1/write", time.Second, prometheus.NewRegistry())
+	writer.SetProxy(Proxy(proxy.URL, ""))
+
+	if err := writer.Write(nil); err != nil {
+		t.Fatal(err)
+	}
+	if requested != "http://victoriametrics.example:8428/api/v1/write" {
+		t.Errorf("Want push by proxy. But found request of '%s'.", requested)
+	}
+}
+
+func TestProxy(t *testing.T) {
+
+	t.Setenv("HTTP_PROXY", "http://env-proxy:3128")
+	t.Setenv("HTTPS_PROXY", "http://env-proxy:3128")
+	t.Setenv("NO_PROXY", "internal.example")
+
+	tests := []struct {
+		name    string
+		proxy   string
+		noProxy string
+		url     string
+		want    string
+	}{
+		{name: "environment", url: "http://victoriametrics.example/api/v1/write", want: "http://env-proxy:3128"},
+		{name: "no proxy by environment", url: "http://internal.example/api/v1/write"},
+		{name: "proxy overrides environment", proxy: "http://proxy:8080", url: "https://victoriametrics.example/api/v1/write", want: "http://proxy:8080"},
+		{name: "no proxy overrides environment", noProxy: "victoriametrics.example", url: "http://internal.example/api/v1/write", want: "http://env-proxy:3128"},
+		{name: "no proxy of host", proxy: "http://proxy:8080", noProxy: "victoriametrics.example", url: "http://victoriametrics.example/api/v1/write"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodPost, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Proxy(tt.proxy, tt.noProxy)(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" && got != nil {
+				t.Errorf("Want no proxy. But found '%s'.", got)
+			}
+			if tt.want != "" && (got == nil || got.String() != tt.want) {
+				t.Errorf("Want proxy '%s'. But found '%v'.", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteFailure(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		status   int
+		requests int32
+	}{
+		{name: "not retried on bad request", status: http.StatusBadRequest, requests: 1},
+		{name: "retried on service unavailable", status: http.StatusServiceUnavailable, requests: defaultMaxRetries + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			writer := NewWriter(logger, server.URL, time.Second, prometheus.NewRegistry())
+			writer.backoff = time.Millisecond
+
+			if err := writer.Write(nil); err == nil {
+				t.Error("Want error. But found none.")
+			}
+			if n := requests.Load(); n != tt.requests {
+				t.Errorf("Want %d requests. But found %d.", tt.requests, n)
+			}
+			if value := testutil.ToFloat64(writer.failure); value != 1 {
+				t.Errorf("Want 1 failed push. But found %v.", value)
+			}
+		})
+	}
+}